@@ -15,10 +15,12 @@ import (
 	"github.com/gocastsian/roham/filer/service/upload"
 	"github.com/gocastsian/roham/filer/storageprovider/storagefactory"
 	cfgloader "github.com/gocastsian/roham/pkg/cfg_loader"
+	"github.com/gocastsian/roham/pkg/event"
 	httpserver "github.com/gocastsian/roham/pkg/http_server"
 	"github.com/gocastsian/roham/pkg/logger"
 	"github.com/gocastsian/roham/pkg/postgresql"
 	"github.com/gocastsian/roham/pkg/postgresqlmigrator"
+	"github.com/gocastsian/roham/pkg/redis"
 
 	"github.com/gocastsian/roham/filer"
 	"github.com/spf13/cobra"
@@ -89,7 +91,11 @@ func serveFiler() {
 	httpServer := http.New(httpserver.New(cfg.HTTPServer), handler, appLogger)
 
 	// Setup UploadServer
-	uploadService := upload.NewUploadService(appLogger, storageProvider, fileRepo, storageRepo)
+	redisClient := redis.Connect(cfg.Redis)
+	defer redis.Close(redisClient)
+
+	outboxRepo := repository.NewOutboxRepo(appLogger, postgresConn.DB)
+	uploadService := upload.NewUploadService(appLogger, storageProvider, fileRepo, storageRepo, outboxRepo, event.NewPublisher(redisClient))
 	tusHandler, err := tusdadapter.New(storageProvider, &uploadService)
 	if err != nil {
 		log.Fatalf("Failed to create tus handler for storage type %s: %v", cfg.Storage.Type, err)
@@ -0,0 +1,52 @@
+package layer.authz
+
+# input.resource is the layer or map project being accessed, input.resource.type tells them apart
+
+default allow = false
+
+role_admin := 1
+
+# every permission includes the ones before it
+permission_rank := {"read": 1, "edit": 2, "admin": 3}
+
+granted(permission) if {
+    permission_rank[permission] >= permission_rank[input.action]
+}
+
+# Admins can do anything
+allow if {
+    input.user.role == role_admin
+}
+
+# Owners administer their layers and maps
+allow if {
+    input.resource.owner_id != 0
+    input.resource.owner_id == input.user.id
+}
+
+# Explicit shares
+allow if {
+    granted(input.user.grant)
+}
+
+# Everyone can read public resources
+allow if {
+    input.action == "read"
+    input.resource.visibility == "public"
+}
+
+# Members of the owning organization can read organization resources
+allow if {
+    input.action == "read"
+    input.resource.visibility == "organization"
+    input.user.organization != ""
+    input.user.organization == input.resource.organization
+}
+
+# Editors of an organization can edit resources tagged with the organization
+allow if {
+    granted("edit")
+    input.user.organization_role == "editor"
+    input.user.organization != ""
+    input.user.organization in input.resource.tags
+}
@@ -18,7 +18,7 @@ import (
 )
 
 type UploadValidator interface {
-	ValidateUpload(targetStorageID types.ID, mimeType string, size int64) error
+	ValidateUpload(targetStorageID, uploaderID types.ID, mimeType string, size int64) error
 }
 
 func NewHandlerWithS3Store(storageName string, s3 *s3.S3, v UploadValidator) (*tusd.Handler, error) {
@@ -44,7 +44,7 @@ func NewHandlerWithS3Store(storageName string, s3 *s3.S3, v UploadValidator) (*t
 				return err
 			}
 			hook.Upload.MetaData["TARGET-STORAGE-ID"] = fmt.Sprintf("%d", storageID)
-			return v.ValidateUpload(storageID, hook.Upload.MetaData["filetype"], hook.Upload.Size)
+			return v.ValidateUpload(storageID, uploaderInfo(hook.HTTPRequest).ID, hook.Upload.MetaData["filetype"], hook.Upload.Size)
 		},
 		NotifyCompleteUploads:   true,
 		NotifyTerminatedUploads: true,
@@ -85,7 +85,7 @@ func NewHandlerWithFileStore(storageName, basePath string, v UploadValidator) (*
 				return err
 			}
 			hook.Upload.MetaData["TARGET-STORAGE-ID"] = fmt.Sprintf("%d", storageID)
-			return v.ValidateUpload(storageID, hook.Upload.MetaData["filetype"], hook.Upload.Size)
+			return v.ValidateUpload(storageID, uploaderInfo(hook.HTTPRequest).ID, hook.Upload.MetaData["filetype"], hook.Upload.Size)
 		},
 		NotifyTerminatedUploads: true,
 		NotifyUploadProgress:    true,
@@ -1,6 +1,8 @@
 package tusdadapter
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"github.com/gocastsian/roham/filer/service/filestorage"
 	"github.com/gocastsian/roham/types"
@@ -27,6 +29,7 @@ func (e *CompleteUploadsHookEvent) ConvertToCreateFileMetadataInput() (filestora
 	}
 
 	fileKey := parts[0]
+	user := uploaderInfo(e.HTTPRequest)
 
 	return filestorage.CreateFileMetadataInput{
 		TargetStorageID: types.ID(storageID),
@@ -34,5 +37,34 @@ func (e *CompleteUploadsHookEvent) ConvertToCreateFileMetadataInput() (filestora
 		FileName:        e.Upload.MetaData["filename"],
 		MimeType:        e.Upload.MetaData["filetype"],
 		Size:            e.Upload.Size,
+		UploaderID:      user.ID,
+		Organization:    user.Organization,
+		MetaData:        e.Upload.MetaData,
 	}, nil
 }
+
+// uploaderInfo reads the user of the upload request from the X-User-Info header. Traefik drops the header a client
+// sends and roham_auth sets it on the upload routes, uploads reaching the server without it are anonymous
+func uploaderInfo(r handler.HTTPRequest) uploader {
+	header := r.Header.Get("X-User-Info")
+	if header == "" {
+		return uploader{}
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return uploader{}
+	}
+
+	var u uploader
+	if err := json.Unmarshal(decoded, &u); err != nil {
+		return uploader{}
+	}
+	return u
+}
+
+// uploader holds the claims of X-User-Info an upload is recorded with
+type uploader struct {
+	ID           types.ID `json:"user_id"`
+	Organization string   `json:"organization"`
+}
@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/gocastsian/roham/filer/adapter/tusdadapter"
 	"github.com/gocastsian/roham/filer/delivery/http"
@@ -93,6 +94,28 @@ func (app Application) Start() {
 		}
 	}()
 
+	// relay outbox events, e.g. completed map-layer uploads, to the event stream
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(app.Config.Outbox.RelayInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := app.UploadServer.Handler.UploadService.PublishPendingEvents(ctx, app.Config.Outbox.BatchSize)
+				if err != nil {
+					app.Logger.Error(fmt.Sprintf("Unable to publish outbox events: %s", err.Error()))
+				} else if n > 0 {
+					app.Logger.Info(fmt.Sprintf("%d outbox events published", n))
+				}
+			}
+		}
+	}()
+
 	<-ctx.Done()
 	app.Logger.Info("Shutdown signal received...")
 
@@ -5,6 +5,7 @@ import (
 	httpserver "github.com/gocastsian/roham/pkg/http_server"
 	"github.com/gocastsian/roham/pkg/logger"
 	"github.com/gocastsian/roham/pkg/postgresql"
+	"github.com/gocastsian/roham/pkg/redis"
 	"time"
 )
 
@@ -15,9 +16,16 @@ type Config struct {
 	TotalShutdownTimeout time.Duration                 `koanf:"total_shutdown_timeout"`
 	Uploader             uploader                      `koanf:"uploader"`
 	Storage              storageprovider.StorageConfig `koanf:"storage"`
+	Redis                redis.Config                  `koanf:"redis"`
+	Outbox               outbox                        `koanf:"outbox"`
 }
 
 type uploader struct {
 	HTTPServer httpserver.Config `koanf:"server"`
 	Logger     logger.Config     `koanf:"logger"`
 }
+
+type outbox struct {
+	RelayInterval time.Duration `koanf:"relay_interval"`
+	BatchSize     int           `koanf:"batch_size"`
+}
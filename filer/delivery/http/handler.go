@@ -1,10 +1,16 @@
 package http
 
 import (
-	"github.com/gocastsian/roham/filer/service/filestorage"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/gocastsian/roham/filer/service/filestorage"
+
 	errmsg "github.com/gocastsian/roham/pkg/err_msg"
 	"github.com/gocastsian/roham/pkg/statuscode"
 	"github.com/gocastsian/roham/pkg/validator"
@@ -21,24 +27,49 @@ func NewHandler(srv filestorage.Service) Handler {
 	}
 }
 
+// DownloadFile streams a file with its length and, when it is known, its sha256 in X-Checksum-Sha256. A "bytes=<offset>-" Range
+// resumes the download from offset, other ranges are answered with the whole file
 func (h Handler) DownloadFile(c echo.Context) error {
 
 	key := c.Param("key")
 
-	body, err := h.storageService.GetFileByKey(c.Request().Context(), key)
+	res, err := h.storageService.DownloadFile(c.Request().Context(), key, rangeOffset(c.Request().Header.Get("Range")))
+	if errors.Is(err, filestorage.ErrRangeNotSatisfiable) {
+		c.Response().Header().Set("Content-Range", fmt.Sprintf("bytes */%d", res.Size))
+		return c.JSON(http.StatusRequestedRangeNotSatisfiable, errmsg.ErrorResponse{Message: err.Error()})
+	}
 	if err != nil {
-		err := handleError(c, err)
-		if err != nil {
-			return err
-		}
+		return handleError(c, err)
 	}
+	defer res.Body.Close()
 
-	// todo set headers using res.metadata
-	//w.Header().Set("Content-Type", metadata.ContentType)
-	//w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileInfo.OriginalName))
-	//w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.ContentLength))
+	header := c.Response().Header()
+	header.Set("Accept-Ranges", "bytes")
+	if res.ChecksumSHA256 != "" {
+		header.Set("X-Checksum-Sha256", res.ChecksumSHA256)
+	}
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": res.FileName}))
+	header.Set("Content-Length", strconv.FormatInt(res.Size-res.Offset, 10))
 
-	return c.Stream(http.StatusOK, "application/octet-stream", body)
+	status := http.StatusOK
+	if res.Offset > 0 {
+		status = http.StatusPartialContent
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", res.Offset, res.Size-1, res.Size))
+	}
+	return c.Stream(status, "application/octet-stream", res.Body)
+}
+
+// rangeOffset reads the start of an open ended "bytes=<offset>-" Range header, anything else starts at 0
+func rangeOffset(header string) int64 {
+	value, found := strings.CutPrefix(header, "bytes=")
+	if !found || !strings.HasSuffix(value, "-") {
+		return 0
+	}
+	offset, err := strconv.ParseInt(strings.TrimSuffix(value, "-"), 10, 64)
+	if err != nil || offset < 0 {
+		return 0
+	}
+	return offset
 }
 
 func (h Handler) DownloadFileUsingPreSignedURL(c echo.Context) error {
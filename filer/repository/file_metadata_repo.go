@@ -32,9 +32,10 @@ func (r FileMetadataRepo) InsertFileMetadata(ctx context.Context, fileMetadata f
 			file_key,
 			file_name,
 			mime_type,
-			file_size
+			file_size,
+			checksum_sha256
 		) VALUES (
-			$1, $2, $3, $4, $5
+			$1, $2, $3, $4, $5, NULLIF($6, '')
 		)
 		RETURNING id
 	`
@@ -51,6 +52,7 @@ func (r FileMetadataRepo) InsertFileMetadata(ctx context.Context, fileMetadata f
 		fileMetadata.FileName,
 		fileMetadata.MimeType,
 		fileMetadata.FileSize,
+		fileMetadata.ChecksumSHA256,
 	).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert file metadata : %w", err)
@@ -62,7 +64,7 @@ func (r FileMetadataRepo) InsertFileMetadata(ctx context.Context, fileMetadata f
 
 func (r FileMetadataRepo) FindByKey(ctx context.Context, key string) (filestorage.FileMetadata, error) {
 	query := `
-        SELECT id, storage_id, file_key, file_name, mime_type, file_size,created_at, updated_at
+        SELECT id, storage_id, file_key, file_name, mime_type, file_size, coalesce(checksum_sha256, ''), created_at, updated_at
         FROM file_metadata WHERE file_key = $1
     `
 
@@ -80,6 +82,7 @@ func (r FileMetadataRepo) FindByKey(ctx context.Context, key string) (filestorag
 		&f.FileName,
 		&f.MimeType,
 		&f.FileSize,
+		&f.ChecksumSHA256,
 		&f.CreatedAt,
 		&f.UpdatedAt,
 	)
@@ -93,3 +96,39 @@ func (r FileMetadataRepo) FindByKey(ctx context.Context, key string) (filestorag
 
 	return f, nil
 }
+
+// InsertFileMetadataWithEvent inserts the metadata of a file and an outbox event about it in one transaction, so
+// an event exists exactly when the file it announces does
+func (r FileMetadataRepo) InsertFileMetadataWithEvent(ctx context.Context, fileMetadata filestorage.FileMetadata,
+	stream string, payload []byte) (types.ID, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id types.ID
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO file_metadata (storage_id, file_key, file_name, mime_type, file_size, checksum_sha256)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		RETURNING id`,
+		fileMetadata.StorageID,
+		fileMetadata.FileKey,
+		fileMetadata.FileName,
+		fileMetadata.MimeType,
+		fileMetadata.FileSize,
+		fileMetadata.ChecksumSHA256,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert file metadata : %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO outbox_events (stream, payload) VALUES ($1, $2)`, stream, payload); err != nil {
+		return 0, fmt.Errorf("failed to insert outbox event: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit file metadata: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gocastsian/roham/filer/service/filestorage"
+	"github.com/gocastsian/roham/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertFileMetadataWithEvent(t *testing.T) {
+	metadata := filestorage.FileMetadata{StorageID: 2, FileKey: "abc", FileName: "roads.zip", MimeType: "application/zip", FileSize: 42,
+		ChecksumSHA256: "9f86d0"}
+
+	t.Run("commits the metadata and the event together", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO file_metadata`).
+			WithArgs(types.ID(2), "abc", "roads.zip", "application/zip", int64(42), "9f86d0").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectExec(`INSERT INTO outbox_events`).
+			WithArgs("uploads", []byte(`{"file_key":"abc"}`)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		id, err := NewFileMetadataRepo(slog.Default(), db).InsertFileMetadataWithEvent(context.Background(), metadata,
+			"uploads", []byte(`{"file_key":"abc"}`))
+		require.NoError(t, err)
+		assert.Equal(t, types.ID(7), id)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("keeps neither when the event can't be written", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO file_metadata`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectExec(`INSERT INTO outbox_events`).WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+
+		_, err = NewFileMetadataRepo(slog.Default(), db).InsertFileMetadataWithEvent(context.Background(), metadata,
+			"uploads", []byte(`{}`))
+		assert.ErrorContains(t, err, "disk full")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
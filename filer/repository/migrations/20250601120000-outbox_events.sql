@@ -0,0 +1,18 @@
+-- +migrate Up
+
+CREATE TABLE outbox_events
+(
+    id           BIGSERIAL PRIMARY KEY,
+    stream       VARCHAR(255) NOT NULL,
+    payload      JSONB        NOT NULL,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_outbox_events_unpublished ON outbox_events (id) WHERE published_at IS NULL;
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_outbox_events_unpublished;
+
+DROP TABLE IF EXISTS outbox_events;
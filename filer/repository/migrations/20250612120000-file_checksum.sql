@@ -0,0 +1,8 @@
+-- +migrate Up
+
+-- the sha256 of a file is computed on its first download and sent with every download after
+ALTER TABLE file_metadata ADD COLUMN checksum_sha256 VARCHAR(64);
+
+-- +migrate Down
+
+ALTER TABLE file_metadata DROP COLUMN IF EXISTS checksum_sha256;
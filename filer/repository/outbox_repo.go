@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"github.com/gocastsian/roham/filer/service/upload"
+	"github.com/gocastsian/roham/types"
+)
+
+type OutboxRepo struct {
+	Logger *slog.Logger
+	db     *sql.DB
+}
+
+func NewOutboxRepo(logger *slog.Logger, db *sql.DB) OutboxRepo {
+	return OutboxRepo{
+		Logger: logger,
+		db:     db,
+	}
+}
+
+func (r OutboxRepo) FindUnpublishedEvents(ctx context.Context, limit int) ([]upload.OutboxEvent, error) {
+	query := `
+		SELECT id, stream, payload, created_at
+		FROM outbox_events
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+	`
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find unpublished outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]upload.OutboxEvent, 0)
+	for rows.Next() {
+		var e upload.OutboxEvent
+		if err := rows.Scan(&e.ID, &e.Stream, &e.Payload, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (r OutboxRepo) MarkEventPublished(ctx context.Context, id types.ID) error {
+	query := `UPDATE outbox_events SET published_at = now() WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to mark outbox event %d as published: %w", id, err)
+	}
+	return nil
+}
@@ -13,12 +13,14 @@ type Storage struct {
 }
 
 type FileMetadata struct {
-	ID        types.ID   `json:"id"`
-	StorageID types.ID   `json:"storage_id"`
-	FileKey   string     `json:"file_key"`
-	FileName  string     `json:"file_name"`
-	MimeType  string     `json:"mime_type"`
-	FileSize  int64      `json:"file_size"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt *time.Time `json:"updated_at"`
+	ID        types.ID `json:"id"`
+	StorageID types.ID `json:"storage_id"`
+	FileKey   string   `json:"file_key"`
+	FileName  string   `json:"file_name"`
+	MimeType  string   `json:"mime_type"`
+	FileSize  int64    `json:"file_size"`
+	// ChecksumSHA256 is the hex encoded sha256 of the file, recorded when the upload completed
+	ChecksumSHA256 string     `json:"checksum_sha256"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      *time.Time `json:"updated_at"`
 }
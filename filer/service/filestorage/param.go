@@ -1,13 +1,20 @@
 package filestorage
 
-import "github.com/gocastsian/roham/types"
+import (
+	"io"
+
+	"github.com/gocastsian/roham/types"
+)
 
 type CreateFileMetadataInput struct {
-	TargetStorageID types.ID `json:"target_storage_id"`
-	FileKey         string   `json:"file_key"`
-	FileName        string   `json:"file_name"`
-	MimeType        string   `json:"mime_type"`
-	Size            int64    `json:"file_size"`
+	TargetStorageID types.ID          `json:"target_storage_id"`
+	FileKey         string            `json:"file_key"`
+	FileName        string            `json:"file_name"`
+	MimeType        string            `json:"mime_type"`
+	Size            int64             `json:"file_size"`
+	UploaderID      types.ID          `json:"uploader_id"`
+	Organization    string            `json:"organization"`
+	MetaData        map[string]string `json:"meta_data"`
 }
 
 type CreateFileMetadataOutput struct {
@@ -28,3 +35,12 @@ type CreateStorageOutput struct {
 	Name string   `json:"storage_name"`
 	Kind string   `json:"storage_kind"`
 }
+
+// DownloadFileOutput is a file opened for download, Body holds the bytes of the file from Offset on
+type DownloadFileOutput struct {
+	Body           io.ReadCloser
+	FileName       string
+	Size           int64
+	Offset         int64
+	ChecksumSHA256 string
+}
@@ -2,6 +2,7 @@ package filestorage
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"time"
@@ -27,6 +28,9 @@ type FileMetadataRepo interface {
 	FindByKey(ctx context.Context, key string) (FileMetadata, error)
 }
 
+// ErrRangeNotSatisfiable is returned for a download starting at or past the end of the file
+var ErrRangeNotSatisfiable = errors.New("requested range is not satisfiable")
+
 func NewStorageService(l *slog.Logger, p storageprovider.Provider, fr FileMetadataRepo, r StorageRepository) Service {
 	return Service{
 		logger:          l,
@@ -51,7 +55,37 @@ func (s Service) GetFileByKey(ctx context.Context, fileKey string) (io.ReadClose
 	}
 	storageName = storage.Name
 
-	return s.storageProvider.GetFile(ctx, storageName, fileKey)
+	return s.storageProvider.GetFile(ctx, storageName, fileKey, 0)
+}
+
+// DownloadFile opens the file of fileKey from offset so an interrupted download can be resumed, with the sha256
+// recorded when its upload completed. Files uploaded before checksums were recorded come without one
+func (s Service) DownloadFile(ctx context.Context, fileKey string, offset int64) (DownloadFileOutput, error) {
+	fileMetadata, err := s.fileRepo.FindByKey(ctx, fileKey)
+	if err != nil {
+		return DownloadFileOutput{}, err
+	}
+	if offset < 0 || (offset > 0 && offset >= fileMetadata.FileSize) {
+		return DownloadFileOutput{Size: fileMetadata.FileSize}, ErrRangeNotSatisfiable
+	}
+
+	storage, err := s.storageRepo.FindByID(ctx, fileMetadata.StorageID)
+	if err != nil {
+		return DownloadFileOutput{}, err
+	}
+
+	body, err := s.storageProvider.GetFile(ctx, storage.Name, fileKey, offset)
+	if err != nil {
+		return DownloadFileOutput{}, err
+	}
+
+	return DownloadFileOutput{
+		Body:           body,
+		FileName:       fileMetadata.FileName,
+		Size:           fileMetadata.FileSize,
+		Offset:         offset,
+		ChecksumSHA256: fileMetadata.ChecksumSHA256,
+	}, nil
 }
 
 func (s Service) GeneratePreSignedURL(ctx context.Context, storageName, fileKey string, t time.Duration) (string, error) {
@@ -0,0 +1,16 @@
+package upload
+
+import (
+	"time"
+
+	"github.com/gocastsian/roham/types"
+)
+
+// OutboxEvent is an event stored next to the upload data and relayed to the event stream afterward,
+// so an event is never lost when the stream is unreachable at upload time
+type OutboxEvent struct {
+	ID        types.ID
+	Stream    string
+	Payload   []byte
+	CreatedAt time.Time
+}
@@ -2,37 +2,66 @@ package upload
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"time"
 
 	"github.com/gocastsian/roham/filer/service/filestorage"
 	"github.com/gocastsian/roham/filer/storageprovider"
+	"github.com/gocastsian/roham/pkg/event"
 	"github.com/gocastsian/roham/types"
 )
 
+// storage kind whose completed uploads are announced to vectorlayer for import
+const mapLayerStorageKind = "map-layer"
+
+// ErrAnonymousUpload is returned for a map layer upload without an authenticated uploader, its layer would
+// have no owner
+var ErrAnonymousUpload = errors.New("map layer uploads need an authenticated uploader")
+
 type Service struct {
 	logger           *slog.Logger
 	fileMetadataRepo FileMetadataRepo
 	storageFinder    StorageFinder
 	storageProvider  storageprovider.Provider
+	outbox           OutboxRepo
+	publisher        EventPublisher
 }
 
-func NewUploadService(l *slog.Logger, sp storageprovider.Provider, fileMetadataRepo FileMetadataRepo, storageRepo StorageFinder) Service {
+func NewUploadService(l *slog.Logger, sp storageprovider.Provider, fileMetadataRepo FileMetadataRepo, storageRepo StorageFinder,
+	outbox OutboxRepo, publisher EventPublisher) Service {
 	return Service{
 		logger:           l,
 		fileMetadataRepo: fileMetadataRepo,
 		storageFinder:    storageRepo,
 		storageProvider:  sp,
+		outbox:           outbox,
+		publisher:        publisher,
 	}
 }
 
+type OutboxRepo interface {
+	FindUnpublishedEvents(ctx context.Context, limit int) ([]OutboxEvent, error)
+	MarkEventPublished(ctx context.Context, id types.ID) error
+}
+
+type EventPublisher interface {
+	Publish(ctx context.Context, stream string, payload []byte) (string, error)
+}
+
 type StorageFinder interface {
 	FindByID(ctx context.Context, id types.ID) (filestorage.Storage, error)
 }
 
 type FileMetadataRepo interface {
 	InsertFileMetadata(ctx context.Context, fileMetadata filestorage.FileMetadata) (types.ID, error)
+	// InsertFileMetadataWithEvent writes the metadata and an outbox event on stream in one transaction
+	InsertFileMetadataWithEvent(ctx context.Context, fileMetadata filestorage.FileMetadata, stream string, payload []byte) (types.ID, error)
 }
 
 func (s *Service) OnCompletedUploads(ctx context.Context, i filestorage.CreateFileMetadataInput) error {
@@ -41,30 +70,90 @@ func (s *Service) OnCompletedUploads(ctx context.Context, i filestorage.CreateFi
 	if err != nil {
 		return err
 	}
+	if storage.Kind == mapLayerStorageKind && i.UploaderID == 0 {
+		return ErrAnonymousUpload
+	}
 
 	err = s.storageProvider.MoveFileToStorage(i.FileKey, s.storageProvider.Config().TempStorage, storage.Name)
 	if err != nil {
 		return err
 	}
 
+	checksum, err := s.fileChecksum(ctx, storage.Name, i.FileKey)
+	if err != nil {
+		return err
+	}
+
 	newFileMetadata := filestorage.FileMetadata{
-		StorageID: i.TargetStorageID,
-		FileKey:   i.FileKey,
-		FileName:  i.FileName,
-		MimeType:  i.MimeType,
-		FileSize:  i.Size,
-		CreatedAt: time.Time{},
-		UpdatedAt: nil,
-	}
-	_, err = s.fileMetadataRepo.InsertFileMetadata(ctx, newFileMetadata)
+		StorageID:      i.TargetStorageID,
+		FileKey:        i.FileKey,
+		FileName:       i.FileName,
+		MimeType:       i.MimeType,
+		FileSize:       i.Size,
+		ChecksumSHA256: checksum,
+		CreatedAt:      time.Time{},
+		UpdatedAt:      nil,
+	}
+	if storage.Kind != mapLayerStorageKind {
+		_, err = s.fileMetadataRepo.InsertFileMetadata(ctx, newFileMetadata)
+		return err
+	}
+
+	payload, err := json.Marshal(event.MapLayerUploaded{
+		FileKey:      i.FileKey,
+		FileName:     i.FileName,
+		MimeType:     i.MimeType,
+		Size:         i.Size,
+		StorageID:    i.TargetStorageID,
+		UploaderID:   i.UploaderID,
+		Organization: i.Organization,
+		MetaData:     i.MetaData,
+		UploadedAt:   time.Now(),
+	})
 	if err != nil {
 		return err
 	}
+	_, err = s.fileMetadataRepo.InsertFileMetadataWithEvent(ctx, newFileMetadata, event.MapLayerUploadedStream, payload)
+	return err
+}
+
+// fileChecksum hashes a stored file once when its upload completes, so downloads can send the checksum
+// right away instead of reading the whole file before their first byte
+func (s *Service) fileChecksum(ctx context.Context, storageName, fileKey string) (string, error) {
+	body, err := s.storageProvider.GetFile(ctx, storageName, fileKey, 0)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
 
-	return nil
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", fileKey, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// PublishPendingEvents relays the outbox to the event stream, an event is marked published only after
+// the stream accepted it so a crash in between publishes it again and consumers must be idempotent
+func (s *Service) PublishPendingEvents(ctx context.Context, batchSize int) (int, error) {
+	events, err := s.outbox.FindUnpublishedEvents(ctx, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for n, e := range events {
+		if _, err := s.publisher.Publish(ctx, e.Stream, e.Payload); err != nil {
+			return n, err
+		}
+		if err := s.outbox.MarkEventPublished(ctx, e.ID); err != nil {
+			return n, err
+		}
+	}
+
+	return len(events), nil
 }
 
-func (s *Service) ValidateUpload(targetStorageID types.ID, mimeType string, size int64) error {
+func (s *Service) ValidateUpload(targetStorageID, uploaderID types.ID, mimeType string, size int64) error {
 
 	ctx := context.Background()
 	storage, err := s.storageFinder.FindByID(ctx, targetStorageID)
@@ -97,6 +186,10 @@ func (s *Service) ValidateUpload(targetStorageID types.ID, mimeType string, size
 		return fmt.Errorf("unsupported storage kind: %s", storage.Kind)
 	}
 
+	if storage.Kind == mapLayerStorageKind && uploaderID == 0 {
+		return ErrAnonymousUpload
+	}
+
 	// Validate file size
 	if size > constraint.MaxSize {
 		return fmt.Errorf("file size exceeds maximum allowed (%d bytes)", constraint.MaxSize)
@@ -0,0 +1,145 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocastsian/roham/filer/service/filestorage"
+	"github.com/gocastsian/roham/filer/storageprovider"
+	"github.com/gocastsian/roham/pkg/event"
+	"github.com/gocastsian/roham/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct{ moved []string }
+
+// GetFile serves the key of a file as its content
+func (p *fakeProvider) GetFile(ctx context.Context, storageName, fileKey string, offset int64) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(fileKey[offset:])), nil
+}
+func (p *fakeProvider) GeneratePreSignedURL(storageName, fileKey string, duration time.Duration) (string, error) {
+	return "", nil
+}
+func (p *fakeProvider) MakeStorage(ctx context.Context, name string) error { return nil }
+func (p *fakeProvider) MoveFileToStorage(targetFileKey, fromStorageName, toStorageName string) error {
+	p.moved = append(p.moved, targetFileKey)
+	return nil
+}
+func (p *fakeProvider) Config() storageprovider.StorageConfig {
+	return storageprovider.StorageConfig{TempStorage: "temp"}
+}
+
+type fakeStorages map[types.ID]filestorage.Storage
+
+func (f fakeStorages) FindByID(ctx context.Context, id types.ID) (filestorage.Storage, error) {
+	return f[id], nil
+}
+
+// fakeFiles records what was written, the metadata of a map layer upload must only come with its event
+type fakeFiles struct {
+	plain  []filestorage.FileMetadata
+	events map[string][]byte
+}
+
+func (f *fakeFiles) InsertFileMetadata(ctx context.Context, fileMetadata filestorage.FileMetadata) (types.ID, error) {
+	f.plain = append(f.plain, fileMetadata)
+	return 1, nil
+}
+
+func (f *fakeFiles) InsertFileMetadataWithEvent(ctx context.Context, fileMetadata filestorage.FileMetadata, stream string, payload []byte) (types.ID, error) {
+	f.events[fileMetadata.FileKey] = payload
+	return 1, nil
+}
+
+type fakeOutbox struct {
+	events    []OutboxEvent
+	published []types.ID
+}
+
+func (f *fakeOutbox) FindUnpublishedEvents(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	return f.events, nil
+}
+
+func (f *fakeOutbox) MarkEventPublished(ctx context.Context, id types.ID) error {
+	f.published = append(f.published, id)
+	return nil
+}
+
+type fakePublisher struct{ failOn string }
+
+func (p fakePublisher) Publish(ctx context.Context, stream string, payload []byte) (string, error) {
+	if string(payload) == p.failOn {
+		return "", errors.New("stream unreachable")
+	}
+	return "1-0", nil
+}
+
+func TestOnCompletedUploads(t *testing.T) {
+	files := &fakeFiles{events: make(map[string][]byte)}
+	storages := fakeStorages{1: {ID: 1, Name: "layers", Kind: mapLayerStorageKind}, 2: {ID: 2, Name: "avatars", Kind: "avatar"}}
+	svc := NewUploadService(slog.Default(), &fakeProvider{}, files, storages, &fakeOutbox{}, fakePublisher{})
+
+	require.NoError(t, svc.OnCompletedUploads(context.Background(), filestorage.CreateFileMetadataInput{
+		TargetStorageID: 1,
+		FileKey:         "abc",
+		FileName:        "roads.zip",
+		UploaderID:      9,
+		Organization:    "municipality",
+		MetaData:        map[string]string{"layer-name": "roads"},
+	}))
+	require.NoError(t, svc.OnCompletedUploads(context.Background(), filestorage.CreateFileMetadataInput{
+		TargetStorageID: 2,
+		FileKey:         "me",
+		FileName:        "me.jpg",
+	}))
+
+	require.Len(t, files.plain, 1)
+	assert.Equal(t, "me", files.plain[0].FileKey)
+	// sha256 of the content "me"
+	assert.Equal(t, "2744ccd10c7533bd736ad890f9dd5cab2adb27b07d500b9493f29cdc420cb2e0", files.plain[0].ChecksumSHA256)
+
+	var uploaded event.MapLayerUploaded
+	require.NoError(t, json.Unmarshal(files.events["abc"], &uploaded))
+	assert.Equal(t, types.ID(9), uploaded.UploaderID)
+	assert.Equal(t, "municipality", uploaded.Organization)
+	assert.Equal(t, "roads", uploaded.MetaData["layer-name"])
+	assert.NotContains(t, files.events, "me")
+}
+
+func TestAnonymousMapLayerUpload(t *testing.T) {
+	files := &fakeFiles{events: make(map[string][]byte)}
+	provider := &fakeProvider{}
+	storages := fakeStorages{1: {ID: 1, Name: "layers", Kind: mapLayerStorageKind}, 2: {ID: 2, Name: "avatars", Kind: "avatar"}}
+	svc := NewUploadService(slog.Default(), provider, files, storages, &fakeOutbox{}, fakePublisher{})
+
+	assert.ErrorIs(t, svc.ValidateUpload(1, 0, "application/zip", 42), ErrAnonymousUpload)
+	assert.NoError(t, svc.ValidateUpload(1, 9, "application/zip", 42))
+	assert.NoError(t, svc.ValidateUpload(2, 0, "image/jpeg", 42))
+
+	err := svc.OnCompletedUploads(context.Background(), filestorage.CreateFileMetadataInput{TargetStorageID: 1, FileKey: "abc"})
+	assert.ErrorIs(t, err, ErrAnonymousUpload)
+	assert.Empty(t, provider.moved)
+	assert.Empty(t, files.events)
+}
+
+func TestPublishPendingEvents(t *testing.T) {
+	outbox := &fakeOutbox{events: []OutboxEvent{
+		{ID: 1, Stream: "s", Payload: []byte("a")},
+		{ID: 2, Stream: "s", Payload: []byte("b")},
+		{ID: 3, Stream: "s", Payload: []byte("c")},
+	}}
+	svc := NewUploadService(slog.Default(), &fakeProvider{}, &fakeFiles{}, fakeStorages{}, outbox, fakePublisher{failOn: "b"})
+
+	n, err := svc.PublishPendingEvents(context.Background(), 10)
+	assert.Error(t, err)
+	assert.Equal(t, 1, n)
+	// an event the stream didn't accept stays unpublished, and so do the ones after it to keep their order
+	assert.Equal(t, []types.ID{1}, outbox.published)
+}
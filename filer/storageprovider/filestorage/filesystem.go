@@ -21,7 +21,7 @@ func New(cfg storageprovider.StorageConfig) (*Storage, error) {
 	}, nil
 }
 
-func (s *Storage) GetFile(ctx context.Context, storageName, fileKey string) (io.ReadCloser, error) {
+func (s *Storage) GetFile(ctx context.Context, storageName, fileKey string, offset int64) (io.ReadCloser, error) {
 
 	filePath := fmt.Sprintf("%s/%s/%s", s.basePath, storageName, fileKey)
 
@@ -29,6 +29,12 @@ func (s *Storage) GetFile(ctx context.Context, storageName, fileKey string) (io.
 	if err != nil {
 		return nil, err
 	}
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
 	return file, nil
 }
 
@@ -7,7 +7,8 @@ import (
 )
 
 type Provider interface {
-	GetFile(ctx context.Context, storageName, fileKey string) (io.ReadCloser, error)
+	// GetFile opens fileKey of storageName from offset bytes into the file
+	GetFile(ctx context.Context, storageName, fileKey string, offset int64) (io.ReadCloser, error)
 	GeneratePreSignedURL(storageName, fileKey string, duration time.Duration) (string, error)
 	MakeStorage(ctx context.Context, name string) error
 	MoveFileToStorage(targetFileKey, fromStorageName, toStorageName string) error
@@ -46,12 +46,15 @@ func (s *Storage) S3() *s3.S3 {
 	return s.s3
 }
 
-func (s *Storage) GetFile(ctx context.Context, storageName, fileKey string) (io.ReadCloser, error) {
+func (s *Storage) GetFile(ctx context.Context, storageName, fileKey string, offset int64) (io.ReadCloser, error) {
 
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(storageName),
 		Key:    aws.String(fileKey),
 	}
+	if offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
 
 	result, err := s.s3.GetObjectWithContext(ctx, input)
 	if err != nil {
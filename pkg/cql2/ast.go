@@ -0,0 +1,337 @@
+// Package cql2 parses OGC Common Query Language (CQL2) filters in their text and JSON encodings.
+// It covers basic CQL2 with LIKE, BETWEEN, IN, spatial and temporal predicates, arithmetic, functions
+// and array predicates are not supported
+package cql2
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expression is a node of a parsed filter, its String is the filter in CQL2 text
+type Expression interface {
+	String() string
+}
+
+// Logical joins its arguments with AND or OR
+type Logical struct {
+	Op   string
+	Args []Expression
+}
+
+type Not struct {
+	Arg Expression
+}
+
+// Comparison compares two scalars with one of = <> < > <= >=
+type Comparison struct {
+	Op    string
+	Left  Expression
+	Right Expression
+}
+
+// Like matches a property against a pattern where % is any text and _ any character
+type Like struct {
+	Negated bool
+	Value   Expression
+	Pattern Expression
+}
+
+type Between struct {
+	Negated bool
+	Value   Expression
+	Low     Expression
+	High    Expression
+}
+
+type In struct {
+	Negated bool
+	Value   Expression
+	List    []Expression
+}
+
+type IsNull struct {
+	Negated bool
+	Value   Expression
+}
+
+// Spatial is one of the S_ predicates, its operands are geometry properties or geometry literals
+type Spatial struct {
+	Op    string
+	Left  Expression
+	Right Expression
+}
+
+// Temporal is one of the T_ predicates, its operands are properties, instants or intervals
+type Temporal struct {
+	Op    string
+	Left  Expression
+	Right Expression
+}
+
+type Property struct {
+	Name string
+}
+
+// Literal is a string, a float64 number or a bool
+type Literal struct {
+	Value interface{}
+}
+
+// Instant is a DATE or TIMESTAMP literal
+type Instant struct {
+	Time time.Time
+	Date bool
+}
+
+// Interval is an INTERVAL literal, a nil bound is open
+type Interval struct {
+	Start *Instant
+	End   *Instant
+}
+
+// Geometry is a geometry literal in WGS 84, written as WKT in CQL2 text and as GeoJSON in CQL2 JSON
+type Geometry struct {
+	WKT     string
+	GeoJSON json.RawMessage
+}
+
+// Spatial predicates, they keep the names of their PostGIS counterparts after the prefix
+var SpatialOps = map[string]bool{
+	"s_intersects": true, "s_equals": true, "s_disjoint": true, "s_touches": true,
+	"s_within": true, "s_overlaps": true, "s_crosses": true, "s_contains": true,
+}
+
+// Temporal predicates
+var TemporalOps = map[string]bool{
+	"t_after": true, "t_before": true, "t_contains": true, "t_disjoint": true,
+	"t_during": true, "t_equals": true, "t_intersects": true,
+}
+
+var comparisonOps = map[string]bool{"=": true, "<>": true, "<": true, ">": true, "<=": true, ">=": true}
+
+func negation(negated bool) string {
+	if negated {
+		return "NOT "
+	}
+	return ""
+}
+
+func (e Logical) String() string {
+	args := make([]string, 0, len(e.Args))
+	for _, arg := range e.Args {
+		args = append(args, arg.String())
+	}
+	return "(" + strings.Join(args, " "+strings.ToUpper(e.Op)+" ") + ")"
+}
+
+func (e Not) String() string { return "NOT (" + e.Arg.String() + ")" }
+
+func (e Comparison) String() string { return e.Left.String() + " " + e.Op + " " + e.Right.String() }
+
+func (e Like) String() string {
+	return e.Value.String() + " " + negation(e.Negated) + "LIKE " + e.Pattern.String()
+}
+
+func (e Between) String() string {
+	return e.Value.String() + " " + negation(e.Negated) + "BETWEEN " + e.Low.String() + " AND " + e.High.String()
+}
+
+func (e In) String() string {
+	items := make([]string, 0, len(e.List))
+	for _, item := range e.List {
+		items = append(items, item.String())
+	}
+	return e.Value.String() + " " + negation(e.Negated) + "IN (" + strings.Join(items, ", ") + ")"
+}
+
+func (e IsNull) String() string { return e.Value.String() + " IS " + negation(e.Negated) + "NULL" }
+
+func (e Spatial) String() string {
+	return strings.ToUpper(e.Op) + "(" + e.Left.String() + ", " + e.Right.String() + ")"
+}
+
+func (e Temporal) String() string {
+	return strings.ToUpper(e.Op) + "(" + e.Left.String() + ", " + e.Right.String() + ")"
+}
+
+func (e Property) String() string { return `"` + strings.ReplaceAll(e.Name, `"`, `""`) + `"` }
+
+func (e Literal) String() string {
+	switch value := e.Value.(type) {
+	case string:
+		return quote(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(value))
+	}
+	return fmt.Sprint(e.Value)
+}
+
+func (e Instant) String() string {
+	if e.Date {
+		return "DATE(" + quote(e.Time.Format(time.DateOnly)) + ")"
+	}
+	return "TIMESTAMP(" + quote(e.Time.UTC().Format(time.RFC3339Nano)) + ")"
+}
+
+func (e Interval) String() string {
+	bound := func(instant *Instant) string {
+		if instant == nil {
+			return "'..'"
+		}
+		if instant.Date {
+			return quote(instant.Time.Format(time.DateOnly))
+		}
+		return quote(instant.Time.UTC().Format(time.RFC3339Nano))
+	}
+	return "INTERVAL(" + bound(e.Start) + ", " + bound(e.End) + ")"
+}
+
+// String returns the WKT of the geometry, a GeoJSON geometry is rendered as its compact JSON
+func (e Geometry) String() string {
+	if e.WKT != "" {
+		return e.WKT
+	}
+	return string(e.GeoJSON)
+}
+
+func quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// Properties returns the names of the properties a filter reads, split into the ones used as geometries
+// by spatial predicates and all others
+func Properties(e Expression) (attributes []string, geometries []string) {
+	var walk func(e Expression, spatial bool)
+	walk = func(e Expression, spatial bool) {
+		switch node := e.(type) {
+		case Logical:
+			for _, arg := range node.Args {
+				walk(arg, false)
+			}
+		case Not:
+			walk(node.Arg, false)
+		case Comparison:
+			walk(node.Left, false)
+			walk(node.Right, false)
+		case Like:
+			walk(node.Value, false)
+			walk(node.Pattern, false)
+		case Between:
+			walk(node.Value, false)
+			walk(node.Low, false)
+			walk(node.High, false)
+		case In:
+			walk(node.Value, false)
+			for _, item := range node.List {
+				walk(item, false)
+			}
+		case IsNull:
+			walk(node.Value, false)
+		case Spatial:
+			walk(node.Left, true)
+			walk(node.Right, true)
+		case Temporal:
+			walk(node.Left, false)
+			walk(node.Right, false)
+		case Property:
+			if spatial {
+				geometries = append(geometries, node.Name)
+			} else {
+				attributes = append(attributes, node.Name)
+			}
+		}
+	}
+	walk(e, false)
+	return attributes, geometries
+}
+
+// check makes sure every predicate has operands of a kind it can compare, both encodings are checked by it
+func check(e Expression) error {
+	switch node := e.(type) {
+	case Logical:
+		if len(node.Args) < 2 {
+			return fmt.Errorf("%s needs at least two arguments", strings.ToUpper(node.Op))
+		}
+		for _, arg := range node.Args {
+			if err := check(arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Not:
+		return check(node.Arg)
+	case Comparison:
+		if !comparisonOps[node.Op] {
+			return fmt.Errorf("unknown comparison operator %s", node.Op)
+		}
+		return scalars(node.Op, node.Left, node.Right)
+	case Like:
+		if _, ok := node.Value.(Property); !ok {
+			return fmt.Errorf("LIKE needs a property on its left, got %s", node.Value)
+		}
+		if literal, ok := node.Pattern.(Literal); !ok || !isString(literal) {
+			return fmt.Errorf("LIKE needs a string pattern, got %s", node.Pattern)
+		}
+		return nil
+	case Between:
+		return scalars("BETWEEN", node.Value, node.Low, node.High)
+	case In:
+		if len(node.List) == 0 {
+			return fmt.Errorf("IN needs at least one value")
+		}
+		return scalars("IN", append([]Expression{node.Value}, node.List...)...)
+	case IsNull:
+		if _, ok := node.Value.(Property); !ok {
+			return fmt.Errorf("IS NULL needs a property, got %s", node.Value)
+		}
+		return nil
+	case Spatial:
+		if !SpatialOps[node.Op] {
+			return fmt.Errorf("unknown spatial predicate %s", node.Op)
+		}
+		for _, operand := range []Expression{node.Left, node.Right} {
+			switch operand.(type) {
+			case Property, Geometry:
+			default:
+				return fmt.Errorf("%s needs geometries, got %s", strings.ToUpper(node.Op), operand)
+			}
+		}
+		return nil
+	case Temporal:
+		if !TemporalOps[node.Op] {
+			return fmt.Errorf("unknown temporal predicate %s", node.Op)
+		}
+		for _, operand := range []Expression{node.Left, node.Right} {
+			switch operand.(type) {
+			case Property, Instant, Interval:
+			default:
+				return fmt.Errorf("%s needs instants or intervals, got %s", strings.ToUpper(node.Op), operand)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%s is not a predicate", e)
+}
+
+// scalars checks the operands of a scalar predicate, they are properties, literals or instants
+func scalars(op string, operands ...Expression) error {
+	for _, operand := range operands {
+		switch operand.(type) {
+		case Property, Literal, Instant:
+		default:
+			return fmt.Errorf("%s needs scalar operands, got %s", op, operand)
+		}
+	}
+	return nil
+}
+
+func isString(literal Literal) bool {
+	_, ok := literal.Value.(string)
+	return ok
+}
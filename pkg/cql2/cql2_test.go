@@ -0,0 +1,123 @@
+package cql2_test
+
+import (
+	"testing"
+
+	"github.com/gocastsian/roham/pkg/cql2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseText(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		want   string
+	}{
+		{name: "comparison", filter: `population >= 1e6`, want: `"population" >= 1000000`},
+		{name: "string escape", filter: `name = 'Qom''s'`, want: `"name" = 'Qom''s'`},
+		{
+			name:   "precedence",
+			filter: `a = 1 or b = 2 and not c <> 3`,
+			want:   `("a" = 1 OR ("b" = 2 AND NOT ("c" <> 3)))`,
+		},
+		{name: "like", filter: `name NOT LIKE 'Teh%'`, want: `"name" NOT LIKE 'Teh%'`},
+		{
+			name:   "between inside and",
+			filter: `area BETWEEN 10 AND 20.5 AND "land use" IN ('farm', 'forest')`,
+			want:   `("area" BETWEEN 10 AND 20.5 AND "land use" IN ('farm', 'forest'))`,
+		},
+		{name: "is null", filter: `owner IS NOT NULL`, want: `"owner" IS NOT NULL`},
+		{name: "boolean", filter: `active = true`, want: `"active" = TRUE`},
+		{name: "date", filter: `built < DATE('1990-03-21')`, want: `"built" < DATE('1990-03-21')`},
+		{
+			name:   "bbox",
+			filter: `S_INTERSECTS(geometry, BBOX(44, 25, 63.5, 40))`,
+			want:   `S_INTERSECTS("geometry", POLYGON((44 25,63.5 25,63.5 40,44 40,44 25)))`,
+		},
+		{
+			name:   "wkt",
+			filter: `s_within(geometry, POLYGON ((51 35, 52 35, 52 36, 51 35)))`,
+			want:   `S_WITHIN("geometry", POLYGON((51 35,52 35,52 36,51 35)))`,
+		},
+		{
+			name:   "collection",
+			filter: `S_DISJOINT(geometry, GEOMETRYCOLLECTION(POINT(1 2), LINESTRING(0 0, -1.5 2)))`,
+			want:   `S_DISJOINT("geometry", GEOMETRYCOLLECTION(POINT(1 2),LINESTRING(0 0,-1.5 2)))`,
+		},
+		{
+			name:   "interval",
+			filter: `T_DURING(observed, INTERVAL('2024-01-01', '..'))`,
+			want:   `T_DURING("observed", INTERVAL('2024-01-01', '..'))`,
+		},
+		{
+			name:   "timestamp",
+			filter: `T_AFTER(observed, TIMESTAMP('2024-01-01T03:30:00+03:30'))`,
+			want:   `T_AFTER("observed", TIMESTAMP('2024-01-01T00:00:00Z'))`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := cql2.ParseText(tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, e.String())
+
+			// the rendered text parses back to the same filter
+			again, err := cql2.ParseText(e.String())
+			require.NoError(t, err)
+			assert.Equal(t, e, again)
+		})
+	}
+}
+
+func TestParseTextErrors(t *testing.T) {
+	for _, filter := range []string{
+		``,
+		`name = `,
+		`name = 'open`,
+		`(a = 1`,
+		`a = 1 b = 2`,
+		`name LIKE 5`,
+		`S_INTERSECTS(geometry, 5)`,
+		`T_BEFORE(observed, 'yesterday')`,
+		`a BETWEEN 1 OR 2`,
+		`a IN ()`,
+		`BBOX(1, 2, 3) = a`,
+		`DATE('1990-02-30') = built`,
+		`T_DURING(observed, INTERVAL('2024-02-01', '2024-01-01'))`,
+		`a ; b`,
+	} {
+		_, err := cql2.ParseText(filter)
+		assert.Error(t, err, filter)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	e, err := cql2.ParseJSON([]byte(`{"op": "and", "args": [
+		{"op": "in", "args": [{"property": "type"}, ["farm", "forest"]]},
+		{"op": "not", "args": [{"op": "isNull", "args": [{"property": "owner"}]}]},
+		{"op": "s_intersects", "args": [{"property": "geometry"}, {"type": "Point", "coordinates": [51.4, 35.7]}]},
+		{"op": "t_intersects", "args": [{"property": "observed"}, {"interval": [{"date": "2024-01-01"}, ".."]}]},
+		{"op": "between", "args": [{"property": "area"}, 10, 20]}
+	]}`))
+	require.NoError(t, err)
+	assert.Equal(t, `("type" IN ('farm', 'forest') AND NOT ("owner" IS NULL) AND `+
+		`S_INTERSECTS("geometry", {"coordinates":[51.4,35.7],"type":"Point"}) AND `+
+		`T_INTERSECTS("observed", INTERVAL('2024-01-01', '..')) AND "area" BETWEEN 10 AND 20)`, e.String())
+
+	attributes, geometries := cql2.Properties(e)
+	assert.Equal(t, []string{"type", "owner", "observed", "area"}, attributes)
+	assert.Equal(t, []string{"geometry"}, geometries)
+
+	for _, filter := range []string{
+		`[]`,
+		`{"op": "and", "args": [{"op": "=", "args": [{"property": "a"}, 1]}]}`,
+		`{"op": "like", "args": [{"property": "name"}]}`,
+		`{"op": "a_contains", "args": [{"property": "tags"}, ["x"]]}`,
+		`{"op": "s_within", "args": [{"property": "geometry"}, {"bbox": [1, 2, "3", 4]}]}`,
+	} {
+		_, err := cql2.ParseJSON([]byte(filter))
+		assert.Error(t, err, filter)
+	}
+}
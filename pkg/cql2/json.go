@@ -0,0 +1,187 @@
+package cql2
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ParseJSON parses a filter in the CQL2 JSON encoding
+func ParseJSON(data []byte) (Expression, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("invalid CQL2 JSON: %w", err)
+	}
+
+	e, err := fromJSON(value)
+	if err == nil {
+		err = check(e)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CQL2 JSON: %w", err)
+	}
+	return e, nil
+}
+
+func fromJSON(value interface{}) (Expression, error) {
+	switch v := value.(type) {
+	case string, float64, bool:
+		return Literal{Value: v}, nil
+	case map[string]interface{}:
+		return objectFromJSON(v)
+	}
+	return nil, fmt.Errorf("unexpected %v", value)
+}
+
+func objectFromJSON(object map[string]interface{}) (Expression, error) {
+	if name, ok := object["property"].(string); ok {
+		return Property{Name: name}, nil
+	}
+	if value, ok := object["date"].(string); ok {
+		return parseInstant(value, true)
+	}
+	if value, ok := object["timestamp"].(string); ok {
+		return parseInstant(value, false)
+	}
+	if bounds, ok := object["interval"].([]interface{}); ok {
+		return intervalFromJSON(bounds)
+	}
+	if box, ok := object["bbox"].([]interface{}); ok {
+		values := make([]float64, 0, len(box))
+		for _, item := range box {
+			number, ok := item.(float64)
+			if !ok {
+				return nil, fmt.Errorf("bbox needs numbers")
+			}
+			values = append(values, number)
+		}
+		return bboxGeometry(values)
+	}
+	if _, ok := object["type"].(string); ok {
+		geometry, err := json.Marshal(object)
+		if err != nil {
+			return nil, err
+		}
+		return Geometry{GeoJSON: geometry}, nil
+	}
+
+	op, ok := object["op"].(string)
+	if !ok {
+		return nil, fmt.Errorf("expected an operation, a property or a literal")
+	}
+	rawArgs, ok := object["args"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s needs an args array", op)
+	}
+	return operationFromJSON(strings.ToLower(op), rawArgs)
+}
+
+func operationFromJSON(op string, rawArgs []interface{}) (Expression, error) {
+	// the list of IN is an array, it is read apart from the other arguments
+	if op == "in" {
+		if len(rawArgs) != 2 {
+			return nil, fmt.Errorf("in needs a value and a list")
+		}
+		value, err := fromJSON(rawArgs[0])
+		if err != nil {
+			return nil, err
+		}
+		items, ok := rawArgs[1].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("in needs a list")
+		}
+		list, err := expressionsFromJSON(items)
+		if err != nil {
+			return nil, err
+		}
+		return In{Value: value, List: list}, nil
+	}
+
+	args, err := expressionsFromJSON(rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	arity := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("%s needs %d arguments, got %d", op, n, len(args))
+		}
+		return nil
+	}
+
+	switch {
+	case op == "and" || op == "or":
+		return Logical{Op: op, Args: args}, nil
+	case op == "not":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		return Not{Arg: args[0]}, nil
+	case comparisonOps[op]:
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		return Comparison{Op: op, Left: args[0], Right: args[1]}, nil
+	case op == "like":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		return Like{Value: args[0], Pattern: args[1]}, nil
+	case op == "between":
+		if err := arity(3); err != nil {
+			return nil, err
+		}
+		return Between{Value: args[0], Low: args[1], High: args[2]}, nil
+	case op == "isnull":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		return IsNull{Value: args[0]}, nil
+	case SpatialOps[op]:
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		return Spatial{Op: op, Left: args[0], Right: args[1]}, nil
+	case TemporalOps[op]:
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		return Temporal{Op: op, Left: args[0], Right: args[1]}, nil
+	}
+	return nil, fmt.Errorf("unsupported operation %s", op)
+}
+
+func expressionsFromJSON(values []interface{}) ([]Expression, error) {
+	expressions := make([]Expression, 0, len(values))
+	for _, value := range values {
+		e, err := fromJSON(value)
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, e)
+	}
+	return expressions, nil
+}
+
+func intervalFromJSON(bounds []interface{}) (Expression, error) {
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("interval needs a start and an end")
+	}
+	values := make([]string, 2)
+	for i, bound := range bounds {
+		switch v := bound.(type) {
+		case string:
+			values[i] = v
+		case map[string]interface{}:
+			if date, ok := v["date"].(string); ok {
+				values[i] = date
+			} else if timestamp, ok := v["timestamp"].(string); ok {
+				values[i] = timestamp
+			} else {
+				return nil, fmt.Errorf("interval bounds are dates, timestamps or ..")
+			}
+		default:
+			return nil, fmt.Errorf("interval bounds are dates, timestamps or ..")
+		}
+	}
+	return parseInterval(values[0], values[1])
+}
@@ -0,0 +1,524 @@
+package cql2
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenQuotedIdentifier
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	start int
+}
+
+// keyword reports whether the token is the unquoted identifier word, keywords are case-insensitive
+func (t token) keyword(word string) bool {
+	return t.kind == tokenIdentifier && strings.EqualFold(t.text, word)
+}
+
+func (t token) symbol(symbol string) bool {
+	return t.kind == tokenSymbol && t.text == symbol
+}
+
+func tokenize(input string) ([]token, error) {
+	tokens := make([]token, 0)
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			// quotes are escaped by doubling them
+			var value strings.Builder
+			start := i
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated %c at %d", r, start)
+				}
+				if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						value.WriteRune(r)
+						i++
+						continue
+					}
+					break
+				}
+				value.WriteRune(runes[i])
+			}
+			i++
+			kind := tokenString
+			if r == '"' {
+				kind = tokenQuotedIdentifier
+			}
+			tokens = append(tokens, token{kind: kind, text: value.String(), start: start})
+		case unicode.IsDigit(r) || r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]) ||
+			(r == '-' || r == '+') && i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.'):
+			start := i
+			for i++; i < len(runes); i++ {
+				c := runes[i]
+				if unicode.IsDigit(c) || c == '.' || c == 'e' || c == 'E' ||
+					(c == '-' || c == '+') && (runes[i-1] == 'e' || runes[i-1] == 'E') {
+					continue
+				}
+				break
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), start: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i++; i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.' || runes[i] == ':'); i++ {
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, text: string(runes[start:i]), start: start})
+		case r == '<' || r == '>':
+			start := i
+			i++
+			if i < len(runes) && (runes[i] == '=' || r == '<' && runes[i] == '>') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(runes[start:i]), start: start})
+		case strings.ContainsRune("=(),", r):
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(r), start: i})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", r, i)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, start: len(runes)}), nil
+}
+
+type textParser struct {
+	tokens []token
+	pos    int
+}
+
+// ParseText parses a filter in the CQL2 text encoding
+func ParseText(input string) (Expression, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CQL2 text: %w", err)
+	}
+
+	p := &textParser{tokens: tokens}
+	e, err := p.or()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = p.unexpected()
+	}
+	if err == nil {
+		err = check(e)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CQL2 text: %w", err)
+	}
+	return e, nil
+}
+
+func (p *textParser) peek() token { return p.tokens[p.pos] }
+
+func (p *textParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *textParser) unexpected() error {
+	return unexpectedToken(p.peek())
+}
+
+func unexpectedToken(t token) error {
+	if t.kind == tokenEOF {
+		return fmt.Errorf("unexpected end of filter")
+	}
+	return fmt.Errorf("unexpected %q at %d", t.text, t.start)
+}
+
+func (p *textParser) expect(symbol string) error {
+	if !p.peek().symbol(symbol) {
+		return p.unexpected()
+	}
+	p.next()
+	return nil
+}
+
+func (p *textParser) acceptKeyword(word string) bool {
+	if p.peek().keyword(word) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *textParser) or() (Expression, error) {
+	return p.logical("or", p.and)
+}
+
+func (p *textParser) and() (Expression, error) {
+	return p.logical("and", p.not)
+}
+
+func (p *textParser) logical(op string, operand func() (Expression, error)) (Expression, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	args := []Expression{first}
+	for p.acceptKeyword(op) {
+		arg, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) == 1 {
+		return first, nil
+	}
+	return Logical{Op: op, Args: args}, nil
+}
+
+func (p *textParser) not() (Expression, error) {
+	if p.acceptKeyword("not") {
+		arg, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Arg: arg}, nil
+	}
+	return p.primary()
+}
+
+func (p *textParser) primary() (Expression, error) {
+	if p.peek().symbol("(") {
+		p.next()
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	}
+
+	if t := p.peek(); t.kind == tokenIdentifier {
+		op := strings.ToLower(t.text)
+		if SpatialOps[op] || TemporalOps[op] {
+			p.next()
+			left, right, err := p.pair()
+			if err != nil {
+				return nil, err
+			}
+			if SpatialOps[op] {
+				return Spatial{Op: op, Left: left, Right: right}, nil
+			}
+			return Temporal{Op: op, Left: left, Right: right}, nil
+		}
+	}
+
+	return p.predicate()
+}
+
+// pair reads the two parenthesized arguments of a spatial or temporal predicate
+func (p *textParser) pair() (Expression, Expression, error) {
+	if err := p.expect("("); err != nil {
+		return nil, nil, err
+	}
+	left, err := p.operand()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := p.expect(","); err != nil {
+		return nil, nil, err
+	}
+	right, err := p.operand()
+	if err != nil {
+		return nil, nil, err
+	}
+	return left, right, p.expect(")")
+}
+
+func (p *textParser) predicate() (Expression, error) {
+	value, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tokenSymbol && comparisonOps[t.text] {
+		p.next()
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return Comparison{Op: t.text, Left: value, Right: right}, nil
+	}
+
+	if p.acceptKeyword("is") {
+		negated := p.acceptKeyword("not")
+		if !p.acceptKeyword("null") {
+			return nil, p.unexpected()
+		}
+		return IsNull{Negated: negated, Value: value}, nil
+	}
+
+	negated := p.acceptKeyword("not")
+	switch {
+	case p.acceptKeyword("like"):
+		pattern, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return Like{Negated: negated, Value: value, Pattern: pattern}, nil
+	case p.acceptKeyword("between"):
+		low, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptKeyword("and") {
+			return nil, p.unexpected()
+		}
+		high, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return Between{Negated: negated, Value: value, Low: low, High: high}, nil
+	case p.acceptKeyword("in"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		list := make([]Expression, 0)
+		for {
+			item, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+			if !p.peek().symbol(",") {
+				break
+			}
+			p.next()
+		}
+		return In{Negated: negated, Value: value, List: list}, p.expect(")")
+	}
+	return nil, p.unexpected()
+}
+
+// wktTypes are the geometry literals of CQL2 text
+var wktTypes = map[string]bool{
+	"point": true, "linestring": true, "polygon": true, "multipoint": true,
+	"multilinestring": true, "multipolygon": true, "geometrycollection": true,
+}
+
+func (p *textParser) operand() (Expression, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return Literal{Value: t.text}, nil
+	case tokenNumber:
+		number, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.start)
+		}
+		return Literal{Value: number}, nil
+	case tokenQuotedIdentifier:
+		return Property{Name: t.text}, nil
+	case tokenIdentifier:
+		word := strings.ToLower(t.text)
+		switch {
+		case word == "true" || word == "false":
+			return Literal{Value: word == "true"}, nil
+		case word == "date" || word == "timestamp":
+			value, err := p.stringArgument()
+			if err != nil {
+				return nil, err
+			}
+			return parseInstant(value, word == "date")
+		case word == "interval":
+			return p.interval()
+		case word == "bbox":
+			return p.bbox()
+		case wktTypes[word] && p.peek().symbol("("):
+			return p.wkt(strings.ToUpper(word))
+		}
+		return Property{Name: t.text}, nil
+	}
+	return nil, unexpectedToken(t)
+}
+
+func (p *textParser) stringArgument() (string, error) {
+	if err := p.expect("("); err != nil {
+		return "", err
+	}
+	t := p.next()
+	if t.kind != tokenString {
+		return "", unexpectedToken(t)
+	}
+	return t.text, p.expect(")")
+}
+
+func (p *textParser) interval() (Expression, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var bounds [2]string
+	for i := range bounds {
+		if i == 1 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		t := p.next()
+		switch {
+		case t.kind == tokenString:
+			bounds[i] = t.text
+		case t.keyword("date") || t.keyword("timestamp"):
+			value, err := p.stringArgument()
+			if err != nil {
+				return nil, err
+			}
+			bounds[i] = value
+		default:
+			return nil, unexpectedToken(t)
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return parseInterval(bounds[0], bounds[1])
+}
+
+func (p *textParser) bbox() (Expression, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	values := make([]float64, 0, 4)
+	for {
+		t := p.next()
+		if t.kind != tokenNumber {
+			return nil, unexpectedToken(t)
+		}
+		number, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.start)
+		}
+		values = append(values, number)
+		if !p.peek().symbol(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return bboxGeometry(values)
+}
+
+// wkt reads the coordinates of a WKT literal and writes them back in a normalized form
+func (p *textParser) wkt(kind string) (Expression, error) {
+	var wkt strings.Builder
+	wkt.WriteString(kind)
+	depth := 0
+	previousNumber := false
+	for {
+		t := p.next()
+		switch {
+		case t.symbol("("):
+			depth++
+			wkt.WriteString("(")
+			previousNumber = false
+		case t.symbol(")"):
+			depth--
+			wkt.WriteString(")")
+			previousNumber = false
+		case t.symbol(","):
+			wkt.WriteString(",")
+			previousNumber = false
+		case t.kind == tokenNumber:
+			if previousNumber {
+				wkt.WriteString(" ")
+			}
+			wkt.WriteString(t.text)
+			previousNumber = true
+		case t.kind == tokenIdentifier && wktTypes[strings.ToLower(t.text)] && kind == "GEOMETRYCOLLECTION":
+			wkt.WriteString(strings.ToUpper(t.text))
+			previousNumber = false
+		case t.keyword("empty"):
+			wkt.WriteString(" EMPTY")
+			previousNumber = false
+		default:
+			return nil, unexpectedToken(t)
+		}
+		if depth == 0 {
+			return Geometry{WKT: wkt.String()}, nil
+		}
+	}
+}
+
+// parseInstant reads the value of a DATE or TIMESTAMP literal
+func parseInstant(value string, date bool) (Instant, error) {
+	if date {
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return Instant{}, fmt.Errorf("invalid date %q", value)
+		}
+		return Instant{Time: t, Date: true}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return Instant{}, fmt.Errorf("invalid timestamp %q", value)
+	}
+	return Instant{Time: t.UTC()}, nil
+}
+
+// parseInterval reads the bounds of an INTERVAL literal, they are dates, timestamps or .. for an open end
+func parseInterval(start, end string) (Expression, error) {
+	var interval Interval
+	for i, value := range []string{start, end} {
+		if value == ".." || value == "" {
+			continue
+		}
+		instant, err := parseInstant(value, !strings.Contains(value, "T"))
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			interval.Start = &instant
+		} else {
+			interval.End = &instant
+		}
+	}
+	if interval.Start != nil && interval.End != nil && interval.End.Time.Before(interval.Start.Time) {
+		return nil, fmt.Errorf("interval %s ends before it starts", interval)
+	}
+	return interval, nil
+}
+
+// bboxGeometry turns the four numbers of a BBOX into a polygon, a 3D box keeps its horizontal extent
+func bboxGeometry(values []float64) (Expression, error) {
+	var minX, minY, maxX, maxY float64
+	switch len(values) {
+	case 4:
+		minX, minY, maxX, maxY = values[0], values[1], values[2], values[3]
+	case 6:
+		minX, minY, maxX, maxY = values[0], values[1], values[3], values[4]
+	default:
+		return nil, fmt.Errorf("BBOX needs 4 or 6 numbers, got %d", len(values))
+	}
+	if minX > maxX || minY > maxY {
+		return nil, fmt.Errorf("BBOX minimum is greater than its maximum")
+	}
+
+	format := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	return Geometry{WKT: fmt.Sprintf("POLYGON((%[1]s %[2]s,%[3]s %[2]s,%[3]s %[4]s,%[1]s %[4]s,%[1]s %[2]s))",
+		format(minX), format(minY), format(maxX), format(maxY))}, nil
+}
@@ -2,9 +2,31 @@ package dateparser
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Calendar is the calendar a date is written in
+type Calendar string
+
+const (
+	CalendarGregorian Calendar = "gregorian"
+	CalendarJalali    Calendar = "jalali"
+)
+
+// ParseCalendar reads a calendar name, an empty name is the Gregorian calendar
+func ParseCalendar(value string) (Calendar, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", string(CalendarGregorian):
+		return CalendarGregorian, nil
+	case string(CalendarJalali), "persian", "shamsi":
+		return CalendarJalali, nil
+	default:
+		return "", fmt.Errorf("unknown calendar %q, must be one of gregorian or jalali", value)
+	}
+}
+
 // ParseDate parses a date string in "YYYY-MM-DD" format and returns a time.Time object
 func ParseDate(input string) (time.Time, error) {
 	const layout = "2006-01-02"
@@ -17,3 +39,185 @@ func ParseDate(input string) (time.Time, error) {
 
 	return convertedDate, nil
 }
+
+// ParseDateIn parses a date written in calendar and returns it as a UTC midnight time.Time
+func ParseDateIn(input string, calendar Calendar) (time.Time, error) {
+	if calendar == CalendarJalali {
+		return ParseJalaliDate(input)
+	}
+	return ParseDate(input)
+}
+
+// FormatDateIn formats the date of t as "YYYY-MM-DD" in calendar
+func FormatDateIn(t time.Time, calendar Calendar) string {
+	if calendar == CalendarJalali {
+		return FormatJalaliDate(t)
+	}
+	return t.Format(time.DateOnly)
+}
+
+// ParseJalaliDate parses a Jalali (Solar Hijri) date and returns the Gregorian day it falls on. The year, month and
+// day can be separated by - or / and written with Latin, Persian or Arabic digits, "YYYYMMDD" without separators
+// is accepted as well since that is how DBF files usually store dates
+func ParseJalaliDate(input string) (time.Time, error) {
+	value := normalizeDigits(strings.TrimSpace(input))
+
+	var parts []string
+	if len(value) == 8 && !strings.ContainsAny(value, "-/") {
+		parts = []string{value[:4], value[4:6], value[6:]}
+	} else {
+		parts = strings.FieldsFunc(value, func(r rune) bool { return r == '-' || r == '/' })
+	}
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("invalid jalali date %q, expected YYYY-MM-DD", input)
+	}
+
+	var fields [3]int
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid jalali date %q, expected YYYY-MM-DD", input)
+		}
+		fields[i] = number
+	}
+
+	return JalaliToGregorian(fields[0], fields[1], fields[2])
+}
+
+// FormatJalaliDate formats the date of t as a Jalali "YYYY-MM-DD"
+func FormatJalaliDate(t time.Time) string {
+	year, month, day := GregorianToJalali(t)
+	return fmt.Sprintf("%04d-%02d-%02d", year, month, day)
+}
+
+// persianDigitOffsets maps the first digit of the Persian and Arabic-Indic digit blocks to '0'
+var persianDigitOffsets = []rune{'۰', '٠'}
+
+func normalizeDigits(value string) string {
+	return strings.Map(func(r rune) rune {
+		for _, zero := range persianDigitOffsets {
+			if r >= zero && r <= zero+9 {
+				return '0' + r - zero
+			}
+		}
+		return r
+	}, value)
+}
+
+// jalaliBreaks are the years the 33-year leap cycle of the Jalali calendar is realigned with the solar year,
+// the conversions follow the algorithm of Kazimierz M. Borkowski used by jalaali-js
+var jalaliBreaks = []int{
+	-61, 9, 38, 199, 426, 686, 756, 818, 1111, 1181, 1210, 1635, 2060, 2097, 2192, 2262, 2324, 2394, 2456, 3178,
+}
+
+// jalaliYear describes the Jalali year starting in Gregorian year gregorianYear
+type jalaliYear struct {
+	// leap is the number of years since the last leap year, 0 for a leap year
+	leap          int
+	gregorianYear int
+	// march is the day of March of gregorianYear that Farvardin 1st falls on
+	march int
+}
+
+func jalaliCalendar(year int) (jalaliYear, error) {
+	if year < jalaliBreaks[0] || year >= jalaliBreaks[len(jalaliBreaks)-1] {
+		return jalaliYear{}, fmt.Errorf("jalali year %d is out of the supported range", year)
+	}
+
+	gregorianYear := year + 621
+	leapJ := -14
+	jp := jalaliBreaks[0]
+	jump := 0
+	for _, jm := range jalaliBreaks[1:] {
+		jump = jm - jp
+		if year < jm {
+			break
+		}
+		leapJ += jump/33*8 + jump%33/4
+		jp = jm
+	}
+
+	n := year - jp
+	leapJ += n/33*8 + (n%33+3)/4
+	if jump%33 == 4 && jump-n == 4 {
+		leapJ++
+	}
+
+	leapG := gregorianYear/4 - (gregorianYear/100+1)*3/4 - 150
+	march := 20 + leapJ - leapG
+
+	if jump-n < 6 {
+		n = n - jump + (jump+4)/33*33
+	}
+	leap := ((n+1)%33 - 1) % 4
+	if leap == -1 {
+		leap = 4
+	}
+
+	return jalaliYear{leap: leap, gregorianYear: gregorianYear, march: march}, nil
+}
+
+// IsJalaliLeapYear reports whether Esfand of year has 30 days
+func IsJalaliLeapYear(year int) bool {
+	calendar, err := jalaliCalendar(year)
+	return err == nil && calendar.leap == 0
+}
+
+// JalaliMonthLength returns the number of days of month in year
+func JalaliMonthLength(year, month int) int {
+	switch {
+	case month <= 6:
+		return 31
+	case month <= 11:
+		return 30
+	case IsJalaliLeapYear(year):
+		return 30
+	default:
+		return 29
+	}
+}
+
+// JalaliToGregorian returns the Gregorian day of a Jalali date as a UTC midnight time.Time
+func JalaliToGregorian(year, month, day int) (time.Time, error) {
+	if month < 1 || month > 12 {
+		return time.Time{}, fmt.Errorf("invalid jalali month %d", month)
+	}
+	calendar, err := jalaliCalendar(year)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if day < 1 || day > JalaliMonthLength(year, month) {
+		return time.Time{}, fmt.Errorf("invalid day %d of jalali month %d/%d", day, year, month)
+	}
+
+	// the first six months have 31 days and the next ones 30
+	dayOfYear := (month-1)*31 - month/7*(month-7) + day - 1
+	return time.Date(calendar.gregorianYear, time.March, calendar.march+dayOfYear, 0, 0, 0, 0, time.UTC), nil
+}
+
+// GregorianToJalali returns the Jalali year, month and day of the date of t
+func GregorianToJalali(t time.Time) (year, month, day int) {
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	year = date.Year() - 621
+	calendar, err := jalaliCalendar(year)
+	if err != nil {
+		return 0, 0, 0
+	}
+
+	newYear := time.Date(date.Year(), time.March, calendar.march, 0, 0, 0, 0, time.UTC)
+	k := int(date.Sub(newYear).Hours() / 24)
+	if k >= 0 {
+		if k <= 185 {
+			return year, 1 + k/31, k%31 + 1
+		}
+		k -= 186
+	} else {
+		// the date is in Dey, Bahman or Esfand of the previous Jalali year
+		year--
+		k += 179
+		if calendar.leap == 1 {
+			k++
+		}
+	}
+	return year, 7 + k/30, k%30 + 1
+}
@@ -0,0 +1,91 @@
+package dateparser_test
+
+import (
+	"testing"
+	"time"
+
+	dateparser "github.com/gocastsian/roham/pkg/date_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJalaliConversion(t *testing.T) {
+	tests := []struct {
+		jalali    string
+		gregorian string
+	}{
+		{jalali: "1403-01-01", gregorian: "2024-03-20"},
+		{jalali: "1403-12-30", gregorian: "2025-03-20"},
+		{jalali: "1404-01-01", gregorian: "2025-03-21"},
+		{jalali: "1399-12-30", gregorian: "2021-03-20"},
+		{jalali: "1378-10-11", gregorian: "2000-01-01"},
+		{jalali: "1357-11-22", gregorian: "1979-02-11"},
+		{jalali: "1402-06-31", gregorian: "2023-09-22"},
+		{jalali: "1402-07-01", gregorian: "2023-09-23"},
+		{jalali: "1300-01-01", gregorian: "1921-03-21"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.jalali, func(t *testing.T) {
+			parsed, err := dateparser.ParseJalaliDate(tt.jalali)
+			require.NoError(t, err)
+			assert.Equal(t, tt.gregorian, parsed.Format(time.DateOnly))
+
+			gregorian, err := dateparser.ParseDate(tt.gregorian)
+			require.NoError(t, err)
+			assert.Equal(t, tt.jalali, dateparser.FormatJalaliDate(gregorian))
+		})
+	}
+}
+
+func TestParseJalaliDate(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "slashes", input: "1403/1/5", want: "2024-03-24"},
+		{name: "persian digits", input: "۱۴۰۳/۰۱/۰۵", want: "2024-03-24"},
+		{name: "arabic digits", input: "١٤٠٣-٠١-٠٥", want: "2024-03-24"},
+		{name: "dbf date", input: "14030105", want: "2024-03-24"},
+		{name: "esfand 30 of a common year", input: "1402-12-30", wantErr: true},
+		{name: "month out of range", input: "1403-13-01", wantErr: true},
+		{name: "not a date", input: "1403-01", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := dateparser.ParseJalaliDate(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, parsed.Format(time.DateOnly))
+		})
+	}
+}
+
+func TestIsJalaliLeapYear(t *testing.T) {
+	for _, year := range []int{1399, 1403, 1408} {
+		assert.True(t, dateparser.IsJalaliLeapYear(year), year)
+	}
+	for _, year := range []int{1400, 1401, 1402, 1404} {
+		assert.False(t, dateparser.IsJalaliLeapYear(year), year)
+	}
+}
+
+func TestDateIn(t *testing.T) {
+	calendar, err := dateparser.ParseCalendar("Jalali")
+	require.NoError(t, err)
+
+	parsed, err := dateparser.ParseDateIn("1403-01-01", calendar)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-03-20", dateparser.FormatDateIn(parsed, dateparser.CalendarGregorian))
+	assert.Equal(t, "1403-01-01", dateparser.FormatDateIn(parsed, calendar))
+
+	_, err = dateparser.ParseCalendar("hijri")
+	assert.Error(t, err)
+}
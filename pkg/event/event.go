@@ -0,0 +1,24 @@
+package event
+
+import (
+	"time"
+
+	"github.com/gocastsian/roham/types"
+)
+
+// MapLayerUploadedStream is the redis stream the filer publishes MapLayerUploaded events to
+const MapLayerUploadedStream = "filer:map_layer_uploaded"
+
+// MapLayerUploaded is published once a tus upload into a storage of kind map-layer is completed
+type MapLayerUploaded struct {
+	FileKey    string            `json:"file_key"`
+	FileName   string            `json:"file_name"`
+	MimeType   string            `json:"mime_type"`
+	Size       int64             `json:"size"`
+	StorageID  types.ID          `json:"storage_id"`
+	UploaderID types.ID          `json:"uploader_id"`
+	MetaData   map[string]string `json:"meta_data"`
+	UploadedAt time.Time         `json:"uploaded_at"`
+	// Organization is the organization claim of the uploader, organization visible layers are shared with it
+	Organization string `json:"organization,omitempty"`
+}
@@ -0,0 +1,149 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const payloadField = "payload"
+
+const (
+	// defaultBlock is how long a read waits for messages when Block isn't set, a read that blocks until a
+	// message arrives would keep the consumer from claiming the messages of dead consumers
+	defaultBlock = 5 * time.Second
+	// minRetryInterval is the least a consumer waits after a failed read so an unreachable redis isn't hammered
+	minRetryInterval = time.Second
+)
+
+type Publisher struct {
+	client *redis.Client
+}
+
+func NewPublisher(client *redis.Client) Publisher {
+	return Publisher{client: client}
+}
+
+// Publish appends payload to stream and returns the id redis assigned to it
+func (p Publisher) Publish(ctx context.Context, stream string, payload []byte) (string, error) {
+	id, err := p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		Values: map[string]interface{}{payloadField: payload},
+	}).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to publish to %s: %w", stream, err)
+	}
+	return id, nil
+}
+
+type ConsumerConfig struct {
+	Group     string        `koanf:"group"`
+	Consumer  string        `koanf:"consumer"`
+	BatchSize int64         `koanf:"batch_size"`
+	Block     time.Duration `koanf:"block"`
+	// ClaimIdle is how long a delivered but unacknowledged message waits before it is delivered again
+	ClaimIdle time.Duration `koanf:"claim_idle"`
+}
+
+// Handler processes one message, the message is acknowledged only when it returns nil
+type Handler func(ctx context.Context, payload []byte) error
+
+// Consumer reads a redis stream through a consumer group, which gives at-least-once delivery:
+// a message whose handler fails or whose consumer dies is claimed again after ClaimIdle
+type Consumer struct {
+	client *redis.Client
+	config ConsumerConfig
+	logger *slog.Logger
+}
+
+func NewConsumer(client *redis.Client, config ConsumerConfig, logger *slog.Logger) Consumer {
+	return Consumer{
+		client: client,
+		config: config,
+		logger: logger,
+	}
+}
+
+// Consume blocks until ctx is done
+func (c Consumer) Consume(ctx context.Context, stream string, handler Handler) error {
+	err := c.client.XGroupCreateMkStream(ctx, stream, c.config.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group %s on %s: %w", c.config.Group, stream, err)
+	}
+
+	for ctx.Err() == nil {
+		claimed, _, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    c.config.Group,
+			Consumer: c.config.Consumer,
+			MinIdle:  c.config.ClaimIdle,
+			Start:    "0-0",
+			Count:    c.config.BatchSize,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			c.logger.Error("failed to claim pending messages", "stream", stream, "err", err)
+		}
+		c.handle(ctx, stream, claimed, handler)
+
+		streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.config.Group,
+			Consumer: c.config.Consumer,
+			Streams:  []string{stream, ">"},
+			Count:    c.config.BatchSize,
+			Block:    c.block(),
+		}).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				c.logger.Error("failed to read messages", "stream", stream, "err", err)
+				wait(ctx, c.retryInterval())
+			}
+			continue
+		}
+		for _, s := range streams {
+			c.handle(ctx, stream, s.Messages, handler)
+		}
+	}
+
+	return ctx.Err()
+}
+
+func (c Consumer) block() time.Duration {
+	if c.config.Block <= 0 {
+		return defaultBlock
+	}
+	return c.config.Block
+}
+
+// retryInterval is how long the consumer pauses after a failed read
+func (c Consumer) retryInterval() time.Duration {
+	return max(c.block(), minRetryInterval)
+}
+
+// wait pauses for d or until ctx is done, whichever comes first
+func wait(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+func (c Consumer) handle(ctx context.Context, stream string, messages []redis.XMessage, handler Handler) {
+	for _, message := range messages {
+		payload, _ := message.Values[payloadField].(string)
+		if err := handler(ctx, []byte(payload)); err != nil {
+			c.logger.Error("failed to handle message, it will be redelivered", "stream", stream, "id", message.ID, "err", err)
+			continue
+		}
+
+		if err := c.client.XAck(ctx, stream, c.config.Group, message.ID).Err(); err != nil {
+			c.logger.Error("failed to ack message", "stream", stream, "id", message.ID, "err", err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package event
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumerIntervals(t *testing.T) {
+	unset := NewConsumer(nil, ConsumerConfig{}, slog.Default())
+	assert.Equal(t, defaultBlock, unset.block())
+	assert.Equal(t, defaultBlock, unset.retryInterval())
+
+	short := NewConsumer(nil, ConsumerConfig{Block: 10 * time.Millisecond}, slog.Default())
+	assert.Equal(t, 10*time.Millisecond, short.block())
+	assert.Equal(t, minRetryInterval, short.retryInterval())
+}
+
+func TestWaitReturnsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	started := time.Now()
+	wait(ctx, time.Hour)
+	assert.Less(t, time.Since(started), time.Second)
+}
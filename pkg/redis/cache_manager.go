@@ -2,6 +2,8 @@ package redis
 
 import (
 	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/redis/go-redis/v9"
 	"log/slog"
 	"time"
@@ -14,13 +16,36 @@ type Cache struct {
 }
 
 type CacheConfig struct {
+	// Name labels the metrics of this cache
+	Name     string        `koanf:"name"`
 	TTL      time.Duration `koanf:"ttl"`
 	WriteTTL time.Duration `koanf:"write_ttl"`
 }
 
 const tag = "cache_manager"
 
+// number of keys deleted per round trip by InvalidatePrefix
+const invalidateBatchSize = 500
+
+var (
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_lookups_total",
+		Help: "Cache reads by result, hit or miss.",
+	}, []string{"cache", "result"})
+	cacheWrites = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_writes_total",
+		Help: "Cache writes by result, ok or error.",
+	}, []string{"cache", "result"})
+	cacheInvalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_invalidations_total",
+		Help: "Cache invalidations by result, ok or error.",
+	}, []string{"cache", "result"})
+)
+
 func NewRedisCache(client *redis.Client, logger *slog.Logger, config CacheConfig) *Cache {
+	if config.Name == "" {
+		config.Name = "default"
+	}
 	return &Cache{
 		client: client,
 		logger: logger,
@@ -31,13 +56,13 @@ func NewRedisCache(client *redis.Client, logger *slog.Logger, config CacheConfig
 func (r *Cache) Get(ctx context.Context, key string) ([]byte, error) {
 	data, err := r.client.Get(ctx, key).Bytes()
 	if err != nil {
-		//todo add metrics --> cache miss
+		cacheLookups.WithLabelValues(r.config.Name, "miss").Inc()
 		r.logger.Info("cache miss", "tag", tag, "key", key)
 		return nil, err
 	}
 
 	r.logger.Info("Cache hit", "tag", tag, "key", key)
-	//todo add metrics --> cache hit
+	cacheLookups.WithLabelValues(r.config.Name, "hit").Inc()
 	return data, nil
 }
 
@@ -46,10 +71,10 @@ func (r *Cache) Set(ctx context.Context, key string, value interface{}) error {
 	defer cancel()
 	err := r.client.Set(ctx, key, value, r.config.TTL).Err()
 	if err != nil {
-		// todo add metrics --> setting in cache failed
+		cacheWrites.WithLabelValues(r.config.Name, "error").Inc()
 		r.logger.Error("error setting in cache", "tag", tag, "key", key, "err", err)
 	} else {
-		// todo add metrics --> setting in cache succeed
+		cacheWrites.WithLabelValues(r.config.Name, "ok").Inc()
 		r.logger.Info("set in cache succeed", "tag", tag, "key", key)
 	}
 	return err
@@ -58,11 +83,56 @@ func (r *Cache) Set(ctx context.Context, key string, value interface{}) error {
 func (r *Cache) Invalidate(ctx context.Context, key string) error {
 	err := r.client.Del(ctx, key).Err()
 	if err != nil {
-		// todo add metrics --> error invalidating cache
+		cacheInvalidations.WithLabelValues(r.config.Name, "error").Inc()
 		r.logger.Error("invalidating cache", "tag", tag, "key", key, "err", err)
 	} else {
-		// todo add metrics --> invalidating cache succeed
+		cacheInvalidations.WithLabelValues(r.config.Name, "ok").Inc()
 		r.logger.Info("invalidating cache", "tag", tag, "key", key)
 	}
 	return err
 }
+
+// InvalidatePrefix removes every key starting with prefix. It walks the keyspace with SCAN so it doesn't
+// block redis, keys written while it runs may survive and should carry a version to be unreachable anyway
+func (r *Cache) InvalidatePrefix(ctx context.Context, prefix string) error {
+	iter := r.client.Scan(ctx, 0, prefix+"*", invalidateBatchSize).Iterator()
+	batch := make([]string, 0, invalidateBatchSize)
+	deleted := 0
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := r.client.Unlink(ctx, batch...).Err(); err != nil {
+			return err
+		}
+		deleted += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	var err error
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == invalidateBatchSize {
+			if err = flush(); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = iter.Err()
+	}
+	if err == nil {
+		err = flush()
+	}
+
+	if err != nil {
+		cacheInvalidations.WithLabelValues(r.config.Name, "error").Inc()
+		r.logger.Error("invalidating cache prefix", "tag", tag, "prefix", prefix, "err", err)
+		return err
+	}
+	cacheInvalidations.WithLabelValues(r.config.Name, "ok").Inc()
+	r.logger.Info("invalidating cache prefix", "tag", tag, "prefix", prefix, "deleted", deleted)
+	return nil
+}
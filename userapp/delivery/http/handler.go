@@ -29,9 +29,10 @@ func NewHandler(userSrv user.Service, guardService guard.Service) Handler {
 	}
 }
 
+// GetAllUsers lists the users, the calendar query parameter picks gregorian or jalali birth dates
 func (h Handler) GetAllUsers(c echo.Context) error {
 
-	res, err := h.UserService.GetAllUsers(c.Request().Context())
+	res, err := h.UserService.GetAllUsers(c.Request().Context(), user.GetAllUsersRequest{Calendar: c.QueryParam("calendar")})
 	if err != nil {
 		if vErr, ok := err.(validator.Error); ok {
 			return c.JSON(vErr.StatusCode(), vErr)
@@ -74,8 +75,11 @@ func (h Handler) authenticate(c echo.Context) error {
 	}
 
 	userInfo := guard.UserClaim{
-		ID:   claim.UserClaim.ID,
-		Role: claim.UserClaim.Role,
+		ID:               claim.UserClaim.ID,
+		Role:             claim.UserClaim.Role,
+		Organization:     claim.UserClaim.Organization,
+		OrganizationRole: claim.UserClaim.OrganizationRole,
+		Region:           claim.UserClaim.Region,
 	}
 
 	jsonData, err := json.Marshal(userInfo)
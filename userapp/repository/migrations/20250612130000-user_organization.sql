@@ -0,0 +1,11 @@
+-- +migrate Up
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS organization VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS organization_role VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS region VARCHAR(100) NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE users
+    DROP COLUMN IF EXISTS organization,
+    DROP COLUMN IF EXISTS organization_role,
+    DROP COLUMN IF EXISTS region;
@@ -7,6 +7,7 @@ import (
 	"github.com/gocastsian/roham/types"
 	"github.com/gocastsian/roham/userapp/service/user"
 	"log/slog"
+	"time"
 )
 
 type Config struct {
@@ -45,7 +46,7 @@ func (repo UserRepo) GetAllUsers(ctx context.Context) ([]user.User, error) {
 
 	for rows.Next() {
 		var result user.User
-		var birthDate sql.NullString
+		var birthDate sql.NullTime
 
 		err := rows.Scan(
 			&result.ID,
@@ -64,7 +65,7 @@ func (repo UserRepo) GetAllUsers(ctx context.Context) ([]user.User, error) {
 		}
 
 		if birthDate.Valid {
-			result.BirthDate = birthDate.String
+			result.BirthDate = birthDate.Time.Format(time.DateOnly)
 		}
 
 		users = append(users, result)
@@ -91,7 +92,7 @@ func (repo UserRepo) GetUserByPhoneNumber(ctx context.Context, phoneNumber strin
 	}
 
 	// Query to fetch the user's details
-	query := "SELECT id, phone_number, role, password_hash FROM users WHERE phone_number=$1"
+	query := "SELECT id, phone_number, role, password_hash, organization, organization_role, region FROM users WHERE phone_number=$1"
 	stmt, err := repo.PostgreSQL.PrepareContext(ctx, query)
 	if err != nil {
 		return user.User{}, fmt.Errorf("failed to prepare statement: %w", err)
@@ -99,7 +100,8 @@ func (repo UserRepo) GetUserByPhoneNumber(ctx context.Context, phoneNumber strin
 	defer stmt.Close()
 
 	var usr user.User
-	err = stmt.QueryRowContext(ctx, phoneNumber).Scan(&usr.ID, &usr.PhoneNumber, &usr.Role, &usr.PasswordHash)
+	err = stmt.QueryRowContext(ctx, phoneNumber).Scan(&usr.ID, &usr.PhoneNumber, &usr.Role, &usr.PasswordHash,
+		&usr.Organization, &usr.OrganizationRole, &usr.Region)
 	if err != nil {
 		return user.User{}, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -150,8 +152,8 @@ func (repo UserRepo) CheckUserUniquness(ctx context.Context, email string, usern
 }
 func (repo UserRepo) RegisterUser(ctx context.Context, user user.User) (types.ID, error) {
 	query := `INSERT INTO users 
-    			(username,first_name,last_name,email,role,password_hash) 
-				VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+    			(username,first_name,last_name,email,role,password_hash,birth_date) 
+				VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::date) RETURNING id`
 	stmt, err := repo.PostgreSQL.PrepareContext(ctx, query)
 	if err != nil {
 		return 0, fmt.Errorf("failed to prepare statement: %w", err)
@@ -167,6 +169,7 @@ func (repo UserRepo) RegisterUser(ctx context.Context, user user.User) (types.ID
 		user.Email,        // $4
 		user.Role,         // $5
 		user.PasswordHash, // $6
+		user.BirthDate,    // $7
 	).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("failed to register user: %w", err)
@@ -184,6 +187,7 @@ func (repo UserRepo) GetUser(ctx context.Context, ID types.ID) (user.User, error
 	defer stmt.Close()
 
 	var usr user.User
+	var birthDate sql.NullTime
 	err = stmt.QueryRowContext(ctx, ID).Scan(
 		&usr.ID,
 		&usr.Username,
@@ -191,7 +195,7 @@ func (repo UserRepo) GetUser(ctx context.Context, ID types.ID) (user.User, error
 		&usr.LastName,
 		&usr.Email,
 		&usr.PhoneNumber,
-		&usr.BirthDate,
+		&birthDate,
 		&usr.CreatedAt,
 		&usr.UpdatedAt,
 		&usr.Role,
@@ -203,6 +207,9 @@ func (repo UserRepo) GetUser(ctx context.Context, ID types.ID) (user.User, error
 			return user.User{}, fmt.Errorf("failed to execute query: %w", err)
 		}
 	}
+	if birthDate.Valid {
+		usr.BirthDate = birthDate.Time.Format(time.DateOnly)
+	}
 
 	return usr, nil
 }
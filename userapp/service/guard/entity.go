@@ -15,6 +15,10 @@ const (
 type UserClaim struct {
 	ID   types.ID   `json:"user_id"`
 	Role types.Role `json:"role"`
+	// Organization, OrganizationRole and Region are what the row rules of other services compare features with
+	Organization     string `json:"organization,omitempty"`
+	OrganizationRole string `json:"organization_role,omitempty"`
+	Region           string `json:"region,omitempty"`
 }
 
 type Claims struct {
@@ -63,6 +63,23 @@ func TestParseToken(t *testing.T) {
 	assert.Equal(t, types.ID(123), parsedClaims.UserClaim.ID)
 }
 
+func TestAccessTokenCarriesOrganization(t *testing.T) {
+	config := guard.Config{
+		SignKey:              "roham",
+		AccessSubject:        "access",
+		AccessExpirationTime: time.Hour,
+	}
+	service := guard.NewService(config, nil, nil)
+	userClaim := guard.UserClaim{ID: 123, Role: 2, Organization: "water", OrganizationRole: "editor", Region: "tehran"}
+
+	token, err := service.CreateAccessToken(userClaim)
+	assert.NoError(t, err)
+
+	parsedClaims, err := service.ParseToken("Bearer " + token)
+	assert.NoError(t, err)
+	assert.Equal(t, userClaim, parsedClaims.UserClaim)
+}
+
 func TestCheckPolicy(t *testing.T) {
 	policy := `package test
 
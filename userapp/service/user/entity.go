@@ -19,6 +19,10 @@ type User struct {
 	IsActive     bool       `json:"is_active"`
 	Role         types.Role `json:"role"`
 	PasswordHash string     `json:"password_hash"`
+	// Organization, OrganizationRole and Region are assigned by an admin and carried in the access token
+	Organization     string `json:"organization"`
+	OrganizationRole string `json:"organization_role"`
+	Region           string `json:"region"`
 }
 
 type LoginRequest struct {
@@ -46,4 +50,7 @@ type RegisterRequest struct {
 	Email           string `json:"email"`
 	Password        string `json:"password"`
 	ConfirmPassword string `json:"confirm_password"`
+	// BirthDate is optional, it is written in Calendar which defaults to gregorian
+	BirthDate string `json:"birth_date"`
+	Calendar  string `json:"calendar"`
 }
@@ -6,6 +6,11 @@ import (
 	"github.com/gocastsian/roham/types"
 )
 
+type GetAllUsersRequest struct {
+	// Calendar the birth dates are returned in, gregorian or jalali
+	Calendar string
+}
+
 type GetAllUsersItem struct {
 	ID          types.ID   `json:"id"`
 	Username    string     `json:"username"`
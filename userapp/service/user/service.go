@@ -7,7 +7,9 @@ import (
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"time"
 
+	dateparser "github.com/gocastsian/roham/pkg/date_parser"
 	errmsg "github.com/gocastsian/roham/pkg/err_msg"
 	"github.com/gocastsian/roham/pkg/password"
 	"github.com/gocastsian/roham/pkg/statuscode"
@@ -55,7 +57,15 @@ func NewService(repo Repository, validator Validator, logger *slog.Logger, guard
 	}
 }
 
-func (srv Service) GetAllUsers(ctx context.Context) (GetAllUsersResponse, error) {
+func (srv Service) GetAllUsers(ctx context.Context, req GetAllUsersRequest) (GetAllUsersResponse, error) {
+	calendar, err := dateparser.ParseCalendar(req.Calendar)
+	if err != nil {
+		return GetAllUsersResponse{}, errmsg.ErrorResponse{
+			Message:         err.Error(),
+			Errors:          map[string]interface{}{"calendar": err.Error()},
+			InternalErrCode: statuscode.IntCodeValidation,
+		}
+	}
 
 	users, err := srv.repository.GetAllUsers(ctx)
 	if err != nil {
@@ -77,7 +87,7 @@ func (srv Service) GetAllUsers(ctx context.Context) (GetAllUsersResponse, error)
 			Avatar:      user.Avatar,
 			PhoneNumber: user.PhoneNumber,
 			Email:       user.Email,
-			BirthDate:   user.BirthDate,
+			BirthDate:   formatBirthDate(user.BirthDate, calendar),
 			CreatedAt:   user.CreatedAt,
 			UpdatedAt:   user.UpdatedAt,
 			Role:        user.Role,
@@ -111,8 +121,11 @@ func (srv Service) Login(ctx context.Context, loginReq LoginRequest) (LoginRespo
 	}
 
 	userClaim := guard.UserClaim{
-		ID:   usr.ID,
-		Role: usr.Role,
+		ID:               usr.ID,
+		Role:             usr.Role,
+		Organization:     usr.Organization,
+		OrganizationRole: usr.OrganizationRole,
+		Region:           usr.Region,
 	}
 
 	accessTok, err := srv.guard.CreateAccessToken(userClaim)
@@ -172,7 +185,7 @@ func (srv Service) RegisterUser(ctx context.Context, regReq RegisterRequest) (Re
 		PhoneNumber:  "",
 		Email:        regReq.Email,
 		Avatar:       "",
-		BirthDate:    "",
+		BirthDate:    normalizeBirthDate(regReq.BirthDate, regReq.Calendar),
 		IsActive:     true,
 		Role:         0,
 		PasswordHash: hashedPassword,
@@ -262,3 +275,25 @@ func (srv Service) createFile(dstAddress string) (*os.File, error) {
 
 	return dst, nil
 }
+
+// normalizeBirthDate converts a validated birth date of a request to the gregorian YYYY-MM-DD it is stored as
+func normalizeBirthDate(birthDate string, calendar string) string {
+	parsedCalendar, err := dateparser.ParseCalendar(calendar)
+	if birthDate == "" || err != nil {
+		return ""
+	}
+	date, err := dateparser.ParseDateIn(birthDate, parsedCalendar)
+	if err != nil {
+		return ""
+	}
+	return date.Format(time.DateOnly)
+}
+
+// formatBirthDate writes a stored birth date in calendar, users without a birth date keep an empty one
+func formatBirthDate(birthDate string, calendar dateparser.Calendar) string {
+	date, err := dateparser.ParseDate(birthDate)
+	if err != nil {
+		return birthDate
+	}
+	return dateparser.FormatDateIn(date, calendar)
+}
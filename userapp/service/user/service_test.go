@@ -89,6 +89,54 @@ func TestRegisterUser_Success(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestRegisterUser_JalaliBirthDate(t *testing.T) {
+	mockRepo := new(MockRepository)
+	userValidator := user.NewValidator(mockRepo)
+	service := user.NewService(mockRepo, userValidator, nil, nil, user.Config{})
+
+	regReq := user.RegisterRequest{
+		Username:        "testuser",
+		FirstName:       "Test",
+		LastName:        "User",
+		Email:           "test@example.com",
+		Password:        "s2Securepassword",
+		ConfirmPassword: "s2Securepassword",
+		BirthDate:       "1369/02/11",
+		Calendar:        "jalali",
+	}
+
+	mockRepo.On("CheckUserUniquness", mock.Anything, regReq.Email, regReq.Username).Return(false, nil)
+	mockRepo.On("RegisterUser", mock.Anything, mock.MatchedBy(func(u user.User) bool {
+		return u.BirthDate == "1990-05-01"
+	})).Return(types.ID(1), nil)
+
+	_, err := service.RegisterUser(context.Background(), regReq)
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+
+	regReq.BirthDate = "1369/02/32"
+	_, err = service.RegisterUser(context.Background(), regReq)
+	assert.Error(t, err)
+}
+
+func TestGetAllUsers_Calendar(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := user.NewService(mockRepo, user.NewValidator(mockRepo), nil, nil, user.Config{})
+	mockRepo.On("GetAllUsers", mock.Anything).Return([]user.User{{ID: 1, BirthDate: "1990-05-01"}, {ID: 2}}, nil)
+
+	res, err := service.GetAllUsers(context.Background(), user.GetAllUsersRequest{Calendar: "jalali"})
+	require.NoError(t, err)
+	assert.Equal(t, "1369-02-11", res.Users[0].BirthDate)
+	assert.Empty(t, res.Users[1].BirthDate)
+
+	res, err = service.GetAllUsers(context.Background(), user.GetAllUsersRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "1990-05-01", res.Users[0].BirthDate)
+
+	_, err = service.GetAllUsers(context.Background(), user.GetAllUsersRequest{Calendar: "lunar"})
+	assert.Error(t, err)
+}
+
 func TestRegisterUser_UserAlreadyExists(t *testing.T) {
 	mockRepo := new(MockRepository)
 	userConf := user.Config{}
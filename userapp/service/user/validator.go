@@ -11,6 +11,7 @@ import (
 	"unicode"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	dateparser "github.com/gocastsian/roham/pkg/date_parser"
 	errmsg "github.com/gocastsian/roham/pkg/err_msg"
 	"github.com/gocastsian/roham/pkg/validator"
 )
@@ -150,6 +151,10 @@ func (v Validator) ValidateRegistration(registerReq RegisterRequest) error {
 	passwordErr := v.ValidatePassword(registerReq.Password)
 
 	ConfirmPasswordErr := v.ValidateConfirmPassword(registerReq.ConfirmPassword, registerReq.Password)
+	var birthDateErr error
+	if registerReq.BirthDate != "" {
+		birthDateErr = v.ValidateBirthDate(registerReq.BirthDate, registerReq.Calendar)
+	}
 
 	errorsMap := make(map[string]interface{})
 
@@ -171,7 +176,11 @@ func (v Validator) ValidateRegistration(registerReq RegisterRequest) error {
 	if emailErr != nil {
 		errorsMap["email"] = emailErr.Error()
 	}
-	if firstnameErr != nil || lastnameErr != nil || emailErr != nil || usernameErr != nil || passwordErr != nil || ConfirmPasswordErr != nil {
+	if birthDateErr != nil {
+		errorsMap["birthDate"] = birthDateErr.Error()
+	}
+	if firstnameErr != nil || lastnameErr != nil || emailErr != nil || usernameErr != nil || passwordErr != nil || ConfirmPasswordErr != nil ||
+		birthDateErr != nil {
 		return errmsg.ErrorResponse{
 			Message:         "user validation has error",
 			Errors:          errorsMap,
@@ -181,9 +190,18 @@ func (v Validator) ValidateRegistration(registerReq RegisterRequest) error {
 	return nil
 }
 
-func (v Validator) ValidateBirthDate(birthDate string) error {
-	err := validation.Date("2006-01-02").Error(ErrUnvalidDate).Validate(birthDate)
-	return err
+// ValidateBirthDate checks an optional birth date written as YYYY-MM-DD in calendar
+func (v Validator) ValidateBirthDate(birthDate string, calendar string) error {
+	return validation.Validate(birthDate, validation.By(func(value interface{}) error {
+		parsedCalendar, err := dateparser.ParseCalendar(calendar)
+		if err != nil {
+			return err
+		}
+		if _, err := dateparser.ParseDateIn(value.(string), parsedCalendar); err != nil {
+			return errors.New(ErrUnvalidDate)
+		}
+		return nil
+	}))
 }
 
 func (v Validator) ValidateAvatar(avatar Avatar, size int64, formats []string) error {
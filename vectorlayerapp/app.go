@@ -2,8 +2,14 @@ package vectorlayerapp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gocastsian/roham/adapter/temporal"
+	pkgevent "github.com/gocastsian/roham/pkg/event"
+	"github.com/gocastsian/roham/pkg/opa"
+	"github.com/gocastsian/roham/pkg/redis"
+	"github.com/gocastsian/roham/vectorlayerapp/delivery/event"
+	inprocessscheduler "github.com/gocastsian/roham/vectorlayerapp/job/inprocess"
 	temporalscheduler "github.com/gocastsian/roham/vectorlayerapp/job/temporal"
 	"github.com/gocastsian/roham/vectorlayerapp/queryclient"
 	"github.com/gocastsian/roham/vectorlayerapp/service"
@@ -22,37 +28,65 @@ import (
 )
 
 type Application struct {
-	layerRepo  service.Repository
-	layerSrv   service.Service
-	Handler    http.Handler
-	Scheduler  temporalscheduler.Scheduler
-	Workflow   service.Workflow
-	HTTPServer http.Server
-	Temporal   temporal.Adapter
-	Config     Config
-	Logger     *slog.Logger
+	layerRepo     service.Repository
+	layerSrv      service.Service
+	Handler       http.Handler
+	EventHandler  event.Handler
+	EventConsumer pkgevent.Consumer
+	Scheduler     service.Scheduler
+	Workflow      service.Workflow
+	HTTPServer    http.Server
+	Temporal      temporal.Adapter
+	InProcess     inprocessscheduler.Scheduler
+	Config        Config
+	Logger        *slog.Logger
 }
 
 func Setup(ctx context.Context, config Config, postgresConn *postgresql.Database, logger *slog.Logger) Application {
-	temporalAdp := temporal.New(config.Temporal)
-	scheduler := temporalscheduler.New(temporalAdp)
-	LayerRepo := repository.NewLayerRepo(postgresConn.DB)
+	var (
+		temporalAdp temporal.Adapter
+		inProcess   inprocessscheduler.Scheduler
+		scheduler   service.Scheduler
+	)
+	switch config.Scheduler.Type {
+	case SchedulerInProcess:
+		inProcess = inprocessscheduler.New(postgresConn.DB, config.Scheduler.InProcess, logger)
+		scheduler = inProcess
+	default:
+		temporalAdp = temporal.New(config.Temporal)
+		scheduler = temporalscheduler.New(temporalAdp)
+	}
+
+	redisClient := redis.Connect(config.Redis)
+	LayerRepo := repository.NewLayerRepo(config.Repository, postgresConn.DB,
+		redis.NewRedisCache(redisClient, logger, config.Cache), redis.NewRedisCache(redisClient, logger, config.TileCache))
 	LayerValidator := service.NewValidator(LayerRepo)
-	queryClient := queryclient.New()
-	LayerSrv := service.NewService(LayerRepo, LayerValidator, scheduler, queryClient)
+	queryClient := queryclient.New(config.Filer)
+	opaEvaluator, err := opa.NewOPAEvaluator(config.LayerPolicy)
+	if err != nil {
+		panic(err)
+	}
+	LayerSrv := service.NewService(LayerRepo, LayerValidator, scheduler, queryClient, opaEvaluator, config.Layer)
 	Handler := http.NewHandler(LayerSrv, logger)
-	wf := service.New(LayerSrv)
+	wf := service.New(LayerSrv, logger)
+	if config.Scheduler.Type == SchedulerInProcess {
+		inProcess.Register("ImportLayerWorkflow", wf.ImportLayer)
+		inProcess.Register("ReprojectLayerWorkflow", wf.ReprojectLayer)
+	}
 
 	return Application{
-		layerRepo:  LayerRepo,
-		layerSrv:   LayerSrv,
-		Handler:    Handler,
-		HTTPServer: http.New(httpserver.New(config.HTTPServer), Handler, logger),
-		Temporal:   temporalAdp,
-		Scheduler:  scheduler,
-		Workflow:   wf,
-		Config:     config,
-		Logger:     logger,
+		layerRepo:     LayerRepo,
+		layerSrv:      LayerSrv,
+		Handler:       Handler,
+		EventHandler:  event.NewHandler(LayerSrv, logger),
+		EventConsumer: pkgevent.NewConsumer(redisClient, config.UploadEvents, logger),
+		HTTPServer:    http.New(httpserver.New(config.HTTPServer), Handler, logger),
+		Temporal:      temporalAdp,
+		Scheduler:     scheduler,
+		InProcess:     inProcess,
+		Workflow:      wf,
+		Config:        config,
+		Logger:        logger,
 	}
 }
 
@@ -63,7 +97,8 @@ func (app Application) Start() {
 	defer stop()
 
 	startServers(app, &wg)
-	startWorkers(app, &wg)
+	startWorkers(ctx, app, &wg)
+	startConsumers(ctx, app, &wg)
 
 	<-ctx.Done()
 	app.Logger.Info("Shutdown signal received...")
@@ -103,18 +138,38 @@ func startServers(app Application, wg *sync.WaitGroup) {
 	}()
 }
 
-func startWorkers(app Application, wg *sync.WaitGroup) {
+func startWorkers(ctx context.Context, app Application, wg *sync.WaitGroup) {
+	if app.Config.Scheduler.Type == SchedulerInProcess {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.Logger.Info("in-process scheduler started")
+			app.InProcess.Run(ctx)
+			app.Logger.Info("in-process scheduler stopped")
+		}()
+		return
+	}
+
 	wg.Add(1)
 	go func() {
 		newWorker := temporal.NewWorker(app.Temporal.GetClient(), "import_layer", worker.Options{})
 
 		newWorker.RegisterWorkflow(app.Workflow.ImportLayerWorkflow)
+		newWorker.RegisterWorkflow(app.Workflow.ReprojectLayerWorkflow)
 		newWorker.RegisterActivity(app.layerSrv.ImportLayer)
 		newWorker.RegisterActivity(app.layerSrv.UpdateJob)
+		newWorker.RegisterActivity(app.layerSrv.AcquireImportSlot)
 		newWorker.RegisterActivity(app.layerSrv.SendNotification)
 		newWorker.RegisterActivity(app.layerSrv.CreateLayer)
 		newWorker.RegisterActivity(app.layerSrv.DropLayerTable)
 		newWorker.RegisterActivity(app.layerSrv.CreateStyle)
+		newWorker.RegisterActivity(app.layerSrv.DeleteStyle)
+		newWorker.RegisterActivity(app.layerSrv.DeleteLayerRecord)
+		newWorker.RegisterActivity(app.layerSrv.ComputeLayerStatistics)
+		newWorker.RegisterActivity(app.layerSrv.ValidateGeometries)
+		newWorker.RegisterActivity(app.layerSrv.ConvertJalaliDates)
+		newWorker.RegisterActivity(app.layerSrv.GeneralizeLayer)
+		newWorker.RegisterActivity(app.layerSrv.ReprojectLayer)
 
 		if err := newWorker.Start(); err != nil {
 			log.Fatalf("error in running newWorker with err: %v", err)
@@ -122,6 +177,18 @@ func startWorkers(app Application, wg *sync.WaitGroup) {
 	}()
 }
 
+func startConsumers(ctx context.Context, app Application, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		app.Logger.Info("map layer upload consumer started")
+		err := app.EventConsumer.Consume(ctx, pkgevent.MapLayerUploadedStream, app.EventHandler.MapLayerUploaded)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			app.Logger.Error("map layer upload consumer stopped", slog.Any("err", err))
+		}
+	}()
+}
+
 func (app Application) shutdownServers(ctx context.Context) bool {
 	shutdownDone := make(chan struct{})
 
@@ -161,5 +228,8 @@ func (app Application) shutdownHTTPServer(wg *sync.WaitGroup) {
 
 func (app Application) shutdownTemporal(wg *sync.WaitGroup) {
 	defer wg.Done()
+	if app.Config.Scheduler.Type == SchedulerInProcess {
+		return
+	}
 	app.Temporal.Shutdown()
 }
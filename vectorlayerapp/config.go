@@ -2,16 +2,43 @@ package vectorlayerapp
 
 import (
 	"github.com/gocastsian/roham/adapter/temporal"
+	"github.com/gocastsian/roham/pkg/event"
 	httpserver "github.com/gocastsian/roham/pkg/http_server"
 	"github.com/gocastsian/roham/pkg/logger"
+	"github.com/gocastsian/roham/pkg/opa"
 	"github.com/gocastsian/roham/pkg/postgresql"
+	"github.com/gocastsian/roham/pkg/redis"
+	inprocessscheduler "github.com/gocastsian/roham/vectorlayerapp/job/inprocess"
+	"github.com/gocastsian/roham/vectorlayerapp/queryclient"
+	"github.com/gocastsian/roham/vectorlayerapp/repository"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
 	"time"
 )
 
 type Config struct {
 	HTTPServer           httpserver.Config `koanf:"http_server"`
 	PostgresDB           postgresql.Config `koanf:"postgres_db"`
+	Repository           repository.Config `koanf:"repository"`
+	Cache                redis.CacheConfig `koanf:"cache_config"`
+	TileCache            redis.CacheConfig `koanf:"tile_cache_config"`
 	Logger               logger.Config     `koanf:"logger"`
 	TotalShutdownTimeout time.Duration     `koanf:"total_shutdown_timeout"`
 	Temporal             temporal.Config
+	Scheduler            SchedulerConfig      `koanf:"scheduler"`
+	Layer                service.Config       `koanf:"layer"`
+	Filer                queryclient.Config   `koanf:"filer"`
+	Redis                redis.Config         `koanf:"redis"`
+	UploadEvents         event.ConsumerConfig `koanf:"upload_events"`
+	LayerPolicy          opa.Config           `koanf:"layer_policy"`
+}
+
+const (
+	SchedulerTemporal  = "temporal"
+	SchedulerInProcess = "inprocess"
+)
+
+type SchedulerConfig struct {
+	// Type is either temporal or inprocess, the in-process scheduler needs nothing but the postgres database
+	Type      string                    `koanf:"type"`
+	InProcess inprocessscheduler.Config `koanf:"inprocess"`
 }
@@ -0,0 +1,77 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gocastsian/roham/pkg/event"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+)
+
+// tus metadata keys a client can set on a map-layer upload to control its import
+const (
+	metaLayerName       = "layer-name"
+	metaInvalidGeometry = "invalid-geometry"
+	metaLayers          = "layers"
+	metaOnDuplicate     = "on-duplicate"
+	metaVisibility      = "visibility"
+	metaTimeStart       = "time-start"
+	metaTimeEnd         = "time-end"
+	metaJalaliDates     = "jalali-dates"
+	metaPriority        = "priority"
+)
+
+type Handler struct {
+	LayerService service.Service
+	Logger       *slog.Logger
+}
+
+func NewHandler(layerService service.Service, logger *slog.Logger) Handler {
+	return Handler{
+		LayerService: layerService,
+		Logger:       logger,
+	}
+}
+
+// MapLayerUploaded schedules the import of a completed map-layer upload. The filer delivers an event at least once,
+// the file key is used as idempotency key so a redelivered event returns the job of the first delivery
+func (h Handler) MapLayerUploaded(ctx context.Context, payload []byte) error {
+	var e event.MapLayerUploaded
+	if err := json.Unmarshal(payload, &e); err != nil {
+		// a malformed event will never succeed, acknowledge it instead of redelivering it forever
+		h.Logger.Error("layer_MapLayerUploaded invalid payload", slog.Any("err", err))
+		return nil
+	}
+
+	res, err := h.LayerService.ScheduleImportLayer(ctx, service.ScheduleImportLayerRequest{
+		FileKey:        e.FileKey,
+		GeometryMode:   service.GeometryMode(e.MetaData[metaInvalidGeometry]),
+		Layers:         strings.FieldsFunc(e.MetaData[metaLayers], func(r rune) bool { return r == ',' || r == ' ' }),
+		LayerName:      e.MetaData[metaLayerName],
+		UserID:         e.UploaderID,
+		IdempotencyKey: "upload:" + e.FileKey,
+		OnDuplicate:    service.DuplicateMode(e.MetaData[metaOnDuplicate]),
+		Visibility:     service.Visibility(e.MetaData[metaVisibility]),
+		Organization:   e.Organization,
+		TimeStart:      e.MetaData[metaTimeStart],
+		TimeEnd:        e.MetaData[metaTimeEnd],
+		JalaliDates:    strings.FieldsFunc(e.MetaData[metaJalaliDates], func(r rune) bool { return r == ',' || r == ' ' }),
+		Priority:       service.Priority(e.MetaData[metaPriority]),
+	})
+	if err != nil {
+		var vErr validation.Errors
+		if errors.As(err, &vErr) {
+			h.Logger.Error("layer_MapLayerUploaded rejected", slog.String("file_key", e.FileKey), slog.Any("err", err))
+			return nil
+		}
+		return fmt.Errorf("failed to schedule import of %s: %w", e.FileKey, err)
+	}
+
+	h.Logger.Info("layer import scheduled from upload", slog.String("file_key", e.FileKey), slog.String("workflow_id", res.WorkflowId))
+	return nil
+}
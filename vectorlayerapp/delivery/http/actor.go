@@ -0,0 +1,31 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/labstack/echo/v4"
+)
+
+var errMissingUser = errors.New("unauthorized")
+
+// actorFromRequest reads the user the gateway authenticated from the base64 encoded X-User-Info header
+func actorFromRequest(c echo.Context) (service.Actor, error) {
+	header := c.Request().Header.Get("X-User-Info")
+	if header == "" {
+		return service.Actor{}, errMissingUser
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return service.Actor{}, errMissingUser
+	}
+
+	var actor service.Actor
+	if err := json.Unmarshal(decoded, &actor); err != nil || actor.ID == 0 {
+		return service.Actor{}, errMissingUser
+	}
+	return actor, nil
+}
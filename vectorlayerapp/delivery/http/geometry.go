@@ -0,0 +1,38 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/labstack/echo/v4"
+)
+
+// TransformGeometry converts a GeoJSON geometry between two EPSG coordinate reference systems, it needs no login
+func (h Handler) TransformGeometry(c echo.Context) error {
+	var req service.TransformGeometryRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	res, err := h.LayerService.TransformGeometry(c.Request().Context(), req)
+	if err != nil {
+		return h.layerError(c, "layer_TransformGeometry", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// MeasureGeometry returns the area, perimeter or length and the centroid of a GeoJSON geometry, it needs no login
+func (h Handler) MeasureGeometry(c echo.Context) error {
+	var req service.MeasureGeometryRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	res, err := h.LayerService.MeasureGeometry(c.Request().Context(), req)
+	if err != nil {
+		return h.layerError(c, "layer_MeasureGeometry", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
@@ -1,10 +1,18 @@
 package http
 
 import (
+	"database/sql"
+	"errors"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gocastsian/roham/pkg/cql2"
+	dateparser "github.com/gocastsian/roham/pkg/date_parser"
+	"github.com/gocastsian/roham/types"
 	"github.com/gocastsian/roham/vectorlayerapp/service"
 	"github.com/labstack/echo/v4"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type Handler struct {
@@ -31,6 +39,11 @@ func (h Handler) healthCheck(c echo.Context) error {
 }
 
 func (h Handler) ImportLayer(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
 	fileKey := c.QueryParam("fileKey")
 	if fileKey == "" {
 		return c.JSON(http.StatusBadRequest, echo.Map{
@@ -38,7 +51,22 @@ func (h Handler) ImportLayer(c echo.Context) error {
 		})
 	}
 
-	res, err := h.LayerService.ScheduleImportLayer(c.Request().Context(), fileKey)
+	res, err := h.LayerService.ScheduleImportLayer(c.Request().Context(), service.ScheduleImportLayerRequest{
+		FileKey:      fileKey,
+		GeometryMode: service.GeometryMode(c.QueryParam("invalidGeometry")),
+		Layers:       splitList(c.QueryParam("layers")),
+		OnDuplicate:  service.DuplicateMode(c.QueryParam("onDuplicate")),
+		UserID:       actor.ID,
+		Visibility:   service.Visibility(c.QueryParam("visibility")),
+		Organization: actor.Organization,
+		TimeStart:    c.QueryParam("timeStart"),
+		TimeEnd:      c.QueryParam("timeEnd"),
+		JalaliDates:  splitList(c.QueryParam("jalaliDates")),
+		Priority:     service.Priority(c.QueryParam("priority")),
+	})
+	if errors.Is(err, service.ErrQueueFull) {
+		return c.JSON(http.StatusTooManyRequests, echo.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
 	}
@@ -48,3 +76,648 @@ func (h Handler) ImportLayer(c echo.Context) error {
 	})
 
 }
+
+// GetJob reports the status of an import of the actor, a waiting one with its position in the queue
+func (h Handler) GetJob(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	res, err := h.LayerService.GetJob(c.Request().Context(), service.GetJobRequest{
+		Actor:      actor,
+		WorkflowId: c.Param("workflowId"),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "job not found"})
+	}
+	if err != nil {
+		return h.layerError(c, "layer_GetJob", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h Handler) GetLayer(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+
+	res, err := h.LayerService.GetLayer(c.Request().Context(), service.GetLayerRequest{
+		Actor: actor,
+		ID:    types.ID(layerID),
+	})
+	if err != nil {
+		return h.layerError(c, "layer_GetLayer", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h Handler) ShareLayer(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+
+	var req service.ShareLayerRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	req.Actor = actor
+	req.LayerID = types.ID(layerID)
+
+	res, err := h.LayerService.ShareLayer(c.Request().Context(), req)
+	if err != nil {
+		return h.layerError(c, "layer_ShareLayer", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h Handler) RevokeLayerShare(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid user id",
+		})
+	}
+
+	err = h.LayerService.RevokeLayerShare(c.Request().Context(), service.RevokeLayerShareRequest{
+		Actor:   actor,
+		LayerID: types.ID(layerID),
+		UserID:  types.ID(userID),
+	})
+	if err != nil {
+		return h.layerError(c, "layer_RevokeLayerShare", err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "success"})
+}
+
+func (h Handler) GetLayerRowRules(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+
+	res, err := h.LayerService.GetLayerRowRules(c.Request().Context(), service.GetLayerRowRulesRequest{
+		Actor:   actor,
+		LayerID: types.ID(layerID),
+	})
+	if err != nil {
+		return h.layerError(c, "layer_GetLayerRowRules", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// SetLayerRowRules replaces the row rules of a layer, it needs admin permission on the layer
+func (h Handler) SetLayerRowRules(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+
+	var req service.SetLayerRowRulesRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	req.Actor = actor
+	req.LayerID = types.ID(layerID)
+
+	res, err := h.LayerService.SetLayerRowRules(c.Request().Context(), req)
+	if err != nil {
+		return h.layerError(c, "layer_SetLayerRowRules", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h Handler) UpdateLayerAccess(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+
+	var req service.UpdateLayerAccessRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	req.Actor = actor
+	req.LayerID = types.ID(layerID)
+
+	res, err := h.LayerService.UpdateLayerAccess(c.Request().Context(), req)
+	if err != nil {
+		return h.layerError(c, "layer_UpdateLayerAccess", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h Handler) UpdateLayerMetadata(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+
+	var metadata service.LayerMetadata
+	if err := c.Bind(&metadata); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	res, err := h.LayerService.UpdateLayerMetadata(c.Request().Context(), service.UpdateLayerMetadataRequest{
+		Actor:    actor,
+		LayerID:  types.ID(layerID),
+		Metadata: metadata,
+	})
+	if err != nil {
+		return h.layerError(c, "layer_UpdateLayerMetadata", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h Handler) ExportLayerMetadata(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+
+	res, err := h.LayerService.ExportLayerMetadata(c.Request().Context(), service.ExportLayerMetadataRequest{
+		Actor:   actor,
+		LayerID: types.ID(layerID),
+		Format:  service.MetadataFormat(c.QueryParam("format")),
+	})
+	if err != nil {
+		return h.layerError(c, "layer_ExportLayerMetadata", err)
+	}
+
+	return c.Blob(http.StatusOK, res.ContentType, res.Document)
+}
+
+// SearchCatalog is open to anonymous users, they only find public layers
+func (h Handler) SearchCatalog(c echo.Context) error {
+	actor, _ := actorFromRequest(c)
+
+	req := service.SearchCatalogRequest{
+		Actor:    actor,
+		Query:    c.QueryParam("q"),
+		Keywords: splitList(c.QueryParam("keywords")),
+	}
+
+	if bbox := c.QueryParam("bbox"); bbox != "" {
+		extent, err := parseBBox(bbox)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		req.BBox = &extent
+	}
+	for param, target := range map[string]*int{"page": &req.Page, "pageSize": &req.PageSize} {
+		if value := c.QueryParam(param); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid " + param})
+			}
+			*target = n
+		}
+	}
+
+	res, err := h.LayerService.SearchCatalog(c.Request().Context(), req)
+	if err != nil {
+		return h.layerError(c, "layer_SearchCatalog", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// Lookup is open to anonymous users like the catalog, a layer they can't read is answered with 403
+func (h Handler) Lookup(c echo.Context) error {
+	actor, _ := actorFromRequest(c)
+
+	lat, latErr := strconv.ParseFloat(c.QueryParam("lat"), 64)
+	lon, lonErr := strconv.ParseFloat(c.QueryParam("lon"), 64)
+	if latErr != nil || lonErr != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "lat and lon are required"})
+	}
+
+	req := service.LookupRequest{
+		Actor:  actor,
+		Point:  service.LookupPoint{Lat: lat, Lon: lon},
+		Layers: splitList(c.QueryParam("layers")),
+	}
+	if value := c.QueryParam("tolerance"); value != "" {
+		tolerance, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid tolerance"})
+		}
+		req.Tolerance = &tolerance
+	}
+	datetime, err := parseDatetime(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	req.Datetime = datetime
+	filter, err := parseFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	req.Filter = filter
+
+	res, err := h.LayerService.Lookup(c.Request().Context(), req)
+	if err != nil {
+		return h.layerError(c, "layer_Lookup", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// Nearest serves the k features of a layer closest to lat and lon as GeoJSON with their distance and bearing,
+// maxDistance in meters bounds the search. Anonymous users get public layers only
+func (h Handler) Nearest(c echo.Context) error {
+	actor, _ := actorFromRequest(c)
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+
+	lat, latErr := strconv.ParseFloat(c.QueryParam("lat"), 64)
+	lon, lonErr := strconv.ParseFloat(c.QueryParam("lon"), 64)
+	if latErr != nil || lonErr != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "lat and lon are required"})
+	}
+
+	req := service.NearestRequest{
+		Actor:   actor,
+		LayerID: types.ID(layerID),
+		Point:   service.LookupPoint{Lat: lat, Lon: lon},
+	}
+	if value := c.QueryParam("k"); value != "" {
+		if req.K, err = strconv.Atoi(value); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid k"})
+		}
+	}
+	if value := c.QueryParam("maxDistance"); value != "" {
+		maxDistance, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid maxDistance"})
+		}
+		req.MaxDistance = &maxDistance
+	}
+	if req.Datetime, err = parseDatetime(c); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	if req.Filter, err = parseFilter(c); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	res, err := h.LayerService.Nearest(c.Request().Context(), req)
+	if err != nil {
+		return h.layerError(c, "layer_Nearest", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// GetTile serves a Mapbox vector tile, y may carry a .mvt or .pbf extension. Anonymous users get public layers only
+func (h Handler) GetTile(c echo.Context) error {
+	actor, _ := actorFromRequest(c)
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+
+	var coordinate [3]int
+	for i, param := range []string{c.Param("z"), c.Param("x"), strings.TrimSuffix(strings.TrimSuffix(c.Param("y"), ".mvt"), ".pbf")} {
+		if coordinate[i], err = strconv.Atoi(param); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid tile coordinate"})
+		}
+	}
+
+	datetime, err := parseDatetime(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	filter, err := parseFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	res, err := h.LayerService.GetTile(c.Request().Context(), service.GetTileRequest{
+		Actor:      actor,
+		LayerID:    types.ID(layerID),
+		Tile:       service.TileCoordinate{Z: coordinate[0], X: coordinate[1], Y: coordinate[2]},
+		Attributes: splitList(c.QueryParam("attributes")),
+		Datetime:   datetime,
+		Filter:     filter,
+	})
+	if err != nil {
+		return h.layerError(c, "layer_GetTile", err)
+	}
+
+	if len(res.Data) == 0 {
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.Blob(http.StatusOK, "application/vnd.mapbox-vector-tile", res.Data)
+}
+
+// AggregateLayer bins the features of a layer into a hex or square grid over bbox and serves the cells as GeoJSON,
+// or as a vector tile whose extent is bbox when f is mvt. Anonymous users get public layers only
+func (h Handler) AggregateLayer(c echo.Context) error {
+	actor, _ := actorFromRequest(c)
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+
+	req := service.AggregateLayerRequest{
+		Actor:     actor,
+		LayerID:   types.ID(layerID),
+		Grid:      service.GridShape(c.QueryParam("grid")),
+		Attribute: c.QueryParam("attribute"),
+		Format:    service.AggregateFormat(c.QueryParam("f")),
+	}
+	if req.BBox, err = parseBBox(c.QueryParam("bbox")); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	if req.Resolution, err = strconv.Atoi(c.QueryParam("resolution")); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid resolution"})
+	}
+	if req.Datetime, err = parseDatetime(c); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	if req.Filter, err = parseFilter(c); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	res, err := h.LayerService.AggregateLayer(c.Request().Context(), req)
+	if err != nil {
+		return h.layerError(c, "layer_AggregateLayer", err)
+	}
+
+	if req.Format == service.AggregateFormatMVT {
+		if len(res.Data) == 0 {
+			return c.NoContent(http.StatusNoContent)
+		}
+		return c.Blob(http.StatusOK, "application/vnd.mapbox-vector-tile", res.Data)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// QueryFeatures serves the features of a layer as GeoJSON, filtered with a CQL2 filter and datetime and paged with
+// limit and offset. Anonymous users get public layers only
+func (h Handler) QueryFeatures(c echo.Context) error {
+	actor, _ := actorFromRequest(c)
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+
+	req := service.QueryFeaturesRequest{
+		Actor:   actor,
+		LayerID: types.ID(layerID),
+	}
+	for param, target := range map[string]*int{"limit": &req.Limit, "offset": &req.Offset} {
+		if value := c.QueryParam(param); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid " + param})
+			}
+			*target = n
+		}
+	}
+	if req.Datetime, err = parseDatetime(c); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	if req.Filter, err = parseFilter(c); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	res, err := h.LayerService.QueryFeatures(c.Request().Context(), req)
+	if err != nil {
+		return h.layerError(c, "layer_QueryFeatures", err)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/geo+json")
+	return c.JSON(http.StatusOK, res)
+}
+
+// ReprojectLayer schedules a job transforming a layer to target_crs, in place or into a new layer
+func (h Handler) ReprojectLayer(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+
+	var req service.ScheduleReprojectLayerRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	req.Actor = actor
+	req.LayerID = types.ID(layerID)
+
+	res, err := h.LayerService.ScheduleReprojectLayer(c.Request().Context(), req)
+	if err != nil {
+		return h.layerError(c, "layer_ReprojectLayer", err)
+	}
+	return c.JSON(http.StatusOK, echo.Map{
+		"message":    "success",
+		"workflowId": res.WorkflowId,
+	})
+}
+
+func (h Handler) DeleteLayer(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	layerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid layer id",
+		})
+	}
+
+	err = h.LayerService.DeleteLayer(c.Request().Context(), service.DeleteLayerRequest{
+		Actor:   actor,
+		LayerID: types.ID(layerID),
+	})
+	if err != nil {
+		return h.layerError(c, "layer_DeleteLayer", err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "success"})
+}
+
+// layerError maps the errors of layer lookups and permission checks to a response
+func (h Handler) layerError(c echo.Context, op string, err error) error {
+	var vErr validation.Errors
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "layer not found"})
+	case errors.Is(err, service.ErrForbidden):
+		return c.JSON(http.StatusForbidden, echo.Map{"error": err.Error()})
+	case errors.As(err, &vErr):
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	h.Logger.Error(op, slog.Any("err", err))
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+}
+
+func (h Handler) PreviewImport(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	fileKey := c.QueryParam("fileKey")
+	if fileKey == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "file key is required",
+		})
+	}
+
+	res, err := h.LayerService.PreviewImport(c.Request().Context(), service.PreviewImportRequest{
+		FileKey: fileKey,
+		Actor:   actor,
+	})
+	if errors.Is(err, service.ErrForbidden) {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": err.Error()})
+	}
+	if err != nil {
+		h.Logger.Error("layer_PreviewImport", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// parseBBox parses a minx,miny,maxx,maxy bounding box in EPSG:4326
+func parseBBox(param string) (service.Extent, error) {
+	parts := strings.Split(param, ",")
+	if len(parts) != 4 {
+		return service.Extent{}, errors.New("bbox must be minx,miny,maxx,maxy")
+	}
+
+	values := make([]float64, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return service.Extent{}, errors.New("bbox must be minx,miny,maxx,maxy")
+		}
+		values[i] = value
+	}
+
+	return service.Extent{MinX: values[0], MinY: values[1], MaxX: values[2], MaxY: values[3]}, nil
+}
+
+// splitList parses a comma separated query parameter, an empty parameter gives nil
+func splitList(param string) []string {
+	if param == "" {
+		return nil
+	}
+
+	items := make([]string, 0)
+	for _, item := range strings.Split(param, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseDatetime reads the datetime query parameter, calendar=jalali lets clients write its dates in the Jalali calendar
+func parseDatetime(c echo.Context) (*service.TimeFilter, error) {
+	calendar, err := dateparser.ParseCalendar(c.QueryParam("calendar"))
+	if err != nil {
+		return nil, err
+	}
+	return service.ParseDatetimeIn(c.QueryParam("datetime"), calendar)
+}
+
+// parseFilter reads the CQL2 filter query parameter, filter-lang picks its encoding
+func parseFilter(c echo.Context) (cql2.Expression, error) {
+	return service.ParseFilter(c.QueryParam("filter"), c.QueryParam("filter-lang"))
+}
@@ -0,0 +1,220 @@
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gocastsian/roham/types"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/labstack/echo/v4"
+)
+
+func (h Handler) CreateMapProject(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	var req service.SaveMapProjectRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	req.Actor = actor
+
+	res, err := h.LayerService.CreateMapProject(c.Request().Context(), req)
+	if err != nil {
+		return h.mapProjectError(c, "layer_CreateMapProject", err)
+	}
+
+	return c.JSON(http.StatusCreated, res)
+}
+
+func (h Handler) UpdateMapProject(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	mapID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid map id",
+		})
+	}
+
+	var req service.SaveMapProjectRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	req.Actor = actor
+	req.ID = types.ID(mapID)
+
+	res, err := h.LayerService.UpdateMapProject(c.Request().Context(), req)
+	if err != nil {
+		return h.mapProjectError(c, "layer_UpdateMapProject", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// GetMapProject is open to anonymous users, they only see public maps and the public layers on them
+func (h Handler) GetMapProject(c echo.Context) error {
+	actor, _ := actorFromRequest(c)
+
+	mapID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid map id",
+		})
+	}
+
+	res, err := h.LayerService.GetMapProject(c.Request().Context(), service.GetMapProjectRequest{
+		Actor: actor,
+		ID:    types.ID(mapID),
+	})
+	if err != nil {
+		return h.mapProjectError(c, "layer_GetMapProject", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h Handler) ListMapProjects(c echo.Context) error {
+	actor, _ := actorFromRequest(c)
+
+	req := service.ListMapProjectsRequest{Actor: actor}
+	for param, target := range map[string]*int{"page": &req.Page, "pageSize": &req.PageSize} {
+		if value := c.QueryParam(param); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid " + param})
+			}
+			*target = n
+		}
+	}
+
+	res, err := h.LayerService.ListMapProjects(c.Request().Context(), req)
+	if err != nil {
+		return h.mapProjectError(c, "layer_ListMapProjects", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h Handler) DeleteMapProject(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	mapID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid map id",
+		})
+	}
+
+	err = h.LayerService.DeleteMapProject(c.Request().Context(), service.DeleteMapProjectRequest{
+		Actor: actor,
+		ID:    types.ID(mapID),
+	})
+	if err != nil {
+		return h.mapProjectError(c, "layer_DeleteMapProject", err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "success"})
+}
+
+func (h Handler) ShareMapProject(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	mapID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid map id",
+		})
+	}
+
+	var req service.ShareMapProjectRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	req.Actor = actor
+	req.MapID = types.ID(mapID)
+
+	res, err := h.LayerService.ShareMapProject(c.Request().Context(), req)
+	if err != nil {
+		return h.mapProjectError(c, "layer_ShareMapProject", err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h Handler) RevokeMapProjectShare(c echo.Context) error {
+	actor, err := actorFromRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+	}
+
+	mapID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid map id",
+		})
+	}
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid user id",
+		})
+	}
+
+	err = h.LayerService.RevokeMapProjectShare(c.Request().Context(), service.RevokeMapProjectShareRequest{
+		Actor:  actor,
+		MapID:  types.ID(mapID),
+		UserID: types.ID(userID),
+	})
+	if err != nil {
+		return h.mapProjectError(c, "layer_RevokeMapProjectShare", err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "success"})
+}
+
+// ExportMapProject downloads a map as a MapLibre style or a QGIS project, anonymous users can export public maps
+func (h Handler) ExportMapProject(c echo.Context) error {
+	actor, _ := actorFromRequest(c)
+
+	mapID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "invalid map id",
+		})
+	}
+
+	res, err := h.LayerService.ExportMapProject(c.Request().Context(), service.ExportMapProjectRequest{
+		Actor:  actor,
+		ID:     types.ID(mapID),
+		Format: service.MapExportFormat(c.QueryParam("format")),
+	})
+	if err != nil {
+		return h.mapProjectError(c, "layer_ExportMapProject", err)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", res.FileName))
+	return c.Blob(http.StatusOK, res.ContentType, res.Document)
+}
+
+// mapProjectError is layerError for map endpoints, a missing row there is the map itself
+func (h Handler) mapProjectError(c echo.Context, op string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "map not found"})
+	}
+	return h.layerError(c, op, err)
+}
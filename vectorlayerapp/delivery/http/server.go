@@ -3,6 +3,8 @@ package http
 import (
 	"context"
 	httpserver "github.com/gocastsian/roham/pkg/http_server"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log/slog"
 )
 
@@ -33,9 +35,46 @@ func (s Server) Stop(ctx context.Context) error {
 }
 
 func (s Server) RegisterRoutes() {
+	s.HTTPServer.Router.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
 	v1 := s.HTTPServer.Router.Group("/v1")
 	v1.GET("/health-check", s.Handler.healthCheck)
 
 	layerGroup := v1.Group("/layer")
 	layerGroup.GET("/import", s.Handler.ImportLayer)
+	layerGroup.POST("/import/preview", s.Handler.PreviewImport)
+	layerGroup.GET("/:id", s.Handler.GetLayer)
+	layerGroup.DELETE("/:id", s.Handler.DeleteLayer)
+	layerGroup.GET("/:id/tiles/:z/:x/:y", s.Handler.GetTile)
+	layerGroup.GET("/:id/items", s.Handler.QueryFeatures)
+	layerGroup.GET("/:id/aggregate", s.Handler.AggregateLayer)
+	layerGroup.GET("/:id/nearest", s.Handler.Nearest)
+	layerGroup.POST("/:id/reproject", s.Handler.ReprojectLayer)
+	layerGroup.PATCH("/:id/access", s.Handler.UpdateLayerAccess)
+	layerGroup.PUT("/:id/shares", s.Handler.ShareLayer)
+	layerGroup.DELETE("/:id/shares/:userId", s.Handler.RevokeLayerShare)
+	layerGroup.GET("/:id/row-rules", s.Handler.GetLayerRowRules)
+	layerGroup.PUT("/:id/row-rules", s.Handler.SetLayerRowRules)
+	layerGroup.GET("/:id/metadata", s.Handler.ExportLayerMetadata)
+	layerGroup.PUT("/:id/metadata", s.Handler.UpdateLayerMetadata)
+
+	v1.GET("/lookup", s.Handler.Lookup)
+	v1.GET("/jobs/:workflowId", s.Handler.GetJob)
+
+	catalogGroup := v1.Group("/catalog")
+	catalogGroup.GET("/search", s.Handler.SearchCatalog)
+
+	geometryGroup := v1.Group("/geometry")
+	geometryGroup.POST("/transform", s.Handler.TransformGeometry)
+	geometryGroup.POST("/measure", s.Handler.MeasureGeometry)
+
+	mapGroup := v1.Group("/maps")
+	mapGroup.POST("", s.Handler.CreateMapProject)
+	mapGroup.GET("", s.Handler.ListMapProjects)
+	mapGroup.GET("/:id", s.Handler.GetMapProject)
+	mapGroup.PUT("/:id", s.Handler.UpdateMapProject)
+	mapGroup.DELETE("/:id", s.Handler.DeleteMapProject)
+	mapGroup.GET("/:id/export", s.Handler.ExportMapProject)
+	mapGroup.PUT("/:id/shares", s.Handler.ShareMapProject)
+	mapGroup.DELETE("/:id/shares/:userId", s.Handler.RevokeMapProjectShare)
 }
@@ -1,8 +1,23 @@
 package job
 
+import (
+	"fmt"
+	"time"
+)
+
 type Event struct {
 	WorkflowId   string
 	WorkflowName string
 	QueueName    string
 	Args         map[string]any
 }
+
+// DeferredError is returned by a workflow that has to wait before it can do anything, a scheduler runs the
+// job again After later without counting the run as an attempt
+type DeferredError struct {
+	After time.Duration
+}
+
+func (e DeferredError) Error() string {
+	return fmt.Sprintf("job deferred for %s", e.After)
+}
@@ -0,0 +1,257 @@
+package inprocessscheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gocastsian/roham/vectorlayerapp/job"
+)
+
+const (
+	statusPending = "pending"
+	statusRunning = "running"
+	statusDone    = "done"
+	statusFailed  = "failed"
+)
+
+type Config struct {
+	Concurrency  int           `koanf:"concurrency"`
+	PollInterval time.Duration `koanf:"poll_interval"`
+	// MaxAttempts bounds how many times a job is picked up, a job is only picked up again when the
+	// process running it died, failures inside a workflow are retried per step by the workflow itself
+	MaxAttempts   int           `koanf:"max_attempts"`
+	RetryInterval time.Duration `koanf:"retry_interval"`
+	// a running job whose heartbeat is older than LockTimeout is considered abandoned
+	LockTimeout time.Duration `koanf:"lock_timeout"`
+}
+
+type WorkflowFunc func(ctx context.Context, event job.Event) error
+
+// Scheduler persists jobs in the job_queue table and runs them in the current process,
+// it is the replacement of the temporal scheduler for installs without a Temporal cluster
+type Scheduler struct {
+	db        *sql.DB
+	config    Config
+	workflows map[string]WorkflowFunc
+	logger    *slog.Logger
+}
+
+func New(db *sql.DB, config Config, logger *slog.Logger) Scheduler {
+	return Scheduler{
+		db:        db,
+		config:    config,
+		workflows: make(map[string]WorkflowFunc),
+		logger:    logger,
+	}
+}
+
+// Register makes a workflow runnable by the name used in job.Event.WorkflowName
+func (s Scheduler) Register(name string, workflow WorkflowFunc) {
+	s.workflows[name] = workflow
+}
+
+func (s Scheduler) Add(ctx context.Context, event job.Event) (string, error) {
+	if _, ok := s.workflows[event.WorkflowName]; !ok {
+		return "", fmt.Errorf("workflow %s is not registered", event.WorkflowName)
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal job %s: %w", event.WorkflowId, err)
+	}
+
+	query := `INSERT INTO job_queue(workflow_id, workflow_name, payload) VALUES ($1, $2, $3)
+		ON CONFLICT (workflow_id) DO NOTHING;`
+	if _, err := s.db.ExecContext(ctx, query, event.WorkflowId, event.WorkflowName, payload); err != nil {
+		return "", fmt.Errorf("failed to enqueue job %s: %w", event.WorkflowId, err)
+	}
+
+	s.logger.Info("Queued workflow", "WorkflowID", event.WorkflowId, "WorkflowName", event.WorkflowName)
+	return event.WorkflowId, nil
+}
+
+// Run polls the queue with Config.Concurrency workers until ctx is cancelled,
+// jobs left running by a previous process are picked up again once their lock expires
+func (s Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < max(s.config.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.poll(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s Scheduler) poll(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// drain the queue before waiting for the next tick
+		for ctx.Err() == nil {
+			ran, err := s.runNext(ctx)
+			if err != nil {
+				s.logger.Error("failed to run queued job", slog.Any("err", err))
+				break
+			}
+			if !ran {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type queuedJob struct {
+	id       int64
+	event    job.Event
+	attempts int
+}
+
+func (s Scheduler) runNext(ctx context.Context) (bool, error) {
+	if err := s.failExhausted(ctx); err != nil {
+		return false, err
+	}
+
+	queued, err := s.claim(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	runErr := s.run(ctx, queued)
+	if ctx.Err() != nil {
+		// shutting down, leave the job locked so another process picks it up after the lock timeout
+		return true, nil
+	}
+
+	var deferred job.DeferredError
+	if errors.As(runErr, &deferred) {
+		return true, s.deferJob(ctx, queued, deferred.After)
+	}
+
+	status, lastErr := statusDone, ""
+	if runErr != nil {
+		status, lastErr = statusFailed, runErr.Error()
+		s.logger.Error("workflow failed", "WorkflowID", queued.event.WorkflowId, slog.Any("err", runErr))
+	}
+	query := `UPDATE job_queue SET status = $1, last_error = NULLIF($2, ''), locked_at = NULL, updated_at = NOW() WHERE id = $3;`
+	if _, err := s.db.ExecContext(ctx, query, status, lastErr, queued.id); err != nil {
+		return true, fmt.Errorf("failed to finish job %s: %w", queued.event.WorkflowId, err)
+	}
+	return true, nil
+}
+
+// deferJob puts a job back in the queue to run again after the given delay, the run is not counted as an attempt
+func (s Scheduler) deferJob(ctx context.Context, queued queuedJob, after time.Duration) error {
+	query := `UPDATE job_queue SET status = $1, attempts = attempts - 1, run_at = NOW() + make_interval(secs => $2),
+		locked_at = NULL, updated_at = NOW() WHERE id = $3;`
+	if _, err := s.db.ExecContext(ctx, query, statusPending, after.Seconds(), queued.id); err != nil {
+		return fmt.Errorf("failed to defer job %s: %w", queued.event.WorkflowId, err)
+	}
+	return nil
+}
+
+func (s Scheduler) claim(ctx context.Context) (queuedJob, error) {
+	query := `UPDATE job_queue SET status = $1, attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM job_queue
+			WHERE (status = $2 AND run_at <= NOW())
+			   OR (status = $1 AND locked_at < NOW() - make_interval(secs => $3) AND attempts < $4)
+			ORDER BY run_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, payload, attempts;`
+
+	var (
+		queued  queuedJob
+		payload []byte
+	)
+	err := s.db.QueryRowContext(ctx, query, statusRunning, statusPending, s.config.LockTimeout.Seconds(), s.config.MaxAttempts).
+		Scan(&queued.id, &payload, &queued.attempts)
+	if err != nil {
+		return queued, err
+	}
+
+	if err := json.Unmarshal(payload, &queued.event); err != nil {
+		return queued, fmt.Errorf("failed to unmarshal job %d: %w", queued.id, err)
+	}
+	return queued, nil
+}
+
+// failExhausted gives up on abandoned jobs that already used all of their attempts. Their workflows never reach
+// a terminal step, so the jobs record is failed here too and releases the import slot it held
+func (s Scheduler) failExhausted(ctx context.Context) error {
+	query := `WITH abandoned AS (
+			UPDATE job_queue SET status = $1, last_error = 'abandoned after ' || attempts || ' attempts', locked_at = NULL, updated_at = NOW()
+			WHERE status = $2 AND locked_at < NOW() - make_interval(secs => $3) AND attempts >= $4
+			RETURNING workflow_id, last_error
+		)
+		UPDATE jobs SET status = 'failed', error = abandoned.last_error, updated_at = NOW()
+		FROM abandoned WHERE jobs.token = abandoned.workflow_id AND jobs.status IN ('pending', 'processing');`
+	_, err := s.db.ExecContext(ctx, query, statusFailed, statusRunning, s.config.LockTimeout.Seconds(), s.config.MaxAttempts)
+	return err
+}
+
+// run executes the workflow of a claimed job while refreshing its lock, a previous attempt of the
+// same job is delayed by RetryInterval so a crash loop does not hammer the filer and the database
+func (s Scheduler) run(ctx context.Context, queued queuedJob) (err error) {
+	workflow, ok := s.workflows[queued.event.WorkflowName]
+	if !ok {
+		return fmt.Errorf("workflow %s is not registered", queued.event.WorkflowName)
+	}
+
+	if queued.attempts > 1 {
+		s.logger.Warn("resuming abandoned workflow", "WorkflowID", queued.event.WorkflowId, "attempt", queued.attempts)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.config.RetryInterval * time.Duration(queued.attempts-1)):
+		}
+	}
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	defer stopHeartbeat()
+	go s.heartbeat(heartbeatCtx, queued.id)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("workflow %s panicked: %v", queued.event.WorkflowId, r)
+		}
+	}()
+
+	return workflow(ctx, queued.event)
+}
+
+func (s Scheduler) heartbeat(ctx context.Context, id int64) {
+	ticker := time.NewTicker(s.config.LockTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			query := `UPDATE job_queue SET locked_at = NOW() WHERE id = $1 AND status = $2;`
+			if _, err := s.db.ExecContext(ctx, query, id, statusRunning); err != nil {
+				s.logger.Error("failed to refresh job lock", slog.Any("err", err))
+			}
+		}
+	}
+}
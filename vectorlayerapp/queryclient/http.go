@@ -1,40 +1,230 @@
 package queryclient
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocastsian/roham/vectorlayerapp/service"
 )
 
+type Config struct {
+	BaseURL string `koanf:"base_url"`
+	// Timeout bounds connecting to the filer and waiting for its response headers, the body itself
+	// is only bounded by the caller's context because archives can take minutes to stream
+	Timeout       time.Duration `koanf:"timeout"`
+	MaxRetries    int           `koanf:"max_retries"`
+	RetryInterval time.Duration `koanf:"retry_interval"`
+	ServiceName   string        `koanf:"service_name"`
+	ServiceToken  string        `koanf:"service_token"`
+}
+
 type QueryClient struct {
+	config Config
+	client *http.Client
 }
 
-func New() QueryClient {
-	return QueryClient{}
+func New(config Config) QueryClient {
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	return QueryClient{
+		config: config,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           dialer.DialContext,
+				TLSHandshakeTimeout:   config.Timeout,
+				ResponseHeaderTimeout: config.Timeout,
+			},
+		},
+	}
 }
 
-func (q QueryClient) DownloadShapeFile(fileKey string) ([]byte, error) {
-	baseUrl := "http://127.0.0.1:5005"
-	encodedKey := url.PathEscape(fileKey)
+type statusError struct {
+	StatusCode int
+	Body       string
+}
 
-	fullUrl := fmt.Sprintf("%s/v1/files/%s/download", baseUrl, encodedKey)
+func (e statusError) Error() string {
+	return fmt.Sprintf("download failed with status %d: %s", e.StatusCode, e.Body)
+}
 
-	resp, err := http.Get(fullUrl)
+// DownloadFile streams the file of fileKey into dst. A failed attempt is resumed with a Range request
+// from what is already on disk, the whole file is then verified against the checksum sent by the filer
+func (q QueryClient) DownloadFile(ctx context.Context, fileKey string, dst string) (service.DownloadedFile, error) {
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make GET request: %w", err)
+		return service.DownloadedFile{}, fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	defer out.Close()
+
+	var (
+		expected string
+		lastErr  error
+	)
+	for attempt := 0; attempt <= q.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			log.Printf("Retrying download of %s (attempt %d): %v", fileKey, attempt, lastErr)
+			select {
+			case <-ctx.Done():
+				return service.DownloadedFile{}, ctx.Err()
+			case <-time.After(q.config.RetryInterval * time.Duration(attempt)):
+			}
+		}
+
+		checksum, err := q.download(ctx, fileKey, out)
+		if checksum != "" {
+			expected = checksum
+		}
+		if err == nil {
+			return verifyDownload(out, expected)
+		}
+
+		lastErr = err
+		var sErr statusError
+		if errors.As(err, &sErr) && sErr.StatusCode < http.StatusInternalServerError && sErr.StatusCode != http.StatusTooManyRequests {
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return service.DownloadedFile{}, fmt.Errorf("failed to download %s: %w", fileKey, lastErr)
+}
+
+// download appends to out from its current size and returns the full file checksum if the filer sent one
+func (q QueryClient) download(ctx context.Context, fileKey string, out *os.File) (string, error) {
+	offset, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+
+	fullUrl := fmt.Sprintf("%s/v1/files/%s/download", strings.TrimRight(q.config.BaseURL, "/"), url.PathEscape(fileKey))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullUrl, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build request: %w", err)
+	}
+	if q.config.ServiceName != "" {
+		req.Header.Set("X-Service-Name", q.config.ServiceName)
+	}
+	if q.config.ServiceToken != "" {
+		req.Header.Set("Authorization", "Bearer "+q.config.ServiceToken)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to make GET request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("download failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// appending a range that doesn't start where the file ends would corrupt it, start over instead
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			if err := restart(out); err != nil {
+				return "", err
+			}
+			return "", fmt.Errorf("filer answered the range from %d with %q", offset, resp.Header.Get("Content-Range"))
+		}
+	case http.StatusOK:
+		// the filer ignored our Range header, start over
+		if err := restart(out); err != nil {
+			return "", err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		if err := restart(out); err != nil {
+			return "", err
+		}
+		return "", statusError{StatusCode: http.StatusServiceUnavailable, Body: "range not satisfiable, restarting download"}
+	default:
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", statusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	checksum := responseChecksum(resp.Header)
+	n, err := io.Copy(out, resp.Body)
+	if err != nil {
+		return checksum, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return checksum, fmt.Errorf("response body truncated: got %d of %d bytes", n, resp.ContentLength)
+	}
+
+	return checksum, nil
+}
+
+// contentRangeStart reads the first byte of a "bytes <start>-<end>/<size>" Content-Range header
+func contentRangeStart(header string) (int64, bool) {
+	value, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return 0, false
+	}
+	start, _, found := strings.Cut(value, "-")
+	if !found {
+		return 0, false
+	}
+	offset, err := strconv.ParseInt(start, 10, 64)
+	return offset, err == nil
+}
+
+func restart(out *os.File) error {
+	if err := out.Truncate(0); err != nil {
+		return err
 	}
+	_, err := out.Seek(0, io.SeekStart)
+	return err
+}
 
-	data, err := io.ReadAll(resp.Body)
+// responseChecksum reads a hex encoded sha256 from either the RFC 3230 Digest header or X-Checksum-Sha256
+func responseChecksum(header http.Header) string {
+	if checksum := header.Get("X-Checksum-Sha256"); checksum != "" {
+		return strings.ToLower(checksum)
+	}
+	for _, digest := range strings.Split(header.Get("Digest"), ",") {
+		algorithm, value, found := strings.Cut(strings.TrimSpace(digest), "=")
+		if !found || !strings.EqualFold(algorithm, "sha-256") {
+			continue
+		}
+		if raw, err := base64.StdEncoding.DecodeString(value); err == nil {
+			return hex.EncodeToString(raw)
+		}
+	}
+	return ""
+}
+
+func verifyDownload(out *os.File, expected string) (service.DownloadedFile, error) {
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return service.DownloadedFile{}, err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, out)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return service.DownloadedFile{}, fmt.Errorf("failed to hash %s: %w", out.Name(), err)
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if expected != "" && expected != checksum {
+		return service.DownloadedFile{}, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", out.Name(), expected, checksum)
 	}
 
-	return data, nil
+	return service.DownloadedFile{
+		Size:   size,
+		SHA256: checksum,
+	}, nil
 }
@@ -0,0 +1,133 @@
+package queryclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadFileResumesInterruptedDownload(t *testing.T) {
+	content := []byte(strings.Repeat("roham-layer-archive", 100))
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/files/layers%2Froads.zip/download", r.URL.EscapedPath())
+		assert.Equal(t, "vectorlayer", r.Header.Get("X-Service-Name"))
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("X-Checksum-Sha256", checksum)
+
+		if r.Header.Get("Range") == "" {
+			// announce the whole file but drop the connection half way
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(content[:len(content)/2])
+			return
+		}
+
+		var offset int
+		_, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset)
+		require.NoError(t, err)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(content)-1, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(content[offset:])
+	}))
+	defer server.Close()
+
+	client := New(Config{
+		BaseURL:       server.URL,
+		Timeout:       time.Second,
+		MaxRetries:    2,
+		RetryInterval: time.Millisecond,
+		ServiceName:   "vectorlayer",
+	})
+
+	dst := filepath.Join(t.TempDir(), "roads.zip")
+	downloaded, err := client.DownloadFile(context.Background(), "layers/roads.zip", dst)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"", fmt.Sprintf("bytes=%d-", len(content)/2)}, ranges)
+	assert.Equal(t, checksum, downloaded.SHA256)
+	assert.Equal(t, int64(len(content)), downloaded.Size)
+
+	written, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, content, written)
+}
+
+func TestDownloadFileRejectsChecksumMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Checksum-Sha256", strings.Repeat("0", 64))
+		_, _ = w.Write([]byte("tampered"))
+	}))
+	defer server.Close()
+
+	client := New(Config{BaseURL: server.URL, Timeout: time.Second})
+	_, err := client.DownloadFile(context.Background(), "roads.zip", filepath.Join(t.TempDir(), "roads.zip"))
+	assert.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestDownloadFileDoesNotRetryClientErrors(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "file not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := New(Config{BaseURL: server.URL, Timeout: time.Second, MaxRetries: 3, RetryInterval: time.Millisecond})
+	_, err := client.DownloadFile(context.Background(), "missing.zip", filepath.Join(t.TempDir(), "missing.zip"))
+	assert.ErrorContains(t, err, "status 404")
+	assert.Equal(t, 1, calls)
+}
+
+func TestDownloadFileRejectsMisplacedRange(t *testing.T) {
+	content := []byte(strings.Repeat("roham-layer-archive", 100))
+	sum := sha256.Sum256(content)
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("X-Checksum-Sha256", hex.EncodeToString(sum[:]))
+
+		switch len(ranges) {
+		case 1:
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(content[:100])
+		case 2:
+			// a range that starts before the requested offset would duplicate bytes
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 10-%d/%d", len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[10:])
+		default:
+			_, _ = w.Write(content)
+		}
+	}))
+	defer server.Close()
+
+	client := New(Config{BaseURL: server.URL, Timeout: time.Second, MaxRetries: 2, RetryInterval: time.Millisecond})
+	dst := filepath.Join(t.TempDir(), "roads.zip")
+	downloaded, err := client.DownloadFile(context.Background(), "roads.zip", dst)
+	require.NoError(t, err)
+
+	// the misplaced range is discarded and the third attempt starts from the beginning
+	assert.Equal(t, []string{"", "bytes=100-", ""}, ranges)
+	assert.Equal(t, int64(len(content)), downloaded.Size)
+	written, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, content, written)
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+var gridFunctions = map[service.GridShape]string{
+	service.GridHexagon: "ST_HexagonGrid",
+	service.GridSquare:  "ST_SquareGrid",
+}
+
+// GetNumericAttributes lists the attribute columns of a layer table that can be summed and averaged
+func (r LayerRepo) GetNumericAttributes(ctx context.Context, tableName string) ([]string, error) {
+	columns, err := r.getAttributeColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, column := range columns {
+		if numericDataTypes[column.DataType] {
+			names = append(names, column.Name)
+		}
+	}
+	return names, nil
+}
+
+// binnedCells renders the bounds and binned common table expressions of an aggregation, bounds is bbox in web
+// mercator and binned holds the geometry, grid index, count, sum and avg of every cell with features. args
+// already holds the parameters of the caller, the ones of the aggregation are appended
+func binnedCells(layer service.LayerEntity, filter service.FeatureFilter, bbox service.Extent,
+	options service.AggregateOptions, args []interface{}) (string, []interface{}, error) {
+	args = append(args, bbox.MinX, bbox.MinY, bbox.MaxX, bbox.MaxY, options.CellSize)
+	first := len(args) - 4
+	condition, args, err := featureCondition(layer, filter, args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	value := "null::float8"
+	if options.Attribute != "" {
+		value = "t." + pq.QuoteIdentifier(options.Attribute)
+	}
+	geom := "t." + pq.QuoteIdentifier(geometryColumn)
+
+	// cells reach past bbox by less than two of their size, the features of those edges are read too
+	query := fmt.Sprintf(`with bounds as (select ST_Transform(ST_MakeEnvelope($%[1]d, $%[2]d, $%[3]d, $%[4]d, 4326), 3857) as geom),
+		points as (
+			select ST_Transform(ST_PointOnSurface(%[6]s), 3857) as geom, %[7]s as value
+			from %[8]s as t, bounds
+			where %[6]s && ST_Transform(ST_Expand(bounds.geom, 2 * $%[5]d::float8), %[9]d) and %[10]s
+		),
+		binned as (
+			select cell.geom, cell.i, cell.j, count(*) as count, sum(points.value)::float8 as sum, avg(points.value)::float8 as avg
+			from bounds
+			cross join lateral %[11]s($%[5]d::float8, bounds.geom) as cell
+			join points on ST_Intersects(cell.geom, points.geom)
+			group by cell.geom, cell.i, cell.j
+		)`,
+		first, first+1, first+2, first+3, first+4, geom, value, pq.QuoteIdentifier(layer.Name), layer.SRID, condition,
+		gridFunctions[options.Grid])
+	return query, args, nil
+}
+
+// AggregateLayer returns the cells of the grid of options over bbox holding features of layer that match filter,
+// their geometries are GeoJSON in WGS 84
+func (r LayerRepo) AggregateLayer(ctx context.Context, layer service.LayerEntity, filter service.FeatureFilter,
+	bbox service.Extent, options service.AggregateOptions) ([]service.AggregateCell, error) {
+	cells, args, err := binnedCells(layer, filter, bbox, options, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	query := cells + ` select ST_AsGeoJSON(ST_Transform(geom, 4326)), count, sum, avg from binned order by i, j;`
+	rows, err := r.PostgreSQL.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate %s: %w", layer.Name, err)
+	}
+	defer rows.Close()
+
+	result := make([]service.AggregateCell, 0)
+	for rows.Next() {
+		var (
+			cell     service.AggregateCell
+			geometry []byte
+		)
+		if err := rows.Scan(&geometry, &cell.Count, &cell.Sum, &cell.Avg); err != nil {
+			return nil, fmt.Errorf("failed to scan aggregate of %s: %w", layer.Name, err)
+		}
+		cell.Geometry = geometry
+		result = append(result, cell)
+	}
+	return result, rows.Err()
+}
+
+// AggregateLayerTile returns the cells of AggregateLayer as a Mapbox vector tile whose extent is bbox, the layer
+// of the tile is named after the layer and holds the count, sum and avg of each cell
+func (r LayerRepo) AggregateLayerTile(ctx context.Context, layer service.LayerEntity, filter service.FeatureFilter,
+	bbox service.Extent, options service.AggregateOptions) ([]byte, error) {
+	cells, args, err := binnedCells(layer, filter, bbox, options, []interface{}{options.Extent, options.Buffer, layer.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	query := cells + ` select coalesce(ST_AsMVT(mvtgeom.*, $3, $1, 'mvt_geometry'), '') from (
+			select ST_AsMVTGeom(binned.geom, bounds.geom, $1, $2, true) as mvt_geometry, count, sum, avg
+			from binned, bounds
+		) as mvtgeom;`
+
+	var data []byte
+	if err := r.PostgreSQL.QueryRowContext(ctx, query, args...).Scan(&data); err != nil {
+		return nil, fmt.Errorf("failed to aggregate tile of %s: %w", layer.Name, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gocastsian/roham/types"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+func (r LayerRepo) UpdateLayerMetadata(ctx context.Context, id types.ID, metadata service.LayerMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata of layer %d: %w", id, err)
+	}
+
+	query := `update layers set metadata = $1, updated_at = now() where id = $2;`
+	if _, err := r.PostgreSQL.ExecContext(ctx, query, data, id); err != nil {
+		return fmt.Errorf("failed to update metadata of layer %d: %w", id, err)
+	}
+	return nil
+}
+
+// SearchLayers runs a catalog search ordered by text relevance and returns one page with the total match count.
+// Unless the filter reads all layers it only matches the layers layer.rego lets the reader read, so the total
+// counts what the reader gets
+func (r LayerRepo) SearchLayers(ctx context.Context, filter service.CatalogFilter) ([]service.LayerEntity, int64, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	argIdx := 1
+	rank := "0"
+
+	// the reader and their organization claims are the first arguments when the search is authorized
+	const reader, organization, organizationRole = "$1", "$2", "$3"
+	if !filter.AllLayers {
+		conditions = append(conditions, `(visibility = 'public'
+			or (owner_id = `+reader+` and `+reader+` <> 0)
+			or (visibility = 'organization' and organization = `+organization+` and `+organization+` <> '')
+			or (`+organizationRole+` = 'editor' and `+organization+` <> '' and `+organization+` = any(tags))
+			or exists (select 1 from layer_shares s where s.layer_id = layers.id and s.user_id = `+reader+`))`)
+		args = append(args, filter.ReaderID, filter.ReaderOrganization, filter.ReaderOrganizationRole)
+		argIdx += 3
+	}
+
+	if filter.Text != "" {
+		tsQuery := fmt.Sprintf("websearch_to_tsquery('simple', $%d)", argIdx)
+		conditions = append(conditions, "search_vector @@ "+tsQuery)
+		rank = "ts_rank(search_vector, " + tsQuery + ")"
+		args = append(args, filter.Text)
+		argIdx++
+	}
+
+	if filter.BBox != nil {
+		conditions = append(conditions, fmt.Sprintf("extent && ST_MakeEnvelope($%d, $%d, $%d, $%d, 4326)", argIdx, argIdx+1, argIdx+2, argIdx+3))
+		args = append(args, filter.BBox.MinX, filter.BBox.MinY, filter.BBox.MaxX, filter.BBox.MaxY)
+		argIdx += 4
+		if !filter.AllLayers {
+			// the extent covers every feature, a reader the row rules restrict would learn where the rows
+			// outside of their scope are, only owners, admins of the layer and exempt readers match on it
+			conditions = append(conditions, fmt.Sprintf(`(not exists (select 1 from layer_row_rules rr where rr.layer_id = layers.id
+					and not ($%[1]d::smallint <> 0 and $%[1]d::smallint = any(rr.exempt_roles)))
+			or (owner_id = %[2]s and %[2]s <> 0)
+			or exists (select 1 from layer_shares s where s.layer_id = layers.id and s.user_id = %[2]s and s.permission = 'admin'))`,
+				argIdx, reader))
+			args = append(args, filter.ReaderRole)
+			argIdx++
+		}
+	}
+
+	if len(filter.Keywords) > 0 {
+		conditions = append(conditions, fmt.Sprintf("metadata -> 'keywords' ?| $%d", argIdx))
+		args = append(args, pq.Array(filter.Keywords))
+		argIdx++
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "where " + strings.Join(conditions, " and ")
+	}
+	query := fmt.Sprintf(`select %s, count(*) over () from layers %s order by %s desc, id limit $%d offset $%d;`,
+		layerColumns, where, rank, argIdx, argIdx+1)
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.PostgreSQL.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search layers: %w", err)
+	}
+	defer rows.Close()
+
+	var total int64
+	layers := make([]service.LayerEntity, 0)
+	for rows.Next() {
+		layer, err := scanLayer(totalScanner{rows: rows, total: &total})
+		if err != nil {
+			return nil, 0, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, total, rows.Err()
+}
+
+// totalScanner appends the window count of a search query to the columns scanLayer reads
+type totalScanner struct {
+	rows  interface{ Scan(dest ...any) error }
+	total *int64
+}
+
+func (t totalScanner) Scan(dest ...any) error {
+	return t.rows.Scan(append(dest, t.total)...)
+}
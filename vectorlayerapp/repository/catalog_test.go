@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gocastsian/roham/types"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchLayers(t *testing.T) {
+	bbox := &service.Extent{MinX: 51, MinY: 35, MaxX: 52, MaxY: 36}
+
+	t.Run("authorizes the reader and hides the extent of row scoped layers", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		query := strings.Join([]string{
+			regexp.QuoteMeta(`(visibility = 'public'`),
+			regexp.QuoteMeta(`extent && ST_MakeEnvelope($4, $5, $6, $7, 4326)`),
+			regexp.QuoteMeta(`not exists (select 1 from layer_row_rules rr`),
+			regexp.QuoteMeta(`limit $9 offset $10;`),
+		}, `(.|\n)*`)
+		mock.ExpectQuery(query).
+			WithArgs(types.ID(7), "municipality", "editor", 51.0, 35.0, 52.0, 36.0, types.Role(2), 20, 40).
+			WillReturnRows(sqlmock.NewRows(nil))
+
+		_, total, err := LayerRepo{PostgreSQL: db}.SearchLayers(context.Background(), service.CatalogFilter{
+			BBox:                   bbox,
+			ReaderID:               7,
+			ReaderRole:             2,
+			ReaderOrganization:     "municipality",
+			ReaderOrganizationRole: "editor",
+			Limit:                  20,
+			Offset:                 40,
+		})
+		require.NoError(t, err)
+		assert.Zero(t, total)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("matches every layer for admins", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(`from layers where extent && ST_MakeEnvelope($1, $2, $3, $4, 4326) order by 0 desc, id limit $5 offset $6;`)).
+			WithArgs(51.0, 35.0, 52.0, 36.0, 20, 0).
+			WillReturnRows(sqlmock.NewRows(nil))
+
+		_, _, err = LayerRepo{PostgreSQL: db}.SearchLayers(context.Background(), service.CatalogFilter{
+			BBox:      bbox,
+			AllLayers: true,
+			Limit:     20,
+		})
+		require.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gocastsian/roham/pkg/cql2"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+var spatialFunctions = map[string]string{
+	"s_intersects": "ST_Intersects",
+	"s_equals":     "ST_Equals",
+	"s_disjoint":   "ST_Disjoint",
+	"s_touches":    "ST_Touches",
+	"s_within":     "ST_Within",
+	"s_overlaps":   "ST_Overlaps",
+	"s_crosses":    "ST_Crosses",
+	"s_contains":   "ST_Contains",
+}
+
+// cqlTranslator renders a CQL2 filter as a where condition on the layer table aliased t. Literals never enter
+// the query text, they are appended to args and referenced by number. Geometry literals are in WGS 84 and are
+// transformed to srid, the system of the layer
+type cqlTranslator struct {
+	args []interface{}
+	srid service.EPSGCode
+}
+
+func (t *cqlTranslator) param(value interface{}) string {
+	t.args = append(t.args, value)
+	return fmt.Sprintf("$%d", len(t.args))
+}
+
+func (t *cqlTranslator) condition(e cql2.Expression) (string, error) {
+	switch node := e.(type) {
+	case cql2.Logical:
+		conditions := make([]string, 0, len(node.Args))
+		for _, arg := range node.Args {
+			condition, err := t.condition(arg)
+			if err != nil {
+				return "", err
+			}
+			conditions = append(conditions, condition)
+		}
+		return "(" + strings.Join(conditions, " "+node.Op+" ") + ")", nil
+	case cql2.Not:
+		condition, err := t.condition(node.Arg)
+		if err != nil {
+			return "", err
+		}
+		return "not (" + condition + ")", nil
+	case cql2.Comparison:
+		return t.scalars("%s "+node.Op+" %s", node.Left, node.Right)
+	case cql2.Like:
+		// the pattern is compared to the text of the value so numbers and dates can be matched too
+		return t.scalars("%s::text "+negation(node.Negated)+"like %s", node.Value, node.Pattern)
+	case cql2.Between:
+		return t.scalars("%s "+negation(node.Negated)+"between %s and %s", node.Value, node.Low, node.High)
+	case cql2.In:
+		operands := append([]cql2.Expression{node.Value}, node.List...)
+		format := "%s " + negation(node.Negated) + "in (" + strings.TrimSuffix(strings.Repeat("%s, ", len(node.List)), ", ") + ")"
+		return t.scalars(format, operands...)
+	case cql2.IsNull:
+		return t.scalars("%s is "+negation(node.Negated)+"null", node.Value)
+	case cql2.Spatial:
+		return t.spatial(node)
+	case cql2.Temporal:
+		return t.temporal(node)
+	}
+	return "", fmt.Errorf("unsupported filter %s", e)
+}
+
+func negation(negated bool) string {
+	if negated {
+		return "not "
+	}
+	return ""
+}
+
+// scalars renders the operands of a scalar predicate and fills them into format
+func (t *cqlTranslator) scalars(format string, operands ...cql2.Expression) (string, error) {
+	values := make([]interface{}, 0, len(operands))
+	for _, operand := range operands {
+		switch node := operand.(type) {
+		case cql2.Property:
+			values = append(values, "t."+pq.QuoteIdentifier(node.Name))
+		case cql2.Literal:
+			values = append(values, t.param(node.Value))
+		case cql2.Instant:
+			values = append(values, t.instant(node))
+		default:
+			return "", fmt.Errorf("%s is not a scalar", operand)
+		}
+	}
+	return fmt.Sprintf(format, values...), nil
+}
+
+func (t *cqlTranslator) instant(instant cql2.Instant) string {
+	if instant.Date {
+		return t.param(instant.Time.Format(time.DateOnly)) + "::date"
+	}
+	return t.param(instant.Time) + "::timestamptz"
+}
+
+func (t *cqlTranslator) spatial(node cql2.Spatial) (string, error) {
+	operands := make([]string, 0, 2)
+	for _, operand := range []cql2.Expression{node.Left, node.Right} {
+		switch geometry := operand.(type) {
+		case cql2.Property:
+			// properties were checked to name the geometry of the layer
+			operands = append(operands, "t."+pq.QuoteIdentifier(geometryColumn))
+		case cql2.Geometry:
+			var literal string
+			if geometry.WKT != "" {
+				literal = fmt.Sprintf("ST_GeomFromText(%s, 4326)", t.param(geometry.WKT))
+			} else {
+				literal = fmt.Sprintf("ST_SetSRID(ST_GeomFromGeoJSON(%s), 4326)", t.param(string(geometry.GeoJSON)))
+			}
+			operands = append(operands, fmt.Sprintf("ST_Transform(%s, %d)", literal, t.srid))
+		default:
+			return "", fmt.Errorf("%s is not a geometry", operand)
+		}
+	}
+	return fmt.Sprintf("%s(%s, %s)", spatialFunctions[node.Op], operands[0], operands[1]), nil
+}
+
+// temporal compares the start and end of both operands, an instant starts and ends at once and the open
+// bounds of an interval are infinite
+func (t *cqlTranslator) temporal(node cql2.Temporal) (string, error) {
+	bounds := make([][2]string, 0, 2)
+	for _, operand := range []cql2.Expression{node.Left, node.Right} {
+		switch value := operand.(type) {
+		case cql2.Property:
+			column := "t." + pq.QuoteIdentifier(value.Name)
+			bounds = append(bounds, [2]string{column, column})
+		case cql2.Instant:
+			instant := t.instant(value)
+			bounds = append(bounds, [2]string{instant, instant})
+		case cql2.Interval:
+			start, end := "'-infinity'::timestamptz", "'infinity'::timestamptz"
+			if value.Start != nil {
+				start = t.instant(*value.Start)
+			}
+			if value.End != nil {
+				end = t.instant(*value.End)
+			}
+			bounds = append(bounds, [2]string{start, end})
+		default:
+			return "", fmt.Errorf("%s is not an instant or an interval", operand)
+		}
+	}
+
+	aStart, aEnd, bStart, bEnd := bounds[0][0], bounds[0][1], bounds[1][0], bounds[1][1]
+	switch node.Op {
+	case "t_after":
+		return fmt.Sprintf("%s > %s", aStart, bEnd), nil
+	case "t_before":
+		return fmt.Sprintf("%s < %s", aEnd, bStart), nil
+	case "t_contains":
+		return fmt.Sprintf("(%s < %s and %s > %s)", aStart, bStart, aEnd, bEnd), nil
+	case "t_during":
+		return fmt.Sprintf("(%s > %s and %s < %s)", aStart, bStart, aEnd, bEnd), nil
+	case "t_equals":
+		return fmt.Sprintf("(%s = %s and %s = %s)", aStart, bStart, aEnd, bEnd), nil
+	case "t_intersects":
+		return fmt.Sprintf("(%s <= %s and %s >= %s)", aStart, bEnd, aEnd, bStart), nil
+	case "t_disjoint":
+		return fmt.Sprintf("(%s > %s or %s < %s)", aStart, bEnd, aEnd, bStart), nil
+	}
+	return "", fmt.Errorf("unsupported temporal predicate %s", node.Op)
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+// QueryFeatures returns the features of layer matching filter ordered by id, with the number of all matches
+func (r LayerRepo) QueryFeatures(ctx context.Context, layer service.LayerEntity, filter service.FeatureFilter,
+	limit int, offset int) (service.FeaturePage, error) {
+	condition, args, err := featureCondition(layer, filter, nil)
+	if err != nil {
+		return service.FeaturePage{}, err
+	}
+	table := pq.QuoteIdentifier(layer.Name)
+	fid := pq.QuoteIdentifier(fidColumn)
+
+	query := fmt.Sprintf(`select t.%[1]s, ST_AsGeoJSON(ST_Transform(t.%[2]s, 4326)), to_jsonb(t) - '%[3]s' - '%[4]s', count(*) over ()
+		from %[5]s as t where %[6]s order by t.%[1]s limit %[7]d offset %[8]d;`,
+		fid, pq.QuoteIdentifier(geometryColumn), geometryColumn, fidColumn, table, condition, limit, offset)
+
+	rows, err := r.PostgreSQL.QueryContext(ctx, query, args...)
+	if err != nil {
+		return service.FeaturePage{}, fmt.Errorf("failed to query features of %s: %w", layer.Name, err)
+	}
+	defer rows.Close()
+
+	page := service.FeaturePage{Features: make([]service.Feature, 0)}
+	for rows.Next() {
+		feature := service.Feature{Type: "Feature"}
+		var geometry, properties []byte
+		if err := rows.Scan(&feature.ID, &geometry, &properties, &page.Matched); err != nil {
+			return service.FeaturePage{}, fmt.Errorf("failed to scan feature of %s: %w", layer.Name, err)
+		}
+		// a feature without geometry keeps a null one
+		feature.Geometry = geometry
+		if err := json.Unmarshal(properties, &feature.Properties); err != nil {
+			return service.FeaturePage{}, fmt.Errorf("failed to unmarshal properties of %s: %w", layer.Name, err)
+		}
+		page.Features = append(page.Features, feature)
+	}
+	if err := rows.Err(); err != nil {
+		return service.FeaturePage{}, err
+	}
+
+	// a page past the last match has no row to carry the count, it is read on its own
+	if len(page.Features) == 0 && offset > 0 {
+		query := fmt.Sprintf(`select count(*) from %s as t where %s;`, table, condition)
+		if err := r.PostgreSQL.QueryRowContext(ctx, query, args...).Scan(&page.Matched); err != nil {
+			return service.FeaturePage{}, fmt.Errorf("failed to count features of %s: %w", layer.Name, err)
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gocastsian/roham/types"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+// BuildGeneralizedGeometries (re)creates the generalized table of a layer with one simplified web mercator geometry
+// per feature and zoom band. Features that collapse at a band are left out of it, they are too small to be drawn
+func (r LayerRepo) BuildGeneralizedGeometries(ctx context.Context, tableName string, levels []service.GeneralizationLevel) error {
+	table := pq.QuoteIdentifier(tableName)
+	generalized := pq.QuoteIdentifier(tableName + service.GeneralizedTableSuffix)
+	geom := pq.QuoteIdentifier(geometryColumn)
+	fid := pq.QuoteIdentifier(fidColumn)
+
+	tx, err := r.PostgreSQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		fmt.Sprintf(`drop table if exists %s;`, generalized),
+		fmt.Sprintf(`create table %s (fid bigint not null, zoom smallint not null, geom geometry(Geometry, 3857) not null,
+			primary key (zoom, fid));`, generalized),
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to create generalized table of %s: %w", tableName, err)
+		}
+	}
+
+	insert := fmt.Sprintf(`insert into %[1]s (fid, zoom, geom)
+		select %[3]s, $1, simplified from (
+			select %[3]s, ST_SimplifyPreserveTopology(ST_Transform(%[4]s, 3857), $2) as simplified
+			from %[2]s where %[4]s is not null
+		) as s where not ST_IsEmpty(simplified);`, generalized, table, fid, geom)
+	for _, level := range levels {
+		if _, err := tx.ExecContext(ctx, insert, level.Zoom, level.Tolerance); err != nil {
+			return fmt.Errorf("failed to generalize %s for zoom %d: %w", tableName, level.Zoom, err)
+		}
+	}
+
+	queries = []string{
+		fmt.Sprintf(`create index on %s using gist (geom);`, generalized),
+		fmt.Sprintf(`analyze %s;`, generalized),
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to index generalized table of %s: %w", tableName, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r LayerRepo) UpdateLayerGeneralization(ctx context.Context, id types.ID, zooms []int) error {
+	bands := make([]int64, 0, len(zooms))
+	for _, zoom := range zooms {
+		bands = append(bands, int64(zoom))
+	}
+
+	query := `update layers set generalized_zooms = NULLIF($1::integer[], '{}') where id = $2;`
+	if _, err := r.PostgreSQL.ExecContext(ctx, query, pq.Array(bands), id); err != nil {
+		return fmt.Errorf("failed to update generalization of layer %d: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+func invalidGeometryCondition(geom string) string {
+	return fmt.Sprintf(`(%[1]s is null or ST_IsEmpty(%[1]s) or not ST_IsValid(%[1]s))`, geom)
+}
+
+func (r LayerRepo) FindInvalidGeometries(ctx context.Context, tableName string) ([]service.InvalidGeometry, error) {
+	geom := pq.QuoteIdentifier(geometryColumn)
+	query := fmt.Sprintf(`select %[1]s, case when %[2]s is null or ST_IsEmpty(%[2]s) then 'Empty geometry' else ST_IsValidReason(%[2]s) end
+		from %[3]s where %[4]s order by %[1]s;`,
+		pq.QuoteIdentifier(fidColumn), geom, pq.QuoteIdentifier(tableName), invalidGeometryCondition(geom))
+
+	rows, err := r.PostgreSQL.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate geometries of %s: %w", tableName, err)
+	}
+	defer rows.Close()
+
+	invalids := make([]service.InvalidGeometry, 0)
+	for rows.Next() {
+		var invalid service.InvalidGeometry
+		if err := rows.Scan(&invalid.FeatureID, &invalid.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan invalid geometry of %s: %w", tableName, err)
+		}
+		invalids = append(invalids, invalid)
+	}
+	return invalids, rows.Err()
+}
+
+// RepairGeometries runs ST_MakeValid on every invalid, non-empty geometry and keeps only the part with the
+// original dimension, ImportLayer promotes every layer to a multi type so anything else would not fit the column
+func (r LayerRepo) RepairGeometries(ctx context.Context, tableName string) (int64, error) {
+	geom := pq.QuoteIdentifier(geometryColumn)
+	query := fmt.Sprintf(`update %[1]s set %[2]s = ST_Multi(ST_CollectionExtract(ST_MakeValid(%[2]s), ST_Dimension(%[2]s) + 1))
+		where %[2]s is not null and not ST_IsEmpty(%[2]s) and not ST_IsValid(%[2]s);`, pq.QuoteIdentifier(tableName), geom)
+
+	res, err := r.PostgreSQL.ExecContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to repair geometries of %s: %w", tableName, err)
+	}
+	return res.RowsAffected()
+}
+
+// QuarantineInvalidGeometries moves the invalid rows of a layer into <table>_quarantine together with their reason
+func (r LayerRepo) QuarantineInvalidGeometries(ctx context.Context, tableName string) (string, error) {
+	quarantineTable := tableName + service.QuarantineTableSuffix
+	table := pq.QuoteIdentifier(tableName)
+	quarantine := pq.QuoteIdentifier(quarantineTable)
+	geom := pq.QuoteIdentifier(geometryColumn)
+	condition := invalidGeometryCondition(geom)
+
+	tx, err := r.PostgreSQL.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		fmt.Sprintf(`drop table if exists %s;`, quarantine),
+		fmt.Sprintf(`create table %s as select *, null::text as invalid_reason from %s with no data;`, quarantine, table),
+		fmt.Sprintf(`insert into %[1]s select t.*, case when %[3]s is null or ST_IsEmpty(%[3]s) then 'Empty geometry' else ST_IsValidReason(%[3]s) end
+			from %[2]s as t where %[4]s;`, quarantine, table, geom, condition),
+		fmt.Sprintf(`delete from %s where %s;`, table, condition),
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return "", fmt.Errorf("failed to quarantine geometries of %s: %w", tableName, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return quarantineTable, nil
+}
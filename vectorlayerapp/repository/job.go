@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"github.com/gocastsian/roham/types"
 	"github.com/gocastsian/roham/vectorlayerapp/service"
@@ -20,7 +21,8 @@ func NewJobRepo(db *sql.DB) LayerRepo {
 }
 
 func (r LayerRepo) AddJob(ctx context.Context, job service.JobEntity) (types.ID, error) {
-	query := `INSERT INTO jobs(token, status) VALUES ($1 , $2) returning id;`
+	query := `INSERT INTO jobs(token, status, user_id, idempotency_key, priority, organization)
+		VALUES ($1 , $2, NULLIF($3, 0), NULLIF($4, ''), coalesce(NULLIF($5, ''), 'interactive'), $6) returning id;`
 	stmt, err := r.PostgreSQL.PrepareContext(ctx, query)
 	if err != nil {
 		return 0, err
@@ -28,7 +30,7 @@ func (r LayerRepo) AddJob(ctx context.Context, job service.JobEntity) (types.ID,
 	defer stmt.Close()
 
 	var res int64
-	err = stmt.QueryRowContext(ctx, job.Token, job.Status).Scan(&res)
+	err = stmt.QueryRowContext(ctx, job.Token, job.Status, job.UserID, job.IdempotencyKey, job.Priority, job.Organization).Scan(&res)
 	if err != nil {
 		return 0, err
 	}
@@ -36,11 +38,31 @@ func (r LayerRepo) AddJob(ctx context.Context, job service.JobEntity) (types.ID,
 	return types.ID(res), nil
 }
 
+const jobColumns = `id, token, status, error, result, coalesce(user_id, 0), coalesce(idempotency_key, ''), coalesce(content_hash, ''), priority, organization, created_at, updated_at`
+
 func (r LayerRepo) GetJobByToken(ctx context.Context, token string) (service.JobEntity, error) {
-	query := `SELECT * FROM jobs WHERE token = $1;`
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE token = $1;`
+	return r.getJob(ctx, query, token)
+}
+
+func (r LayerRepo) GetJobByIdempotencyKey(ctx context.Context, key string) (service.JobEntity, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE idempotency_key = $1;`
+	return r.getJob(ctx, query, key)
+}
+
+func (r LayerRepo) ReleaseIdempotencyKey(ctx context.Context, token string) error {
+	query := `UPDATE jobs SET idempotency_key = NULL WHERE token = $1;`
+	if _, err := r.PostgreSQL.ExecContext(ctx, query, token); err != nil {
+		return fmt.Errorf("failed to release idempotency key of job %s: %w", token, err)
+	}
+	return nil
+}
+
+func (r LayerRepo) getJob(ctx context.Context, query string, arg any) (service.JobEntity, error) {
 	var (
-		job service.JobEntity
-		id  int64
+		job    service.JobEntity
+		id     int64
+		result []byte
 	)
 
 	stmt, err := r.PostgreSQL.PrepareContext(ctx, query)
@@ -49,11 +71,18 @@ func (r LayerRepo) GetJobByToken(ctx context.Context, token string) (service.Job
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRowContext(ctx, token).Scan(&id, &job.Token, &job.Status, &job.Error, &job.CreatedAt, &job.UpdatedAt)
+	err = stmt.QueryRowContext(ctx, arg).Scan(&id, &job.Token, &job.Status, &job.Error, &result, &job.UserID, &job.IdempotencyKey, &job.ContentHash, &job.Priority, &job.Organization, &job.CreatedAt, &job.UpdatedAt)
 	if err != nil {
 		return job, err
 	}
 
+	if len(result) > 0 {
+		job.Result = &service.JobResult{}
+		if err := json.Unmarshal(result, job.Result); err != nil {
+			return job, fmt.Errorf("failed to unmarshal job result: %w", err)
+		}
+	}
+
 	job.ID = types.ID(id)
 	return job, nil
 
@@ -75,6 +104,22 @@ func (r LayerRepo) UpdateJob(ctx context.Context, job service.JobEntity) (bool,
 		argIdx++
 	}
 
+	if job.Result != nil {
+		result, err := json.Marshal(job.Result)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal job result: %w", err)
+		}
+		setParts = append(setParts, fmt.Sprintf("result = $%d", argIdx))
+		args = append(args, result)
+		argIdx++
+	}
+
+	if job.ContentHash != "" {
+		setParts = append(setParts, fmt.Sprintf("content_hash = $%d", argIdx))
+		args = append(args, job.ContentHash)
+		argIdx++
+	}
+
 	if len(setParts) == 0 {
 		return false, fmt.Errorf("no fields to update")
 	}
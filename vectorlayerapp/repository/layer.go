@@ -3,23 +3,56 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
+
 	"github.com/gocastsian/roham/types"
 	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
 )
 
+const layerColumns = `id, name, geom_type, srid, default_style, statistics, coalesce(content_hash, ''),
+	coalesce(owner_id, 0), visibility, coalesce(organization, ''), tags, metadata,
+	coalesce(time_start_attribute, ''), coalesce(time_end_attribute, ''), coalesce(generalized_zooms, '{}'), created_at, updated_at`
+
+type Config struct {
+	CachePrefix  string `koanf:"cache_prefix"`
+	CacheEnabled bool   `koanf:"cache_enabled"`
+	// MaxCachedTileSize is the largest tile in bytes kept in the tile cache, bigger tiles are generated every time
+	MaxCachedTileSize int `koanf:"max_cached_tile_size"`
+}
+
+// Cache keeps hot query results, *redis.Cache implements it
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value interface{}) error
+	Invalidate(ctx context.Context, key string) error
+	InvalidatePrefix(ctx context.Context, prefix string) error
+}
+
 // LayerRepo is the concrete implementation of the service.Repository interface
 type LayerRepo struct {
+	Config     Config
 	PostgreSQL *sql.DB // PostgreSQL connection
+	Cache      Cache
+	TileCache  Cache
 }
 
 // NewLayerRepo creates a new instance of LayerRepo with PostgreSQL and Redis connections
-func NewLayerRepo(db *sql.DB) LayerRepo {
+func NewLayerRepo(config Config, db *sql.DB, cache Cache, tileCache Cache) LayerRepo {
 	return LayerRepo{
+		Config:     config,
 		PostgreSQL: db,
+		Cache:      cache,
+		TileCache:  tileCache,
 	}
 }
 
+func (r LayerRepo) cacheEnabled() bool {
+	return r.Config.CacheEnabled && r.Cache != nil
+}
+
 func (r LayerRepo) HealthCheck(ctx context.Context) (string, error) {
 	query := `SELECT 1;`
 
@@ -33,10 +66,19 @@ func (r LayerRepo) HealthCheck(ctx context.Context) (string, error) {
 }
 
 func (r LayerRepo) CreateLayer(ctx context.Context, layer service.LayerEntity) (types.ID, error) {
-	query := `insert into layers(name , default_style ,geom_type ) values($1 , $2 , $3) returning id;`
+	query := `insert into layers(name , default_style ,geom_type, content_hash, owner_id, visibility, organization,
+			time_start_attribute, time_end_attribute, srid)
+		values($1 , $2 , $3, NULLIF($4, ''), NULLIF($5, 0), coalesce(NULLIF($6, ''), 'private'), NULLIF($7, ''),
+			NULLIF($8, ''), NULLIF($9, ''), coalesce(NULLIF($10, 0), 4326)) returning id;`
+
+	var timeStart, timeEnd string
+	if layer.Time != nil {
+		timeStart, timeEnd = layer.Time.StartAttribute, layer.Time.EndAttribute
+	}
 
 	var id types.ID
-	err := r.PostgreSQL.QueryRowContext(ctx, query, layer.Name, layer.DefaultStyle, layer.GeomType).Scan(&id)
+	err := r.PostgreSQL.QueryRowContext(ctx, query, layer.Name, layer.DefaultStyle, layer.GeomType, layer.ContentHash,
+		layer.OwnerID, layer.Visibility, layer.Organization, timeStart, timeEnd, int(layer.SRID)).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create layer: %w", err)
 	}
@@ -45,25 +87,231 @@ func (r LayerRepo) CreateLayer(ctx context.Context, layer service.LayerEntity) (
 }
 
 func (r LayerRepo) DropTable(ctx context.Context, tableName string) (bool, error) {
-	query := `drop table if exists $1;`
-	err := r.PostgreSQL.QueryRowContext(ctx, query, tableName)
+	query := fmt.Sprintf(`drop table if exists %s;`, pq.QuoteIdentifier(tableName))
+	_, err := r.PostgreSQL.ExecContext(ctx, query)
 	if err != nil {
 		return false, fmt.Errorf("failed to drop table: %w", err)
 	}
 	return true, nil
 }
 
+// TableExists reports whether any table or view of the search path is called tableName
+func (r LayerRepo) TableExists(ctx context.Context, tableName string) (bool, error) {
+	query := `select to_regclass($1) is not null;`
+
+	var exists bool
+	if err := r.PostgreSQL.QueryRowContext(ctx, query, pq.QuoteIdentifier(tableName)).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to look up table %s: %w", tableName, err)
+	}
+	return exists, nil
+}
+
+// ReplaceLayerTable swaps the staging table a re-import wrote in for the table of layer id in one transaction. The
+// old table and the tables derived from it are dropped, the quarantine of the staging table moves along and the
+// layer is served from its full geometries until it is generalized again. A nil layerTime keeps the time attributes
+func (r LayerRepo) ReplaceLayerTable(ctx context.Context, id types.ID, stagingTable string, tableName string, layerTime *service.LayerTime) error {
+	tx, err := r.PostgreSQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{tableName, tableName + service.QuarantineTableSuffix, tableName + service.GeneralizedTableSuffix} {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`drop table if exists %s;`, pq.QuoteIdentifier(table))); err != nil {
+			return fmt.Errorf("failed to drop table %s: %w", table, err)
+		}
+	}
+	if err := renameTable(ctx, tx, stagingTable, tableName); err != nil {
+		return err
+	}
+	quarantine, err := tableExists(ctx, tx, stagingTable+service.QuarantineTableSuffix)
+	if err != nil {
+		return err
+	}
+	if quarantine {
+		if err := renameTable(ctx, tx, stagingTable+service.QuarantineTableSuffix, tableName+service.QuarantineTableSuffix); err != nil {
+			return err
+		}
+	}
+
+	query := `update layers set generalized_zooms = null, updated_at = now() where id = $1;`
+	if _, err := tx.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to reset generalization of layer %d: %w", id, err)
+	}
+	if layerTime != nil {
+		query := `update layers set time_start_attribute = NULLIF($1, ''), time_end_attribute = NULLIF($2, '') where id = $3;`
+		if _, err := tx.ExecContext(ctx, query, layerTime.StartAttribute, layerTime.EndAttribute, id); err != nil {
+			return fmt.Errorf("failed to update time attributes of layer %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to replace table of layer %d: %w", id, err)
+	}
+	return nil
+}
+
+// renameTable renames a table together with the indexes and sequences named after it, ogr2ogr names them after
+// the table and a later import of the old name would collide with them
+func renameTable(ctx context.Context, tx *sql.Tx, from string, to string) error {
+	query := `select distinct c.relname, c.relkind from pg_depend d join pg_class c on c.oid = d.objid
+		where d.classid = 'pg_class'::regclass and d.refclassid = 'pg_class'::regclass
+			and d.refobjid = to_regclass($1) and c.relkind in ('i', 'S');`
+	rows, err := tx.QueryContext(ctx, query, pq.QuoteIdentifier(from))
+	if err != nil {
+		return fmt.Errorf("failed to list the relations of %s: %w", from, err)
+	}
+	renames := make([]string, 0)
+	for rows.Next() {
+		var name, kind string
+		if err := rows.Scan(&name, &kind); err != nil {
+			rows.Close()
+			return err
+		}
+		if !strings.HasPrefix(name, from) {
+			continue
+		}
+		relation := "index"
+		if kind == "S" {
+			relation = "sequence"
+		}
+		renames = append(renames, fmt.Sprintf(`alter %s %s rename to %s;`, relation,
+			pq.QuoteIdentifier(name), pq.QuoteIdentifier(to+strings.TrimPrefix(name, from))))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	renames = append(renames, fmt.Sprintf(`alter table %s rename to %s;`, pq.QuoteIdentifier(from), pq.QuoteIdentifier(to)))
+	for _, rename := range renames {
+		if _, err := tx.ExecContext(ctx, rename); err != nil {
+			return fmt.Errorf("failed to rename %s to %s: %w", from, to, err)
+		}
+	}
+	return nil
+}
+
+func tableExists(ctx context.Context, tx *sql.Tx, tableName string) (bool, error) {
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `select to_regclass($1) is not null;`, pq.QuoteIdentifier(tableName)).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to look up table %s: %w", tableName, err)
+	}
+	return exists, nil
+}
+
+// TouchLayer marks a layer as changed, its updated_at is the version cached results are keyed with
+func (r LayerRepo) TouchLayer(ctx context.Context, id types.ID) error {
+	query := `update layers set updated_at = now() where id = $1;`
+	if _, err := r.PostgreSQL.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to touch layer %d: %w", id, err)
+	}
+	return nil
+}
+
+func (r LayerRepo) DeleteLayer(ctx context.Context, id types.ID) error {
+	query := `delete from layers where id = $1;`
+	if _, err := r.PostgreSQL.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete layer %d: %w", id, err)
+	}
+	return nil
+}
+
 func (r LayerRepo) GetLayerByName(ctx context.Context, name string) (service.LayerEntity, error) {
-	query := `select * from layers where name = $1;`
+	query := `select ` + layerColumns + ` from layers where name = $1;`
 
-	var layer service.LayerEntity
-	err := r.PostgreSQL.QueryRowContext(ctx, query, name).Scan(&layer.ID, &layer.Name, &layer.DefaultStyle, &layer.CreatedAt, &layer.UpdatedAt)
+	layer, err := scanLayer(r.PostgreSQL.QueryRowContext(ctx, query, name))
 	if err != nil {
 		return service.LayerEntity{}, fmt.Errorf("failed to read layer %s: %w", name, err)
 	}
 	return layer, nil
 }
 
+func (r LayerRepo) GetLayerByID(ctx context.Context, id types.ID) (service.LayerEntity, error) {
+	query := `select ` + layerColumns + ` from layers where id = $1;`
+
+	layer, err := scanLayer(r.PostgreSQL.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return service.LayerEntity{}, fmt.Errorf("failed to read layer %d: %w", id, err)
+	}
+	return layer, nil
+}
+
+func (r LayerRepo) GetLayersByContentHash(ctx context.Context, contentHash string, ownerID types.ID) ([]service.LayerEntity, error) {
+	query := `select ` + layerColumns + ` from layers where content_hash = $1 and coalesce(owner_id, 0) = $2 order by id;`
+
+	rows, err := r.PostgreSQL.QueryContext(ctx, query, contentHash, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layers of content hash %s: %w", contentHash, err)
+	}
+	defer rows.Close()
+
+	layers := make([]service.LayerEntity, 0)
+	for rows.Next() {
+		layer, err := scanLayer(rows)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, rows.Err()
+}
+
+func (r LayerRepo) UpdateLayerStatistics(ctx context.Context, id types.ID, statistics service.LayerStatistics) error {
+	data, err := json.Marshal(statistics)
+	if err != nil {
+		return fmt.Errorf("failed to marshal statistics of layer %d: %w", id, err)
+	}
+
+	// the extent is kept as a geometry too so the catalog can filter on it with an index
+	query := `update layers set statistics = $1,
+		extent = case when $1::jsonb -> 'extent' is null or jsonb_typeof($1::jsonb -> 'extent') <> 'object' then null
+			else ST_MakeEnvelope(($1::jsonb -> 'extent' ->> 'min_x')::float8, ($1::jsonb -> 'extent' ->> 'min_y')::float8,
+				($1::jsonb -> 'extent' ->> 'max_x')::float8, ($1::jsonb -> 'extent' ->> 'max_y')::float8, 4326) end,
+		updated_at = now() where id = $2;`
+	if _, err := r.PostgreSQL.ExecContext(ctx, query, data, id); err != nil {
+		return fmt.Errorf("failed to update statistics of layer %d: %w", id, err)
+	}
+	return nil
+}
+
+// scanLayer reads the layerColumns of a *sql.Row or *sql.Rows
+func scanLayer(row interface{ Scan(dest ...any) error }) (service.LayerEntity, error) {
+	var (
+		layer      service.LayerEntity
+		statistics []byte
+		metadata   []byte
+		layerTime  service.LayerTime
+		zooms      pq.Int64Array
+	)
+	err := row.Scan(&layer.ID, &layer.Name, &layer.GeomType, &layer.SRID, &layer.DefaultStyle, &statistics, &layer.ContentHash,
+		&layer.OwnerID, &layer.Visibility, &layer.Organization, pq.Array(&layer.Tags), &metadata,
+		&layerTime.StartAttribute, &layerTime.EndAttribute, &zooms, &layer.CreatedAt, &layer.UpdatedAt)
+	if err != nil {
+		return service.LayerEntity{}, err
+	}
+
+	if layerTime.StartAttribute != "" {
+		layer.Time = &layerTime
+	}
+	for _, zoom := range zooms {
+		layer.GeneralizedZooms = append(layer.GeneralizedZooms, int(zoom))
+	}
+
+	if len(statistics) > 0 {
+		layer.Statistics = &service.LayerStatistics{}
+		if err := json.Unmarshal(statistics, layer.Statistics); err != nil {
+			return service.LayerEntity{}, fmt.Errorf("failed to unmarshal layer statistics: %w", err)
+		}
+	}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &layer.Metadata); err != nil {
+			return service.LayerEntity{}, fmt.Errorf("failed to unmarshal layer metadata: %w", err)
+		}
+	}
+	return layer, nil
+}
+
 func (r LayerRepo) CreateStyle(ctx context.Context, style service.StyleEntity) (types.ID, error) {
 	query := `insert into styles(file_path) values($1) returning id;`
 	var id types.ID
@@ -73,3 +321,13 @@ func (r LayerRepo) CreateStyle(ctx context.Context, style service.StyleEntity) (
 	}
 	return id, nil
 }
+
+// DeleteStyle removes a style and returns the path of its SLD file, sql.ErrNoRows is returned for an unknown style
+func (r LayerRepo) DeleteStyle(ctx context.Context, id types.ID) (string, error) {
+	query := `delete from styles where id = $1 returning file_path;`
+	var filePath string
+	if err := r.PostgreSQL.QueryRowContext(ctx, query, id).Scan(&filePath); err != nil {
+		return "", fmt.Errorf("failed to delete style %d: %w", id, err)
+	}
+	return filePath, nil
+}
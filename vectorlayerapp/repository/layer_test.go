@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gocastsian/roham/types"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceLayerTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`drop table if exists "roads";`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`drop table if exists "roads_quarantine";`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`drop table if exists "roads_generalized";`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	// the index and sequence ogr2ogr named after the staging table follow it, a later re-import needs their names
+	mock.ExpectQuery(regexp.QuoteMeta(`select distinct c.relname, c.relkind from pg_depend d`)).
+		WithArgs(`"roads_staging"`).
+		WillReturnRows(sqlmock.NewRows([]string{"relname", "relkind"}).
+			AddRow("roads_staging_pkey", "i").
+			AddRow("roads_staging_ogc_fid_seq", "S"))
+	mock.ExpectExec(regexp.QuoteMeta(`alter index "roads_staging_pkey" rename to "roads_pkey";`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`alter sequence "roads_staging_ogc_fid_seq" rename to "roads_ogc_fid_seq";`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`alter table "roads_staging" rename to "roads";`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`select to_regclass($1) is not null;`)).
+		WithArgs(`"roads_staging_quarantine"`).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(regexp.QuoteMeta(`update layers set generalized_zooms = null, updated_at = now() where id = $1;`)).
+		WithArgs(types.ID(12)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`update layers set time_start_attribute = NULLIF($1, '')`)).
+		WithArgs("opened_at", "", types.ID(12)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = LayerRepo{PostgreSQL: db}.ReplaceLayerTable(context.Background(), 12, "roads_staging", "roads",
+		&service.LayerTime{StartAttribute: "opened_at"})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+// approximate length of one degree of latitude in meters, used to turn a tolerance into a bounding box
+const metersPerDegree = 111_320.0
+
+// LookupFeatures returns the features of layer that contain the point, or for line and point layers lie within
+// tolerance meters of it. Results are cached per layer version, a re-import or new statistics change the key
+func (r LayerRepo) LookupFeatures(ctx context.Context, layer service.LayerEntity, point service.LookupPoint, tolerance float64, limit int,
+	filter service.FeatureFilter) ([]service.LookupFeature, error) {
+	key := fmt.Sprintf("%s:lookup:%d:%d:%.6f:%.6f:%g:%d:%s", r.Config.CachePrefix, layer.ID, layer.UpdatedAt.UnixNano(),
+		point.Lat, point.Lon, tolerance, limit, filter.CacheKey())
+	if r.cacheEnabled() {
+		if data, err := r.Cache.Get(ctx, key); err == nil {
+			var features []service.LookupFeature
+			if json.Unmarshal(data, &features) == nil {
+				return features, nil
+			}
+		}
+	}
+
+	features, err := r.lookupFeatures(ctx, layer, point, tolerance, limit, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.cacheEnabled() {
+		if data, err := json.Marshal(features); err == nil {
+			// a failed write only costs the next request a query, Set logs it already
+			_ = r.Cache.Set(ctx, key, data)
+		}
+	}
+	return features, nil
+}
+
+// degreeBox turns a distance in meters around point into the half width and height of a box in degrees
+func degreeBox(point service.LookupPoint, meters float64) (float64, float64) {
+	dy := meters / metersPerDegree
+	return dy / math.Max(math.Cos(point.Lat*math.Pi/180), 0.01), dy
+}
+
+func (r LayerRepo) lookupFeatures(ctx context.Context, layer service.LayerEntity, point service.LookupPoint, tolerance float64, limit int,
+	filter service.FeatureFilter) ([]service.LookupFeature, error) {
+	geom := pq.QuoteIdentifier(geometryColumn)
+	fid := pq.QuoteIdentifier(fidColumn)
+	pt := `ST_SetSRID(ST_MakePoint($1, $2), 4326)`
+	// distances are measured on the spheroid whatever system the layer is stored in, ST_Transform is a no-op for 4326
+	geography := fmt.Sprintf(`ST_Transform(%s, 4326)::geography`, geom)
+
+	// every condition starts with a bounding box operator so the GiST index ogr2ogr creates is used
+	var condition string
+	args := []interface{}{point.Lon, point.Lat}
+	if strings.Contains(strings.ToUpper(layer.GeomType), "POLYGON") || tolerance <= 0 {
+		condition = fmt.Sprintf(`%[1]s && ST_Transform(%[2]s, %[3]d) and ST_Intersects(%[1]s, ST_Transform(%[2]s, %[3]d))`,
+			geom, pt, layer.SRID)
+	} else {
+		dx, dy := degreeBox(point, tolerance)
+		condition = fmt.Sprintf(`%[1]s && ST_Transform(ST_Expand(%[2]s, $3, $4), %[3]d) and ST_DWithin(%[4]s, %[2]s::geography, $5)`,
+			geom, pt, layer.SRID, geography)
+		args = append(args, dx, dy, tolerance)
+	}
+	filterCondition, args, err := featureCondition(layer, filter, args)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`select %[1]s, ST_Distance(%[2]s, %[3]s::geography), to_jsonb(t) - '%[4]s' - '%[5]s'
+		from %[6]s as t where %[7]s and %[9]s order by 2, 1 limit %[8]d;`,
+		fid, geography, pt, geometryColumn, fidColumn, pq.QuoteIdentifier(layer.Name), condition, limit, filterCondition)
+
+	rows, err := r.PostgreSQL.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up features of %s: %w", layer.Name, err)
+	}
+	defer rows.Close()
+
+	features := make([]service.LookupFeature, 0)
+	for rows.Next() {
+		var (
+			feature    service.LookupFeature
+			properties []byte
+		)
+		if err := rows.Scan(&feature.ID, &feature.Distance, &properties); err != nil {
+			return nil, fmt.Errorf("failed to scan feature of %s: %w", layer.Name, err)
+		}
+		if err := json.Unmarshal(properties, &feature.Properties); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal properties of %s: %w", layer.Name, err)
+		}
+		features = append(features, feature)
+	}
+	return features, rows.Err()
+}
@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gocastsian/roham/types"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+const mapProjectColumns = `id, name, description, coalesce(owner_id, 0), visibility, coalesce(organization, ''),
+	center_lon, center_lat, zoom, basemap, created_at, updated_at`
+
+func (r LayerRepo) CreateMapProject(ctx context.Context, project service.MapProjectEntity) (types.ID, error) {
+	basemap, err := marshalBasemap(project.Basemap)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.PostgreSQL.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `insert into map_projects(name, description, owner_id, visibility, organization, center_lon, center_lat, zoom, basemap)
+		values ($1, $2, NULLIF($3, 0), $4, NULLIF($5, ''), $6, $7, $8, $9) returning id;`
+
+	var id types.ID
+	err = tx.QueryRowContext(ctx, query, project.Name, project.Description, project.OwnerID, project.Visibility, project.Organization,
+		project.View.Center.Lon, project.View.Center.Lat, project.View.Zoom, basemap).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create map: %w", err)
+	}
+
+	if err := insertMapProjectLayers(ctx, tx, id, project.Layers); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// UpdateMapProject replaces the view, the basemap and the layer list of a map
+func (r LayerRepo) UpdateMapProject(ctx context.Context, project service.MapProjectEntity) error {
+	basemap, err := marshalBasemap(project.Basemap)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.PostgreSQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `update map_projects set name = $1, description = $2, visibility = $3, center_lon = $4, center_lat = $5,
+		zoom = $6, basemap = $7, updated_at = now() where id = $8;`
+	_, err = tx.ExecContext(ctx, query, project.Name, project.Description, project.Visibility,
+		project.View.Center.Lon, project.View.Center.Lat, project.View.Zoom, basemap, project.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update map %d: %w", project.ID, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `delete from map_project_layers where map_id = $1;`, project.ID); err != nil {
+		return fmt.Errorf("failed to clear layers of map %d: %w", project.ID, err)
+	}
+	if err := insertMapProjectLayers(ctx, tx, project.ID, project.Layers); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertMapProjectLayers(ctx context.Context, tx *sql.Tx, mapID types.ID, layers []service.MapProjectLayer) error {
+	query := `insert into map_project_layers(map_id, position, layer_id, opacity, visible, style_id, min_zoom, max_zoom)
+		values ($1, $2, $3, $4, $5, NULLIF($6, 0), $7, $8);`
+	for _, layer := range layers {
+		_, err := tx.ExecContext(ctx, query, mapID, layer.Order, layer.LayerID, layer.Opacity, layer.Visible,
+			layer.StyleID, layer.MinZoom, layer.MaxZoom)
+		if err != nil {
+			return fmt.Errorf("failed to add layer %d to map %d: %w", layer.LayerID, mapID, err)
+		}
+	}
+	return nil
+}
+
+func (r LayerRepo) GetMapProject(ctx context.Context, id types.ID) (service.MapProjectEntity, error) {
+	query := `select ` + mapProjectColumns + ` from map_projects where id = $1;`
+
+	project, err := scanMapProject(r.PostgreSQL.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return service.MapProjectEntity{}, fmt.Errorf("failed to read map %d: %w", id, err)
+	}
+
+	layers, err := r.getMapProjectLayers(ctx, []types.ID{id})
+	if err != nil {
+		return service.MapProjectEntity{}, err
+	}
+	project.Layers = layers[id]
+	return project, nil
+}
+
+// ListMapProjects returns one page of the maps the filter may see, most recently changed first, with the total count
+func (r LayerRepo) ListMapProjects(ctx context.Context, filter service.MapProjectFilter) ([]service.MapProjectEntity, int64, error) {
+	where := ""
+	args := []interface{}{filter.Limit, filter.Offset}
+	if !filter.AllMaps {
+		where = `where visibility = 'public'
+			or (owner_id = $3 and $3 <> 0)
+			or (visibility = 'organization' and organization = $4 and $4 <> '')
+			or exists (select 1 from map_project_shares s where s.map_id = map_projects.id and s.user_id = $3)`
+		args = append(args, filter.ReaderID, filter.ReaderOrganization)
+	}
+	query := fmt.Sprintf(`select %s, count(*) over () from map_projects %s order by updated_at desc, id limit $1 offset $2;`,
+		mapProjectColumns, where)
+
+	rows, err := r.PostgreSQL.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list maps: %w", err)
+	}
+	defer rows.Close()
+
+	var total int64
+	projects := make([]service.MapProjectEntity, 0)
+	ids := make([]types.ID, 0)
+	for rows.Next() {
+		project, err := scanMapProject(totalScanner{rows: rows, total: &total})
+		if err != nil {
+			return nil, 0, err
+		}
+		projects = append(projects, project)
+		ids = append(ids, project.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	layers, err := r.getMapProjectLayers(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range projects {
+		projects[i].Layers = layers[projects[i].ID]
+	}
+	return projects, total, nil
+}
+
+// getMapProjectLayers reads the layers of several maps at once, keyed by map id and ordered bottom up
+func (r LayerRepo) getMapProjectLayers(ctx context.Context, mapIDs []types.ID) (map[types.ID][]service.MapProjectLayer, error) {
+	query := `select m.map_id, m.position, m.layer_id, m.opacity, m.visible, coalesce(m.style_id, 0), m.min_zoom, m.max_zoom,
+			l.name, l.geom_type
+		from map_project_layers m join layers l on l.id = m.layer_id
+		where m.map_id = any($1) order by m.map_id, m.position;`
+
+	ids := make([]int64, 0, len(mapIDs))
+	for _, id := range mapIDs {
+		ids = append(ids, int64(id))
+	}
+	rows, err := r.PostgreSQL.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read map layers: %w", err)
+	}
+	defer rows.Close()
+
+	layers := make(map[types.ID][]service.MapProjectLayer, len(mapIDs))
+	for _, id := range mapIDs {
+		layers[id] = make([]service.MapProjectLayer, 0)
+	}
+	for rows.Next() {
+		var (
+			mapID types.ID
+			layer service.MapProjectLayer
+		)
+		err := rows.Scan(&mapID, &layer.Order, &layer.LayerID, &layer.Opacity, &layer.Visible, &layer.StyleID,
+			&layer.MinZoom, &layer.MaxZoom, &layer.LayerName, &layer.GeomType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan map layer: %w", err)
+		}
+		layers[mapID] = append(layers[mapID], layer)
+	}
+	return layers, rows.Err()
+}
+
+func (r LayerRepo) DeleteMapProject(ctx context.Context, id types.ID) error {
+	query := `delete from map_projects where id = $1;`
+	if _, err := r.PostgreSQL.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete map %d: %w", id, err)
+	}
+	return nil
+}
+
+func (r LayerRepo) GetMapProjectShares(ctx context.Context, mapID types.ID) ([]service.MapProjectShareEntity, error) {
+	query := `select map_id, user_id, permission, created_at, updated_at from map_project_shares where map_id = $1 order by user_id;`
+
+	rows, err := r.PostgreSQL.QueryContext(ctx, query, mapID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shares of map %d: %w", mapID, err)
+	}
+	defer rows.Close()
+
+	shares := make([]service.MapProjectShareEntity, 0)
+	for rows.Next() {
+		var share service.MapProjectShareEntity
+		if err := rows.Scan(&share.MapID, &share.UserID, &share.Permission, &share.CreatedAt, &share.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan share of map %d: %w", mapID, err)
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+func (r LayerRepo) UpsertMapProjectShare(ctx context.Context, share service.MapProjectShareEntity) (service.MapProjectShareEntity, error) {
+	query := `insert into map_project_shares(map_id, user_id, permission) values ($1, $2, $3)
+		on conflict (map_id, user_id) do update set permission = excluded.permission, updated_at = now()
+		returning created_at, updated_at;`
+
+	err := r.PostgreSQL.QueryRowContext(ctx, query, share.MapID, share.UserID, share.Permission).Scan(&share.CreatedAt, &share.UpdatedAt)
+	if err != nil {
+		return service.MapProjectShareEntity{}, fmt.Errorf("failed to share map %d with user %d: %w", share.MapID, share.UserID, err)
+	}
+	return share, nil
+}
+
+func (r LayerRepo) DeleteMapProjectShare(ctx context.Context, mapID types.ID, userID types.ID) error {
+	query := `delete from map_project_shares where map_id = $1 and user_id = $2;`
+	if _, err := r.PostgreSQL.ExecContext(ctx, query, mapID, userID); err != nil {
+		return fmt.Errorf("failed to revoke share of map %d from user %d: %w", mapID, userID, err)
+	}
+	return nil
+}
+
+// scanMapProject reads the mapProjectColumns of a *sql.Row or *sql.Rows, the layers are read separately
+func scanMapProject(row interface{ Scan(dest ...any) error }) (service.MapProjectEntity, error) {
+	var (
+		project service.MapProjectEntity
+		basemap []byte
+	)
+	err := row.Scan(&project.ID, &project.Name, &project.Description, &project.OwnerID, &project.Visibility, &project.Organization,
+		&project.View.Center.Lon, &project.View.Center.Lat, &project.View.Zoom, &basemap, &project.CreatedAt, &project.UpdatedAt)
+	if err != nil {
+		return service.MapProjectEntity{}, err
+	}
+
+	if len(basemap) > 0 {
+		project.Basemap = &service.Basemap{}
+		if err := json.Unmarshal(basemap, project.Basemap); err != nil {
+			return service.MapProjectEntity{}, fmt.Errorf("failed to unmarshal basemap of map %d: %w", project.ID, err)
+		}
+	}
+	return project, nil
+}
+
+func marshalBasemap(basemap *service.Basemap) ([]byte, error) {
+	if basemap == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(basemap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal basemap: %w", err)
+	}
+	return data, nil
+}
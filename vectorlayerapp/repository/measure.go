@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+)
+
+func (r LayerRepo) GetSpatialReference(ctx context.Context, srid service.EPSGCode) (service.SpatialReference, error) {
+	query := `select srid, coalesce(proj4text, '') from spatial_ref_sys where srid = $1;`
+
+	var reference service.SpatialReference
+	if err := r.PostgreSQL.QueryRowContext(ctx, query, srid).Scan(&reference.SRID, &reference.Proj4); err != nil {
+		return service.SpatialReference{}, fmt.Errorf("failed to read spatial reference %s: %w", srid, err)
+	}
+	return reference, nil
+}
+
+func (r LayerRepo) TransformGeometry(ctx context.Context, geometry json.RawMessage, from service.EPSGCode, to service.EPSGCode) (json.RawMessage, error) {
+	query := `select ST_AsGeoJSON(ST_Transform(ST_SetSRID(ST_GeomFromGeoJSON($1), $2), $3));`
+
+	var transformed []byte
+	if err := r.PostgreSQL.QueryRowContext(ctx, query, string(geometry), from, to).Scan(&transformed); err != nil {
+		return nil, fmt.Errorf("failed to transform geometry from %s to %s: %w", from, to, err)
+	}
+	return transformed, nil
+}
+
+// MeasureGeometry measures a geometry in srid. Geodesic measurements are taken on the geography of the geometry,
+// which PostGIS computes on the WGS 84 spheroid, planar ones on the geometry itself in the units of srid
+func (r LayerRepo) MeasureGeometry(ctx context.Context, geometry json.RawMessage, srid service.EPSGCode,
+	method service.MeasurementMethod) (service.GeometryMeasurements, error) {
+	measured := `geom`
+	centroid := `ST_Centroid(geom)`
+	if method == service.MeasurementGeodesic {
+		measured = `ST_Transform(geom, 4326)::geography`
+		centroid = `ST_Transform(ST_Centroid(ST_Transform(geom, 4326)::geography)::geometry, $2)`
+	}
+
+	query := fmt.Sprintf(`with input as (select ST_SetSRID(ST_GeomFromGeoJSON($1), $2) as geom)
+		select ST_Dimension(geom), ST_Area(%[1]s), ST_Length(%[1]s), ST_Perimeter(%[1]s), ST_AsGeoJSON(%[2]s) from input;`,
+		measured, centroid)
+
+	var (
+		measurements service.GeometryMeasurements
+		center       []byte
+	)
+	err := r.PostgreSQL.QueryRowContext(ctx, query, string(geometry), srid).Scan(&measurements.Dimension, &measurements.Area,
+		&measurements.Length, &measurements.Perimeter, &center)
+	if err != nil {
+		return service.GeometryMeasurements{}, fmt.Errorf("failed to measure geometry in %s: %w", srid, err)
+	}
+	measurements.Centroid = center
+	return measurements, nil
+}
@@ -0,0 +1,9 @@
+-- +migrate Up
+
+ALTER TABLE layers
+    ADD COLUMN statistics JSONB;
+
+-- +migrate Down
+
+ALTER TABLE layers
+    DROP COLUMN IF EXISTS statistics;
@@ -0,0 +1,9 @@
+-- +migrate Up
+
+ALTER TABLE jobs
+    ADD COLUMN result JSONB;
+
+-- +migrate Down
+
+ALTER TABLE jobs
+    DROP COLUMN IF EXISTS result;
@@ -0,0 +1,11 @@
+-- +migrate Up
+
+ALTER TABLE jobs
+    ADD COLUMN user_id         BIGINT,
+    ADD COLUMN idempotency_key VARCHAR(255) UNIQUE;
+
+-- +migrate Down
+
+ALTER TABLE jobs
+    DROP COLUMN IF EXISTS idempotency_key,
+    DROP COLUMN IF EXISTS user_id;
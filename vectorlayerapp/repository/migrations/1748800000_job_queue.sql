@@ -0,0 +1,21 @@
+-- +migrate Up
+create table job_queue
+(
+    id            bigserial primary key,
+    workflow_id   varchar(199) not null unique,
+    workflow_name varchar(199) not null,
+    payload       jsonb        not null,
+    status        varchar(20)  not null default 'pending',
+    attempts      int          not null default 0,
+    last_error    text,
+    run_at        TIMESTAMP    not null default NOW(),
+    locked_at     TIMESTAMP,
+    created_at    TIMESTAMP DEFAULT NOW(),
+    updated_at    TIMESTAMP DEFAULT NOW()
+);
+
+create index job_queue_claim_idx on job_queue (status, run_at);
+
+-- +migrate Down
+
+drop table job_queue;
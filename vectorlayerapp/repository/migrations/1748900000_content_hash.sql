@@ -0,0 +1,17 @@
+-- +migrate Up
+
+ALTER TABLE layers
+    ADD COLUMN content_hash VARCHAR(64);
+CREATE INDEX layers_content_hash_idx ON layers (content_hash);
+
+ALTER TABLE jobs
+    ADD COLUMN content_hash VARCHAR(64);
+
+-- +migrate Down
+
+ALTER TABLE jobs
+    DROP COLUMN IF EXISTS content_hash;
+
+DROP INDEX IF EXISTS layers_content_hash_idx;
+ALTER TABLE layers
+    DROP COLUMN IF EXISTS content_hash;
@@ -0,0 +1,30 @@
+-- +migrate Up
+
+ALTER TABLE layers
+    ADD COLUMN owner_id     BIGINT,
+    ADD COLUMN visibility   VARCHAR(20) NOT NULL DEFAULT 'private',
+    ADD COLUMN organization VARCHAR(100),
+    ADD COLUMN tags         TEXT[]      NOT NULL DEFAULT '{}';
+
+-- layers imported before ownership existed have no owner, keep them readable by everyone as they were
+UPDATE layers SET visibility = 'public' WHERE owner_id IS NULL;
+
+CREATE TABLE layer_shares
+(
+    layer_id   BIGINT      NOT NULL REFERENCES layers (id) ON DELETE CASCADE,
+    user_id    BIGINT      NOT NULL,
+    permission VARCHAR(10) NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (layer_id, user_id)
+);
+
+-- +migrate Down
+
+DROP TABLE layer_shares;
+
+ALTER TABLE layers
+    DROP COLUMN IF EXISTS tags,
+    DROP COLUMN IF EXISTS organization,
+    DROP COLUMN IF EXISTS visibility,
+    DROP COLUMN IF EXISTS owner_id;
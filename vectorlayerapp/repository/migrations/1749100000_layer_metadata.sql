@@ -0,0 +1,30 @@
+-- +migrate Up
+
+ALTER TABLE layers
+    ADD COLUMN metadata      JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN extent        geometry(Polygon, 4326),
+    ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(metadata ->> 'title', '') || ' ' || name), 'A') ||
+        setweight(to_tsvector('simple', coalesce(metadata ->> 'keywords', '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(metadata ->> 'description', '') || ' ' ||
+                                        coalesce(metadata ->> 'source', '')), 'C')
+        ) STORED;
+
+CREATE INDEX layers_search_vector_idx ON layers USING GIN (search_vector);
+CREATE INDEX layers_extent_idx ON layers USING GIST (extent);
+
+UPDATE layers
+SET extent = ST_MakeEnvelope((statistics -> 'extent' ->> 'min_x')::float8, (statistics -> 'extent' ->> 'min_y')::float8,
+                             (statistics -> 'extent' ->> 'max_x')::float8, (statistics -> 'extent' ->> 'max_y')::float8, 4326)
+WHERE statistics -> 'extent' IS NOT NULL
+  AND jsonb_typeof(statistics -> 'extent') = 'object';
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS layers_extent_idx;
+DROP INDEX IF EXISTS layers_search_vector_idx;
+
+ALTER TABLE layers
+    DROP COLUMN IF EXISTS search_vector,
+    DROP COLUMN IF EXISTS extent,
+    DROP COLUMN IF EXISTS metadata;
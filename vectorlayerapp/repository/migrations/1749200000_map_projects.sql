@@ -0,0 +1,51 @@
+-- +migrate Up
+
+CREATE TABLE map_projects
+(
+    id           BIGSERIAL PRIMARY KEY,
+    name         VARCHAR(255)     NOT NULL,
+    description  TEXT             NOT NULL DEFAULT '',
+    owner_id     BIGINT,
+    visibility   VARCHAR(20)      NOT NULL DEFAULT 'private',
+    organization VARCHAR(100),
+    center_lon   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    center_lat   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    zoom         DOUBLE PRECISION NOT NULL DEFAULT 0,
+    basemap      JSONB,
+    created_at   TIMESTAMP DEFAULT NOW(),
+    updated_at   TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX map_projects_owner_id_idx ON map_projects (owner_id);
+
+-- a layer deleted from the catalog disappears from every map using it
+CREATE TABLE map_project_layers
+(
+    map_id   BIGINT           NOT NULL REFERENCES map_projects (id) ON DELETE CASCADE,
+    position INT              NOT NULL,
+    layer_id BIGINT           NOT NULL REFERENCES layers (id) ON DELETE CASCADE,
+    opacity  DOUBLE PRECISION NOT NULL DEFAULT 1,
+    visible  BOOLEAN          NOT NULL DEFAULT TRUE,
+    style_id BIGINT REFERENCES styles (id) ON DELETE SET NULL,
+    min_zoom DOUBLE PRECISION NOT NULL DEFAULT 0,
+    max_zoom DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (map_id, position)
+);
+
+CREATE INDEX map_project_layers_layer_id_idx ON map_project_layers (layer_id);
+
+CREATE TABLE map_project_shares
+(
+    map_id     BIGINT      NOT NULL REFERENCES map_projects (id) ON DELETE CASCADE,
+    user_id    BIGINT      NOT NULL,
+    permission VARCHAR(10) NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (map_id, user_id)
+);
+
+-- +migrate Down
+
+DROP TABLE map_project_shares;
+DROP TABLE map_project_layers;
+DROP TABLE map_projects;
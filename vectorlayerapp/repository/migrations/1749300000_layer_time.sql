@@ -0,0 +1,11 @@
+-- +migrate Up
+
+ALTER TABLE layers
+    ADD COLUMN time_start_attribute VARCHAR(63),
+    ADD COLUMN time_end_attribute   VARCHAR(63);
+
+-- +migrate Down
+
+ALTER TABLE layers
+    DROP COLUMN IF EXISTS time_end_attribute,
+    DROP COLUMN IF EXISTS time_start_attribute;
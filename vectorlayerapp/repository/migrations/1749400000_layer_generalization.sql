@@ -0,0 +1,9 @@
+-- +migrate Up
+
+ALTER TABLE layers
+    ADD COLUMN generalized_zooms INTEGER[];
+
+-- +migrate Down
+
+ALTER TABLE layers
+    DROP COLUMN IF EXISTS generalized_zooms;
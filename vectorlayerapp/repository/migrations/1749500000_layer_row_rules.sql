@@ -0,0 +1,18 @@
+-- +migrate Up
+
+-- a row rule keeps the features of a layer whose attribute equals a claim of the reading user
+CREATE TABLE layer_row_rules
+(
+    id           BIGSERIAL PRIMARY KEY,
+    layer_id     BIGINT      NOT NULL REFERENCES layers (id) ON DELETE CASCADE,
+    attribute    VARCHAR(63) NOT NULL,
+    claim        VARCHAR(20) NOT NULL,
+    exempt_roles SMALLINT[]  NOT NULL DEFAULT '{}',
+    created_at   TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX layer_row_rules_layer_id_idx ON layer_row_rules (layer_id);
+
+-- +migrate Down
+
+DROP TABLE layer_row_rules;
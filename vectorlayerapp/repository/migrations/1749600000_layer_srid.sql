@@ -0,0 +1,10 @@
+-- +migrate Up
+
+-- layers were always imported in EPSG:4326, a reprojection moves their table to another system
+ALTER TABLE layers
+    ADD COLUMN srid INTEGER NOT NULL DEFAULT 4326;
+
+-- +migrate Down
+
+ALTER TABLE layers
+    DROP COLUMN IF EXISTS srid;
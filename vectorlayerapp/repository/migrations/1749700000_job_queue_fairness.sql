@@ -0,0 +1,15 @@
+-- +migrate Up
+
+-- an import only starts processing once its user and organization are under their limits, the running and
+-- waiting jobs are counted from here
+ALTER TABLE jobs
+    ADD COLUMN priority     VARCHAR(32) NOT NULL DEFAULT 'interactive',
+    ADD COLUMN organization VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX jobs_status_created_at_idx ON jobs (status, created_at);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS jobs_status_created_at_idx;
+ALTER TABLE jobs
+    DROP COLUMN IF EXISTS organization,
+    DROP COLUMN IF EXISTS priority;
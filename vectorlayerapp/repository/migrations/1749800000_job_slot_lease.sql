@@ -0,0 +1,12 @@
+-- +migrate Up
+
+-- a processing job holds its slot until it finishes or its lease runs out, a workflow that was terminated or
+-- timed out never finishes its job itself
+ALTER TABLE jobs
+    ADD COLUMN slot_acquired_at TIMESTAMP;
+UPDATE jobs SET slot_acquired_at = updated_at WHERE status = 'processing';
+
+-- +migrate Down
+
+ALTER TABLE jobs
+    DROP COLUMN IF EXISTS slot_acquired_at;
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+// nearestCandidates is how many times k features the KNN index is asked for, the index orders them by planar
+// distance in the system of the layer and the geodesic distance picks the k nearest among them
+const nearestCandidates = 4
+
+// NearestFeatures returns the k features of layer matching filter closest to point, within maxDistance meters
+// when it is set
+func (r LayerRepo) NearestFeatures(ctx context.Context, layer service.LayerEntity, point service.LookupPoint, k int,
+	maxDistance *float64, filter service.FeatureFilter) ([]service.NearestFeature, error) {
+	geom := "t." + pq.QuoteIdentifier(geometryColumn)
+	pt := `ST_SetSRID(ST_MakePoint($1, $2), 4326)`
+
+	args := []interface{}{point.Lon, point.Lat}
+	within := "true"
+	if maxDistance != nil {
+		// the box keeps the GiST index in use, ST_DWithin measures on the spheroid
+		dx, dy := degreeBox(point, *maxDistance)
+		args = append(args, dx, dy, *maxDistance)
+		within = fmt.Sprintf(`%[1]s && ST_Transform(ST_Expand(%[2]s, $3, $4), %[3]d)
+			and ST_DWithin(ST_Transform(%[1]s, 4326)::geography, %[2]s::geography, $5)`, geom, pt, layer.SRID)
+	}
+	condition, args, err := featureCondition(layer, filter, args)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`select c.id, ST_AsGeoJSON(c.wgs84), c.distance,
+			degrees(ST_Azimuth(%[1]s::geography, ST_ClosestPoint(c.wgs84, %[1]s)::geography)), c.properties
+		from (
+			select t.%[2]s as id, ST_Transform(%[3]s, 4326) as wgs84,
+				ST_Distance(ST_Transform(%[3]s, 4326)::geography, %[1]s::geography) as distance,
+				to_jsonb(t) - '%[4]s' - '%[5]s' as properties
+			from %[6]s as t
+			where %[3]s is not null and %[7]s and %[8]s
+			order by %[3]s <-> ST_Transform(%[1]s, %[9]d)
+			limit %[10]d
+		) as c
+		order by c.distance, c.id limit %[11]d;`,
+		pt, pq.QuoteIdentifier(fidColumn), geom, geometryColumn, fidColumn, pq.QuoteIdentifier(layer.Name), within,
+		condition, layer.SRID, k*nearestCandidates, k)
+
+	rows, err := r.PostgreSQL.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find features of %s nearest to %g,%g: %w", layer.Name, point.Lat, point.Lon, err)
+	}
+	defer rows.Close()
+
+	features := make([]service.NearestFeature, 0, k)
+	for rows.Next() {
+		feature := service.NearestFeature{Type: "Feature"}
+		var geometry, properties []byte
+		if err := rows.Scan(&feature.ID, &geometry, &feature.Distance, &feature.Bearing, &properties); err != nil {
+			return nil, fmt.Errorf("failed to scan feature of %s: %w", layer.Name, err)
+		}
+		feature.Geometry = geometry
+		if err := json.Unmarshal(properties, &feature.Properties); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal properties of %s: %w", layer.Name, err)
+		}
+		features = append(features, feature)
+	}
+	return features, rows.Err()
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gocastsian/roham/types"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+// jobRank orders the waiting jobs aliased %[1]s by the priority classes in $2, unknown classes come last
+const jobRank = `coalesce(array_position($2::text[], %[1]s.priority::text), array_length($2::text[], 1) + 1)`
+
+// underLimits holds when the user and organization of the job aliased %[1]s run fewer jobs than $3 and $4
+const underLimits = `($3 = 0 or (select count(*) from jobs r where r.status = 'processing' and r.user_id = %[1]s.user_id) < $3)
+	and ($4 = 0 or %[1]s.organization = '' or
+		(select count(*) from jobs r where r.status = 'processing' and r.organization = %[1]s.organization) < $4)`
+
+// AcquireJobSlot moves a pending job to processing when its user and organization are under the limits of slot
+// and no job ahead of it could take the slot instead, jobs are ahead by priority class and then by age as
+// GetJobQueuePosition counts them. Slots are handed out one at a time under an advisory lock, a job that is
+// already processing keeps its slot. Jobs whose lease ran out are failed first, their workflows were terminated,
+// timed out or abandoned without releasing their slot
+func (r LayerRepo) AcquireJobSlot(ctx context.Context, token string, slot service.JobSlot) (bool, error) {
+	tx, err := r.PostgreSQL.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `select pg_advisory_xact_lock(hashtext('jobs_slots'));`); err != nil {
+		return false, fmt.Errorf("failed to lock job slots: %w", err)
+	}
+
+	expire := `update jobs set status = 'failed', error = 'abandoned, the job held its slot for longer than ' || $1,
+		updated_at = now()
+		where status = 'processing' and slot_acquired_at < now() - make_interval(secs => $2);`
+	if _, err := tx.ExecContext(ctx, expire, slot.Lease.String(), slot.Lease.Seconds()); err != nil {
+		return false, fmt.Errorf("failed to release expired job slots: %w", err)
+	}
+
+	var status service.JobStatus
+	if err := tx.QueryRowContext(ctx, `select status from jobs where token = $1;`, token).Scan(&status); err != nil {
+		return false, err
+	}
+	switch status {
+	case service.JobStatusProcessing:
+		return true, tx.Commit()
+	case service.JobStatusPending:
+	default:
+		return false, fmt.Errorf("job %s is already %s", token, status)
+	}
+
+	query := fmt.Sprintf(`update jobs j set status = 'processing', slot_acquired_at = now()
+		where j.token = $1 and %s
+		and not exists (
+			select 1 from jobs w
+			where w.status = 'pending' and w.token <> j.token and (%s, w.created_at, w.id) < (%s, j.created_at, j.id) and %s
+		);`,
+		fmt.Sprintf(underLimits, "j"), fmt.Sprintf(jobRank, "w"), fmt.Sprintf(jobRank, "j"), fmt.Sprintf(underLimits, "w"))
+	res, err := tx.ExecContext(ctx, query, token, pq.Array(priorityNames(slot.Priorities)), slot.UserConcurrency, slot.OrganizationConcurrency)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire slot of job %s: %w", token, err)
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return updated == 1, tx.Commit()
+}
+
+// GetJobQueuePosition counts the pending jobs served before a job plus one, it is zero once the job left the queue
+func (r LayerRepo) GetJobQueuePosition(ctx context.Context, token string, priorities []service.Priority) (int, error) {
+	query := fmt.Sprintf(`select case when j.status = 'pending' then (
+			select count(*) + 1 from jobs w
+			where w.status = 'pending' and (%s, w.created_at, w.id) < (%s, j.created_at, j.id)
+		) else 0 end
+		from jobs j where j.token = $1;`, fmt.Sprintf(jobRank, "w"), fmt.Sprintf(jobRank, "j"))
+
+	var position int
+	if err := r.PostgreSQL.QueryRowContext(ctx, query, token, pq.Array(priorityNames(priorities))).Scan(&position); err != nil {
+		return 0, fmt.Errorf("failed to read queue position of job %s: %w", token, err)
+	}
+	return position, nil
+}
+
+func (r LayerRepo) CountPendingJobs(ctx context.Context, userID types.ID) (int, error) {
+	query := `select count(*) from jobs where status = 'pending' and user_id = $1;`
+	var count int
+	if err := r.PostgreSQL.QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count pending jobs of user %d: %w", userID, err)
+	}
+	return count, nil
+}
+
+func priorityNames(priorities []service.Priority) []string {
+	names := make([]string, 0, len(priorities))
+	for _, priority := range priorities {
+		names = append(names, string(priority))
+	}
+	return names
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireJobSlot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	slot := service.JobSlot{UserConcurrency: 1, Priorities: []service.Priority{"high", "normal"}, Lease: time.Hour}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`select pg_advisory_xact_lock(hashtext('jobs_slots'));`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`update jobs set status = 'failed'`)).
+		WithArgs("1h0m0s", 3600.0).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`select status from jobs where token = $1;`)).
+		WithArgs("import_2").
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(service.JobStatusPending))
+	// a job of the same class that was queued earlier is served first, the order of GetJobQueuePosition
+	mock.ExpectExec(regexp.QuoteMeta(`, w.created_at, w.id) < (coalesce(array_position($2::text[], j.priority::text), array_length($2::text[], 1) + 1), j.created_at, j.id)`)).
+		WithArgs("import_2", pq.Array([]string{"high", "normal"}), 1, 0).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	granted, err := LayerRepo{PostgreSQL: db}.AcquireJobSlot(context.Background(), "import_2", slot)
+	require.NoError(t, err)
+	assert.False(t, granted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
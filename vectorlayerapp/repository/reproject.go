@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gocastsian/roham/types"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+// geometryType returns the geometry type the geometry column of a layer table is declared with, such as MULTIPOLYGON
+func (r LayerRepo) geometryType(ctx context.Context, tableName string) (string, error) {
+	query := `select type from geometry_columns where f_table_schema = current_schema() and f_table_name = $1 and f_geometry_column = $2;`
+
+	var geometryType string
+	if err := r.PostgreSQL.QueryRowContext(ctx, query, tableName, geometryColumn).Scan(&geometryType); err != nil {
+		return "", fmt.Errorf("failed to read geometry type of %s: %w", tableName, err)
+	}
+	return geometryType, nil
+}
+
+// transformColumn is the statement moving the geometry column of table to srid, it keeps the declared geometry type.
+// Changing the type of a column rewrites the table and rebuilds its indexes, the spatial one included
+func transformColumn(table string, geometryType string, srid service.EPSGCode) string {
+	geom := pq.QuoteIdentifier(geometryColumn)
+	return fmt.Sprintf(`alter table %[1]s alter column %[2]s type geometry(%[3]s, %[4]d) using ST_Transform(%[2]s, %[4]d);`,
+		table, geom, geometryType, srid)
+}
+
+// ReprojectLayerTable transforms the geometries of a layer table to srid in place, the srid of the layer is
+// changed in the same transaction so no reader ever queries the table with the wrong system
+func (r LayerRepo) ReprojectLayerTable(ctx context.Context, layerID types.ID, tableName string, srid service.EPSGCode) error {
+	geometryType, err := r.geometryType(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	table := pq.QuoteIdentifier(tableName)
+
+	tx, err := r.PostgreSQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, transformColumn(table, geometryType, srid)); err != nil {
+		return fmt.Errorf("failed to reproject %s to EPSG:%d: %w", tableName, srid, err)
+	}
+	if _, err := tx.ExecContext(ctx, `update layers set srid = $1, updated_at = now() where id = $2;`, srid, layerID); err != nil {
+		return fmt.Errorf("failed to update srid of layer %d: %w", layerID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if _, err := r.PostgreSQL.ExecContext(ctx, fmt.Sprintf(`analyze %s;`, table)); err != nil {
+		return fmt.Errorf("failed to analyze %s: %w", tableName, err)
+	}
+	return nil
+}
+
+// CopyReprojectedTable writes the features of a layer table into a new table with their geometries in srid,
+// the copy gets the primary key and spatial index ogr2ogr gives imported tables. It is marked as created by the
+// job createdBy and an existing target without that mark fails with service.ErrTableTaken
+func (r LayerRepo) CopyReprojectedTable(ctx context.Context, tableName string, targetTable string, srid service.EPSGCode, createdBy string) error {
+	geometryType, err := r.geometryType(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	source := pq.QuoteIdentifier(tableName)
+	target := pq.QuoteIdentifier(targetTable)
+
+	tx, err := r.PostgreSQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// a retried copy replaces what an earlier attempt left behind, any other table of that name is kept
+	var exists bool
+	var marker string
+	query := `select to_regclass($1) is not null, coalesce(obj_description(to_regclass($1), 'pg_class'), '');`
+	if err := tx.QueryRowContext(ctx, query, target).Scan(&exists, &marker); err != nil {
+		return fmt.Errorf("failed to look up table %s: %w", targetTable, err)
+	}
+	if exists && marker != createdByMarker(createdBy) {
+		return service.ErrTableTaken
+	}
+
+	queries := []string{
+		fmt.Sprintf(`drop table if exists %s;`, target),
+		fmt.Sprintf(`create table %s as table %s;`, target, source),
+		fmt.Sprintf(`comment on table %s is %s;`, target, pq.QuoteLiteral(createdByMarker(createdBy))),
+		transformColumn(target, geometryType, srid),
+		fmt.Sprintf(`alter table %s add primary key (%s);`, target, pq.QuoteIdentifier(fidColumn)),
+		fmt.Sprintf(`create index on %s using gist (%s);`, target, pq.QuoteIdentifier(geometryColumn)),
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to copy %s into %s in EPSG:%d: %w", tableName, targetTable, srid, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if _, err := r.PostgreSQL.ExecContext(ctx, fmt.Sprintf(`analyze %s;`, target)); err != nil {
+		return fmt.Errorf("failed to analyze %s: %w", targetTable, err)
+	}
+	return nil
+}
+
+// DropTableCreatedBy drops a table CopyReprojectedTable created for the job createdBy, any other table is kept
+func (r LayerRepo) DropTableCreatedBy(ctx context.Context, tableName string, createdBy string) (bool, error) {
+	var marker string
+	query := `select coalesce(obj_description(to_regclass($1), 'pg_class'), '');`
+	if err := r.PostgreSQL.QueryRowContext(ctx, query, pq.QuoteIdentifier(tableName)).Scan(&marker); err != nil {
+		return false, fmt.Errorf("failed to look up table %s: %w", tableName, err)
+	}
+	if marker != createdByMarker(createdBy) {
+		return false, nil
+	}
+	return r.DropTable(ctx, tableName)
+}
+
+// createdByMarker is the comment of a table a job created, it tells the job's own tables from the rest
+func createdByMarker(workflowId string) string {
+	return "created by job " + workflowId
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gocastsian/roham/types"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+func (r LayerRepo) GetLayerShares(ctx context.Context, layerID types.ID) ([]service.LayerShareEntity, error) {
+	query := `select layer_id, user_id, permission, created_at, updated_at from layer_shares where layer_id = $1 order by user_id;`
+
+	rows, err := r.PostgreSQL.QueryContext(ctx, query, layerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shares of layer %d: %w", layerID, err)
+	}
+	defer rows.Close()
+
+	shares := make([]service.LayerShareEntity, 0)
+	for rows.Next() {
+		var share service.LayerShareEntity
+		if err := rows.Scan(&share.LayerID, &share.UserID, &share.Permission, &share.CreatedAt, &share.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan share of layer %d: %w", layerID, err)
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+func (r LayerRepo) UpsertLayerShare(ctx context.Context, share service.LayerShareEntity) (service.LayerShareEntity, error) {
+	query := `insert into layer_shares(layer_id, user_id, permission) values ($1, $2, $3)
+		on conflict (layer_id, user_id) do update set permission = excluded.permission, updated_at = now()
+		returning created_at, updated_at;`
+
+	err := r.PostgreSQL.QueryRowContext(ctx, query, share.LayerID, share.UserID, share.Permission).Scan(&share.CreatedAt, &share.UpdatedAt)
+	if err != nil {
+		return service.LayerShareEntity{}, fmt.Errorf("failed to share layer %d with user %d: %w", share.LayerID, share.UserID, err)
+	}
+	return share, nil
+}
+
+func (r LayerRepo) DeleteLayerShare(ctx context.Context, layerID types.ID, userID types.ID) error {
+	query := `delete from layer_shares where layer_id = $1 and user_id = $2;`
+	if _, err := r.PostgreSQL.ExecContext(ctx, query, layerID, userID); err != nil {
+		return fmt.Errorf("failed to revoke share of layer %d from user %d: %w", layerID, userID, err)
+	}
+	return nil
+}
+
+func (r LayerRepo) UpdateLayerAccess(ctx context.Context, id types.ID, visibility service.Visibility, tags []string) error {
+	if tags == nil {
+		tags = []string{}
+	}
+
+	query := `update layers set visibility = $1, tags = $2, updated_at = now() where id = $3;`
+	if _, err := r.PostgreSQL.ExecContext(ctx, query, visibility, pq.Array(tags), id); err != nil {
+		return fmt.Errorf("failed to update access of layer %d: %w", id, err)
+	}
+	return nil
+}
+
+func (r LayerRepo) GetLayerRowRules(ctx context.Context, layerID types.ID) ([]service.LayerRowRuleEntity, error) {
+	query := `select id, layer_id, attribute, claim, exempt_roles, created_at from layer_row_rules where layer_id = $1 order by id;`
+
+	rows, err := r.PostgreSQL.QueryContext(ctx, query, layerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read row rules of layer %d: %w", layerID, err)
+	}
+	defer rows.Close()
+
+	rules := make([]service.LayerRowRuleEntity, 0)
+	for rows.Next() {
+		var (
+			rule        service.LayerRowRuleEntity
+			exemptRoles pq.Int64Array
+		)
+		if err := rows.Scan(&rule.ID, &rule.LayerID, &rule.Attribute, &rule.Claim, &exemptRoles, &rule.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row rule of layer %d: %w", layerID, err)
+		}
+		rule.ExemptRoles = make([]types.Role, 0, len(exemptRoles))
+		for _, role := range exemptRoles {
+			rule.ExemptRoles = append(rule.ExemptRoles, types.Role(role))
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// ReplaceLayerRowRules swaps the row rules of a layer for rules in one transaction, so readers never see a partial set
+func (r LayerRepo) ReplaceLayerRowRules(ctx context.Context, layerID types.ID, rules []service.LayerRowRuleEntity) ([]service.LayerRowRuleEntity, error) {
+	tx, err := r.PostgreSQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `delete from layer_row_rules where layer_id = $1;`, layerID); err != nil {
+		return nil, fmt.Errorf("failed to clear row rules of layer %d: %w", layerID, err)
+	}
+
+	query := `insert into layer_row_rules(layer_id, attribute, claim, exempt_roles) values ($1, $2, $3, $4)
+		returning id, created_at;`
+	saved := make([]service.LayerRowRuleEntity, 0, len(rules))
+	for _, rule := range rules {
+		exemptRoles := make(pq.Int64Array, 0, len(rule.ExemptRoles))
+		for _, role := range rule.ExemptRoles {
+			exemptRoles = append(exemptRoles, int64(role))
+		}
+		if rule.ExemptRoles == nil {
+			rule.ExemptRoles = []types.Role{}
+		}
+
+		rule.LayerID = layerID
+		err := tx.QueryRowContext(ctx, query, layerID, rule.Attribute, rule.Claim, exemptRoles).Scan(&rule.ID, &rule.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save row rule of layer %d: %w", layerID, err)
+		}
+		saved = append(saved, rule)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+// column names created by ogr2ogr through the -lco flags of ImportLayer
+const (
+	geometryColumn = "wkb_geometry"
+	fidColumn      = "ogc_fid"
+)
+
+var numericDataTypes = map[string]bool{
+	"smallint":         true,
+	"integer":          true,
+	"bigint":           true,
+	"numeric":          true,
+	"real":             true,
+	"double precision": true,
+}
+
+type attributeColumn struct {
+	Name     string
+	DataType string
+}
+
+func (r LayerRepo) ComputeLayerStatistics(ctx context.Context, tableName string, topN int) (service.LayerStatistics, error) {
+	table := pq.QuoteIdentifier(tableName)
+	geom := pq.QuoteIdentifier(geometryColumn)
+
+	var (
+		statistics             service.LayerStatistics
+		minX, minY, maxX, maxY sql.NullFloat64
+	)
+	// the extent is reported in WGS 84, the box of a reprojected layer is transformed back from its system
+	query := fmt.Sprintf(`select n, ST_XMin(box), ST_YMin(box), ST_XMax(box), ST_YMax(box) from (
+			select count(*) as n, ST_Transform(ST_SetSRID(ST_Extent(%[1]s)::geometry, max(ST_SRID(%[1]s))), 4326) as box from %[2]s
+		) as e;`, geom, table)
+	err := r.PostgreSQL.QueryRowContext(ctx, query).Scan(&statistics.FeatureCount, &minX, &minY, &maxX, &maxY)
+	if err != nil {
+		return service.LayerStatistics{}, fmt.Errorf("failed to compute extent of %s: %w", tableName, err)
+	}
+	if minX.Valid {
+		statistics.Extent = &service.Extent{MinX: minX.Float64, MinY: minY.Float64, MaxX: maxX.Float64, MaxY: maxY.Float64}
+	}
+
+	columns, err := r.getAttributeColumns(ctx, tableName)
+	if err != nil {
+		return service.LayerStatistics{}, err
+	}
+
+	statistics.Attributes = make([]service.AttributeStatistics, 0, len(columns))
+	for _, column := range columns {
+		attribute, err := r.computeAttributeStatistics(ctx, table, column, topN)
+		if err != nil {
+			return service.LayerStatistics{}, fmt.Errorf("failed to compute statistics of %s.%s: %w", tableName, column.Name, err)
+		}
+		statistics.Attributes = append(statistics.Attributes, attribute)
+	}
+	statistics.ComputedAt = time.Now()
+
+	return statistics, nil
+}
+
+func (r LayerRepo) getAttributeColumns(ctx context.Context, tableName string) ([]attributeColumn, error) {
+	query := `select column_name, data_type from information_schema.columns
+		where table_schema = current_schema() and table_name = $1 and column_name not in ($2, $3) and udt_name <> 'geometry'
+		order by ordinal_position;`
+
+	rows, err := r.PostgreSQL.QueryContext(ctx, query, tableName, geometryColumn, fidColumn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", tableName, err)
+	}
+	defer rows.Close()
+
+	columns := make([]attributeColumn, 0)
+	for rows.Next() {
+		var column attributeColumn
+		if err := rows.Scan(&column.Name, &column.DataType); err != nil {
+			return nil, fmt.Errorf("failed to scan column of %s: %w", tableName, err)
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+func (r LayerRepo) computeAttributeStatistics(ctx context.Context, table string, column attributeColumn, topN int) (service.AttributeStatistics, error) {
+	attribute := service.AttributeStatistics{Name: column.Name, DataType: column.DataType}
+	col := pq.QuoteIdentifier(column.Name)
+
+	if numericDataTypes[column.DataType] {
+		var minValue, maxValue, meanValue sql.NullFloat64
+		query := fmt.Sprintf(`select count(*) - count(%[1]s), min(%[1]s)::float8, max(%[1]s)::float8, avg(%[1]s)::float8 from %[2]s;`, col, table)
+		err := r.PostgreSQL.QueryRowContext(ctx, query).Scan(&attribute.NullCount, &minValue, &maxValue, &meanValue)
+		if err != nil {
+			return service.AttributeStatistics{}, err
+		}
+		attribute.Min = nullFloatPtr(minValue)
+		attribute.Max = nullFloatPtr(maxValue)
+		attribute.Mean = nullFloatPtr(meanValue)
+		return attribute, nil
+	}
+
+	query := fmt.Sprintf(`select count(*) - count(%[1]s) from %[2]s;`, col, table)
+	if err := r.PostgreSQL.QueryRowContext(ctx, query).Scan(&attribute.NullCount); err != nil {
+		return service.AttributeStatistics{}, err
+	}
+
+	query = fmt.Sprintf(`select %[1]s::text, count(*) from %[2]s where %[1]s is not null group by 1 order by 2 desc, 1 limit $1;`, col, table)
+	rows, err := r.PostgreSQL.QueryContext(ctx, query, topN)
+	if err != nil {
+		return service.AttributeStatistics{}, err
+	}
+	defer rows.Close()
+
+	attribute.TopValues = make([]service.ValueCount, 0, topN)
+	for rows.Next() {
+		var value service.ValueCount
+		if err := rows.Scan(&value.Value, &value.Count); err != nil {
+			return service.AttributeStatistics{}, err
+		}
+		attribute.TopValues = append(attribute.TopValues, value)
+	}
+	return attribute, rows.Err()
+}
+
+func nullFloatPtr(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
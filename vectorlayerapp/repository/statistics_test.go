@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// topValues is how many of the most frequent values the service asks for
+const topValues = 10
+
+func TestComputeLayerStatistics(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	// an empty layer has no extent, ST_Extent of no rows is null
+	mock.ExpectQuery(regexp.QuoteMeta(`select n, ST_XMin(box)`)).
+		WillReturnRows(sqlmock.NewRows([]string{"n", "minx", "miny", "maxx", "maxy"}).AddRow(0, nil, nil, nil, nil))
+	mock.ExpectQuery(regexp.QuoteMeta(`select column_name, data_type from information_schema.columns`)).
+		WithArgs("parcels", geometryColumn, fidColumn).
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type"}).
+			AddRow("name", "character varying").
+			AddRow("area", "double precision"))
+	mock.ExpectQuery(regexp.QuoteMeta(`select count(*) - count("name") from "parcels";`)).
+		WillReturnRows(sqlmock.NewRows([]string{"nulls"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta(`select "name"::text, count(*) from "parcels"`)).
+		WithArgs(topValues).
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`select count(*) - count("area"), min("area")::float8`)).
+		WillReturnRows(sqlmock.NewRows([]string{"nulls", "min", "max", "avg"}).AddRow(0, nil, nil, nil))
+
+	statistics, err := LayerRepo{PostgreSQL: db}.ComputeLayerStatistics(context.Background(), "parcels", topValues)
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Nil(t, statistics.Extent)
+	assert.Zero(t, statistics.FeatureCount)
+	require.Len(t, statistics.Attributes, 2)
+
+	// text columns are categorical and get their most frequent values, numeric ones a range and a mean
+	name, area := statistics.Attributes[0], statistics.Attributes[1]
+	assert.Equal(t, "character varying", name.DataType)
+	assert.NotNil(t, name.TopValues)
+	assert.Nil(t, name.Min)
+	assert.Equal(t, "double precision", area.DataType)
+	assert.Nil(t, area.TopValues)
+	assert.Nil(t, area.Min)
+	assert.Nil(t, area.Mean)
+}
+
+func TestComputeLayerStatisticsExtent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`select n, ST_XMin(box)`)).
+		WillReturnRows(sqlmock.NewRows([]string{"n", "minx", "miny", "maxx", "maxy"}).AddRow(3, 51.2, 35.5, 51.6, 35.9))
+	mock.ExpectQuery(regexp.QuoteMeta(`select column_name, data_type from information_schema.columns`)).
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type"}).AddRow("floors", "integer"))
+	mock.ExpectQuery(regexp.QuoteMeta(`select count(*) - count("floors"), min("floors")::float8`)).
+		WillReturnRows(sqlmock.NewRows([]string{"nulls", "min", "max", "avg"}).AddRow(1, 1.0, 12.0, 4.5))
+
+	statistics, err := LayerRepo{PostgreSQL: db}.ComputeLayerStatistics(context.Background(), "buildings", topValues)
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	require.NotNil(t, statistics.Extent)
+	assert.Equal(t, 51.2, statistics.Extent.MinX)
+	assert.Equal(t, 35.9, statistics.Extent.MaxY)
+	assert.EqualValues(t, 3, statistics.FeatureCount)
+	require.Len(t, statistics.Attributes, 1)
+	floors := statistics.Attributes[0]
+	assert.EqualValues(t, 1, floors.NullCount)
+	require.NotNil(t, floors.Max)
+	assert.Equal(t, 12.0, *floors.Max)
+	assert.Equal(t, 4.5, *floors.Mean)
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/gocastsian/roham/types"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+var temporalDataTypes = map[string]bool{
+	"date":                        true,
+	"timestamp without time zone": true,
+	"timestamp with time zone":    true,
+}
+
+// GetTimeAttributes lists the attribute columns of a layer table that can hold the time of its features
+func (r LayerRepo) GetTimeAttributes(ctx context.Context, tableName string) ([]string, error) {
+	columns, err := r.getAttributeColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, column := range columns {
+		if temporalDataTypes[column.DataType] {
+			names = append(names, column.Name)
+		}
+	}
+	return names, nil
+}
+
+func (r LayerRepo) UpdateLayerTime(ctx context.Context, id types.ID, layerTime *service.LayerTime) error {
+	var timeStart, timeEnd string
+	if layerTime != nil {
+		timeStart, timeEnd = layerTime.StartAttribute, layerTime.EndAttribute
+	}
+
+	query := `update layers set time_start_attribute = NULLIF($1, ''), time_end_attribute = NULLIF($2, ''), updated_at = now() where id = $3;`
+	if _, err := r.PostgreSQL.ExecContext(ctx, query, timeStart, timeEnd, id); err != nil {
+		return fmt.Errorf("failed to update time attributes of layer %d: %w", id, err)
+	}
+	return nil
+}
+
+// ComputeTemporalExtent returns the earliest start and the latest end of the features of a time-enabled layer table
+func (r LayerRepo) ComputeTemporalExtent(ctx context.Context, tableName string, layerTime service.LayerTime) (*service.TemporalExtent, error) {
+	start, end := timeColumns("", layerTime)
+	query := fmt.Sprintf(`select min(%s)::timestamptz, max(%s)::timestamptz from %s;`, start, end, pq.QuoteIdentifier(tableName))
+
+	var minTime, maxTime sql.NullTime
+	if err := r.PostgreSQL.QueryRowContext(ctx, query).Scan(&minTime, &maxTime); err != nil {
+		return nil, fmt.Errorf("failed to compute temporal extent of %s: %w", tableName, err)
+	}
+
+	extent := &service.TemporalExtent{}
+	if minTime.Valid {
+		extent.Start = &minTime.Time
+	}
+	if maxTime.Valid {
+		extent.End = &maxTime.Time
+	}
+	return extent, nil
+}
+
+// timeColumns returns the start and end expressions of a feature, a missing end makes the feature an instant
+func timeColumns(alias string, layerTime service.LayerTime) (string, string) {
+	start := alias + pq.QuoteIdentifier(layerTime.StartAttribute)
+	if layerTime.EndAttribute == "" {
+		return start, start
+	}
+	return start, fmt.Sprintf("coalesce(%s%s, %s)", alias, pq.QuoteIdentifier(layerTime.EndAttribute), start)
+}
+
+// featureCondition renders filter as a where condition on the layer table aliased t, it is "true" for a filter
+// keeping every feature. The parameters of the condition are appended to args and numbered after the ones in it
+func featureCondition(layer service.LayerEntity, filter service.FeatureFilter, args []interface{}) (string, []interface{}, error) {
+	conditions := make([]string, 0)
+
+	// a feature overlaps the filter when it starts before the filter ends and ends after the filter starts
+	if filter.Time != nil && layer.Time != nil {
+		start, end := timeColumns("t.", *layer.Time)
+		conditions = append(conditions, start+" is not null")
+		if filter.Time.End != nil {
+			args = append(args, *filter.Time.End)
+			conditions = append(conditions, fmt.Sprintf("%s <= $%d", start, len(args)))
+		}
+		if filter.Time.Start != nil {
+			args = append(args, *filter.Time.Start)
+			conditions = append(conditions, fmt.Sprintf("%s >= $%d", end, len(args)))
+		}
+	}
+
+	// the row scope is compared as text, claims are text whatever the type of the attribute is
+	if filter.Scope != nil {
+		if filter.Scope.Denied {
+			return "false", args, nil
+		}
+		for _, match := range filter.Scope.Matches {
+			args = append(args, match.Value)
+			conditions = append(conditions, fmt.Sprintf("t.%s::text = $%d", pq.QuoteIdentifier(match.Attribute), len(args)))
+		}
+	}
+
+	if filter.CQL != nil {
+		translator := cqlTranslator{args: args, srid: layer.SRID}
+		condition, err := translator.condition(filter.CQL)
+		if err != nil {
+			return "", nil, err
+		}
+		args = translator.args
+		conditions = append(conditions, condition)
+	}
+
+	if len(conditions) == 0 {
+		return "true", args, nil
+	}
+	return strings.Join(conditions, " and "), args, nil
+}
+
+// GetDistinctAttributeValues returns the distinct non-null values of an attribute column as text
+func (r LayerRepo) GetDistinctAttributeValues(ctx context.Context, tableName string, attribute string) ([]string, error) {
+	column := pq.QuoteIdentifier(attribute)
+	query := fmt.Sprintf(`select distinct %[1]s::text from %[2]s where %[1]s is not null;`, column, pq.QuoteIdentifier(tableName))
+
+	rows, err := r.PostgreSQL.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values of %s.%s: %w", tableName, attribute, err)
+	}
+	defer rows.Close()
+
+	values := make([]string, 0)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, fmt.Errorf("failed to scan value of %s.%s: %w", tableName, attribute, err)
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// ConvertAttributeToDate replaces an attribute column with a date column of the same name filled through dates,
+// which maps the text of the old values to YYYY-MM-DD. Values missing from dates become null
+func (r LayerRepo) ConvertAttributeToDate(ctx context.Context, tableName string, attribute string, dates map[string]string) error {
+	table := pq.QuoteIdentifier(tableName)
+	column := pq.QuoteIdentifier(attribute)
+	converted := pq.QuoteIdentifier(attribute + "_date")
+
+	values := make([]string, 0, len(dates))
+	days := make([]string, 0, len(dates))
+	for value, day := range dates {
+		values = append(values, value)
+		days = append(days, day)
+	}
+
+	tx, err := r.PostgreSQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []struct {
+		query string
+		args  []interface{}
+	}{
+		{query: fmt.Sprintf(`alter table %s add column %s date;`, table, converted)},
+		{
+			query: fmt.Sprintf(`update %[1]s as t set %[2]s = m.day from unnest($1::text[], $2::date[]) as m(value, day)
+				where t.%[3]s::text = m.value;`, table, converted, column),
+			args: []interface{}{pq.Array(values), pq.Array(days)},
+		},
+		{query: fmt.Sprintf(`alter table %s drop column %s;`, table, column)},
+		{query: fmt.Sprintf(`alter table %s rename column %s to %s;`, table, converted, column)},
+	}
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, q.query, q.args...); err != nil {
+			return fmt.Errorf("failed to convert %s.%s to dates: %w", tableName, attribute, err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gocastsian/roham/types"
+	"github.com/gocastsian/roham/vectorlayerapp/service"
+	"github.com/lib/pq"
+)
+
+func (r LayerRepo) tileCacheEnabled() bool {
+	return r.Config.CacheEnabled && r.TileCache != nil
+}
+
+func (r LayerRepo) tileKeyPrefix(layerID types.ID) string {
+	return fmt.Sprintf("%s:tiles:%d:", r.Config.CachePrefix, layerID)
+}
+
+// tileKey is <prefix>:tiles:<layer>:<version>:<z>/<x>/<y>:<attribute set and filter>, they are hashed to keep keys short
+func (r LayerRepo) tileKey(layer service.LayerEntity, tile service.TileCoordinate, attributes []string, filter service.FeatureFilter) string {
+	sorted := append([]string(nil), attributes...)
+	sort.Strings(sorted)
+	sum := sha1.Sum([]byte(strings.Join(sorted, "\x00") + "\x00" + filter.CacheKey()))
+
+	return fmt.Sprintf("%s%d:%d/%d/%d:%s", r.tileKeyPrefix(layer.ID), layer.UpdatedAt.UnixNano(),
+		tile.Z, tile.X, tile.Y, hex.EncodeToString(sum[:8]))
+}
+
+// GetTile returns the Mapbox vector tile of the features of layer matching filter with the given attributes,
+// from the tile cache when possible
+func (r LayerRepo) GetTile(ctx context.Context, layer service.LayerEntity, tile service.TileCoordinate, attributes []string,
+	filter service.FeatureFilter, options service.TileOptions) ([]byte, error) {
+	key := r.tileKey(layer, tile, attributes, filter)
+	if r.tileCacheEnabled() {
+		if data, err := r.TileCache.Get(ctx, key); err == nil {
+			return data, nil
+		}
+	}
+
+	data, err := r.generateTile(ctx, layer, tile, attributes, filter, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.tileCacheEnabled() && (r.Config.MaxCachedTileSize <= 0 || len(data) <= r.Config.MaxCachedTileSize) {
+		_ = r.TileCache.Set(ctx, key, data)
+	}
+	return data, nil
+}
+
+func (r LayerRepo) generateTile(ctx context.Context, layer service.LayerEntity, tile service.TileCoordinate, attributes []string,
+	filter service.FeatureFilter, options service.TileOptions) ([]byte, error) {
+	columns := make([]string, 0, len(attributes))
+	for _, attribute := range attributes {
+		columns = append(columns, ", t."+pq.QuoteIdentifier(attribute))
+	}
+
+	args := []interface{}{tile.Z, tile.X, tile.Y, options.Extent, options.Buffer, layer.Name}
+	condition, args, err := featureCondition(layer, filter, args)
+	if err != nil {
+		return nil, err
+	}
+
+	// generalized geometries are stored in web mercator already and are matched against the tile envelope directly
+	geometry := fmt.Sprintf(`ST_Transform(t.%s, 3857)`, pq.QuoteIdentifier(geometryColumn))
+	source := pq.QuoteIdentifier(layer.Name) + " as t"
+	intersects := fmt.Sprintf(`t.%s && ST_Transform(bounds.geom, %d)`, pq.QuoteIdentifier(geometryColumn), layer.SRID)
+	if options.GeneralizedZoom != nil {
+		args = append(args, *options.GeneralizedZoom)
+		geometry = "g.geom"
+		source = fmt.Sprintf(`%s as t join %s as g on g.fid = t.%s and g.zoom = $%d`, pq.QuoteIdentifier(layer.Name),
+			pq.QuoteIdentifier(layer.Name+service.GeneralizedTableSuffix), pq.QuoteIdentifier(fidColumn), len(args))
+		intersects = "g.geom && bounds.geom"
+	}
+
+	query := fmt.Sprintf(`with bounds as (select ST_TileEnvelope($1, $2, $3) as geom),
+		mvtgeom as (
+			select ST_AsMVTGeom(%[1]s, bounds.geom, $4, $5, true) as mvt_geometry, t.%[2]s%[3]s
+			from %[4]s, bounds
+			where %[7]s and %[6]s
+		)
+		select coalesce(ST_AsMVT(mvtgeom.*, $6, $4, 'mvt_geometry', '%[5]s'), '') from mvtgeom;`,
+		geometry, pq.QuoteIdentifier(fidColumn), strings.Join(columns, ""), source, fidColumn, condition, intersects)
+
+	var data []byte
+	err = r.PostgreSQL.QueryRowContext(ctx, query, args...).Scan(&data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate tile %d/%d/%d of %s: %w", tile.Z, tile.X, tile.Y, layer.Name, err)
+	}
+	return data, nil
+}
+
+// GetLayerAttributes lists the attribute columns of a layer table, they are what a tile request may select
+func (r LayerRepo) GetLayerAttributes(ctx context.Context, tableName string) ([]string, error) {
+	columns, err := r.getAttributeColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.Name)
+	}
+	return names, nil
+}
+
+// InvalidateLayerCache drops every cached tile and lookup result of a layer
+func (r LayerRepo) InvalidateLayerCache(ctx context.Context, layerID types.ID) error {
+	if r.tileCacheEnabled() {
+		if err := r.TileCache.InvalidatePrefix(ctx, r.tileKeyPrefix(layerID)); err != nil {
+			return err
+		}
+	}
+	if r.cacheEnabled() {
+		if err := r.Cache.InvalidatePrefix(ctx, fmt.Sprintf("%s:lookup:%d:", r.Config.CachePrefix, layerID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+)
+
+type AggregateConfig struct {
+	// MaxCells bounds the cells a bbox may be split into at the requested resolution
+	MaxCells int `koanf:"max_cells"`
+}
+
+type GridShape string
+
+const (
+	GridHexagon GridShape = "hex"
+	GridSquare  GridShape = "square"
+)
+
+type AggregateFormat string
+
+const (
+	AggregateFormatGeoJSON AggregateFormat = "geojson"
+	AggregateFormatMVT     AggregateFormat = "mvt"
+)
+
+// gridEdgeLengths are the average hexagon edge lengths in meters of the H3 resolutions 0 to 15, the cells of a
+// resolution are laid out on the web mercator plane with this edge
+var gridEdgeLengths = [...]float64{
+	1107712.591, 418676.0055, 158244.6558, 59810.85794, 22606.3794, 8544.408276, 3229.482772, 1220.629759,
+	461.3546837, 174.3756681, 65.90780749, 24.9105614, 9.415526211, 3.559893033, 1.348574562, 0.509713273,
+}
+
+// MaxGridResolution is the finest resolution of the aggregation grids
+const MaxGridResolution = len(gridEdgeLengths) - 1
+
+// hexagonArea is the area of a regular hexagon with an edge of 1
+var hexagonArea = 3 * math.Sqrt(3) / 2
+
+// gridCellSize is the size argument of ST_HexagonGrid or ST_SquareGrid at resolution, squares get the area of
+// the hexagons of the same resolution so both grids bin alike
+func gridCellSize(grid GridShape, resolution int) float64 {
+	edge := gridEdgeLengths[resolution]
+	if grid == GridSquare {
+		return edge * math.Sqrt(hexagonArea)
+	}
+	return edge
+}
+
+// gridCellCount estimates how many cells of resolution cover bbox on the web mercator plane
+func gridCellCount(bbox Extent, resolution int) float64 {
+	minX, minY := webMercator(bbox.MinX, bbox.MinY)
+	maxX, maxY := webMercator(bbox.MaxX, bbox.MaxY)
+	edge := gridEdgeLengths[resolution]
+	return (maxX - minX) * (maxY - minY) / (hexagonArea * edge * edge)
+}
+
+// webMercatorMaxLatitude is where EPSG:3857 ends, latitudes beyond it are clamped
+const webMercatorMaxLatitude = 85.05112878
+
+func webMercator(lon, lat float64) (float64, float64) {
+	const radius = 6378137.0
+	lat = clampMercatorLatitude(lat)
+	return radius * lon * math.Pi / 180, radius * math.Log(math.Tan(math.Pi/4+lat*math.Pi/360))
+}
+
+func clampMercatorLatitude(lat float64) float64 {
+	return math.Max(-webMercatorMaxLatitude, math.Min(webMercatorMaxLatitude, lat))
+}
+
+// mercatorBounds clamps the latitudes of a WGS 84 bbox the way webMercator does, PostGIS can't transform the
+// poles to EPSG:3857
+func (e Extent) mercatorBounds() Extent {
+	e.MinY = clampMercatorLatitude(e.MinY)
+	e.MaxY = clampMercatorLatitude(e.MaxY)
+	return e
+}
+
+// AggregateOptions describe the grid a layer is binned into, Extent and Buffer encode an mvt answer
+type AggregateOptions struct {
+	Grid      GridShape
+	CellSize  float64
+	Attribute string
+	Extent    int
+	Buffer    int
+}
+
+// AggregateCell is a grid cell holding features, Sum and Avg are set when an attribute was aggregated
+type AggregateCell struct {
+	Geometry json.RawMessage
+	Count    int64
+	Sum      *float64
+	Avg      *float64
+}
+
+// AggregateLayer bins the features of a layer matching the filter and datetime of the request into the cells of
+// a hexagon or square grid over bbox, every feature counts in the cell holding a point on its surface
+func (s Service) AggregateLayer(ctx context.Context, req AggregateLayerRequest) (AggregateLayerResponse, error) {
+	if req.Grid == "" {
+		req.Grid = GridHexagon
+	}
+	if req.Format == "" {
+		req.Format = AggregateFormatGeoJSON
+	}
+	if err := s.validator.ValidateAggregateLayer(req, s.config.Aggregate); err != nil {
+		return AggregateLayerResponse{}, err
+	}
+
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return AggregateLayerResponse{}, err
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionRead); err != nil {
+		return AggregateLayerResponse{}, err
+	}
+
+	if req.Attribute != "" {
+		numeric, err := s.repository.GetNumericAttributes(ctx, layer.Name)
+		if err != nil {
+			return AggregateLayerResponse{}, err
+		}
+		if err := s.validator.ValidateAggregateAttribute(req.Attribute, numeric); err != nil {
+			return AggregateLayerResponse{}, err
+		}
+	}
+	if err := s.checkFilter(ctx, layer, req.Filter); err != nil {
+		return AggregateLayerResponse{}, err
+	}
+	scope, err := s.rowScope(ctx, req.Actor, layer)
+	if err != nil {
+		return AggregateLayerResponse{}, err
+	}
+
+	filter := FeatureFilter{Time: req.Datetime, CQL: req.Filter, Scope: scope}
+	options := AggregateOptions{
+		Grid:      req.Grid,
+		CellSize:  gridCellSize(req.Grid, req.Resolution),
+		Attribute: req.Attribute,
+		Extent:    s.config.Tile.Extent,
+		Buffer:    s.config.Tile.Buffer,
+	}
+
+	bbox := req.BBox.mercatorBounds()
+	if req.Format == AggregateFormatMVT {
+		data, err := s.repository.AggregateLayerTile(ctx, layer, filter, bbox, options)
+		if err != nil {
+			return AggregateLayerResponse{}, err
+		}
+		return AggregateLayerResponse{Data: data}, nil
+	}
+
+	cells, err := s.repository.AggregateLayer(ctx, layer, filter, bbox, options)
+	if err != nil {
+		return AggregateLayerResponse{}, err
+	}
+	res := AggregateLayerResponse{Type: "FeatureCollection", Features: make([]AggregateFeature, 0, len(cells))}
+	for _, cell := range cells {
+		res.Features = append(res.Features, AggregateFeature{
+			Type:       "Feature",
+			Geometry:   cell.Geometry,
+			Properties: AggregateProperties{Count: cell.Count, Sum: cell.Sum, Avg: cell.Avg},
+		})
+	}
+	return res, nil
+}
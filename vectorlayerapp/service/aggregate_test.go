@@ -0,0 +1,73 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGridCellSize(t *testing.T) {
+	assert.Equal(t, gridEdgeLengths[7], gridCellSize(GridHexagon, 7))
+
+	// a square of resolution 7 covers as much of the plane as a hexagon of it
+	side := gridCellSize(GridSquare, 7)
+	assert.InDelta(t, hexagonArea*gridEdgeLengths[7]*gridEdgeLengths[7], side*side, 1e-6)
+
+	for resolution := 1; resolution <= MaxGridResolution; resolution++ {
+		assert.Less(t, gridEdgeLengths[resolution], gridEdgeLengths[resolution-1])
+	}
+}
+
+func TestGridCellCount(t *testing.T) {
+	tehran := Extent{MinX: 51.2, MinY: 35.5, MaxX: 51.6, MaxY: 35.9}
+	cells := gridCellCount(tehran, 7)
+	assert.InDelta(t, 630, cells, 30)
+
+	// a resolution finer has about seven times as many cells, like H3
+	assert.InDelta(t, 7, gridCellCount(tehran, 8)/cells, 0.05)
+
+	// latitudes past the end of web mercator are clamped
+	world := gridCellCount(Extent{MinX: -180, MinY: -90, MaxX: 180, MaxY: 90}, 0)
+	assert.False(t, math.IsInf(world, 0))
+}
+
+func TestExtentMercatorBounds(t *testing.T) {
+	world := Extent{MinX: -180, MinY: -90, MaxX: 180, MaxY: 90}.mercatorBounds()
+	assert.Equal(t, Extent{MinX: -180, MinY: -webMercatorMaxLatitude, MaxX: 180, MaxY: webMercatorMaxLatitude}, world)
+
+	tehran := Extent{MinX: 51.2, MinY: 35.5, MaxX: 51.6, MaxY: 35.9}
+	assert.Equal(t, tehran, tehran.mercatorBounds())
+}
+
+func TestValidateAggregateLayer(t *testing.T) {
+	v := NewValidator(nil)
+	config := AggregateConfig{MaxCells: 1000}
+	valid := AggregateLayerRequest{
+		Grid:       GridHexagon,
+		Format:     AggregateFormatGeoJSON,
+		Resolution: 7,
+		BBox:       Extent{MinX: 51.2, MinY: 35.5, MaxX: 51.6, MaxY: 35.9},
+	}
+	assert.NoError(t, v.ValidateAggregateLayer(valid, config))
+
+	tests := map[string]func(req *AggregateLayerRequest){
+		"unknown grid":      func(req *AggregateLayerRequest) { req.Grid = "triangle" },
+		"unknown format":    func(req *AggregateLayerRequest) { req.Format = "csv" },
+		"negative":          func(req *AggregateLayerRequest) { req.Resolution = -1 },
+		"beyond finest":     func(req *AggregateLayerRequest) { req.Resolution = MaxGridResolution + 1 },
+		"too many cells":    func(req *AggregateLayerRequest) { req.Resolution = 9 },
+		"empty bbox":        func(req *AggregateLayerRequest) { req.BBox = Extent{} },
+		"bbox out of range": func(req *AggregateLayerRequest) { req.BBox.MaxY = 95 },
+	}
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := valid
+			change(&req)
+			assert.Error(t, v.ValidateAggregateLayer(req, config))
+		})
+	}
+
+	assert.NoError(t, v.ValidateAggregateAttribute("population", []string{"area", "population"}))
+	assert.Error(t, v.ValidateAggregateAttribute("name", []string{"area", "population"}))
+}
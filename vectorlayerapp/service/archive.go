@@ -0,0 +1,302 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.temporal.io/sdk/temporal"
+)
+
+type ArchiveConfig struct {
+	MaxUncompressedSize int64   `koanf:"max_uncompressed_size"`
+	MaxFileCount        int     `koanf:"max_file_count"`
+	MaxCompressionRatio float64 `koanf:"max_compression_ratio"`
+}
+
+// default archive limits, they apply to every limit that isn't configured so an archive is never unbounded
+const (
+	defaultMaxUncompressedSize = 10 << 30
+	defaultMaxFileCount        = 1000
+	defaultMaxCompressionRatio = 100
+)
+
+// withDefaults replaces the limits that are zero or negative with the defaults
+func (c ArchiveConfig) withDefaults() ArchiveConfig {
+	if c.MaxUncompressedSize <= 0 {
+		c.MaxUncompressedSize = defaultMaxUncompressedSize
+	}
+	if c.MaxFileCount <= 0 {
+		c.MaxFileCount = defaultMaxFileCount
+	}
+	if c.MaxCompressionRatio <= 0 {
+		c.MaxCompressionRatio = defaultMaxCompressionRatio
+	}
+	return c
+}
+
+// datasetFormats maps the file extensions we can import to their GDAL driver name
+var datasetFormats = map[string]string{
+	".shp":     "ESRI Shapefile",
+	".geojson": "GeoJSON",
+	".gpkg":    "GPKG",
+}
+
+type dataset struct {
+	Name      string
+	Path      string
+	Format    string
+	StylePath string
+}
+
+// fetchArchive downloads the file of fileKey from the filer and extracts it into dir
+func (s Service) fetchArchive(ctx context.Context, fileKey string, dir string) (DownloadedFile, error) {
+	zipPath := filepath.Join(dir, filepath.Base(fileKey)+".zip")
+	downloaded, err := s.filerClient.DownloadFile(ctx, fileKey, zipPath)
+	if err != nil {
+		return DownloadedFile{}, fmt.Errorf("failed to download %s: %w", fileKey, err)
+	}
+	log.Printf("Saved zip file %s (%d bytes, sha256 %s)", zipPath, downloaded.Size, downloaded.SHA256)
+
+	if err := extractZip(zipPath, dir, s.config.Archive); err != nil {
+		if errors.Is(err, ErrUnsafeArchive) {
+			return DownloadedFile{}, temporal.NewNonRetryableApplicationError(err.Error(), UnsafeArchiveErrorType, err)
+		}
+		return DownloadedFile{}, fmt.Errorf("failed to unzip file %s: %w", zipPath, err)
+	}
+	log.Printf("Unzipped files to %s", dir)
+
+	return downloaded, nil
+}
+
+// extractZip extracts src into dst and rejects archives that escape dst, contain symlinks
+// or exceed the configured limits, the limits are enforced on the bytes actually written
+// because the sizes in the zip headers are controlled by the uploader
+func extractZip(src string, dst string, limits ArchiveConfig) error {
+	limits = limits.withDefaults()
+	reader, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if len(reader.File) > limits.MaxFileCount {
+		return fmt.Errorf("%w: %d entries exceed the limit of %d", ErrUnsafeArchive, len(reader.File), limits.MaxFileCount)
+	}
+
+	root, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+
+	var written int64
+	for _, file := range reader.File {
+		target, err := safeExtractPath(root, file.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := file.Mode()
+		if mode&os.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s is a symbolic link", ErrUnsafeArchive, file.Name)
+		}
+		if mode.IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !mode.IsRegular() {
+			return fmt.Errorf("%w: %s is not a regular file", ErrUnsafeArchive, file.Name)
+		}
+
+		if file.CompressedSize64 > 0 &&
+			float64(file.UncompressedSize64)/float64(file.CompressedSize64) > limits.MaxCompressionRatio {
+			return fmt.Errorf("%w: compression ratio of %s exceeds %.0f", ErrUnsafeArchive, file.Name, limits.MaxCompressionRatio)
+		}
+
+		n, err := extractZipFile(file, target, limits.MaxUncompressedSize-written)
+		if err != nil {
+			return err
+		}
+		if file.CompressedSize64 > 0 &&
+			float64(n)/float64(file.CompressedSize64) > limits.MaxCompressionRatio {
+			return fmt.Errorf("%w: compression ratio of %s exceeds %.0f", ErrUnsafeArchive, file.Name, limits.MaxCompressionRatio)
+		}
+		written += n
+	}
+
+	return nil
+}
+
+func safeExtractPath(root string, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") || strings.HasPrefix(name, "\\") || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%w: %s is an absolute path", ErrUnsafeArchive, name)
+	}
+
+	target := filepath.Join(root, name)
+	if target != root && !strings.HasPrefix(target, root+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%w: %s escapes the extraction directory", ErrUnsafeArchive, name)
+	}
+	return target, nil
+}
+
+func extractZipFile(file *zip.File, target string, remaining int64) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	// one byte more than allowed tells us the limit was crossed
+	n, err := io.Copy(out, io.LimitReader(rc, remaining+1))
+	if err != nil {
+		return n, fmt.Errorf("failed to extract %s: %w", file.Name, err)
+	}
+	if n > remaining {
+		return n, fmt.Errorf("%w: uncompressed size exceeds the limit", ErrUnsafeArchive)
+	}
+	return n, nil
+}
+
+// findDatasets lists every importable dataset under dir, each one paired with the .sld file sharing its basename
+func findDatasets(dir string) ([]dataset, error) {
+	datasets := make([]dataset, 0)
+	styles := make(map[string]string)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		base := strings.TrimSuffix(path, filepath.Ext(path))
+		if ext == ".sld" {
+			styles[strings.ToLower(base)] = path
+			return nil
+		}
+		if format, ok := datasetFormats[ext]; ok {
+			datasets = append(datasets, dataset{
+				Name:   strings.ToLower(filepath.Base(base)),
+				Path:   path,
+				Format: format,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan directory for datasets: %w", err)
+	}
+
+	for i := range datasets {
+		base := strings.TrimSuffix(datasets[i].Path, filepath.Ext(datasets[i].Path))
+		datasets[i].StylePath = styles[strings.ToLower(base)]
+	}
+
+	return datasets, nil
+}
+
+// importTarget is a layer of an archive dataset and the table it is imported into
+type importTarget struct {
+	Dataset     dataset
+	SourceLayer string
+	LayerName   string
+	GeomType    string
+}
+
+// planImport pairs every selected layer of datasets with the table it is written to. A single layer file keeps
+// its file name and containers such as GeoPackage name each table after the layer, rename replaces the name of
+// the only layer of an archive. A selection naming a layer the archive doesn't have is rejected, and so are two
+// layers that would be written to the same table since ogr2ogr would silently keep only the last one
+func planImport(datasets []dataset, infos []ogrInfo, selected []string, rename string) ([]importTarget, error) {
+	sourceLayers := 0
+	for _, info := range infos {
+		sourceLayers += len(info.Layers)
+	}
+	wanted := make(map[string]bool, len(selected))
+	for _, name := range selected {
+		wanted[strings.ToLower(name)] = true
+	}
+
+	targets := make([]importTarget, 0, sourceLayers)
+	found := make(map[string]bool, sourceLayers)
+	sources := make(map[string][]string)
+	for i, ds := range datasets {
+		info := infos[i]
+		for _, sourceLayer := range info.Layers {
+			layerName := ds.Name
+			if len(info.Layers) > 1 {
+				layerName = strings.ToLower(sourceLayer.Name)
+			}
+			found[layerName] = true
+			if len(wanted) > 0 && !wanted[layerName] {
+				continue
+			}
+			if rename != "" && sourceLayers == 1 {
+				layerName = strings.ToLower(rename)
+			}
+
+			geomType := "GEOMETRY"
+			if len(sourceLayer.GeometryFields) > 0 {
+				geomType = promoteToMultiGeometryType(sourceLayer.GeometryFields[0].Type)
+			}
+			sources[layerName] = append(sources[layerName], ds.Path+":"+sourceLayer.Name)
+			targets = append(targets, importTarget{
+				Dataset:     ds,
+				SourceLayer: sourceLayer.Name,
+				LayerName:   layerName,
+				GeomType:    geomType,
+			})
+		}
+	}
+
+	missing := make([]string, 0)
+	for name := range wanted {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("the archive has no layers named %s", strings.Join(missing, ", ")), LayerNotFoundErrorType, nil)
+	}
+
+	collisions := make([]string, 0)
+	for name, paths := range sources {
+		if len(paths) > 1 {
+			collisions = append(collisions, fmt.Sprintf("%s (%s)", name, strings.Join(paths, ", ")))
+		}
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return nil, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("layers of the archive share a table name, select one of them or rename the files: %s",
+				strings.Join(collisions, "; ")), LayerNameCollisionErrorType, nil)
+	}
+
+	if len(targets) == 0 {
+		return nil, temporal.NewNonRetryableApplicationError("no importable layer found in the archive", LayerNotFoundErrorType, nil)
+	}
+	return targets, nil
+}
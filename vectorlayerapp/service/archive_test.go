@@ -0,0 +1,216 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/temporal"
+)
+
+type zipEntry struct {
+	name    string
+	content []byte
+	mode    os.FileMode
+}
+
+func writeZip(t *testing.T, entries []zipEntry) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		if entry.mode != 0 {
+			header.SetMode(entry.mode)
+		}
+		f, err := w.CreateHeader(header)
+		require.NoError(t, err)
+		_, err = f.Write(entry.content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	path := filepath.Join(t.TempDir(), "archive.zip")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	return path
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}
+
+func TestExtractZip(t *testing.T) {
+	limits := ArchiveConfig{
+		MaxUncompressedSize: 1024,
+		MaxFileCount:        3,
+		MaxCompressionRatio: 50,
+	}
+
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		unsafe  bool
+	}{
+		{
+			name:    "valid archive",
+			entries: []zipEntry{{name: "roads.shp", content: []byte("shape")}, {name: "styles/roads.sld", content: []byte("style")}},
+		},
+		{
+			name:    "path traversal",
+			entries: []zipEntry{{name: "../../etc/cron.d/evil", content: []byte("x")}},
+			unsafe:  true,
+		},
+		{
+			name:    "absolute path",
+			entries: []zipEntry{{name: "/etc/passwd", content: []byte("x")}},
+			unsafe:  true,
+		},
+		{
+			name:    "symlink",
+			entries: []zipEntry{{name: "link", content: []byte("/etc/passwd"), mode: os.ModeSymlink | 0777}},
+			unsafe:  true,
+		},
+		{
+			name:    "too many files",
+			entries: []zipEntry{{name: "a"}, {name: "b"}, {name: "c"}, {name: "d"}},
+			unsafe:  true,
+		},
+		{
+			name:    "too large",
+			entries: []zipEntry{{name: "big", content: randomBytes(2048)}},
+			unsafe:  true,
+		},
+		{
+			name:    "compression bomb",
+			entries: []zipEntry{{name: "zeros", content: make([]byte, 1000)}},
+			unsafe:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := t.TempDir()
+			err := extractZip(writeZip(t, tt.entries), dst, limits)
+			if tt.unsafe {
+				assert.ErrorIs(t, err, ErrUnsafeArchive)
+				return
+			}
+			require.NoError(t, err)
+			for _, entry := range tt.entries {
+				content, err := os.ReadFile(filepath.Join(dst, entry.name))
+				require.NoError(t, err)
+				assert.Equal(t, entry.content, content)
+			}
+		})
+	}
+}
+
+func TestExtractZipDefaultLimits(t *testing.T) {
+	// an unconfigured deployment still rejects bombs
+	err := extractZip(writeZip(t, []zipEntry{{name: "zeros", content: make([]byte, 1<<20)}}), t.TempDir(), ArchiveConfig{})
+	assert.ErrorIs(t, err, ErrUnsafeArchive)
+
+	entries := make([]zipEntry, defaultMaxFileCount+1)
+	for i := range entries {
+		entries[i] = zipEntry{name: fmt.Sprintf("file%d", i)}
+	}
+	err = extractZip(writeZip(t, entries), t.TempDir(), ArchiveConfig{MaxUncompressedSize: 1 << 20})
+	assert.ErrorIs(t, err, ErrUnsafeArchive)
+
+	assert.Equal(t, ArchiveConfig{MaxUncompressedSize: 5, MaxFileCount: defaultMaxFileCount, MaxCompressionRatio: 20},
+		ArchiveConfig{MaxUncompressedSize: 5, MaxFileCount: -1, MaxCompressionRatio: 20}.withDefaults())
+}
+
+// ogrInfoOf builds the ogrinfo output of a dataset holding polygon layers with the given names
+func ogrInfoOf(t *testing.T, layers ...string) ogrInfo {
+	t.Helper()
+
+	var info ogrInfo
+	for _, name := range layers {
+		layer := ogrInfoLayer{Name: name}
+		require.NoError(t, json.Unmarshal([]byte(`[{"name":"geom","type":"Polygon"}]`), &layer.GeometryFields))
+		info.Layers = append(info.Layers, layer)
+	}
+	return info
+}
+
+func TestPlanImport(t *testing.T) {
+	roads := dataset{Name: "roads", Path: "a/roads.shp"}
+	otherRoads := dataset{Name: "roads", Path: "b/roads.shp"}
+	rivers := dataset{Name: "rivers", Path: "rivers.geojson"}
+	container := dataset{Name: "city", Path: "city.gpkg"}
+
+	tableNames := func(targets []importTarget) []string {
+		names := make([]string, 0, len(targets))
+		for _, target := range targets {
+			names = append(names, target.LayerName)
+		}
+		return names
+	}
+	errorType := func(err error) string {
+		var appErr *temporal.ApplicationError
+		require.True(t, errors.As(err, &appErr))
+		return appErr.Type()
+	}
+
+	t.Run("names tables after files and container layers", func(t *testing.T) {
+		targets, err := planImport([]dataset{roads, container},
+			[]ogrInfo{ogrInfoOf(t, "roads"), ogrInfoOf(t, "Parcels", "Buildings")}, nil, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"roads", "parcels", "buildings"}, tableNames(targets))
+		assert.Equal(t, "MULTIPOLYGON", targets[0].GeomType)
+		assert.Equal(t, "Parcels", targets[1].SourceLayer)
+	})
+
+	t.Run("renames the only layer", func(t *testing.T) {
+		targets, err := planImport([]dataset{roads}, []ogrInfo{ogrInfoOf(t, "roads")}, []string{"Roads"}, "Streets")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"streets"}, tableNames(targets))
+	})
+
+	t.Run("imports only the selection", func(t *testing.T) {
+		targets, err := planImport([]dataset{roads, rivers},
+			[]ogrInfo{ogrInfoOf(t, "roads"), ogrInfoOf(t, "rivers")}, []string{"rivers"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"rivers"}, tableNames(targets))
+	})
+
+	t.Run("rejects a selection the archive doesn't have", func(t *testing.T) {
+		_, err := planImport([]dataset{roads}, []ogrInfo{ogrInfoOf(t, "roads")}, []string{"roads", "lakes"}, "")
+		require.Error(t, err)
+		assert.Equal(t, LayerNotFoundErrorType, errorType(err))
+		assert.Contains(t, err.Error(), "lakes")
+	})
+
+	t.Run("rejects files sharing a name", func(t *testing.T) {
+		_, err := planImport([]dataset{roads, otherRoads},
+			[]ogrInfo{ogrInfoOf(t, "roads"), ogrInfoOf(t, "roads")}, nil, "")
+		require.Error(t, err)
+		assert.Equal(t, LayerNameCollisionErrorType, errorType(err))
+		assert.Contains(t, err.Error(), "a/roads.shp")
+	})
+
+	t.Run("rejects a container layer named like a file", func(t *testing.T) {
+		_, err := planImport([]dataset{roads, container},
+			[]ogrInfo{ogrInfoOf(t, "roads"), ogrInfoOf(t, "roads", "rivers")}, nil, "")
+		assert.Equal(t, LayerNameCollisionErrorType, errorType(err))
+	})
+
+	t.Run("selecting one of the colliding layers is allowed", func(t *testing.T) {
+		targets, err := planImport([]dataset{rivers, container},
+			[]ogrInfo{ogrInfoOf(t, "rivers"), ogrInfoOf(t, "rivers", "roads")}, []string{"roads"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"roads"}, tableNames(targets))
+	})
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gocastsian/roham/types"
+)
+
+const (
+	defaultCatalogPageSize = 20
+	maxCatalogPageSize     = 100
+)
+
+// CatalogFilter is a catalog search as the repository runs it. The reader fields apply the read rules of the
+// layer policy in the query, so the total of a search is the same on every page
+type CatalogFilter struct {
+	Text     string
+	BBox     *Extent
+	Keywords []string
+	// ReaderID, ReaderRole and the organization claims select the layers the reader may read, and whether
+	// the row rules of a layer let its extent match the bbox
+	ReaderID               types.ID
+	ReaderRole             types.Role
+	ReaderOrganization     string
+	ReaderOrganizationRole string
+	AllLayers              bool
+	Limit                  int
+	Offset                 int
+}
+
+func (s Service) UpdateLayerMetadata(ctx context.Context, req UpdateLayerMetadataRequest) (GetLayerResponse, error) {
+	if err := s.validator.ValidateLayerMetadata(req.Metadata); err != nil {
+		return GetLayerResponse{}, err
+	}
+
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return GetLayerResponse{}, err
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionEdit); err != nil {
+		return GetLayerResponse{}, err
+	}
+
+	if err := s.repository.UpdateLayerMetadata(ctx, layer.ID, req.Metadata); err != nil {
+		return GetLayerResponse{}, err
+	}
+	layer.Metadata = req.Metadata
+
+	return GetLayerResponse{Layer: layer}, nil
+}
+
+func (s Service) ExportLayerMetadata(ctx context.Context, req ExportLayerMetadataRequest) (ExportLayerMetadataResponse, error) {
+	if req.Format == "" {
+		req.Format = MetadataFormatISO19115
+	}
+	if err := s.validator.ValidateExportLayerMetadata(req); err != nil {
+		return ExportLayerMetadataResponse{}, err
+	}
+
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return ExportLayerMetadataResponse{}, err
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionRead); err != nil {
+		return ExportLayerMetadataResponse{}, err
+	}
+	if err := s.scopeLayer(ctx, req.Actor, &layer); err != nil {
+		return ExportLayerMetadataResponse{}, err
+	}
+
+	document, err := exportMetadata(layer, req.Format)
+	if err != nil {
+		return ExportLayerMetadataResponse{}, err
+	}
+
+	return ExportLayerMetadataResponse{
+		ContentType: "application/xml",
+		Document:    document,
+	}, nil
+}
+
+func (s Service) SearchCatalog(ctx context.Context, req SearchCatalogRequest) (SearchCatalogResponse, error) {
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize < 1 {
+		req.PageSize = defaultCatalogPageSize
+	}
+	req.PageSize = min(req.PageSize, maxCatalogPageSize)
+	if err := s.validator.ValidateSearchCatalog(req); err != nil {
+		return SearchCatalogResponse{}, err
+	}
+
+	layers, total, err := s.repository.SearchLayers(ctx, CatalogFilter{
+		Text:                   req.Query,
+		BBox:                   req.BBox,
+		Keywords:               req.Keywords,
+		ReaderID:               req.Actor.ID,
+		ReaderRole:             req.Actor.Role,
+		ReaderOrganization:     req.Actor.Organization,
+		ReaderOrganizationRole: req.Actor.OrganizationRole,
+		AllLayers:              req.Actor.Role == types.RoleAdmin,
+		Limit:                  req.PageSize,
+		Offset:                 (req.Page - 1) * req.PageSize,
+	})
+	if err != nil {
+		return SearchCatalogResponse{}, fmt.Errorf("failed to search the catalog: %w", err)
+	}
+
+	items := make([]CatalogItem, 0, len(layers))
+	for _, layer := range layers {
+		if err := s.scopeLayer(ctx, req.Actor, &layer); err != nil {
+			return SearchCatalogResponse{}, err
+		}
+		items = append(items, catalogItem(layer))
+	}
+
+	return SearchCatalogResponse{
+		Items:    items,
+		Total:    total,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+	}, nil
+}
+
+func catalogItem(layer LayerEntity) CatalogItem {
+	item := CatalogItem{
+		ID:         layer.ID,
+		Name:       layer.Name,
+		GeomType:   layer.GeomType,
+		Visibility: layer.Visibility,
+		Metadata:   layer.Metadata,
+		UpdatedAt:  layer.UpdatedAt,
+	}
+	if layer.Statistics != nil {
+		item.Extent = layer.Statistics.Extent
+		item.FeatureCount = layer.Statistics.FeatureCount
+	}
+	return item
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// compensation undoes one step of a workflow by running activity with req
+type compensation struct {
+	result   CompensationResult
+	activity any
+	req      any
+}
+
+// saga collects the compensations of the steps a workflow completed, rollback undoes them newest first
+type saga struct {
+	compensations []compensation
+}
+
+func (s *saga) add(step CompensationStep, target string, activity any, req any) {
+	s.compensations = append(s.compensations, compensation{
+		result:   CompensationResult{Step: step, Target: target},
+		activity: activity,
+		req:      req,
+	})
+}
+
+// rollback waits on every compensation before starting the next one and keeps going when one fails, the
+// results record what was undone. The compensations run detached so a cancelled workflow still cleans up
+func (s *saga) rollback(steps steps) []CompensationResult {
+	detached := steps.Detached()
+	results := make([]CompensationResult, 0, len(s.compensations))
+	for i := len(s.compensations) - 1; i >= 0; i-- {
+		c := s.compensations[i]
+		result := c.result
+		if err := detached.Execute(c.activity, c.req, nil); err != nil {
+			result.Error = err.Error()
+			steps.Logger().Error("Failed to compensate", "Step", result.Step, "Target", result.Target, "Error", err)
+		}
+		results = append(results, result)
+	}
+	s.compensations = nil
+	return results
+}
+
+// DeleteStyle removes a style and its SLD file, a style that is already gone is not an error so the
+// compensation of an import can be retried
+func (s Service) DeleteStyle(ctx context.Context, req DeleteStyleRequest) (DeleteStyleResponse, error) {
+	filePath, err := s.repository.DeleteStyle(ctx, req.StyleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DeleteStyleResponse{}, nil
+	}
+	if err != nil {
+		return DeleteStyleResponse{}, err
+	}
+
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return DeleteStyleResponse{}, fmt.Errorf("failed to remove SLD file %s: %w", filePath, err)
+	}
+	return DeleteStyleResponse{FilePath: filePath}, nil
+}
+
+// DeleteLayerRecord removes the layers row of a layer an import created, its tables are dropped by DropLayerTable
+func (s Service) DeleteLayerRecord(ctx context.Context, req DeleteLayerRecordRequest) error {
+	if err := s.repository.DeleteLayer(ctx, req.LayerID); err != nil {
+		return err
+	}
+	if err := s.repository.InvalidateLayerCache(ctx, req.LayerID); err != nil {
+		log.Printf("failed to invalidate cache of deleted layer %d: %v", req.LayerID, err)
+	}
+	return nil
+}
+
+// discardImportedLayers removes the tables and styles a failing ImportLayer attempt already wrote, re-imported
+// layers only lose their staging table and keep serving their own
+func (s Service) discardImportedLayers(ctx context.Context, layers []ImportedLayer) {
+	for _, layer := range layers {
+		if _, err := s.DropLayerTable(ctx, DropLayerRequest{TableName: layer.table()}); err != nil {
+			log.Printf("Warning: Failed to drop table %s of a failed import: %v", layer.table(), err)
+		}
+		if layer.StyleFileID == 0 {
+			continue
+		}
+		if _, err := s.DeleteStyle(ctx, DeleteStyleRequest{StyleID: layer.StyleFileID}); err != nil {
+			log.Printf("Warning: Failed to delete style %d of a failed import: %v", layer.StyleFileID, err)
+		}
+	}
+}
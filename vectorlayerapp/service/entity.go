@@ -1,7 +1,9 @@
 package service
 
 import (
+	"encoding/json"
 	"github.com/gocastsian/roham/types"
+	"strconv"
 	"time"
 )
 
@@ -15,22 +17,376 @@ const (
 )
 
 type JobEntity struct {
-	ID        types.ID  `json:"id"`
-	Token     string    `json:"token"`
-	Status    JobStatus `json:"Status"`
-	Error     *string   `json:"Error"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID             types.ID   `json:"id"`
+	Token          string     `json:"token"`
+	Status         JobStatus  `json:"Status"`
+	Error          *string    `json:"Error"`
+	Result         *JobResult `json:"result"`
+	UserID         types.ID   `json:"user_id"`
+	IdempotencyKey string     `json:"idempotency_key"`
+	ContentHash    string     `json:"content_hash"`
+	Priority       Priority   `json:"priority"`
+	Organization   string     `json:"organization"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// JobResult is the summary an import job leaves behind, it is stored as JSONB on the jobs table
+type JobResult struct {
+	Layers []LayerImportResult `json:"layers"`
+}
+
+type LayerImportResult struct {
+	Name               string                     `json:"name"`
+	LayerID            types.ID                   `json:"layer_id,omitempty"`
+	GeomType           string                     `json:"geom_type"`
+	Status             JobStatus                  `json:"status"`
+	Error              string                     `json:"error,omitempty"`
+	GeometryValidation *GeometryValidationSummary `json:"geometry_validation,omitempty"`
+	// Duplicate is set when the archive was already imported and the job only linked to the existing layer
+	Duplicate       bool             `json:"duplicate,omitempty"`
+	DateConversions []DateConversion `json:"date_conversions,omitempty"`
+	// RolledBack lists what was undone, newest first, when the layer failed or the job failed after creating it
+	RolledBack []CompensationResult `json:"rolled_back,omitempty"`
+}
+
+// CompensationResult reports one step of a failed import that was undone, Error is set when undoing it failed too
+type CompensationResult struct {
+	Step   CompensationStep `json:"step"`
+	Target string           `json:"target"`
+	Error  string           `json:"error,omitempty"`
+}
+
+type CompensationStep string
+
+const (
+	CompensationDropTable   CompensationStep = "drop_table"
+	CompensationDeleteStyle CompensationStep = "delete_style"
+	CompensationDeleteLayer CompensationStep = "delete_layer"
+)
+
+// DateConversion reports how the distinct values of a Jalali date attribute were converted during import
+type DateConversion struct {
+	Attribute       string `json:"attribute"`
+	ConvertedValues int    `json:"converted_values"`
+	// InvalidValues are the distinct values that weren't a Jalali date, the features holding them get a null date
+	InvalidValues int `json:"invalid_values"`
+}
+
+// ReprojectMode decides whether a reprojection replaces the table of a layer or copies it into a new layer
+type ReprojectMode string
+
+const (
+	ReprojectModeInPlace  ReprojectMode = "in_place"
+	ReprojectModeNewLayer ReprojectMode = "new_layer"
+)
+
+// DuplicateMode decides what an import does with an archive whose content hash was already imported
+type DuplicateMode string
+
+const (
+	DuplicateModeLink   DuplicateMode = "link"
+	DuplicateModeReject DuplicateMode = "reject"
+)
+
+// GeometryMode decides what the import does with features whose geometry is invalid
+type GeometryMode string
+
+const (
+	GeometryModeRepair     GeometryMode = "repair"
+	GeometryModeReject     GeometryMode = "reject"
+	GeometryModeQuarantine GeometryMode = "quarantine"
+)
+
+type GeometryProblem string
+
+const (
+	GeometryProblemEmpty            GeometryProblem = "empty"
+	GeometryProblemSelfIntersection GeometryProblem = "self_intersection"
+	GeometryProblemRing             GeometryProblem = "ring"
+	GeometryProblemOther            GeometryProblem = "other"
+)
+
+type InvalidGeometry struct {
+	FeatureID int64           `json:"feature_id"`
+	Problem   GeometryProblem `json:"problem"`
+	Reason    string          `json:"reason"`
+}
+
+type GeometryValidationSummary struct {
+	Mode            GeometryMode            `json:"mode"`
+	InvalidCount    int                     `json:"invalid_count"`
+	Problems        map[GeometryProblem]int `json:"problems"`
+	RepairedCount   int64                   `json:"repaired_count"`
+	QuarantineTable string                  `json:"quarantine_table,omitempty"`
+	Features        []InvalidGeometry       `json:"features"`
 }
 
 // TODO add new column system_cordiante
 type LayerEntity struct {
-	ID           types.ID  `json:"id"`
-	Name         string    `json:"name"`
-	GeomType     string    `json:"geom_type"`
-	DefaultStyle types.ID  `json:"default_style"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           types.ID         `json:"id"`
+	Name         string           `json:"name"`
+	GeomType     string           `json:"geom_type"`
+	SRID         EPSGCode         `json:"srid"`
+	DefaultStyle types.ID         `json:"default_style"`
+	Statistics   *LayerStatistics `json:"statistics"`
+	ContentHash  string           `json:"content_hash,omitempty"`
+	OwnerID      types.ID         `json:"owner_id"`
+	Visibility   Visibility       `json:"visibility"`
+	Organization string           `json:"organization,omitempty"`
+	Tags         []string         `json:"tags"`
+	Metadata     LayerMetadata    `json:"metadata"`
+	Time         *LayerTime       `json:"time,omitempty"`
+	// GeneralizedZooms are the zoom bands simplified geometries were built for, in ascending order
+	GeneralizedZooms []int     `json:"generalized_zooms,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// LayerStatistics is computed after every import and stored as JSONB on the layers table
+type LayerStatistics struct {
+	Extent       *Extent               `json:"extent"`
+	FeatureCount int64                 `json:"feature_count"`
+	Attributes   []AttributeStatistics `json:"attributes"`
+	// TemporalExtent is only computed for layers with time attributes
+	TemporalExtent *TemporalExtent `json:"temporal_extent,omitempty"`
+	ComputedAt     time.Time       `json:"computed_at"`
+}
+
+// LayerTime names the attributes holding the time of the features of a time-enabled layer,
+// features without an end attribute are instants at their start
+type LayerTime struct {
+	StartAttribute string `json:"start_attribute"`
+	EndAttribute   string `json:"end_attribute,omitempty"`
+}
+
+// TemporalExtent is the span covered by the features of a time-enabled layer
+type TemporalExtent struct {
+	Start *time.Time `json:"start"`
+	End   *time.Time `json:"end"`
+}
+
+type Extent struct {
+	MinX float64 `json:"min_x"`
+	MinY float64 `json:"min_y"`
+	MaxX float64 `json:"max_x"`
+	MaxY float64 `json:"max_y"`
+}
+
+type AttributeStatistics struct {
+	Name      string       `json:"name"`
+	DataType  string       `json:"data_type"`
+	NullCount int64        `json:"null_count"`
+	Min       *float64     `json:"min,omitempty"`
+	Max       *float64     `json:"max,omitempty"`
+	Mean      *float64     `json:"mean,omitempty"`
+	TopValues []ValueCount `json:"top_values,omitempty"`
+}
+
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// LayerMetadata describes a layer for the catalog, it is stored as JSONB on the layers table
+type LayerMetadata struct {
+	Title           string          `json:"title,omitempty"`
+	Description     string          `json:"description,omitempty"`
+	Keywords        []string        `json:"keywords,omitempty"`
+	Source          string          `json:"source,omitempty"`
+	License         string          `json:"license,omitempty"`
+	Contact         Contact         `json:"contact"`
+	UpdateFrequency UpdateFrequency `json:"update_frequency,omitempty"`
+}
+
+type Contact struct {
+	Name         string `json:"name,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Email        string `json:"email,omitempty"`
+	Phone        string `json:"phone,omitempty"`
+}
+
+// UpdateFrequency takes the values of the ISO 19115 MD_MaintenanceFrequencyCode list
+type UpdateFrequency string
+
+const (
+	UpdateFrequencyContinual   UpdateFrequency = "continual"
+	UpdateFrequencyDaily       UpdateFrequency = "daily"
+	UpdateFrequencyWeekly      UpdateFrequency = "weekly"
+	UpdateFrequencyFortnightly UpdateFrequency = "fortnightly"
+	UpdateFrequencyMonthly     UpdateFrequency = "monthly"
+	UpdateFrequencyQuarterly   UpdateFrequency = "quarterly"
+	UpdateFrequencyBiannually  UpdateFrequency = "biannually"
+	UpdateFrequencyAnnually    UpdateFrequency = "annually"
+	UpdateFrequencyAsNeeded    UpdateFrequency = "asNeeded"
+	UpdateFrequencyIrregular   UpdateFrequency = "irregular"
+	UpdateFrequencyNotPlanned  UpdateFrequency = "notPlanned"
+	UpdateFrequencyUnknown     UpdateFrequency = "unknown"
+)
+
+// MetadataFormat is an export format of the layer metadata
+type MetadataFormat string
+
+const (
+	MetadataFormatISO19115   MetadataFormat = "iso19115"
+	MetadataFormatDublinCore MetadataFormat = "dublincore"
+)
+
+type LookupPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// LookupFeature is a feature found by a point lookup, Distance is 0 for features containing the point
+type LookupFeature struct {
+	ID         int64          `json:"id"`
+	Distance   float64        `json:"distance"`
+	Properties map[string]any `json:"properties"`
+}
+
+// Visibility decides who can read a layer without an explicit share
+type Visibility string
+
+const (
+	VisibilityPrivate      Visibility = "private"
+	VisibilityOrganization Visibility = "organization"
+	VisibilityPublic       Visibility = "public"
+)
+
+// Permission is what a share grants on a layer, every permission includes the ones before it
+type Permission string
+
+const (
+	PermissionRead  Permission = "read"
+	PermissionEdit  Permission = "edit"
+	PermissionAdmin Permission = "admin"
+)
+
+type LayerShareEntity struct {
+	LayerID    types.ID   `json:"layer_id"`
+	UserID     types.ID   `json:"user_id"`
+	Permission Permission `json:"permission"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// MapProjectEntity is a saved map composing several layers, it only references the layers and
+// readers of the map still need read access to every layer to see it
+type MapProjectEntity struct {
+	ID           types.ID          `json:"id"`
+	Name         string            `json:"name"`
+	Description  string            `json:"description"`
+	OwnerID      types.ID          `json:"owner_id"`
+	Visibility   Visibility        `json:"visibility"`
+	Organization string            `json:"organization,omitempty"`
+	View         MapView           `json:"view"`
+	Basemap      *Basemap          `json:"basemap"`
+	Layers       []MapProjectLayer `json:"layers"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// MapView is the initial view of a map
+type MapView struct {
+	Center LookupPoint `json:"center"`
+	Zoom   float64     `json:"zoom"`
+}
+
+// Basemap is a raster XYZ tile service drawn below the layers of a map
+type Basemap struct {
+	Name string `json:"name"`
+	// URL is a tile template with {z}, {x} and {y} placeholders
+	URL         string `json:"url"`
+	Attribution string `json:"attribution,omitempty"`
+}
+
+// MapProjectLayer is a layer placed on a map, layers are drawn in ascending Order so the last one is on top
+type MapProjectLayer struct {
+	LayerID types.ID `json:"layer_id"`
+	Order   int      `json:"order"`
+	Opacity float64  `json:"opacity"`
+	Visible bool     `json:"visible"`
+	// StyleID is the style chosen for the layer on this map, 0 uses the default style of the layer
+	StyleID types.ID `json:"style_id,omitempty"`
+	// MinZoom and MaxZoom limit the zoom levels the layer is shown at, a MaxZoom of 0 has no upper limit
+	MinZoom float64 `json:"min_zoom"`
+	MaxZoom float64 `json:"max_zoom"`
+	// LayerName and GeomType are read from the layer and ignored on writes
+	LayerName string `json:"layer_name"`
+	GeomType  string `json:"geom_type"`
+}
+
+// UnmarshalJSON shows a layer placed without opacity or visible fully opaque and visible
+func (l *MapProjectLayer) UnmarshalJSON(data []byte) error {
+	type plain MapProjectLayer
+	layer := plain{Opacity: 1, Visible: true}
+	if err := json.Unmarshal(data, &layer); err != nil {
+		return err
+	}
+	*l = MapProjectLayer(layer)
+	return nil
+}
+
+type MapProjectShareEntity struct {
+	MapID      types.ID   `json:"map_id"`
+	UserID     types.ID   `json:"user_id"`
+	Permission Permission `json:"permission"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// MapExportFormat is a document format a map project can be exported as
+type MapExportFormat string
+
+const (
+	MapExportFormatMapLibre MapExportFormat = "maplibre"
+	MapExportFormatQGIS     MapExportFormat = "qgis"
+)
+
+// Actor is the authenticated user a request is made for, as forwarded by the gateway in X-User-Info
+type Actor struct {
+	ID               types.ID   `json:"user_id"`
+	Role             types.Role `json:"role"`
+	Organization     string     `json:"organization"`
+	OrganizationRole string     `json:"organization_role"`
+	// Region is the area the user works in, such as the province of a provincial office
+	Region string `json:"region"`
+}
+
+// Claim is an attribute of the actor a row rule compares the features of a layer with
+type Claim string
+
+const (
+	ClaimRole         Claim = "role"
+	ClaimOrganization Claim = "organization"
+	ClaimRegion       Claim = "region"
+)
+
+// Value returns the claim of actor as text, roles are their number. It is empty when the actor doesn't have it
+func (c Claim) Value(actor Actor) string {
+	switch c {
+	case ClaimRole:
+		if actor.Role == 0 {
+			return ""
+		}
+		return strconv.Itoa(int(actor.Role))
+	case ClaimOrganization:
+		return actor.Organization
+	case ClaimRegion:
+		return actor.Region
+	}
+	return ""
+}
+
+// LayerRowRuleEntity limits the features of a layer to the ones whose attribute equals a claim of the reader,
+// readers with one of the exempt roles see every feature
+type LayerRowRuleEntity struct {
+	ID          types.ID     `json:"id"`
+	LayerID     types.ID     `json:"layer_id"`
+	Attribute   string       `json:"attribute"`
+	Claim       Claim        `json:"claim"`
+	ExemptRoles []types.Role `json:"exempt_roles"`
+	CreatedAt   time.Time    `json:"created_at"`
 }
 
 type StyleEntity struct {
@@ -47,3 +403,9 @@ type LayerStylesEntity struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// DownloadedFile describes a file the FilerClient has written to disk
+type DownloadedFile struct {
+	Size   int64
+	SHA256 string
+}
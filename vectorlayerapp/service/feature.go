@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gocastsian/roham/pkg/cql2"
+)
+
+type FeatureConfig struct {
+	DefaultLimit int `koanf:"default_limit"`
+	MaxLimit     int `koanf:"max_limit"`
+}
+
+// GeometryProperty is the name CQL2 filters use for the geometry of a feature, whatever its column is called
+const GeometryProperty = "geometry"
+
+// Feature is a GeoJSON feature of a layer, its geometry is in WGS 84
+type Feature struct {
+	Type       string          `json:"type"`
+	ID         int64           `json:"id"`
+	Geometry   json.RawMessage `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+// FeaturePage is a page of the features of a layer matching a filter, Matched counts all of them
+type FeaturePage struct {
+	Features []Feature
+	Matched  int64
+}
+
+// ParseFilter parses the filter of a feature request, lang is cql2-text or cql2-json and defaults to the former
+func ParseFilter(filter string, lang string) (cql2.Expression, error) {
+	if filter == "" {
+		return nil, nil
+	}
+
+	var (
+		expression cql2.Expression
+		err        error
+	)
+	switch lang {
+	case "", "cql2-text":
+		expression, err = cql2.ParseText(filter)
+	case "cql2-json":
+		expression, err = cql2.ParseJSON([]byte(filter))
+	default:
+		return nil, validation.Errors{"filter-lang": fmt.Errorf("must be cql2-text or cql2-json")}
+	}
+	if err != nil {
+		return nil, validation.Errors{"filter": err}
+	}
+	return expression, nil
+}
+
+// checkFilter makes sure a filter only reads attributes of the layer table, spatial predicates read its geometry
+func (s Service) checkFilter(ctx context.Context, layer LayerEntity, filter cql2.Expression) error {
+	if filter == nil {
+		return nil
+	}
+
+	available, err := s.repository.GetLayerAttributes(ctx, layer.Name)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(available))
+	for _, name := range available {
+		known[name] = true
+	}
+
+	attributes, geometries := cql2.Properties(filter)
+	for _, name := range attributes {
+		if !known[name] {
+			return validation.Errors{"filter": fmt.Errorf("%s is not an attribute of layer %s", name, layer.Name)}
+		}
+	}
+	for _, name := range geometries {
+		if name != GeometryProperty {
+			return validation.Errors{"filter": fmt.Errorf("spatial predicates compare %s, not %s", GeometryProperty, name)}
+		}
+	}
+	return nil
+}
+
+// QueryFeatures returns a page of the features of a layer matching the filter and datetime of the request
+func (s Service) QueryFeatures(ctx context.Context, req QueryFeaturesRequest) (QueryFeaturesResponse, error) {
+	if req.Limit == 0 {
+		req.Limit = s.config.Feature.DefaultLimit
+	}
+	if err := s.validator.ValidateQueryFeatures(req, s.config.Feature); err != nil {
+		return QueryFeaturesResponse{}, err
+	}
+
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return QueryFeaturesResponse{}, err
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionRead); err != nil {
+		return QueryFeaturesResponse{}, err
+	}
+	if err := s.checkFilter(ctx, layer, req.Filter); err != nil {
+		return QueryFeaturesResponse{}, err
+	}
+	scope, err := s.rowScope(ctx, req.Actor, layer)
+	if err != nil {
+		return QueryFeaturesResponse{}, err
+	}
+
+	filter := FeatureFilter{Time: req.Datetime, CQL: req.Filter, Scope: scope}
+	page, err := s.repository.QueryFeatures(ctx, layer, filter, req.Limit, req.Offset)
+	if err != nil {
+		return QueryFeaturesResponse{}, err
+	}
+
+	return QueryFeaturesResponse{
+		Type:           "FeatureCollection",
+		Features:       page.Features,
+		NumberMatched:  page.Matched,
+		NumberReturned: len(page.Features),
+	}, nil
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter("", "cql2-json")
+	require.NoError(t, err)
+	assert.Nil(t, filter)
+
+	filter, err = ParseFilter(`S_INTERSECTS(geometry, BBOX(51, 35, 52, 36)) AND population > 1000`, "cql2-text")
+	require.NoError(t, err)
+	assert.Equal(t, `(S_INTERSECTS("geometry", POLYGON((51 35,52 35,52 36,51 36,51 35))) AND "population" > 1000)`, filter.String())
+
+	tests := []struct {
+		name   string
+		filter string
+		lang   string
+		field  string
+	}{
+		{name: "unknown encoding", filter: `a = 1`, lang: "sql", field: "filter-lang"},
+		{name: "invalid text", filter: `a = `, field: "filter"},
+		{name: "text as json", filter: `a = 1`, lang: "cql2-json", field: "filter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFilter(tt.filter, tt.lang)
+			var errs validation.Errors
+			require.ErrorAs(t, err, &errs)
+			assert.Contains(t, errs, tt.field)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/gocastsian/roham/types"
+)
+
+// GeneralizationConfig sets the zoom bands simplified geometries are built for after an import
+type GeneralizationConfig struct {
+	// Zooms are the highest zoom of every band, a tile uses the band of the smallest zoom not below its own.
+	// Tiles past the last band are cut from the full geometries
+	Zooms []int `koanf:"zooms"`
+	// PixelTolerance is the simplification tolerance in pixels of a 256 pixel tile at the zoom of the band
+	PixelTolerance float64 `koanf:"pixel_tolerance"`
+}
+
+// GeneralizationLevel is one zoom band of a generalized layer
+type GeneralizationLevel struct {
+	Zoom int
+	// Tolerance is in web mercator meters
+	Tolerance float64
+}
+
+// length of the equator in web mercator meters
+const webMercatorCircumference = 2 * math.Pi * 6378137
+
+// ZoomResolution returns the meters per pixel of a 256 pixel tile at zoom
+func ZoomResolution(zoom int) float64 {
+	return webMercatorCircumference / (256 * math.Exp2(float64(zoom)))
+}
+
+// levels returns the bands of the config ordered by zoom
+func (c GeneralizationConfig) levels() []GeneralizationLevel {
+	zooms := append([]int(nil), c.Zooms...)
+	sort.Ints(zooms)
+
+	levels := make([]GeneralizationLevel, 0, len(zooms))
+	for i, zoom := range zooms {
+		if zoom < 0 || (i > 0 && zoom == zooms[i-1]) {
+			continue
+		}
+		levels = append(levels, GeneralizationLevel{Zoom: zoom, Tolerance: c.PixelTolerance * ZoomResolution(zoom)})
+	}
+	return levels
+}
+
+// generalizedZoom picks the band a tile at zoom is cut from, nil means the full geometries
+func generalizedZoom(layer LayerEntity, zoom int) *int {
+	for _, band := range layer.GeneralizedZooms {
+		if band >= zoom {
+			return &band
+		}
+	}
+	return nil
+}
+
+// GeneralizeLayer builds the simplified geometries of every zoom band of a line or polygon layer, point layers
+// have nothing to simplify. Simplification preserves topology so polygons stay valid and keep their holes.
+// A layer that isn't generalized, skipped or failed, loses the generalized geometries of its former table
+func (s Service) GeneralizeLayer(ctx context.Context, req GeneralizeLayerRequest) (GeneralizeLayerResponse, error) {
+	levels := s.config.Tile.Generalization.levels()
+	if len(levels) == 0 || s.config.Tile.Generalization.PixelTolerance <= 0 ||
+		strings.Contains(strings.ToUpper(req.GeomType), "POINT") {
+		return GeneralizeLayerResponse{}, s.clearGeneralization(ctx, req.LayerID, req.TableName)
+	}
+
+	if err := s.repository.BuildGeneralizedGeometries(ctx, req.TableName, levels); err != nil {
+		if clearErr := s.clearGeneralization(ctx, req.LayerID, req.TableName); clearErr != nil {
+			log.Printf("failed to clear generalization of %s: %v", req.TableName, clearErr)
+		}
+		return GeneralizeLayerResponse{}, err
+	}
+
+	zooms := make([]int, 0, len(levels))
+	for _, level := range levels {
+		zooms = append(zooms, level.Zoom)
+	}
+	if err := s.repository.UpdateLayerGeneralization(ctx, req.LayerID, zooms); err != nil {
+		return GeneralizeLayerResponse{}, err
+	}
+	s.layerChanged(ctx, req.LayerID)
+
+	log.Printf("Generalized %s for zoom bands %v", req.TableName, zooms)
+	return GeneralizeLayerResponse{Zooms: zooms}, nil
+}
+
+// clearGeneralization serves a layer from its full geometries again, the zoom bands are cleared before the
+// generalized table is dropped so no tile is ever read from a missing or foreign table
+func (s Service) clearGeneralization(ctx context.Context, layerID types.ID, tableName string) error {
+	if err := s.repository.UpdateLayerGeneralization(ctx, layerID, nil); err != nil {
+		return err
+	}
+	if _, err := s.repository.DropTable(ctx, tableName+GeneralizedTableSuffix); err != nil {
+		return err
+	}
+	s.layerChanged(ctx, layerID)
+	return nil
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneralizationLevels(t *testing.T) {
+	config := GeneralizationConfig{Zooms: []int{9, 3, 6, 3, -1}, PixelTolerance: 0.5}
+
+	levels := config.levels()
+	require.Len(t, levels, 3)
+	assert.Equal(t, []int{3, 6, 9}, []int{levels[0].Zoom, levels[1].Zoom, levels[2].Zoom})
+	assert.InDelta(t, 0.5*156543.03392804097/8, levels[0].Tolerance, 1e-6)
+	assert.InDelta(t, levels[0].Tolerance/64, levels[2].Tolerance, 1e-9)
+}
+
+func TestGeneralizedZoom(t *testing.T) {
+	layer := LayerEntity{GeneralizedZooms: []int{3, 6, 9}}
+
+	for zoom, want := range map[int]int{0: 3, 3: 3, 4: 6, 9: 9} {
+		band := generalizedZoom(layer, zoom)
+		require.NotNil(t, band, zoom)
+		assert.Equal(t, want, *band, zoom)
+	}
+	assert.Nil(t, generalizedZoom(layer, 10))
+	assert.Nil(t, generalizedZoom(LayerEntity{}, 0))
+}
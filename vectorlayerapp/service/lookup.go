@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"fmt"
+)
+
+type LookupConfig struct {
+	// DefaultTolerance and MaxTolerance are in meters
+	DefaultTolerance float64 `koanf:"default_tolerance"`
+	MaxTolerance     float64 `koanf:"max_tolerance"`
+	MaxLayers        int     `koanf:"max_layers"`
+	// MaxFeatures bounds the features returned per layer
+	MaxFeatures int `koanf:"max_features"`
+}
+
+// Lookup answers "what is at this coordinate" for every named layer, layers the actor can't read fail the whole request
+func (s Service) Lookup(ctx context.Context, req LookupRequest) (LookupResponse, error) {
+	if req.Tolerance == nil {
+		req.Tolerance = &s.config.Lookup.DefaultTolerance
+	}
+	if err := s.validator.ValidateLookup(req, s.config.Lookup); err != nil {
+		return LookupResponse{}, err
+	}
+
+	results := make([]LayerLookupResult, 0, len(req.Layers))
+	for _, name := range req.Layers {
+		layer, err := s.repository.GetLayerByName(ctx, name)
+		if err != nil {
+			return LookupResponse{}, err
+		}
+		if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionRead); err != nil {
+			return LookupResponse{}, err
+		}
+		if err := s.checkFilter(ctx, layer, req.Filter); err != nil {
+			return LookupResponse{}, err
+		}
+		scope, err := s.rowScope(ctx, req.Actor, layer)
+		if err != nil {
+			return LookupResponse{}, err
+		}
+
+		features, err := s.repository.LookupFeatures(ctx, layer, req.Point, *req.Tolerance, s.config.Lookup.MaxFeatures,
+			FeatureFilter{Time: req.Datetime, CQL: req.Filter, Scope: scope})
+		if err != nil {
+			return LookupResponse{}, fmt.Errorf("failed to look up %s: %w", name, err)
+		}
+		results = append(results, LayerLookupResult{
+			Layer:    layer.Name,
+			LayerID:  layer.ID,
+			Features: features,
+		})
+	}
+
+	return LookupResponse{
+		Point:  req.Point,
+		Layers: results,
+	}, nil
+}
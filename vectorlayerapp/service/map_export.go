@@ -0,0 +1,377 @@
+package service
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// zoom levels of a map are the ones of MapLibre, which renders 512 pixel tiles
+const (
+	webMercatorRadius = 6378137.0
+	// resolution in meters per pixel at zoom 0
+	zoomZeroResolution = 2 * math.Pi * webMercatorRadius / 512
+	// scale denominator at zoom 0 for the 0.28 mm pixel of OGC and QGIS
+	zoomZeroScale       = zoomZeroResolution / 0.00028
+	maxMercatorLatitude = 85.05112878
+	// the viewport a QGIS canvas extent is computed for
+	qgisCanvasWidth  = 1024
+	qgisCanvasHeight = 768
+)
+
+// default colors of map layers, picked by the position of the layer
+var mapLayerPalette = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#17becf"}
+
+var fileNameRegexp = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// mapExporter renders map projects for clients outside Roham, the documents point at the tile endpoint of every layer
+type mapExporter struct {
+	publicURL string
+	maxZoom   int
+}
+
+func (e mapExporter) tileURL(mapLayer MapProjectLayer) string {
+	return fmt.Sprintf("%s/v1/layer/%d/tiles/{z}/{x}/{y}.mvt", strings.TrimSuffix(e.publicURL, "/"), mapLayer.LayerID)
+}
+
+func mapFileName(project MapProjectEntity) string {
+	name := strings.Trim(fileNameRegexp.ReplaceAllString(project.Name, "_"), "_")
+	if name == "" {
+		return "map-" + strconv.FormatUint(uint64(project.ID), 10)
+	}
+	return name
+}
+
+type mapLibreStyle struct {
+	Version  int                       `json:"version"`
+	Name     string                    `json:"name"`
+	Metadata map[string]any            `json:"metadata,omitempty"`
+	Center   [2]float64                `json:"center"`
+	Zoom     float64                   `json:"zoom"`
+	Sources  map[string]mapLibreSource `json:"sources"`
+	Layers   []mapLibreLayer           `json:"layers"`
+}
+
+type mapLibreSource struct {
+	Type        string   `json:"type"`
+	Tiles       []string `json:"tiles"`
+	TileSize    int      `json:"tileSize,omitempty"`
+	MaxZoom     int      `json:"maxzoom,omitempty"`
+	Attribution string   `json:"attribution,omitempty"`
+}
+
+type mapLibreLayer struct {
+	ID          string         `json:"id"`
+	Type        string         `json:"type"`
+	Source      string         `json:"source"`
+	SourceLayer string         `json:"source-layer,omitempty"`
+	Filter      []any          `json:"filter,omitempty"`
+	MinZoom     float64        `json:"minzoom,omitempty"`
+	MaxZoom     float64        `json:"maxzoom,omitempty"`
+	Layout      map[string]any `json:"layout"`
+	Paint       map[string]any `json:"paint,omitempty"`
+	Metadata    map[string]any `json:"metadata,omitempty"`
+}
+
+// mapLibreStyle renders project as a MapLibre style document with one vector source per layer
+func (e mapExporter) mapLibreStyle(project MapProjectEntity) ([]byte, error) {
+	style := mapLibreStyle{
+		Version:  8,
+		Name:     project.Name,
+		Metadata: map[string]any{"roham:map_id": project.ID},
+		Center:   [2]float64{project.View.Center.Lon, project.View.Center.Lat},
+		Zoom:     project.View.Zoom,
+		Sources:  make(map[string]mapLibreSource),
+		Layers:   make([]mapLibreLayer, 0),
+	}
+
+	if project.Basemap != nil {
+		style.Sources["basemap"] = mapLibreSource{
+			Type:        "raster",
+			Tiles:       []string{project.Basemap.URL},
+			TileSize:    256,
+			Attribution: project.Basemap.Attribution,
+		}
+		style.Layers = append(style.Layers, mapLibreLayer{
+			ID:     "basemap",
+			Type:   "raster",
+			Source: "basemap",
+			Layout: map[string]any{"visibility": "visible"},
+		})
+	}
+
+	for i, mapLayer := range project.Layers {
+		sourceID := fmt.Sprintf("layer-%d-%d", mapLayer.LayerID, i)
+		style.Sources[sourceID] = mapLibreSource{
+			Type:    "vector",
+			Tiles:   []string{e.tileURL(mapLayer)},
+			MaxZoom: e.maxZoom,
+		}
+
+		visibility := "none"
+		if mapLayer.Visible {
+			visibility = "visible"
+		}
+		color := mapLayerPalette[i%len(mapLayerPalette)]
+		metadata := map[string]any{"roham:layer_id": mapLayer.LayerID}
+		if mapLayer.StyleID != 0 {
+			metadata["roham:style_id"] = mapLayer.StyleID
+		}
+
+		for _, symbolizer := range geometrySymbolizers(mapLayer.GeomType) {
+			style.Layers = append(style.Layers, mapLibreLayer{
+				ID:          sourceID + "-" + symbolizer.layerType,
+				Type:        symbolizer.layerType,
+				Source:      sourceID,
+				SourceLayer: mapLayer.LayerName,
+				Filter:      symbolizer.filter,
+				MinZoom:     mapLayer.MinZoom,
+				MaxZoom:     mapLayer.MaxZoom,
+				Layout:      map[string]any{"visibility": visibility},
+				Paint:       symbolizer.paint(color, mapLayer.Opacity),
+				Metadata:    metadata,
+			})
+		}
+	}
+
+	out, err := json.MarshalIndent(style, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode style of map %d: %w", project.ID, err)
+	}
+	return out, nil
+}
+
+type geometrySymbolizer struct {
+	layerType string
+	filter    []any
+	paint     func(color string, opacity float64) map[string]any
+}
+
+var (
+	fillSymbolizer = geometrySymbolizer{
+		layerType: "fill",
+		filter:    []any{"==", "$type", "Polygon"},
+		paint: func(color string, opacity float64) map[string]any {
+			return map[string]any{"fill-color": color, "fill-opacity": opacity * 0.5, "fill-outline-color": color}
+		},
+	}
+	lineSymbolizer = geometrySymbolizer{
+		layerType: "line",
+		filter:    []any{"==", "$type", "LineString"},
+		paint: func(color string, opacity float64) map[string]any {
+			return map[string]any{"line-color": color, "line-opacity": opacity, "line-width": 1.5}
+		},
+	}
+	circleSymbolizer = geometrySymbolizer{
+		layerType: "circle",
+		filter:    []any{"==", "$type", "Point"},
+		paint: func(color string, opacity float64) map[string]any {
+			return map[string]any{"circle-color": color, "circle-opacity": opacity, "circle-radius": 4}
+		},
+	}
+)
+
+// geometrySymbolizers picks the MapLibre layers drawing a geometry type, layers of mixed geometries get all of them
+func geometrySymbolizers(geomType string) []geometrySymbolizer {
+	geomType = strings.ToUpper(geomType)
+	switch {
+	case strings.Contains(geomType, "POLYGON"):
+		return []geometrySymbolizer{fillSymbolizer}
+	case strings.Contains(geomType, "LINESTRING"):
+		return []geometrySymbolizer{lineSymbolizer}
+	case strings.Contains(geomType, "POINT"):
+		return []geometrySymbolizer{circleSymbolizer}
+	default:
+		return []geometrySymbolizer{fillSymbolizer, lineSymbolizer, circleSymbolizer}
+	}
+}
+
+type qgisProject struct {
+	XMLName       xml.Name        `xml:"qgis"`
+	ProjectName   string          `xml:"projectname,attr"`
+	Version       string          `xml:"version,attr"`
+	Title         string          `xml:"title"`
+	ProjectCRS    qgisCRS         `xml:"projectCrs>spatialrefsys"`
+	LayerTree     []qgisTreeLayer `xml:"layer-tree-group>layer-tree-layer"`
+	Canvas        qgisCanvas      `xml:"mapcanvas"`
+	ProjectLayers []qgisMapLayer  `xml:"projectlayers>maplayer"`
+	LayerOrder    []qgisLayerRef  `xml:"layerorder>layer"`
+}
+
+type qgisCRS struct {
+	AuthID string `xml:"authid"`
+}
+
+type qgisTreeLayer struct {
+	ID       string `xml:"id,attr"`
+	Name     string `xml:"name,attr"`
+	Source   string `xml:"source,attr"`
+	Checked  string `xml:"checked,attr"`
+	Expanded string `xml:"expanded,attr"`
+}
+
+type qgisCanvas struct {
+	Name        string     `xml:"name,attr"`
+	Units       string     `xml:"units"`
+	Extent      qgisExtent `xml:"extent"`
+	Destination qgisCRS    `xml:"destinationsrs>spatialrefsys"`
+}
+
+type qgisExtent struct {
+	XMin string `xml:"xmin"`
+	YMin string `xml:"ymin"`
+	XMax string `xml:"xmax"`
+	YMax string `xml:"ymax"`
+}
+
+type qgisMapLayer struct {
+	Type                 string        `xml:"type,attr"`
+	HasScaleBasedVisible int           `xml:"hasScaleBasedVisibilityFlag,attr"`
+	MinScale             string        `xml:"minScale,attr"`
+	MaxScale             string        `xml:"maxScale,attr"`
+	ID                   string        `xml:"id"`
+	DataSource           string        `xml:"datasource"`
+	LayerName            string        `xml:"layername"`
+	SRS                  qgisCRS       `xml:"srs>spatialrefsys"`
+	Provider             string        `xml:"provider,omitempty"`
+	Opacity              string        `xml:"layerOpacity"`
+	Properties           qgisOptionMap `xml:"customproperties>Option"`
+	Attribution          *qgisAttrList `xml:"attributionlist,omitempty"`
+}
+
+type qgisAttrList struct {
+	Attribution string `xml:"attribution"`
+}
+
+type qgisOptionMap struct {
+	Type    string       `xml:"type,attr"`
+	Options []qgisOption `xml:"Option"`
+}
+
+type qgisOption struct {
+	Name  string `xml:"name,attr"`
+	Type  string `xml:"type,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type qgisLayerRef struct {
+	ID string `xml:"id,attr"`
+}
+
+// qgisProject renders project as a QGIS project file with an XYZ vector tile layer per map layer
+func (e mapExporter) qgisProject(project MapProjectEntity) ([]byte, error) {
+	doc := qgisProject{
+		ProjectName: project.Name,
+		Version:     "3.34.0",
+		Title:       project.Name,
+		ProjectCRS:  qgisCRS{AuthID: "EPSG:3857"},
+		Canvas: qgisCanvas{
+			Name:        "theMapCanvas",
+			Units:       "meters",
+			Extent:      canvasExtent(project.View),
+			Destination: qgisCRS{AuthID: "EPSG:3857"},
+		},
+	}
+
+	// the layer tree lists the top layer first while map layers are ordered bottom up
+	for i := len(project.Layers) - 1; i >= 0; i-- {
+		mapLayer := project.Layers[i]
+		id := fmt.Sprintf("roham_layer_%d_%d", mapLayer.LayerID, i)
+		source := fmt.Sprintf("styleUrl=&type=xyz&url=%s&zmax=%d&zmin=0", url.QueryEscape(e.tileURL(mapLayer)), e.maxZoom)
+
+		layer := qgisMapLayer{
+			Type:       "vector-tile",
+			MinScale:   zoomScale(mapLayer.MinZoom),
+			MaxScale:   zoomScale(mapLayer.MaxZoom),
+			ID:         id,
+			DataSource: source,
+			LayerName:  mapLayer.LayerName,
+			SRS:        qgisCRS{AuthID: "EPSG:3857"},
+			Opacity:    strconv.FormatFloat(mapLayer.Opacity, 'f', -1, 64),
+			Properties: qgisOptionMap{Type: "Map", Options: []qgisOption{
+				{Name: "roham/layer_id", Type: "QString", Value: strconv.FormatUint(uint64(mapLayer.LayerID), 10)},
+			}},
+		}
+		if mapLayer.MinZoom > 0 || mapLayer.MaxZoom > 0 {
+			layer.HasScaleBasedVisible = 1
+		}
+		if mapLayer.StyleID != 0 {
+			layer.Properties.Options = append(layer.Properties.Options, qgisOption{
+				Name: "roham/style_id", Type: "QString", Value: strconv.FormatUint(uint64(mapLayer.StyleID), 10),
+			})
+		}
+
+		doc.ProjectLayers = append(doc.ProjectLayers, layer)
+		doc.LayerTree = append(doc.LayerTree, qgisTreeLayer{
+			ID: id, Name: mapLayer.LayerName, Source: source, Checked: qgisChecked(mapLayer.Visible), Expanded: "1",
+		})
+		doc.LayerOrder = append(doc.LayerOrder, qgisLayerRef{ID: id})
+	}
+
+	if project.Basemap != nil {
+		source := "type=xyz&url=" + url.QueryEscape(project.Basemap.URL)
+		layer := qgisMapLayer{
+			Type:       "raster",
+			MinScale:   "0",
+			MaxScale:   "0",
+			ID:         "roham_basemap",
+			DataSource: source,
+			LayerName:  project.Basemap.Name,
+			SRS:        qgisCRS{AuthID: "EPSG:3857"},
+			Provider:   "wms",
+			Opacity:    "1",
+			Properties: qgisOptionMap{Type: "Map"},
+		}
+		if project.Basemap.Attribution != "" {
+			layer.Attribution = &qgisAttrList{Attribution: project.Basemap.Attribution}
+		}
+		doc.ProjectLayers = append(doc.ProjectLayers, layer)
+		doc.LayerTree = append(doc.LayerTree, qgisTreeLayer{
+			ID: layer.ID, Name: layer.LayerName, Source: source, Checked: qgisChecked(true), Expanded: "1",
+		})
+		doc.LayerOrder = append(doc.LayerOrder, qgisLayerRef{ID: layer.ID})
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QGIS project of map %d: %w", project.ID, err)
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func qgisChecked(visible bool) string {
+	if visible {
+		return "Qt::Checked"
+	}
+	return "Qt::Unchecked"
+}
+
+// zoomScale converts a zoom level to a QGIS scale denominator, zoom 0 means no limit
+func zoomScale(zoom float64) string {
+	if zoom <= 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(math.Round(zoomZeroScale/math.Pow(2, zoom)), 'f', -1, 64)
+}
+
+// canvasExtent is the Web Mercator extent of a QGIS canvas showing view
+func canvasExtent(view MapView) qgisExtent {
+	lat := math.Max(-maxMercatorLatitude, math.Min(maxMercatorLatitude, view.Center.Lat))
+	x := webMercatorRadius * view.Center.Lon * math.Pi / 180
+	y := webMercatorRadius * math.Log(math.Tan(math.Pi/4+lat*math.Pi/360))
+
+	resolution := zoomZeroResolution / math.Pow(2, view.Zoom)
+	halfWidth := resolution * qgisCanvasWidth / 2
+	halfHeight := resolution * qgisCanvasHeight / 2
+	return qgisExtent{
+		XMin: formatCoordinate(x - halfWidth),
+		YMin: formatCoordinate(y - halfHeight),
+		XMax: formatCoordinate(x + halfWidth),
+		YMax: formatCoordinate(y + halfHeight),
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMapProject() MapProjectEntity {
+	return MapProjectEntity{
+		ID:   3,
+		Name: "Tehran utilities",
+		View: MapView{Center: LookupPoint{Lat: 35.7, Lon: 51.4}, Zoom: 11},
+		Basemap: &Basemap{
+			Name:        "OpenStreetMap",
+			URL:         "https://tile.openstreetmap.org/{z}/{x}/{y}.png",
+			Attribution: "© OpenStreetMap contributors",
+		},
+		Layers: []MapProjectLayer{
+			{LayerID: 7, Order: 0, Opacity: 0.6, Visible: true, LayerName: "parcels", GeomType: "MULTIPOLYGON", MinZoom: 12},
+			{LayerID: 8, Order: 1, Opacity: 1, Visible: false, StyleID: 4, LayerName: "pipes", GeomType: "MULTILINESTRING"},
+		},
+	}
+}
+
+func TestMapLibreStyle(t *testing.T) {
+	exporter := mapExporter{publicURL: "https://gis.example.com/vectorlayer/", maxZoom: 22}
+
+	out, err := exporter.mapLibreStyle(testMapProject())
+	require.NoError(t, err)
+
+	var style mapLibreStyle
+	require.NoError(t, json.Unmarshal(out, &style))
+
+	assert.Equal(t, 8, style.Version)
+	assert.Equal(t, [2]float64{51.4, 35.7}, style.Center)
+	assert.Equal(t, []string{"https://gis.example.com/vectorlayer/v1/layer/7/tiles/{z}/{x}/{y}.mvt"}, style.Sources["layer-7-0"].Tiles)
+	assert.Equal(t, 22, style.Sources["layer-7-0"].MaxZoom)
+	assert.Equal(t, "raster", style.Sources["basemap"].Type)
+
+	require.Len(t, style.Layers, 3)
+	assert.Equal(t, "basemap", style.Layers[0].ID, "the basemap is drawn first")
+
+	parcels := style.Layers[1]
+	assert.Equal(t, "fill", parcels.Type)
+	assert.Equal(t, "parcels", parcels.SourceLayer)
+	assert.Equal(t, 12.0, parcels.MinZoom)
+	assert.Equal(t, "visible", parcels.Layout["visibility"])
+	assert.Equal(t, 0.3, parcels.Paint["fill-opacity"])
+
+	pipes := style.Layers[2]
+	assert.Equal(t, "line", pipes.Type)
+	assert.Equal(t, "none", pipes.Layout["visibility"])
+	assert.Equal(t, 4.0, pipes.Metadata["roham:style_id"])
+}
+
+func TestMapLibreStyleMixedGeometry(t *testing.T) {
+	project := MapProjectEntity{ID: 1, Name: "mixed", Layers: []MapProjectLayer{
+		{LayerID: 9, Opacity: 1, Visible: true, LayerName: "features", GeomType: "GEOMETRY"},
+	}}
+
+	out, err := mapExporter{maxZoom: 22}.mapLibreStyle(project)
+	require.NoError(t, err)
+
+	var style mapLibreStyle
+	require.NoError(t, json.Unmarshal(out, &style))
+
+	types := make([]string, 0)
+	for _, layer := range style.Layers {
+		types = append(types, layer.Type)
+	}
+	assert.Equal(t, []string{"fill", "line", "circle"}, types)
+}
+
+func TestQGISProject(t *testing.T) {
+	exporter := mapExporter{publicURL: "https://gis.example.com/vectorlayer", maxZoom: 22}
+
+	out, err := exporter.qgisProject(testMapProject())
+	require.NoError(t, err)
+
+	var doc struct {
+		XMLName xml.Name `xml:"qgis"`
+		Tree    []struct {
+			Name    string `xml:"name,attr"`
+			Checked string `xml:"checked,attr"`
+		} `xml:"layer-tree-group>layer-tree-layer"`
+		Layers []struct {
+			Type       string `xml:"type,attr"`
+			ScaleFlag  int    `xml:"hasScaleBasedVisibilityFlag,attr"`
+			MinScale   string `xml:"minScale,attr"`
+			DataSource string `xml:"datasource"`
+			Opacity    string `xml:"layerOpacity"`
+		} `xml:"projectlayers>maplayer"`
+		Extent struct {
+			XMin float64 `xml:"xmin"`
+			XMax float64 `xml:"xmax"`
+		} `xml:"mapcanvas>extent"`
+	}
+	require.NoError(t, xml.Unmarshal(out, &doc))
+
+	require.Len(t, doc.Tree, 3)
+	assert.Equal(t, "pipes", doc.Tree[0].Name, "the top layer comes first in the layer tree")
+	assert.Equal(t, "Qt::Unchecked", doc.Tree[0].Checked)
+	assert.Equal(t, "parcels", doc.Tree[1].Name)
+	assert.Equal(t, "OpenStreetMap", doc.Tree[2].Name)
+
+	require.Len(t, doc.Layers, 3)
+	parcels := doc.Layers[1]
+	assert.Equal(t, "vector-tile", parcels.Type)
+	assert.Equal(t, 1, parcels.ScaleFlag)
+	assert.Equal(t, "68247", parcels.MinScale)
+	assert.Equal(t, "0.6", parcels.Opacity)
+	assert.Contains(t, parcels.DataSource, "url=https%3A%2F%2Fgis.example.com%2Fvectorlayer%2Fv1%2Flayer%2F7%2Ftiles%2F%7Bz%7D")
+	assert.Equal(t, "raster", doc.Layers[2].Type)
+
+	// Tehran is east of Greenwich and the canvas is centered on it
+	assert.Greater(t, doc.Extent.XMin, 5_000_000.0)
+	assert.InDelta(t, 5_721_000.0, (doc.Extent.XMin+doc.Extent.XMax)/2, 1_000)
+}
+
+func TestNormalizeMapLayers(t *testing.T) {
+	layers := normalizeMapLayers([]MapProjectLayer{
+		{LayerID: 1, Order: 10},
+		{LayerID: 2, Order: -1},
+		{LayerID: 3, Order: 10},
+	})
+
+	ids := make([]uint64, 0)
+	for i, layer := range layers {
+		assert.Equal(t, i, layer.Order)
+		ids = append(ids, uint64(layer.LayerID))
+	}
+	assert.Equal(t, []uint64{2, 1, 3}, ids)
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gocastsian/roham/types"
+)
+
+type MapProjectConfig struct {
+	// PublicURL is the address clients reach this service at, exported map documents reference the tile endpoints under it
+	PublicURL string `koanf:"public_url"`
+	MaxLayers int    `koanf:"max_layers"`
+}
+
+// MapProjectFilter selects the map projects a reader may see, like CatalogFilter every result is still checked against the policy
+type MapProjectFilter struct {
+	ReaderID           types.ID
+	ReaderOrganization string
+	AllMaps            bool
+	Limit              int
+	Offset             int
+}
+
+// authorizeMapProject asks the policy whether actor may use project with permission, it returns ErrForbidden when not
+func (s Service) authorizeMapProject(ctx context.Context, actor Actor, project MapProjectEntity, permission Permission) error {
+	shares, err := s.repository.GetMapProjectShares(ctx, project.ID)
+	if err != nil {
+		return fmt.Errorf("failed to read shares of map %d: %w", project.ID, err)
+	}
+
+	grants := make([]policyShare, 0, len(shares))
+	for _, share := range shares {
+		grants = append(grants, policyShare{UserID: share.UserID, Permission: share.Permission})
+	}
+	input := policyInput(actor, policyResource{
+		Type:         "map_project",
+		ID:           project.ID,
+		Name:         project.Name,
+		OwnerID:      project.OwnerID,
+		Visibility:   project.Visibility,
+		Organization: project.Organization,
+	}, grants, permission)
+
+	if err := s.authorizer.Evaluate(ctx, input); err != nil {
+		log.Printf("map %d: %s denied to user %d: %v", project.ID, permission, actor.ID, err)
+		return ErrForbidden
+	}
+	return nil
+}
+
+// readableLayers drops the layers of project the actor can't read, a shared map must not reveal them
+func (s Service) readableLayers(ctx context.Context, actor Actor, project MapProjectEntity) (MapProjectEntity, error) {
+	layers := make([]MapProjectLayer, 0, len(project.Layers))
+	for _, mapLayer := range project.Layers {
+		layer, err := s.repository.GetLayerByID(ctx, mapLayer.LayerID)
+		if err != nil {
+			return MapProjectEntity{}, err
+		}
+		if err := s.authorizeLayer(ctx, actor, layer, PermissionRead); err != nil {
+			if errors.Is(err, ErrForbidden) {
+				continue
+			}
+			return MapProjectEntity{}, err
+		}
+		layers = append(layers, mapLayer)
+	}
+	project.Layers = layers
+	return project, nil
+}
+
+// checkMapLayers makes sure every layer placed on a map exists and can be read by the actor saving it
+func (s Service) checkMapLayers(ctx context.Context, actor Actor, layers []MapProjectLayer) error {
+	for i, mapLayer := range layers {
+		layer, err := s.repository.GetLayerByID(ctx, mapLayer.LayerID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return validation.Errors{"layers": fmt.Errorf("layer %d at position %d does not exist", mapLayer.LayerID, i)}
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.authorizeLayer(ctx, actor, layer, PermissionRead); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeMapLayers sorts the layers by their order and renumbers them from 0
+func normalizeMapLayers(layers []MapProjectLayer) []MapProjectLayer {
+	normalized := make([]MapProjectLayer, len(layers))
+	copy(normalized, layers)
+	sort.SliceStable(normalized, func(i, j int) bool { return normalized[i].Order < normalized[j].Order })
+	for i := range normalized {
+		normalized[i].Order = i
+	}
+	return normalized
+}
+
+func (s Service) CreateMapProject(ctx context.Context, req SaveMapProjectRequest) (MapProjectResponse, error) {
+	if req.Visibility == "" {
+		req.Visibility = VisibilityPrivate
+	}
+	if err := s.validator.ValidateSaveMapProject(req, s.config.Map); err != nil {
+		return MapProjectResponse{}, err
+	}
+	if err := s.checkMapLayers(ctx, req.Actor, req.Layers); err != nil {
+		return MapProjectResponse{}, err
+	}
+
+	project := MapProjectEntity{
+		Name:         req.Name,
+		Description:  req.Description,
+		OwnerID:      req.Actor.ID,
+		Visibility:   req.Visibility,
+		Organization: req.Actor.Organization,
+		View:         req.View,
+		Basemap:      req.Basemap,
+		Layers:       normalizeMapLayers(req.Layers),
+	}
+	id, err := s.repository.CreateMapProject(ctx, project)
+	if err != nil {
+		return MapProjectResponse{}, err
+	}
+
+	project, err = s.repository.GetMapProject(ctx, id)
+	if err != nil {
+		return MapProjectResponse{}, err
+	}
+	return MapProjectResponse{Map: project}, nil
+}
+
+// UpdateMapProject replaces the content of a map, the owner and the organization of a map never change
+func (s Service) UpdateMapProject(ctx context.Context, req SaveMapProjectRequest) (MapProjectResponse, error) {
+	project, err := s.repository.GetMapProject(ctx, req.ID)
+	if err != nil {
+		return MapProjectResponse{}, err
+	}
+	if err := s.authorizeMapProject(ctx, req.Actor, project, PermissionEdit); err != nil {
+		return MapProjectResponse{}, err
+	}
+
+	if req.Visibility == "" {
+		req.Visibility = project.Visibility
+	}
+	if err := s.validator.ValidateSaveMapProject(req, s.config.Map); err != nil {
+		return MapProjectResponse{}, err
+	}
+	if req.Visibility != project.Visibility {
+		if err := s.authorizeMapProject(ctx, req.Actor, project, PermissionAdmin); err != nil {
+			return MapProjectResponse{}, err
+		}
+	}
+	if err := s.checkMapLayers(ctx, req.Actor, req.Layers); err != nil {
+		return MapProjectResponse{}, err
+	}
+
+	project.Name = req.Name
+	project.Description = req.Description
+	project.Visibility = req.Visibility
+	project.View = req.View
+	project.Basemap = req.Basemap
+	project.Layers = normalizeMapLayers(req.Layers)
+	if err := s.repository.UpdateMapProject(ctx, project); err != nil {
+		return MapProjectResponse{}, err
+	}
+
+	project, err = s.repository.GetMapProject(ctx, project.ID)
+	if err != nil {
+		return MapProjectResponse{}, err
+	}
+	return MapProjectResponse{Map: project}, nil
+}
+
+func (s Service) GetMapProject(ctx context.Context, req GetMapProjectRequest) (MapProjectResponse, error) {
+	project, err := s.repository.GetMapProject(ctx, req.ID)
+	if err != nil {
+		return MapProjectResponse{}, err
+	}
+	if err := s.authorizeMapProject(ctx, req.Actor, project, PermissionRead); err != nil {
+		return MapProjectResponse{}, err
+	}
+
+	project, err = s.readableLayers(ctx, req.Actor, project)
+	if err != nil {
+		return MapProjectResponse{}, err
+	}
+	return MapProjectResponse{Map: project}, nil
+}
+
+func (s Service) ListMapProjects(ctx context.Context, req ListMapProjectsRequest) (ListMapProjectsResponse, error) {
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize < 1 {
+		req.PageSize = defaultCatalogPageSize
+	}
+	req.PageSize = min(req.PageSize, maxCatalogPageSize)
+
+	projects, total, err := s.repository.ListMapProjects(ctx, MapProjectFilter{
+		ReaderID:           req.Actor.ID,
+		ReaderOrganization: req.Actor.Organization,
+		AllMaps:            req.Actor.Role == types.RoleAdmin,
+		Limit:              req.PageSize,
+		Offset:             (req.Page - 1) * req.PageSize,
+	})
+	if err != nil {
+		return ListMapProjectsResponse{}, fmt.Errorf("failed to list maps: %w", err)
+	}
+
+	items := make([]MapProjectEntity, 0, len(projects))
+	for _, project := range projects {
+		if err := s.authorizeMapProject(ctx, req.Actor, project, PermissionRead); err != nil {
+			if errors.Is(err, ErrForbidden) {
+				total--
+				continue
+			}
+			return ListMapProjectsResponse{}, err
+		}
+		project, err := s.readableLayers(ctx, req.Actor, project)
+		if err != nil {
+			return ListMapProjectsResponse{}, err
+		}
+		items = append(items, project)
+	}
+
+	return ListMapProjectsResponse{
+		Items:    items,
+		Total:    total,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+	}, nil
+}
+
+func (s Service) DeleteMapProject(ctx context.Context, req DeleteMapProjectRequest) error {
+	project, err := s.repository.GetMapProject(ctx, req.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.authorizeMapProject(ctx, req.Actor, project, PermissionAdmin); err != nil {
+		return err
+	}
+
+	return s.repository.DeleteMapProject(ctx, project.ID)
+}
+
+func (s Service) ShareMapProject(ctx context.Context, req ShareMapProjectRequest) (ShareMapProjectResponse, error) {
+	if err := s.validator.ValidateShareLayer(ShareLayerRequest{UserID: req.UserID, Permission: req.Permission}); err != nil {
+		return ShareMapProjectResponse{}, err
+	}
+
+	project, err := s.repository.GetMapProject(ctx, req.MapID)
+	if err != nil {
+		return ShareMapProjectResponse{}, err
+	}
+	if err := s.authorizeMapProject(ctx, req.Actor, project, PermissionAdmin); err != nil {
+		return ShareMapProjectResponse{}, err
+	}
+
+	share, err := s.repository.UpsertMapProjectShare(ctx, MapProjectShareEntity{
+		MapID:      req.MapID,
+		UserID:     req.UserID,
+		Permission: req.Permission,
+	})
+	if err != nil {
+		return ShareMapProjectResponse{}, err
+	}
+
+	return ShareMapProjectResponse{Share: share}, nil
+}
+
+func (s Service) RevokeMapProjectShare(ctx context.Context, req RevokeMapProjectShareRequest) error {
+	project, err := s.repository.GetMapProject(ctx, req.MapID)
+	if err != nil {
+		return err
+	}
+	if err := s.authorizeMapProject(ctx, req.Actor, project, PermissionAdmin); err != nil {
+		return err
+	}
+
+	return s.repository.DeleteMapProjectShare(ctx, req.MapID, req.UserID)
+}
+
+// ExportMapProject renders a map as a document other clients open directly, only the layers the actor can read are included
+func (s Service) ExportMapProject(ctx context.Context, req ExportMapProjectRequest) (ExportMapProjectResponse, error) {
+	if req.Format == "" {
+		req.Format = MapExportFormatMapLibre
+	}
+	if err := s.validator.ValidateExportMapProject(req); err != nil {
+		return ExportMapProjectResponse{}, err
+	}
+
+	res, err := s.GetMapProject(ctx, GetMapProjectRequest{Actor: req.Actor, ID: req.ID})
+	if err != nil {
+		return ExportMapProjectResponse{}, err
+	}
+
+	exporter := mapExporter{publicURL: s.config.Map.PublicURL, maxZoom: s.config.Tile.MaxZoom}
+	switch req.Format {
+	case MapExportFormatQGIS:
+		document, err := exporter.qgisProject(res.Map)
+		if err != nil {
+			return ExportMapProjectResponse{}, err
+		}
+		return ExportMapProjectResponse{
+			ContentType: "application/x-qgis-project",
+			FileName:    mapFileName(res.Map) + ".qgs",
+			Document:    document,
+		}, nil
+	default:
+		document, err := exporter.mapLibreStyle(res.Map)
+		if err != nil {
+			return ExportMapProjectResponse{}, err
+		}
+		return ExportMapProjectResponse{
+			ContentType: "application/json",
+			FileName:    mapFileName(res.Map) + ".json",
+			Document:    document,
+		}, nil
+	}
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapProjectLayerDefaults(t *testing.T) {
+	var layers []MapProjectLayer
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"layer_id": 7},
+		{"layer_id": 8, "opacity": 0, "visible": false},
+		{"layer_id": 9, "opacity": 0.4}
+	]`), &layers))
+
+	require.Len(t, layers, 3)
+	assert.Equal(t, 1.0, layers[0].Opacity)
+	assert.True(t, layers[0].Visible)
+	assert.Equal(t, 0.0, layers[1].Opacity)
+	assert.False(t, layers[1].Visible)
+	assert.Equal(t, 0.4, layers[2].Opacity)
+	assert.True(t, layers[2].Visible)
+}
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type GeometryConfig struct {
+	// MaxVertices bounds the size of the geometries the transform and measure endpoints accept
+	MaxVertices int `koanf:"max_vertices"`
+}
+
+// EPSGCode identifies a coordinate reference system of spatial_ref_sys, it is read from 4326 or "EPSG:4326"
+type EPSGCode int
+
+// WGS84 is the EPSG code of longitude and latitude on the WGS 84 ellipsoid, GeoJSON coordinates are in it by default
+const WGS84 EPSGCode = 4326
+
+func (c *EPSGCode) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case float64:
+		*c = EPSGCode(v)
+		return nil
+	case string:
+		code, err := ParseEPSGCode(v)
+		if err != nil {
+			return err
+		}
+		*c = code
+		return nil
+	}
+	return fmt.Errorf("invalid EPSG code %s", data)
+}
+
+func (c EPSGCode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+func (c EPSGCode) String() string {
+	return "EPSG:" + strconv.Itoa(int(c))
+}
+
+// ParseEPSGCode reads an EPSG code with or without its EPSG: prefix
+func ParseEPSGCode(value string) (EPSGCode, error) {
+	value = strings.TrimSpace(value)
+	if len(value) > 5 && strings.EqualFold(value[:5], "EPSG:") {
+		value = value[5:]
+	}
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid EPSG code %q", value)
+	}
+	return EPSGCode(code), nil
+}
+
+// SpatialReference describes a coordinate reference system known to PostGIS
+type SpatialReference struct {
+	SRID EPSGCode
+	// Proj4 is the proj4text of spatial_ref_sys, the units and the kind of system are read from it
+	Proj4 string
+}
+
+// Geographic reports a longitude and latitude system, planar measurements in it would be in degrees
+func (r SpatialReference) Geographic() bool {
+	return strings.Contains(r.Proj4, "+proj=longlat") || strings.Contains(r.Proj4, "+proj=latlong")
+}
+
+// Unit returns the linear unit of a projected system, meters unless its proj4 definition names another one
+func (r SpatialReference) Unit() string {
+	if r.Geographic() {
+		return "degree"
+	}
+	for _, parameter := range strings.Fields(r.Proj4) {
+		if unit, found := strings.CutPrefix(parameter, "+units="); found {
+			return unit
+		}
+	}
+	return "m"
+}
+
+// MeasurementMethod decides how the area and lengths of a geometry are computed
+type MeasurementMethod string
+
+const (
+	// MeasurementGeodesic measures on the WGS 84 spheroid, it is right everywhere whatever the input system is
+	MeasurementGeodesic MeasurementMethod = "geodesic"
+	// MeasurementPlanar measures in the plane of a projected input system, in its units
+	MeasurementPlanar MeasurementMethod = "planar"
+)
+
+type Measurement struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+// GeometryMeasurements are the raw results of the repository, Dimension is the one of ST_Dimension
+type GeometryMeasurements struct {
+	Dimension int
+	Area      float64
+	Length    float64
+	Perimeter float64
+	Centroid  json.RawMessage
+}
+
+// geoJSONGeometry is the part of a GeoJSON geometry validation needs, coordinates are counted without decoding them
+type geoJSONGeometry struct {
+	Type        string            `json:"type"`
+	Coordinates json.RawMessage   `json:"coordinates"`
+	Geometries  []geoJSONGeometry `json:"geometries"`
+}
+
+var geoJSONTypes = []interface{}{
+	"Point", "MultiPoint", "LineString", "MultiLineString", "Polygon", "MultiPolygon", "GeometryCollection",
+}
+
+// geoJSONVertices validates the structure of a GeoJSON geometry and returns its number of positions
+func geoJSONVertices(raw json.RawMessage) (int, error) {
+	var geometry geoJSONGeometry
+	if err := json.Unmarshal(raw, &geometry); err != nil {
+		return 0, errors.New("must be a GeoJSON geometry")
+	}
+	return geometry.vertices()
+}
+
+func (g geoJSONGeometry) vertices() (int, error) {
+	if err := validation.Validate(g.Type, validation.Required, validation.In(geoJSONTypes...)); err != nil {
+		return 0, fmt.Errorf("must be a GeoJSON geometry, type %q is not supported", g.Type)
+	}
+
+	if g.Type == "GeometryCollection" {
+		total := 0
+		for _, member := range g.Geometries {
+			count, err := member.vertices()
+			if err != nil {
+				return 0, err
+			}
+			total += count
+		}
+		return total, nil
+	}
+
+	// positions are the innermost arrays, they hold numbers only
+	var positions func(value interface{}) (int, bool)
+	positions = func(value interface{}) (int, bool) {
+		items, ok := value.([]interface{})
+		if !ok || len(items) == 0 {
+			return 0, false
+		}
+		if _, isNumber := items[0].(float64); isNumber {
+			return 1, len(items) >= 2
+		}
+		total := 0
+		for _, item := range items {
+			count, ok := positions(item)
+			if !ok {
+				return 0, false
+			}
+			total += count
+		}
+		return total, true
+	}
+
+	var coordinates interface{}
+	if err := json.Unmarshal(g.Coordinates, &coordinates); err != nil {
+		return 0, errors.New("must be a GeoJSON geometry with coordinates")
+	}
+	count, ok := positions(coordinates)
+	if !ok {
+		return 0, fmt.Errorf("coordinates of the %s are malformed", g.Type)
+	}
+	return count, nil
+}
+
+// spatialReference reads a coordinate reference system, an unknown EPSG code is a validation error of field
+func (s Service) spatialReference(ctx context.Context, field string, code EPSGCode) (SpatialReference, error) {
+	reference, err := s.repository.GetSpatialReference(ctx, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SpatialReference{}, validation.Errors{field: fmt.Errorf("unknown coordinate reference system %s", code)}
+	}
+	return reference, err
+}
+
+func (s Service) TransformGeometry(ctx context.Context, req TransformGeometryRequest) (TransformGeometryResponse, error) {
+	if req.From == 0 {
+		req.From = WGS84
+	}
+	if err := s.validator.ValidateTransformGeometry(req, s.config.Geometry); err != nil {
+		return TransformGeometryResponse{}, err
+	}
+
+	if _, err := s.spatialReference(ctx, "from", req.From); err != nil {
+		return TransformGeometryResponse{}, err
+	}
+	if _, err := s.spatialReference(ctx, "to", req.To); err != nil {
+		return TransformGeometryResponse{}, err
+	}
+
+	geometry, err := s.repository.TransformGeometry(ctx, req.Geometry, req.From, req.To)
+	if err != nil {
+		return TransformGeometryResponse{}, err
+	}
+	return TransformGeometryResponse{Geometry: geometry, CRS: req.To}, nil
+}
+
+// MeasureGeometry computes the area and perimeter of a polygon or the length of a line, and the centroid
+// of any geometry in the system of the input
+func (s Service) MeasureGeometry(ctx context.Context, req MeasureGeometryRequest) (MeasureGeometryResponse, error) {
+	if req.CRS == 0 {
+		req.CRS = WGS84
+	}
+	if req.Method == "" {
+		req.Method = MeasurementGeodesic
+	}
+	if err := s.validator.ValidateMeasureGeometry(req, s.config.Geometry); err != nil {
+		return MeasureGeometryResponse{}, err
+	}
+
+	reference, err := s.spatialReference(ctx, "crs", req.CRS)
+	if err != nil {
+		return MeasureGeometryResponse{}, err
+	}
+	unit := "m"
+	if req.Method == MeasurementPlanar {
+		if reference.Geographic() {
+			return MeasureGeometryResponse{}, validation.Errors{
+				"method": fmt.Errorf("planar measurements need a projected system, %s is geographic", req.CRS),
+			}
+		}
+		unit = reference.Unit()
+	}
+
+	measurements, err := s.repository.MeasureGeometry(ctx, req.Geometry, req.CRS, req.Method)
+	if err != nil {
+		return MeasureGeometryResponse{}, err
+	}
+
+	res := MeasureGeometryResponse{
+		CRS:      req.CRS,
+		Method:   req.Method,
+		Centroid: measurements.Centroid,
+	}
+	switch measurements.Dimension {
+	case 2:
+		res.Area = &Measurement{Value: measurements.Area, Unit: unit + "²"}
+		res.Perimeter = &Measurement{Value: measurements.Perimeter, Unit: unit}
+	case 1:
+		res.Length = &Measurement{Value: measurements.Length, Unit: unit}
+	}
+	return res, nil
+}
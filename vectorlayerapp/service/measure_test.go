@@ -0,0 +1,79 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEPSGCodeJSON(t *testing.T) {
+	var req TransformGeometryRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"from": 4326, "to": "epsg:32639"}`), &req))
+	assert.Equal(t, WGS84, req.From)
+	assert.Equal(t, EPSGCode(32639), req.To)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"to": "UTM 39N"}`), &req))
+
+	data, err := json.Marshal(TransformGeometryResponse{Geometry: json.RawMessage(`null`), CRS: 32639})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"geometry": null, "crs": "EPSG:32639"}`, string(data))
+}
+
+func TestSpatialReferenceUnit(t *testing.T) {
+	wgs84 := SpatialReference{SRID: 4326, Proj4: "+proj=longlat +datum=WGS84 +no_defs"}
+	assert.True(t, wgs84.Geographic())
+
+	utm := SpatialReference{SRID: 32639, Proj4: "+proj=utm +zone=39 +datum=WGS84 +units=m +no_defs"}
+	assert.False(t, utm.Geographic())
+	assert.Equal(t, "m", utm.Unit())
+
+	feet := SpatialReference{SRID: 2227, Proj4: "+proj=lcc +lat_1=38.43 +datum=NAD83 +units=us-ft +no_defs"}
+	assert.Equal(t, "us-ft", feet.Unit())
+}
+
+func TestGeoJSONVertices(t *testing.T) {
+	tests := []struct {
+		name     string
+		geometry string
+		want     int
+		wantErr  bool
+	}{
+		{name: "point", geometry: `{"type": "Point", "coordinates": [51.4, 35.7]}`, want: 1},
+		{name: "polygon", geometry: `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}`, want: 4},
+		{
+			name:     "collection",
+			geometry: `{"type": "GeometryCollection", "geometries": [{"type": "Point", "coordinates": [0, 0]}, {"type": "LineString", "coordinates": [[0, 0], [1, 1]]}]}`,
+			want:     3,
+		},
+		{name: "feature", geometry: `{"type": "Feature", "geometry": null}`, wantErr: true},
+		{name: "short position", geometry: `{"type": "LineString", "coordinates": [[0], [1, 1]]}`, wantErr: true},
+		{name: "no coordinates", geometry: `{"type": "Point"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := geoJSONVertices(json.RawMessage(tt.geometry))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateMeasureGeometry(t *testing.T) {
+	v := NewValidator(nil)
+	line := json.RawMessage(`{"type": "LineString", "coordinates": [[0, 0], [1, 1], [2, 2]]}`)
+
+	assert.NoError(t, v.ValidateMeasureGeometry(MeasureGeometryRequest{Geometry: line, CRS: WGS84, Method: MeasurementGeodesic},
+		GeometryConfig{MaxVertices: 3}))
+	assert.Error(t, v.ValidateMeasureGeometry(MeasureGeometryRequest{Geometry: line, CRS: WGS84, Method: MeasurementGeodesic},
+		GeometryConfig{MaxVertices: 2}))
+	assert.Error(t, v.ValidateMeasureGeometry(MeasureGeometryRequest{Geometry: line, CRS: WGS84, Method: "ellipsoidal"},
+		GeometryConfig{}))
+	assert.Error(t, v.ValidateMeasureGeometry(MeasureGeometryRequest{CRS: WGS84, Method: MeasurementPlanar}, GeometryConfig{}))
+}
@@ -4,4 +4,43 @@ import "errors"
 
 var (
 	HealthCheckError = errors.New("health check failed")
+	ErrUnsafeArchive = errors.New("unsafe archive")
+	ErrForbidden     = errors.New("you don't have permission to access this layer")
+	ErrQueueFull     = errors.New("too many of your imports are waiting, try again once some of them started")
+	ErrTableTaken    = errors.New("the table already exists")
 )
+
+// InvalidGeometryErrorType is the temporal application error type of an import rejected by ValidateGeometries
+const InvalidGeometryErrorType = "InvalidGeometry"
+
+// UnsafeArchiveErrorType is the temporal application error type of an archive rejected during extraction
+const UnsafeArchiveErrorType = "UnsafeArchive"
+
+// QuarantineTableSuffix names the table the quarantine geometry mode moves invalid features of <layer> to
+const QuarantineTableSuffix = "_quarantine"
+
+// GeneralizedTableSuffix names the table holding the simplified geometries of every zoom band of <layer>
+const GeneralizedTableSuffix = "_generalized"
+
+// StagingTableSuffix names the table a re-import of <layer> is written to, it replaces the table of the layer
+// once the import succeeded
+const StagingTableSuffix = "_staging"
+
+// DuplicateDatasetErrorType is the temporal application error type of an archive that was already imported
+const DuplicateDatasetErrorType = "DuplicateDataset"
+
+// InvalidTimeAttributeErrorType is the temporal application error type of a layer whose time attributes can't be used
+const InvalidTimeAttributeErrorType = "InvalidTimeAttribute"
+
+// InvalidDateAttributeErrorType is the temporal application error type of an import naming Jalali date attributes the layer doesn't have
+const InvalidDateAttributeErrorType = "InvalidDateAttribute"
+
+// LayerNotFoundErrorType is the temporal application error type of an import selecting layers the archive doesn't have
+const LayerNotFoundErrorType = "LayerNotFound"
+
+// LayerNameCollisionErrorType is the temporal application error type of an archive whose layers map to the same table
+const LayerNameCollisionErrorType = "LayerNameCollision"
+
+// LayerNameTakenErrorType is the temporal application error type of an import whose layer name belongs to another
+// user's layer or to a table that isn't a layer
+const LayerNameTakenErrorType = "LayerNameTaken"
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	gmdNamespace        = "http://www.isotc211.org/2005/gmd"
+	gcoNamespace        = "http://www.isotc211.org/2005/gco"
+	isoCodeListLocation = "http://standards.iso.org/iso/19139/resources/gmxCodelists.xml"
+	oaiDCNamespace      = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+	dcNamespace         = "http://purl.org/dc/elements/1.1/"
+)
+
+// encoding/xml has no support for namespace prefixes, the elements below carry the prefix in their name
+
+type characterString struct {
+	Value string `xml:"gco:CharacterString"`
+}
+
+type codeListValue struct {
+	CodeList      string `xml:"codeList,attr"`
+	CodeListValue string `xml:"codeListValue,attr"`
+	Value         string `xml:",chardata"`
+}
+
+func isoCode(list string, value string) *codeListValue {
+	return &codeListValue{CodeList: isoCodeListLocation + "#" + list, CodeListValue: value, Value: value}
+}
+
+type isoMetadata struct {
+	XMLName            xml.Name          `xml:"gmd:MD_Metadata"`
+	GMD                string            `xml:"xmlns:gmd,attr"`
+	GCO                string            `xml:"xmlns:gco,attr"`
+	FileIdentifier     characterString   `xml:"gmd:fileIdentifier"`
+	Contact            isoResponsible    `xml:"gmd:contact>gmd:CI_ResponsibleParty"`
+	DateStamp          string            `xml:"gmd:dateStamp>gco:DateTime"`
+	IdentificationInfo isoIdentification `xml:"gmd:identificationInfo>gmd:MD_DataIdentification"`
+	Lineage            *characterString  `xml:"gmd:dataQualityInfo>gmd:DQ_DataQuality>gmd:lineage>gmd:LI_Lineage>gmd:statement,omitempty"`
+}
+
+type isoResponsible struct {
+	IndividualName   *characterString `xml:"gmd:individualName,omitempty"`
+	OrganisationName *characterString `xml:"gmd:organisationName,omitempty"`
+	Phone            *characterString `xml:"gmd:contactInfo>gmd:CI_Contact>gmd:phone>gmd:CI_Telephone>gmd:voice,omitempty"`
+	Email            *characterString `xml:"gmd:contactInfo>gmd:CI_Contact>gmd:address>gmd:CI_Address>gmd:electronicMailAddress,omitempty"`
+	Role             *codeListValue   `xml:"gmd:role>gmd:CI_RoleCode"`
+}
+
+type isoIdentification struct {
+	Title           characterString   `xml:"gmd:citation>gmd:CI_Citation>gmd:title"`
+	CreationDate    string            `xml:"gmd:citation>gmd:CI_Citation>gmd:date>gmd:CI_Date>gmd:date>gco:DateTime"`
+	CreationType    *codeListValue    `xml:"gmd:citation>gmd:CI_Citation>gmd:date>gmd:CI_Date>gmd:dateType>gmd:CI_DateTypeCode"`
+	Abstract        characterString   `xml:"gmd:abstract"`
+	UpdateFrequency *codeListValue    `xml:"gmd:resourceMaintenance>gmd:MD_MaintenanceInformation>gmd:maintenanceAndUpdateFrequency>gmd:MD_MaintenanceFrequencyCode,omitempty"`
+	Keywords        []characterString `xml:"gmd:descriptiveKeywords>gmd:MD_Keywords>gmd:keyword,omitempty"`
+	License         *characterString  `xml:"gmd:resourceConstraints>gmd:MD_LegalConstraints>gmd:otherConstraints,omitempty"`
+	BoundingBox     *isoBoundingBox   `xml:"gmd:extent>gmd:EX_Extent>gmd:geographicElement>gmd:EX_GeographicBoundingBox,omitempty"`
+}
+
+type isoBoundingBox struct {
+	West  string `xml:"gmd:westBoundLongitude>gco:Decimal"`
+	East  string `xml:"gmd:eastBoundLongitude>gco:Decimal"`
+	South string `xml:"gmd:southBoundLatitude>gco:Decimal"`
+	North string `xml:"gmd:northBoundLatitude>gco:Decimal"`
+}
+
+type dublinCore struct {
+	XMLName     xml.Name `xml:"oai_dc:dc"`
+	OAIDC       string   `xml:"xmlns:oai_dc,attr"`
+	DC          string   `xml:"xmlns:dc,attr"`
+	Identifier  string   `xml:"dc:identifier"`
+	Title       string   `xml:"dc:title"`
+	Creator     string   `xml:"dc:creator,omitempty"`
+	Subjects    []string `xml:"dc:subject"`
+	Description string   `xml:"dc:description,omitempty"`
+	Source      string   `xml:"dc:source,omitempty"`
+	Rights      string   `xml:"dc:rights,omitempty"`
+	Date        string   `xml:"dc:date"`
+	Type        string   `xml:"dc:type"`
+	Coverage    string   `xml:"dc:coverage,omitempty"`
+}
+
+// exportMetadata renders the metadata of layer as an XML document in format
+func exportMetadata(layer LayerEntity, format MetadataFormat) ([]byte, error) {
+	var document any
+	switch format {
+	case MetadataFormatISO19115:
+		document = isoDocument(layer)
+	case MetadataFormatDublinCore:
+		document = dublinCoreDocument(layer)
+	default:
+		return nil, fmt.Errorf("unsupported metadata format %q", format)
+	}
+
+	out, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s metadata of layer %d: %w", format, layer.ID, err)
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func isoDocument(layer LayerEntity) isoMetadata {
+	meta := layer.Metadata
+	doc := isoMetadata{
+		GMD:            gmdNamespace,
+		GCO:            gcoNamespace,
+		FileIdentifier: characterString{Value: layerIdentifier(layer)},
+		Contact: isoResponsible{
+			IndividualName:   optionalString(meta.Contact.Name),
+			OrganisationName: optionalString(meta.Contact.Organization),
+			Phone:            optionalString(meta.Contact.Phone),
+			Email:            optionalString(meta.Contact.Email),
+			Role:             isoCode("CI_RoleCode", "pointOfContact"),
+		},
+		DateStamp: layer.UpdatedAt.UTC().Format(time.RFC3339),
+		IdentificationInfo: isoIdentification{
+			Title:        characterString{Value: layerTitle(layer)},
+			CreationDate: layer.CreatedAt.UTC().Format(time.RFC3339),
+			CreationType: isoCode("CI_DateTypeCode", "creation"),
+			Abstract:     characterString{Value: meta.Description},
+			License:      optionalString(meta.License),
+		},
+		Lineage: optionalString(meta.Source),
+	}
+
+	if meta.UpdateFrequency != "" {
+		doc.IdentificationInfo.UpdateFrequency = isoCode("MD_MaintenanceFrequencyCode", string(meta.UpdateFrequency))
+	}
+	for _, keyword := range meta.Keywords {
+		doc.IdentificationInfo.Keywords = append(doc.IdentificationInfo.Keywords, characterString{Value: keyword})
+	}
+	if extent := layerExtent(layer); extent != nil {
+		doc.IdentificationInfo.BoundingBox = &isoBoundingBox{
+			West:  formatCoordinate(extent.MinX),
+			East:  formatCoordinate(extent.MaxX),
+			South: formatCoordinate(extent.MinY),
+			North: formatCoordinate(extent.MaxY),
+		}
+	}
+	return doc
+}
+
+func dublinCoreDocument(layer LayerEntity) dublinCore {
+	meta := layer.Metadata
+	creator := meta.Contact.Organization
+	if creator == "" {
+		creator = meta.Contact.Name
+	}
+
+	doc := dublinCore{
+		OAIDC:       oaiDCNamespace,
+		DC:          dcNamespace,
+		Identifier:  layerIdentifier(layer),
+		Title:       layerTitle(layer),
+		Creator:     creator,
+		Subjects:    meta.Keywords,
+		Description: meta.Description,
+		Source:      meta.Source,
+		Rights:      meta.License,
+		Date:        layer.CreatedAt.UTC().Format(time.DateOnly),
+		Type:        "Dataset",
+	}
+	if extent := layerExtent(layer); extent != nil {
+		// DCMI Box encoding
+		doc.Coverage = fmt.Sprintf("westlimit=%s; southlimit=%s; eastlimit=%s; northlimit=%s; projection=EPSG:4326",
+			formatCoordinate(extent.MinX), formatCoordinate(extent.MinY), formatCoordinate(extent.MaxX), formatCoordinate(extent.MaxY))
+	}
+	return doc
+}
+
+func layerIdentifier(layer LayerEntity) string {
+	return "layer-" + strconv.FormatUint(uint64(layer.ID), 10)
+}
+
+// layerTitle falls back to the table name for layers nobody described yet
+func layerTitle(layer LayerEntity) string {
+	if layer.Metadata.Title != "" {
+		return layer.Metadata.Title
+	}
+	return layer.Name
+}
+
+func layerExtent(layer LayerEntity) *Extent {
+	if layer.Statistics == nil {
+		return nil
+	}
+	return layer.Statistics.Extent
+}
+
+func optionalString(value string) *characterString {
+	if value == "" {
+		return nil
+	}
+	return &characterString{Value: value}
+}
+
+func formatCoordinate(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
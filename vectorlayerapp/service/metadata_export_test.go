@@ -0,0 +1,84 @@
+package service
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportMetadata(t *testing.T) {
+	layer := LayerEntity{
+		ID:   12,
+		Name: "roads",
+		Metadata: LayerMetadata{
+			Title:           "Road network",
+			Description:     "Primary & secondary roads",
+			Keywords:        []string{"transport", "roads"},
+			Source:          "National mapping agency",
+			License:         "CC-BY-4.0",
+			Contact:         Contact{Name: "GIS desk", Email: "gis@example.com"},
+			UpdateFrequency: UpdateFrequencyMonthly,
+		},
+		Statistics: &LayerStatistics{Extent: &Extent{MinX: 44.5, MinY: 25, MaxX: 63.25, MaxY: 39.75}},
+		CreatedAt:  time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC),
+		UpdatedAt:  time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	t.Run("iso 19115", func(t *testing.T) {
+		out, err := exportMetadata(layer, MetadataFormatISO19115)
+		require.NoError(t, err)
+
+		var doc struct {
+			XMLName  xml.Name `xml:"MD_Metadata"`
+			ID       string   `xml:"fileIdentifier>CharacterString"`
+			Title    string   `xml:"identificationInfo>MD_DataIdentification>citation>CI_Citation>title>CharacterString"`
+			Abstract string   `xml:"identificationInfo>MD_DataIdentification>abstract>CharacterString"`
+			Keywords []string `xml:"identificationInfo>MD_DataIdentification>descriptiveKeywords>MD_Keywords>keyword>CharacterString"`
+			West     string   `xml:"identificationInfo>MD_DataIdentification>extent>EX_Extent>geographicElement>EX_GeographicBoundingBox>westBoundLongitude>Decimal"`
+			Email    string   `xml:"contact>CI_ResponsibleParty>contactInfo>CI_Contact>address>CI_Address>electronicMailAddress>CharacterString"`
+		}
+		require.NoError(t, xml.Unmarshal(out, &doc))
+		assert.Equal(t, "layer-12", doc.ID)
+		assert.Equal(t, "Road network", doc.Title)
+		assert.Equal(t, "Primary & secondary roads", doc.Abstract)
+		assert.Equal(t, []string{"transport", "roads"}, doc.Keywords)
+		assert.Equal(t, "44.5", doc.West)
+		assert.Equal(t, "gis@example.com", doc.Email)
+		assert.Contains(t, string(out), `codeListValue="monthly"`)
+		assert.NotContains(t, string(out), "individualName></")
+	})
+
+	t.Run("dublin core", func(t *testing.T) {
+		out, err := exportMetadata(layer, MetadataFormatDublinCore)
+		require.NoError(t, err)
+
+		var doc struct {
+			Title    string   `xml:"title"`
+			Subjects []string `xml:"subject"`
+			Rights   string   `xml:"rights"`
+			Creator  string   `xml:"creator"`
+			Coverage string   `xml:"coverage"`
+		}
+		require.NoError(t, xml.Unmarshal(out, &doc))
+		assert.Equal(t, "Road network", doc.Title)
+		assert.Equal(t, []string{"transport", "roads"}, doc.Subjects)
+		assert.Equal(t, "CC-BY-4.0", doc.Rights)
+		assert.Equal(t, "GIS desk", doc.Creator)
+		assert.Contains(t, doc.Coverage, "westlimit=44.5")
+	})
+
+	t.Run("falls back to the layer name", func(t *testing.T) {
+		out, err := exportMetadata(LayerEntity{ID: 1, Name: "parcels"}, MetadataFormatDublinCore)
+		require.NoError(t, err)
+		assert.Contains(t, string(out), "<dc:title>parcels</dc:title>")
+		assert.NotContains(t, string(out), "dc:coverage")
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := exportMetadata(layer, "fgdc")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type NearestConfig struct {
+	DefaultK int `koanf:"default_k"`
+	MaxK     int `koanf:"max_k"`
+	// MaxDistance bounds the maxDistance of a request in meters, zero leaves it unbounded
+	MaxDistance float64 `koanf:"max_distance"`
+}
+
+// NearestFeature is a GeoJSON feature found by a nearest search. Distance is geodesic in meters and 0 for a
+// feature under the point, Bearing is in degrees clockwise from north towards the closest point of the
+// feature and nil when the point lies on it
+type NearestFeature struct {
+	Type       string          `json:"type"`
+	ID         int64           `json:"id"`
+	Geometry   json.RawMessage `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+	Distance   float64         `json:"distance"`
+	Bearing    *float64        `json:"bearing"`
+}
+
+// Nearest returns the k features of a layer closest to a point, nearest first. It works on layers of any
+// geometry type, lines and polygons are as near as their closest point
+func (s Service) Nearest(ctx context.Context, req NearestRequest) (NearestResponse, error) {
+	if req.K == 0 {
+		req.K = s.config.Nearest.DefaultK
+	}
+	if err := s.validator.ValidateNearest(req, s.config.Nearest); err != nil {
+		return NearestResponse{}, err
+	}
+
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return NearestResponse{}, err
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionRead); err != nil {
+		return NearestResponse{}, err
+	}
+	if err := s.checkFilter(ctx, layer, req.Filter); err != nil {
+		return NearestResponse{}, err
+	}
+	scope, err := s.rowScope(ctx, req.Actor, layer)
+	if err != nil {
+		return NearestResponse{}, err
+	}
+
+	features, err := s.repository.NearestFeatures(ctx, layer, req.Point, req.K, req.MaxDistance,
+		FeatureFilter{Time: req.Datetime, CQL: req.Filter, Scope: scope})
+	if err != nil {
+		return NearestResponse{}, err
+	}
+
+	return NearestResponse{
+		Type:           "FeatureCollection",
+		Point:          req.Point,
+		Features:       features,
+		NumberReturned: len(features),
+	}, nil
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateNearest(t *testing.T) {
+	v := NewValidator(nil)
+	config := NearestConfig{DefaultK: 5, MaxK: 100, MaxDistance: 50000}
+	distance := func(meters float64) *float64 { return &meters }
+
+	valid := NearestRequest{Point: LookupPoint{Lat: 35.7, Lon: 51.4}, K: 5}
+	assert.NoError(t, v.ValidateNearest(valid, config))
+	valid.MaxDistance = distance(2000)
+	assert.NoError(t, v.ValidateNearest(valid, config))
+
+	tests := map[string]func(req *NearestRequest){
+		"latitude out of range":  func(req *NearestRequest) { req.Point.Lat = 91 },
+		"longitude out of range": func(req *NearestRequest) { req.Point.Lon = -181 },
+		"no features":            func(req *NearestRequest) { req.K = 0 },
+		"too many features":      func(req *NearestRequest) { req.K = 101 },
+		"zero distance":          func(req *NearestRequest) { req.MaxDistance = distance(0) },
+		"distance beyond max":    func(req *NearestRequest) { req.MaxDistance = distance(50001) },
+	}
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := valid
+			change(&req)
+			assert.Error(t, v.ValidateNearest(req, config))
+		})
+	}
+
+	// without a configured bound any positive distance is accepted
+	valid.MaxDistance = distance(1e7)
+	assert.NoError(t, v.ValidateNearest(valid, NearestConfig{MaxK: 100}))
+}
@@ -1,28 +1,108 @@
 package service
 
-import "github.com/gocastsian/roham/types"
+import (
+	"encoding/json"
+	"time"
 
-type ScheduleImportLayerRequest struct{}
+	"github.com/gocastsian/roham/pkg/cql2"
+	"github.com/gocastsian/roham/types"
+)
+
+type ScheduleImportLayerRequest struct {
+	FileKey      string
+	GeometryMode GeometryMode
+	Layers       []string
+	// LayerName renames the layer of a single dataset archive, it is ignored for multi-layer archives
+	LayerName string
+	UserID    types.ID
+	// IdempotencyKey makes repeated requests with the same key return the job of the first one
+	IdempotencyKey string
+	// OnDuplicate decides between linking to and rejecting an archive that was already imported
+	OnDuplicate DuplicateMode
+	// Visibility and Organization are given to every layer the import creates, UserID becomes their owner
+	Visibility   Visibility
+	Organization string
+	// TimeStart and TimeEnd name the date attributes that make the imported layers time-enabled
+	TimeStart string
+	TimeEnd   string
+	// JalaliDates name the attributes holding Jalali date strings that are converted to date columns
+	JalaliDates []string
+	// Priority is the class the import waits in for a slot, it defaults to the configured default class
+	Priority Priority
+}
 type ScheduleImportLayerResponse struct {
 	WorkflowId string
 }
 
 // ==========================================================
-type UpdateJobStatusRequest struct {
+type AcquireImportSlotRequest struct {
 	WorkflowId string
-	Status     JobStatus
-	ErrorMsg   *string
+}
+type AcquireImportSlotResponse struct {
+	Granted bool
+	// Position and RetryAfter tell a job that wasn't granted a slot where it waits and when to ask again
+	Position   int
+	RetryAfter time.Duration
+}
+
+// ==========================================================
+type GetJobRequest struct {
+	Actor      Actor
+	WorkflowId string
+}
+type GetJobResponse struct {
+	Job JobEntity `json:"job"`
+	// QueuePosition is the position of a pending job among the waiting ones, it is zero once the job started
+	QueuePosition int `json:"queue_position"`
+}
+
+// ==========================================================
+type UpdateJobStatusRequest struct {
+	WorkflowId  string
+	Status      JobStatus
+	ErrorMsg    *string
+	Result      *JobResult
+	ContentHash string
 }
 type UpdateJobStatusResponse struct{}
 
 // ==========================================================
 type ImportLayerRequest struct {
-	FileKey string
+	FileKey   string
+	LayerName string
+	// Layers limits the import to the named datasets of the archive, empty means all of them
+	Layers      []string
+	OnDuplicate DuplicateMode
+	// OwnerID limits deduplication to layers of the same owner
+	OwnerID types.ID
 }
 type ImportLayerResponse struct {
-	Status      bool
+	Status bool
+	Layers []ImportedLayer
+	// ContentHash is the hex encoded sha256 of the downloaded archive
+	ContentHash string
+}
+
+type ImportedLayer struct {
 	LayerName   string
+	GeomType    string
 	StyleFileID types.ID
+	// ExistingLayerID is set instead of importing when the same archive was already imported
+	ExistingLayerID types.ID
+	// TableName is the table the features were imported into, the staging table of a re-import. It is empty
+	// in the results of older jobs, where it was always LayerName
+	TableName string
+	// ReplacedLayerID is the layer of the owner the import replaces, CreateLayer swaps the staging table in for
+	// the table of that layer. A failing job drops the staging table and keeps the layer as it was
+	ReplacedLayerID types.ID
+}
+
+// table is where ImportLayer wrote the features of the layer
+func (l ImportedLayer) table() string {
+	if l.TableName != "" {
+		return l.TableName
+	}
+	return l.LayerName
 }
 
 // ==========================================================
@@ -33,19 +113,74 @@ type SendNotificationRequest struct {
 }
 type SendNotificationResponse struct{}
 
+// ==========================================================
+type ScheduleReprojectLayerRequest struct {
+	Actor     Actor         `json:"-"`
+	LayerID   types.ID      `json:"-"`
+	TargetCRS EPSGCode      `json:"target_crs"`
+	Mode      ReprojectMode `json:"mode"`
+	// LayerName names the layer a new_layer reprojection creates
+	LayerName string `json:"layer_name"`
+}
+type ScheduleReprojectLayerResponse struct {
+	WorkflowId string
+}
+
+// ==========================================================
+type ReprojectLayerRequest struct {
+	LayerID types.ID
+	// TargetTable is the table of the new layer, it is empty when the layer is reprojected in place
+	TargetTable string
+	SRID        EPSGCode
+	// WorkflowId marks the target table as created by the job, only a table with its mark is ever replaced
+	WorkflowId string
+}
+type ReprojectLayerResponse struct {
+	// TableName, GeomType, DefaultStyle and Time describe the source layer, a new layer takes them over
+	TableName    string
+	GeomType     string
+	DefaultStyle types.ID
+	Time         *LayerTime
+}
+
 // ==========================================================
 type CreateLayerRequest struct {
 	LayerName    string
 	GeomType     string
 	DefaultStyle types.ID
+	ContentHash  string
+	OwnerID      types.ID
+	Visibility   Visibility
+	Organization string
+	Time         *LayerTime
+	// SRID is the system of the table, imports are always in WGS 84 and leave it zero
+	SRID EPSGCode
+	// TableName holds the features when it isn't LayerName, the staging table a re-import swaps in
+	TableName string
 }
 type CreateLayerResponse struct {
 	ID types.ID
+	// Created is false when an existing layer of the same name was reused by a re-import
+	Created bool
+}
+
+// ==========================================================
+type ConvertJalaliDatesRequest struct {
+	TableName  string
+	Attributes []string
+	// SkipMissing converts only the attributes the table has, the attributes of a multi-layer import are
+	// usually found in some of its layers only
+	SkipMissing bool
+}
+type ConvertJalaliDatesResponse struct {
+	Conversions []DateConversion
 }
 
 // ==========================================================
 type DropLayerRequest struct {
 	TableName string
+	// CreatedBy limits the drop to a table the job with this workflow id created, its derived tables are kept
+	CreatedBy string
 }
 type DropLayerResponse struct {
 	Success bool
@@ -58,3 +193,389 @@ type CreateStyleRequest struct {
 type CreateStyleResponse struct {
 	ID types.ID
 }
+
+// ==========================================================
+type DeleteStyleRequest struct {
+	StyleID types.ID
+}
+type DeleteStyleResponse struct {
+	FilePath string
+}
+
+// ==========================================================
+type DeleteLayerRecordRequest struct {
+	LayerID types.ID
+}
+
+// ==========================================================
+type ComputeLayerStatisticsRequest struct {
+	LayerID   types.ID
+	TableName string
+}
+type ComputeLayerStatisticsResponse struct {
+	FeatureCount int64
+}
+
+// ==========================================================
+type GeneralizeLayerRequest struct {
+	LayerID   types.ID
+	TableName string
+	GeomType  string
+}
+type GeneralizeLayerResponse struct {
+	Zooms []int
+}
+
+// ==========================================================
+type GetLayerRequest struct {
+	Actor Actor
+	ID    types.ID
+}
+type GetLayerResponse struct {
+	Layer LayerEntity `json:"layer"`
+}
+
+// ==========================================================
+type ValidateGeometriesRequest struct {
+	TableName string
+	Mode      GeometryMode
+}
+type ValidateGeometriesResponse struct {
+	Summary GeometryValidationSummary
+}
+
+// ==========================================================
+type PreviewImportRequest struct {
+	FileKey string
+	// Actor must be an authenticated user, previews download and unpack the archive like an import does
+	Actor Actor
+}
+type PreviewImportResponse struct {
+	FileKey  string           `json:"file_key"`
+	Datasets []DatasetPreview `json:"datasets"`
+}
+
+type DatasetPreview struct {
+	Name           string            `json:"name"`
+	File           string            `json:"file"`
+	Format         string            `json:"format"`
+	GeometryType   string            `json:"geometry_type"`
+	CRS            string            `json:"crs"`
+	FeatureCount   int64             `json:"feature_count"`
+	Fields         []FieldSchema     `json:"fields"`
+	Encoding       string            `json:"encoding"`
+	HasStyle       bool              `json:"has_style"`
+	SampleFeatures []json.RawMessage `json:"sample_features"`
+}
+
+type FieldSchema struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Width    int    `json:"width"`
+	Nullable bool   `json:"nullable"`
+}
+
+// ==========================================================
+type ShareLayerRequest struct {
+	Actor      Actor      `json:"-"`
+	LayerID    types.ID   `json:"-"`
+	UserID     types.ID   `json:"user_id"`
+	Permission Permission `json:"permission"`
+}
+type ShareLayerResponse struct {
+	Share LayerShareEntity `json:"share"`
+}
+
+// ==========================================================
+type RevokeLayerShareRequest struct {
+	Actor   Actor
+	LayerID types.ID
+	UserID  types.ID
+}
+
+// ==========================================================
+type GetLayerRowRulesRequest struct {
+	Actor   Actor
+	LayerID types.ID
+}
+
+// ==========================================================
+type SetLayerRowRulesRequest struct {
+	Actor   Actor          `json:"-"`
+	LayerID types.ID       `json:"-"`
+	Rules   []LayerRowRule `json:"rules"`
+}
+
+type LayerRowRule struct {
+	Attribute   string       `json:"attribute"`
+	Claim       Claim        `json:"claim"`
+	ExemptRoles []types.Role `json:"exempt_roles"`
+}
+
+type LayerRowRulesResponse struct {
+	Rules []LayerRowRuleEntity `json:"rules"`
+}
+
+// ==========================================================
+type UpdateLayerAccessRequest struct {
+	Actor      Actor      `json:"-"`
+	LayerID    types.ID   `json:"-"`
+	Visibility Visibility `json:"visibility"`
+	// Tags replaces the tags of the layer, nil keeps them
+	Tags []string `json:"tags"`
+}
+
+// ==========================================================
+type UpdateLayerMetadataRequest struct {
+	Actor    Actor
+	LayerID  types.ID
+	Metadata LayerMetadata
+}
+
+// ==========================================================
+type ExportLayerMetadataRequest struct {
+	Actor   Actor
+	LayerID types.ID
+	Format  MetadataFormat
+}
+type ExportLayerMetadataResponse struct {
+	ContentType string
+	Document    []byte
+}
+
+// ==========================================================
+type SearchCatalogRequest struct {
+	Actor Actor
+	// Query is matched against the name, title, keywords, description and source of the layers
+	Query    string
+	BBox     *Extent
+	Keywords []string
+	Page     int
+	PageSize int
+}
+type SearchCatalogResponse struct {
+	Items    []CatalogItem `json:"items"`
+	Total    int64         `json:"total"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+}
+
+type CatalogItem struct {
+	ID           types.ID      `json:"id"`
+	Name         string        `json:"name"`
+	GeomType     string        `json:"geom_type"`
+	Visibility   Visibility    `json:"visibility"`
+	Metadata     LayerMetadata `json:"metadata"`
+	Extent       *Extent       `json:"extent"`
+	FeatureCount int64         `json:"feature_count"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+// ==========================================================
+type LookupRequest struct {
+	Actor  Actor
+	Point  LookupPoint
+	Layers []string
+	// Tolerance in meters for line and point layers, polygon layers always need to contain the point
+	Tolerance *float64
+	Datetime  *TimeFilter
+	// Filter is a CQL2 filter applied to every layer, its properties have to exist on all of them
+	Filter cql2.Expression
+}
+type LookupResponse struct {
+	Point  LookupPoint         `json:"point"`
+	Layers []LayerLookupResult `json:"layers"`
+}
+
+type LayerLookupResult struct {
+	Layer    string          `json:"layer"`
+	LayerID  types.ID        `json:"layer_id"`
+	Features []LookupFeature `json:"features"`
+}
+
+// ==========================================================
+type NearestRequest struct {
+	Actor   Actor
+	LayerID types.ID
+	Point   LookupPoint
+	K       int
+	// MaxDistance in meters leaves out features farther from the point, nil searches the whole layer
+	MaxDistance *float64
+	Datetime    *TimeFilter
+	Filter      cql2.Expression
+}
+type NearestResponse struct {
+	Type           string           `json:"type"`
+	Point          LookupPoint      `json:"point"`
+	Features       []NearestFeature `json:"features"`
+	NumberReturned int              `json:"numberReturned"`
+}
+
+// ==========================================================
+type GetTileRequest struct {
+	Actor   Actor
+	LayerID types.ID
+	Tile    TileCoordinate
+	// Attributes are the columns encoded as feature properties, the tile only has geometries and ids without them
+	Attributes []string
+	Datetime   *TimeFilter
+	Filter     cql2.Expression
+}
+type GetTileResponse struct {
+	Data []byte
+}
+
+// ==========================================================
+type AggregateLayerRequest struct {
+	Actor   Actor
+	LayerID types.ID
+	Grid    GridShape
+	// Resolution picks the cell size like an H3 resolution, 0 is the coarsest
+	Resolution int
+	BBox       Extent
+	// Attribute is the numeric attribute summed and averaged per cell, cells only count features without it
+	Attribute string
+	Format    AggregateFormat
+	Datetime  *TimeFilter
+	Filter    cql2.Expression
+}
+type AggregateLayerResponse struct {
+	Type     string             `json:"type"`
+	Features []AggregateFeature `json:"features"`
+	// Data is the vector tile of an mvt request, bbox is its extent
+	Data []byte `json:"-"`
+}
+
+// AggregateFeature is a grid cell as a GeoJSON feature, its geometry is in WGS 84
+type AggregateFeature struct {
+	Type       string              `json:"type"`
+	Geometry   json.RawMessage     `json:"geometry"`
+	Properties AggregateProperties `json:"properties"`
+}
+
+type AggregateProperties struct {
+	Count int64    `json:"count"`
+	Sum   *float64 `json:"sum,omitempty"`
+	Avg   *float64 `json:"avg,omitempty"`
+}
+
+// ==========================================================
+type QueryFeaturesRequest struct {
+	Actor    Actor
+	LayerID  types.ID
+	Filter   cql2.Expression
+	Datetime *TimeFilter
+	Limit    int
+	Offset   int
+}
+type QueryFeaturesResponse struct {
+	Type           string    `json:"type"`
+	Features       []Feature `json:"features"`
+	NumberMatched  int64     `json:"numberMatched"`
+	NumberReturned int       `json:"numberReturned"`
+}
+
+// ==========================================================
+type DeleteLayerRequest struct {
+	Actor   Actor
+	LayerID types.ID
+}
+
+// ==========================================================
+type SaveMapProjectRequest struct {
+	Actor       Actor             `json:"-"`
+	ID          types.ID          `json:"-"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Visibility  Visibility        `json:"visibility"`
+	View        MapView           `json:"view"`
+	Basemap     *Basemap          `json:"basemap"`
+	Layers      []MapProjectLayer `json:"layers"`
+}
+type MapProjectResponse struct {
+	Map MapProjectEntity `json:"map"`
+}
+
+// ==========================================================
+type GetMapProjectRequest struct {
+	Actor Actor
+	ID    types.ID
+}
+
+// ==========================================================
+type ListMapProjectsRequest struct {
+	Actor    Actor
+	Page     int
+	PageSize int
+}
+type ListMapProjectsResponse struct {
+	Items    []MapProjectEntity `json:"items"`
+	Total    int64              `json:"total"`
+	Page     int                `json:"page"`
+	PageSize int                `json:"page_size"`
+}
+
+// ==========================================================
+type DeleteMapProjectRequest struct {
+	Actor Actor
+	ID    types.ID
+}
+
+// ==========================================================
+type ShareMapProjectRequest struct {
+	Actor      Actor      `json:"-"`
+	MapID      types.ID   `json:"-"`
+	UserID     types.ID   `json:"user_id"`
+	Permission Permission `json:"permission"`
+}
+type ShareMapProjectResponse struct {
+	Share MapProjectShareEntity `json:"share"`
+}
+
+// ==========================================================
+type RevokeMapProjectShareRequest struct {
+	Actor  Actor
+	MapID  types.ID
+	UserID types.ID
+}
+
+// ==========================================================
+type ExportMapProjectRequest struct {
+	Actor  Actor
+	ID     types.ID
+	Format MapExportFormat
+}
+type ExportMapProjectResponse struct {
+	ContentType string
+	FileName    string
+	Document    []byte
+}
+
+// ==========================================================
+type TransformGeometryRequest struct {
+	// Geometry is a GeoJSON geometry with coordinates in From
+	Geometry json.RawMessage `json:"geometry"`
+	From     EPSGCode        `json:"from"`
+	To       EPSGCode        `json:"to"`
+}
+type TransformGeometryResponse struct {
+	Geometry json.RawMessage `json:"geometry"`
+	CRS      EPSGCode        `json:"crs"`
+}
+
+// ==========================================================
+type MeasureGeometryRequest struct {
+	Geometry json.RawMessage   `json:"geometry"`
+	CRS      EPSGCode          `json:"crs"`
+	Method   MeasurementMethod `json:"method"`
+}
+type MeasureGeometryResponse struct {
+	CRS    EPSGCode          `json:"crs"`
+	Method MeasurementMethod `json:"method"`
+	// Area and Perimeter are set for polygons, Length for lines
+	Area      *Measurement `json:"area,omitempty"`
+	Perimeter *Measurement `json:"perimeter,omitempty"`
+	Length    *Measurement `json:"length,omitempty"`
+	// Centroid is a GeoJSON point in CRS
+	Centroid json.RawMessage `json:"centroid"`
+}
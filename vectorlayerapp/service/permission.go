@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gocastsian/roham/types"
+)
+
+// Authorizer evaluates the layer policy, *opa.OPAEvaluator implements it
+type Authorizer interface {
+	Evaluate(ctx context.Context, input map[string]interface{}) error
+}
+
+// authorizeLayer asks the policy whether actor may use layer with permission, it returns ErrForbidden when not
+func (s Service) authorizeLayer(ctx context.Context, actor Actor, layer LayerEntity, permission Permission) error {
+	shares, err := s.repository.GetLayerShares(ctx, layer.ID)
+	if err != nil {
+		return fmt.Errorf("failed to read shares of layer %d: %w", layer.ID, err)
+	}
+
+	if err := s.authorizer.Evaluate(ctx, layerPolicyInput(actor, layer, shares, permission)); err != nil {
+		log.Printf("layer %d: %s denied to user %d: %v", layer.ID, permission, actor.ID, err)
+		return ErrForbidden
+	}
+	return nil
+}
+
+// policyResource is what the policy is asked about, layers and map projects are checked by the same rules
+type policyResource struct {
+	Type         string
+	ID           types.ID
+	Name         string
+	OwnerID      types.ID
+	Visibility   Visibility
+	Organization string
+	Tags         []string
+}
+
+// policyShare is a share of a layer or a map project as the policy sees it
+type policyShare struct {
+	UserID     types.ID
+	Permission Permission
+}
+
+func layerPolicyInput(actor Actor, layer LayerEntity, shares []LayerShareEntity, permission Permission) map[string]interface{} {
+	grants := make([]policyShare, 0, len(shares))
+	for _, share := range shares {
+		grants = append(grants, policyShare{UserID: share.UserID, Permission: share.Permission})
+	}
+
+	return policyInput(actor, policyResource{
+		Type:         "layer",
+		ID:           layer.ID,
+		Name:         layer.Name,
+		OwnerID:      layer.OwnerID,
+		Visibility:   layer.Visibility,
+		Organization: layer.Organization,
+		Tags:         layer.Tags,
+	}, grants, permission)
+}
+
+// policyInput is the input document of the layer policy. The grant of the actor is resolved here so
+// policies don't have to search the share list, the full list is still passed for rules that need it
+func policyInput(actor Actor, resource policyResource, shares []policyShare, permission Permission) map[string]interface{} {
+	grant := ""
+	shareList := make([]map[string]interface{}, 0, len(shares))
+	for _, share := range shares {
+		if share.UserID == actor.ID {
+			grant = string(share.Permission)
+		}
+		shareList = append(shareList, map[string]interface{}{
+			"user_id":    share.UserID,
+			"permission": share.Permission,
+		})
+	}
+
+	tags := resource.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return map[string]interface{}{
+		"action": permission,
+		"user": map[string]interface{}{
+			"id":                actor.ID,
+			"role":              actor.Role,
+			"organization":      actor.Organization,
+			"organization_role": actor.OrganizationRole,
+			"grant":             grant,
+		},
+		"resource": map[string]interface{}{
+			"type":         resource.Type,
+			"id":           resource.ID,
+			"name":         resource.Name,
+			"owner_id":     resource.OwnerID,
+			"visibility":   resource.Visibility,
+			"organization": resource.Organization,
+			"tags":         tags,
+			"shares":       shareList,
+		},
+	}
+}
+
+func (s Service) ShareLayer(ctx context.Context, req ShareLayerRequest) (ShareLayerResponse, error) {
+	if err := s.validator.ValidateShareLayer(req); err != nil {
+		return ShareLayerResponse{}, err
+	}
+
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return ShareLayerResponse{}, err
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionAdmin); err != nil {
+		return ShareLayerResponse{}, err
+	}
+
+	share, err := s.repository.UpsertLayerShare(ctx, LayerShareEntity{
+		LayerID:    req.LayerID,
+		UserID:     req.UserID,
+		Permission: req.Permission,
+	})
+	if err != nil {
+		return ShareLayerResponse{}, err
+	}
+
+	return ShareLayerResponse{Share: share}, nil
+}
+
+func (s Service) RevokeLayerShare(ctx context.Context, req RevokeLayerShareRequest) error {
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return err
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionAdmin); err != nil {
+		return err
+	}
+
+	return s.repository.DeleteLayerShare(ctx, req.LayerID, req.UserID)
+}
+
+func (s Service) UpdateLayerAccess(ctx context.Context, req UpdateLayerAccessRequest) (GetLayerResponse, error) {
+	if err := s.validator.ValidateUpdateLayerAccess(req); err != nil {
+		return GetLayerResponse{}, err
+	}
+
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return GetLayerResponse{}, err
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionAdmin); err != nil {
+		return GetLayerResponse{}, err
+	}
+
+	if req.Visibility != "" {
+		layer.Visibility = req.Visibility
+	}
+	if req.Tags != nil {
+		layer.Tags = req.Tags
+	}
+	if err := s.repository.UpdateLayerAccess(ctx, layer.ID, layer.Visibility, layer.Tags); err != nil {
+		return GetLayerResponse{}, err
+	}
+
+	return GetLayerResponse{Layer: layer}, nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gocastsian/roham/pkg/opa"
+	"github.com/gocastsian/roham/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayerPolicy(t *testing.T) {
+	evaluator, err := opa.NewOPAEvaluator(opa.Config{
+		Package: "layer.authz",
+		Rule:    "allow",
+		Policy:  "../../deploy/vectorlayer/development/layer.rego",
+		IsPath:  true,
+	})
+	require.NoError(t, err)
+
+	layer := LayerEntity{ID: 1, OwnerID: 10, Visibility: VisibilityPrivate, Organization: "nsdi", Tags: []string{"cadastre"}}
+	shares := []LayerShareEntity{{LayerID: 1, UserID: 20, Permission: PermissionEdit}}
+
+	tests := []struct {
+		name       string
+		actor      Actor
+		layer      func(LayerEntity) LayerEntity
+		permission Permission
+		allowed    bool
+	}{
+		{name: "owner", actor: Actor{ID: 10}, permission: PermissionAdmin, allowed: true},
+		{name: "stranger on private layer", actor: Actor{ID: 30}, permission: PermissionRead, allowed: false},
+		{name: "admin", actor: Actor{ID: 30, Role: types.RoleAdmin}, permission: PermissionAdmin, allowed: true},
+		{name: "edit share can read", actor: Actor{ID: 20}, permission: PermissionRead, allowed: true},
+		{name: "edit share can edit", actor: Actor{ID: 20}, permission: PermissionEdit, allowed: true},
+		{name: "edit share can not administer", actor: Actor{ID: 20}, permission: PermissionAdmin, allowed: false},
+		{
+			name: "public layer read", actor: Actor{ID: 30}, permission: PermissionRead, allowed: true,
+			layer: func(l LayerEntity) LayerEntity { l.Visibility = VisibilityPublic; return l },
+		},
+		{
+			name: "public layer edit", actor: Actor{ID: 30}, permission: PermissionEdit, allowed: false,
+			layer: func(l LayerEntity) LayerEntity { l.Visibility = VisibilityPublic; return l },
+		},
+		{
+			name: "organization member read", actor: Actor{ID: 30, Organization: "nsdi"}, permission: PermissionRead, allowed: true,
+			layer: func(l LayerEntity) LayerEntity { l.Visibility = VisibilityOrganization; return l },
+		},
+		{
+			name: "other organization read", actor: Actor{ID: 30, Organization: "other"}, permission: PermissionRead, allowed: false,
+			layer: func(l LayerEntity) LayerEntity { l.Visibility = VisibilityOrganization; return l },
+		},
+		{name: "organization editor on tagged layer", actor: Actor{ID: 30, Organization: "cadastre", OrganizationRole: "editor"}, permission: PermissionEdit, allowed: true},
+		{name: "organization viewer on tagged layer", actor: Actor{ID: 30, Organization: "cadastre", OrganizationRole: "viewer"}, permission: PermissionEdit, allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := layer
+			if tt.layer != nil {
+				l = tt.layer(l)
+			}
+			err := evaluator.Evaluate(context.Background(), layerPolicyInput(tt.actor, l, shares, tt.permission))
+			assert.Equal(t, tt.allowed, err == nil, "evaluate error: %v", err)
+		})
+	}
+}
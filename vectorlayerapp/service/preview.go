@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// number of features returned as a sample of every dataset in an import preview
+const previewSampleSize = 5
+
+// ogrInfo is the subset of `ogrinfo -json` output used by the import preview
+type ogrInfo struct {
+	DriverShortName string         `json:"driverShortName"`
+	Layers          []ogrInfoLayer `json:"layers"`
+}
+
+type ogrInfoLayer struct {
+	Name           string `json:"name"`
+	FeatureCount   int64  `json:"featureCount"`
+	GeometryFields []struct {
+		Name             string `json:"name"`
+		Type             string `json:"type"`
+		CoordinateSystem struct {
+			WKT      string `json:"wkt"`
+			ProjJSON struct {
+				ID struct {
+					Authority string `json:"authority"`
+					Code      int    `json:"code"`
+				} `json:"id"`
+			} `json:"projjson"`
+		} `json:"coordinateSystem"`
+	} `json:"geometryFields"`
+	Fields []struct {
+		Name     string `json:"name"`
+		Type     string `json:"type"`
+		Width    int    `json:"width"`
+		Nullable bool   `json:"nullable"`
+	} `json:"fields"`
+	Metadata map[string]map[string]string `json:"metadata"`
+}
+
+func (s Service) PreviewImport(ctx context.Context, req PreviewImportRequest) (PreviewImportResponse, error) {
+	if req.Actor.ID == 0 {
+		return PreviewImportResponse{}, ErrForbidden
+	}
+
+	tempDir, err := os.MkdirTemp("", "preview-*")
+	if err != nil {
+		return PreviewImportResponse{}, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := s.fetchArchive(ctx, req.FileKey, tempDir); err != nil {
+		return PreviewImportResponse{}, err
+	}
+
+	datasets, err := findDatasets(tempDir)
+	if err != nil {
+		return PreviewImportResponse{}, err
+	}
+
+	previews := make([]DatasetPreview, 0, len(datasets))
+	for _, ds := range datasets {
+		info, err := inspectDataset(ctx, ds.Path)
+		if err != nil {
+			return PreviewImportResponse{}, err
+		}
+
+		for _, layer := range info.Layers {
+			preview := DatasetPreview{
+				Name:         strings.ToLower(layer.Name),
+				File:         filepath.Base(ds.Path),
+				Format:       ds.Format,
+				FeatureCount: layer.FeatureCount,
+				Encoding:     detectEncoding(ds, layer),
+				HasStyle:     ds.StylePath != "",
+				Fields:       make([]FieldSchema, 0, len(layer.Fields)),
+			}
+			if info.DriverShortName != "" {
+				preview.Format = info.DriverShortName
+			}
+			if len(layer.GeometryFields) > 0 {
+				geometry := layer.GeometryFields[0]
+				preview.GeometryType = geometry.Type
+				if id := geometry.CoordinateSystem.ProjJSON.ID; id.Authority != "" {
+					preview.CRS = fmt.Sprintf("%s:%d", id.Authority, id.Code)
+				}
+			}
+			for _, field := range layer.Fields {
+				preview.Fields = append(preview.Fields, FieldSchema{
+					Name:     field.Name,
+					Type:     field.Type,
+					Width:    field.Width,
+					Nullable: field.Nullable,
+				})
+			}
+
+			preview.SampleFeatures, err = sampleFeatures(ctx, ds.Path, layer.Name, previewSampleSize)
+			if err != nil {
+				return PreviewImportResponse{}, err
+			}
+			previews = append(previews, preview)
+		}
+	}
+
+	return PreviewImportResponse{
+		FileKey:  req.FileKey,
+		Datasets: previews,
+	}, nil
+}
+
+func inspectDataset(ctx context.Context, path string) (ogrInfo, error) {
+	output, err := exec.CommandContext(ctx, "ogrinfo", "-json", "-so", "-ro", path).Output()
+	if err != nil {
+		log.Printf("ogrinfo failed on %s: %v", path, err)
+		return ogrInfo{}, fmt.Errorf("ogrinfo failed on %s: %w", filepath.Base(path), err)
+	}
+
+	var info ogrInfo
+	if err := json.Unmarshal(output, &info); err != nil {
+		return ogrInfo{}, fmt.Errorf("failed to parse ogrinfo output of %s: %w", filepath.Base(path), err)
+	}
+	return info, nil
+}
+
+func sampleFeatures(ctx context.Context, path string, layerName string, limit int) ([]json.RawMessage, error) {
+	output, err := exec.CommandContext(ctx, "ogr2ogr",
+		"-f", "GeoJSON",
+		"/vsistdout/",
+		path,
+		layerName,
+		"-limit", fmt.Sprint(limit),
+		"-t_srs", "EPSG:4326",
+	).Output()
+	if err != nil {
+		log.Printf("ogr2ogr sample failed on %s: %v", path, err)
+		return nil, fmt.Errorf("failed to read sample features of %s: %w", layerName, err)
+	}
+
+	var collection struct {
+		Features []json.RawMessage `json:"features"`
+	}
+	if err := json.Unmarshal(output, &collection); err != nil {
+		return nil, fmt.Errorf("failed to parse sample features of %s: %w", layerName, err)
+	}
+	return collection.Features, nil
+}
+
+// detectEncoding prefers the .cpg sidecar of a shapefile and falls back to what GDAL reports
+func detectEncoding(ds dataset, layer ogrInfoLayer) string {
+	cpg, err := os.ReadFile(strings.TrimSuffix(ds.Path, filepath.Ext(ds.Path)) + ".cpg")
+	if err == nil && strings.TrimSpace(string(cpg)) != "" {
+		return strings.TrimSpace(string(cpg))
+	}
+
+	if encoding := layer.Metadata["SHAPEFILE"]["SOURCE_ENCODING"]; encoding != "" {
+		return encoding
+	}
+	return "unknown"
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Priority string
+
+const (
+	PriorityInteractive Priority = "interactive"
+	PriorityBulk        Priority = "bulk"
+)
+
+// QueueConfig shares the import workers between users. An import only starts processing while its user and
+// organization run fewer jobs than their concurrency, and while no job of an earlier priority class waits
+// for a slot it could take. Zero disables a limit
+type QueueConfig struct {
+	UserConcurrency         int `koanf:"user_concurrency"`
+	OrganizationConcurrency int `koanf:"organization_concurrency"`
+	// MaxPendingPerUser bounds the imports a user may have waiting, further ones are rejected
+	MaxPendingPerUser int `koanf:"max_pending_per_user"`
+	// Priorities lists the priority classes from first to last served
+	Priorities      []Priority `koanf:"priorities"`
+	DefaultPriority Priority   `koanf:"default_priority"`
+	// RecheckInterval is how long a waiting import sleeps before asking for a slot again
+	RecheckInterval time.Duration `koanf:"recheck_interval"`
+	// SlotLease is how long a processing job may hold its slot, a job still processing after it is failed as
+	// abandoned. It must outlast the longest job, it defaults to defaultSlotLease
+	SlotLease time.Duration `koanf:"slot_lease"`
+}
+
+// defaultSlotLease outlasts the 24 hour timeouts of the import activities
+const defaultSlotLease = 48 * time.Hour
+
+func (c QueueConfig) slotLease() time.Duration {
+	if c.SlotLease > 0 {
+		return c.SlotLease
+	}
+	return defaultSlotLease
+}
+
+// classes returns the configured priority classes, interactive before bulk when none are configured
+func (c QueueConfig) classes() []Priority {
+	if len(c.Priorities) == 0 {
+		return []Priority{PriorityInteractive, PriorityBulk}
+	}
+	return c.Priorities
+}
+
+func (c QueueConfig) defaultPriority() Priority {
+	if c.DefaultPriority != "" {
+		return c.DefaultPriority
+	}
+	return c.classes()[0]
+}
+
+// JobSlot are the limits a job is admitted under, Priorities orders the waiting jobs. Jobs processing for longer
+// than Lease no longer count against the limits
+type JobSlot struct {
+	UserConcurrency         int
+	OrganizationConcurrency int
+	Priorities              []Priority
+	Lease                   time.Duration
+}
+
+func (s Service) jobSlot() JobSlot {
+	return JobSlot{
+		UserConcurrency:         s.config.Queue.UserConcurrency,
+		OrganizationConcurrency: s.config.Queue.OrganizationConcurrency,
+		Priorities:              s.config.Queue.classes(),
+		Lease:                   s.config.Queue.slotLease(),
+	}
+}
+
+// AcquireImportSlot moves a pending job to processing when the queue admits it, otherwise it reports the
+// position of the job and when to ask again. A job that is already processing keeps its slot, so the
+// activity can be retried
+func (s Service) AcquireImportSlot(ctx context.Context, req AcquireImportSlotRequest) (AcquireImportSlotResponse, error) {
+	granted, err := s.repository.AcquireJobSlot(ctx, req.WorkflowId, s.jobSlot())
+	if err != nil {
+		return AcquireImportSlotResponse{}, fmt.Errorf("failed to acquire a slot for job %s: %w", req.WorkflowId, err)
+	}
+	if granted {
+		return AcquireImportSlotResponse{Granted: true}, nil
+	}
+
+	position, err := s.repository.GetJobQueuePosition(ctx, req.WorkflowId, s.config.Queue.classes())
+	if err != nil {
+		return AcquireImportSlotResponse{}, fmt.Errorf("failed to read queue position of job %s: %w", req.WorkflowId, err)
+	}
+	retryAfter := s.config.Queue.RecheckInterval
+	if retryAfter <= 0 {
+		retryAfter = time.Minute
+	}
+	return AcquireImportSlotResponse{Position: position, RetryAfter: retryAfter}, nil
+}
+
+// GetJob returns a job of the actor, a pending one carries its position in the queue
+func (s Service) GetJob(ctx context.Context, req GetJobRequest) (GetJobResponse, error) {
+	job, err := s.repository.GetJobByToken(ctx, req.WorkflowId)
+	if err != nil {
+		return GetJobResponse{}, err
+	}
+	// the jobs of other users are not found rather than forbidden, their ids are not given away
+	if job.UserID != req.Actor.ID {
+		return GetJobResponse{}, sql.ErrNoRows
+	}
+
+	res := GetJobResponse{Job: job}
+	if job.Status == JobStatusPending {
+		res.QueuePosition, err = s.repository.GetJobQueuePosition(ctx, job.Token, s.config.Queue.classes())
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return GetJobResponse{}, fmt.Errorf("failed to read queue position of job %s: %w", job.Token, err)
+		}
+	}
+	return res, nil
+}
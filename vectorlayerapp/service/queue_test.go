@@ -0,0 +1,33 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateScheduleImportLayerPriority(t *testing.T) {
+	v := NewValidator(nil)
+	req := ScheduleImportLayerRequest{FileKey: "archive.zip"}
+
+	defaults := QueueConfig{}
+	assert.Equal(t, PriorityInteractive, defaults.defaultPriority())
+	for _, priority := range []Priority{"", PriorityInteractive, PriorityBulk} {
+		req.Priority = priority
+		assert.NoError(t, v.ValidateScheduleImportLayer(req, defaults), priority)
+	}
+	req.Priority = "urgent"
+	assert.Error(t, v.ValidateScheduleImportLayer(req, defaults))
+
+	configured := QueueConfig{Priorities: []Priority{"urgent", PriorityBulk}}
+	assert.Equal(t, Priority("urgent"), configured.defaultPriority())
+	assert.NoError(t, v.ValidateScheduleImportLayer(req, configured))
+	req.Priority = PriorityInteractive
+	assert.Error(t, v.ValidateScheduleImportLayer(req, configured))
+}
+
+func TestQueueConfigSlotLease(t *testing.T) {
+	assert.Equal(t, defaultSlotLease, QueueConfig{}.slotLease())
+	assert.Equal(t, time.Hour, QueueConfig{SlotLease: time.Hour}.slotLease())
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gocastsian/roham/vectorlayerapp/job"
+	"github.com/google/uuid"
+	"go.temporal.io/sdk/temporal"
+)
+
+// ScheduleReprojectLayer starts a job transforming a layer to another coordinate reference system. In place it
+// needs edit permission, a copy into a new layer only needs to read every feature of the source
+func (s Service) ScheduleReprojectLayer(ctx context.Context, req ScheduleReprojectLayerRequest) (ScheduleReprojectLayerResponse, error) {
+	if req.Mode == "" {
+		req.Mode = ReprojectModeInPlace
+	}
+	// ogr2ogr launders layer names to lower case, names of new layers follow it
+	req.LayerName = strings.ToLower(req.LayerName)
+	if err := s.validator.ValidateScheduleReprojectLayer(req); err != nil {
+		return ScheduleReprojectLayerResponse{}, err
+	}
+
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return ScheduleReprojectLayerResponse{}, err
+	}
+	permission := PermissionEdit
+	if req.Mode == ReprojectModeNewLayer {
+		permission = PermissionRead
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, permission); err != nil {
+		return ScheduleReprojectLayerResponse{}, err
+	}
+	if req.Mode == ReprojectModeNewLayer {
+		// the copy would carry the rows outside of the scope of the actor into a layer they own
+		scope, err := s.rowScope(ctx, req.Actor, layer)
+		if err != nil {
+			return ScheduleReprojectLayerResponse{}, err
+		}
+		if scope != nil {
+			return ScheduleReprojectLayerResponse{}, ErrForbidden
+		}
+
+		_, err = s.repository.GetLayerByName(ctx, req.LayerName)
+		if err == nil {
+			return ScheduleReprojectLayerResponse{}, validation.Errors{
+				"layer_name": fmt.Errorf("layer %s already exists", req.LayerName),
+			}
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return ScheduleReprojectLayerResponse{}, err
+		}
+		// the job tables and the derived tables of other layers aren't layers but must not be replaced either
+		for _, table := range layerTables(req.LayerName) {
+			exists, err := s.repository.TableExists(ctx, table)
+			if err != nil {
+				return ScheduleReprojectLayerResponse{}, err
+			}
+			if exists {
+				return ScheduleReprojectLayerResponse{}, validation.Errors{
+					"layer_name": fmt.Errorf("the name %s is taken by table %s", req.LayerName, table),
+				}
+			}
+		}
+	}
+
+	if _, err := s.spatialReference(ctx, "target_crs", req.TargetCRS); err != nil {
+		return ScheduleReprojectLayerResponse{}, err
+	}
+	if req.TargetCRS == layer.SRID {
+		return ScheduleReprojectLayerResponse{}, validation.Errors{
+			"target_crs": fmt.Errorf("layer %s is already in %s", layer.Name, req.TargetCRS),
+		}
+	}
+
+	workflowId := "reproject_" + uuid.New().String()
+	// reprojections share the import workers, they count against the limits of the queue while processing
+	_, err = s.repository.AddJob(ctx, JobEntity{
+		Token:        workflowId,
+		Status:       JobStatusPending,
+		UserID:       req.Actor.ID,
+		Priority:     s.config.Queue.defaultPriority(),
+		Organization: req.Actor.Organization,
+	})
+	if err != nil {
+		return ScheduleReprojectLayerResponse{}, fmt.Errorf("failed to create job record: %w", err)
+	}
+
+	_, err = s.scheduler.Add(ctx, job.Event{
+		WorkflowId:   workflowId,
+		WorkflowName: "ReprojectLayerWorkflow",
+		QueueName:    "import_layer",
+		Args: map[string]any{
+			"layer_id":     strconv.FormatUint(uint64(layer.ID), 10),
+			"target_srid":  strconv.Itoa(int(req.TargetCRS)),
+			"mode":         string(req.Mode),
+			"layer_name":   req.LayerName,
+			"owner_id":     strconv.FormatUint(uint64(req.Actor.ID), 10),
+			"organization": req.Actor.Organization,
+		},
+	})
+	if err != nil {
+		errMsg := err.Error()
+		_, _ = s.repository.UpdateJob(ctx, JobEntity{
+			Token:  workflowId,
+			Status: JobStatusFailed,
+			Error:  &errMsg,
+		})
+		return ScheduleReprojectLayerResponse{}, fmt.Errorf("failed to start workflow: %w", err)
+	}
+
+	return ScheduleReprojectLayerResponse{WorkflowId: workflowId}, nil
+}
+
+// ReprojectLayer transforms the table of a layer to req.SRID, or copies it into req.TargetTable when one is given.
+// The copy is registered as a layer by CreateLayer afterwards. A target table created meanwhile by anything but
+// an earlier attempt of the same job is left alone and fails the job
+func (s Service) ReprojectLayer(ctx context.Context, req ReprojectLayerRequest) (ReprojectLayerResponse, error) {
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return ReprojectLayerResponse{}, fmt.Errorf("failed to read layer %d: %w", req.LayerID, err)
+	}
+	res := ReprojectLayerResponse{
+		TableName:    layer.Name,
+		GeomType:     layer.GeomType,
+		DefaultStyle: layer.DefaultStyle,
+		Time:         layer.Time,
+	}
+
+	if req.TargetTable == "" {
+		if err := s.repository.ReprojectLayerTable(ctx, layer.ID, layer.Name, req.SRID); err != nil {
+			return ReprojectLayerResponse{}, err
+		}
+		s.layerChanged(ctx, layer.ID)
+		return res, nil
+	}
+
+	err = s.repository.CopyReprojectedTable(ctx, layer.Name, req.TargetTable, req.SRID, req.WorkflowId)
+	if errors.Is(err, ErrTableTaken) {
+		return ReprojectLayerResponse{}, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("table %s was created by someone else", req.TargetTable), LayerNameTakenErrorType, err)
+	}
+	if err != nil {
+		return ReprojectLayerResponse{}, err
+	}
+	return res, nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RowMatch keeps the features whose attribute, read as text, equals Value
+type RowMatch struct {
+	Attribute string
+	Value     string
+}
+
+// RowScope is the part of a layer the row rules let an actor read, every match has to hold. A denied scope
+// reads nothing, it is what an actor lacking a claim a rule needs gets
+type RowScope struct {
+	Matches []RowMatch
+	Denied  bool
+}
+
+// String identifies the scope in cache keys
+func (s RowScope) String() string {
+	if s.Denied {
+		return "denied"
+	}
+	parts := make([]string, 0, len(s.Matches))
+	for _, match := range s.Matches {
+		parts = append(parts, match.Attribute+"="+match.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// resolveRowScope turns the row rules of a layer into the scope of actor, nil is an unrestricted scope.
+// The rules apply to anonymous users too, they have no claims and read nothing of a layer with rules
+func resolveRowScope(actor Actor, rules []LayerRowRuleEntity) *RowScope {
+	scope := &RowScope{}
+	for _, rule := range rules {
+		if actor.Role != 0 && slices.Contains(rule.ExemptRoles, actor.Role) {
+			continue
+		}
+		value := rule.Claim.Value(actor)
+		if value == "" {
+			return &RowScope{Denied: true}
+		}
+		scope.Matches = append(scope.Matches, RowMatch{Attribute: rule.Attribute, Value: value})
+	}
+	if len(scope.Matches) == 0 {
+		return nil
+	}
+	return scope
+}
+
+// rowScope returns the features of layer actor may read, admins of the layer are never restricted so they
+// can manage all of its data. It is called after authorizeLayer granted read access
+func (s Service) rowScope(ctx context.Context, actor Actor, layer LayerEntity) (*RowScope, error) {
+	rules, err := s.repository.GetLayerRowRules(ctx, layer.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	shares, err := s.repository.GetLayerShares(ctx, layer.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shares of layer %d: %w", layer.ID, err)
+	}
+	if s.authorizer.Evaluate(ctx, layerPolicyInput(actor, layer, shares, PermissionAdmin)) == nil {
+		return nil, nil
+	}
+	return resolveRowScope(actor, rules), nil
+}
+
+// scopeLayer drops the statistics of layer when actor only reads part of it, they describe every feature
+// and their extent and top values would reveal rows outside of the scope
+func (s Service) scopeLayer(ctx context.Context, actor Actor, layer *LayerEntity) error {
+	scope, err := s.rowScope(ctx, actor, *layer)
+	if err != nil {
+		return err
+	}
+	if scope != nil {
+		layer.Statistics = nil
+	}
+	return nil
+}
+
+func (s Service) GetLayerRowRules(ctx context.Context, req GetLayerRowRulesRequest) (LayerRowRulesResponse, error) {
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return LayerRowRulesResponse{}, err
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionAdmin); err != nil {
+		return LayerRowRulesResponse{}, err
+	}
+
+	rules, err := s.repository.GetLayerRowRules(ctx, layer.ID)
+	if err != nil {
+		return LayerRowRulesResponse{}, err
+	}
+	return LayerRowRulesResponse{Rules: rules}, nil
+}
+
+// SetLayerRowRules replaces the row rules of a layer, an empty list lifts every restriction
+func (s Service) SetLayerRowRules(ctx context.Context, req SetLayerRowRulesRequest) (LayerRowRulesResponse, error) {
+	if err := s.validator.ValidateSetLayerRowRules(req); err != nil {
+		return LayerRowRulesResponse{}, err
+	}
+
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return LayerRowRulesResponse{}, err
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionAdmin); err != nil {
+		return LayerRowRulesResponse{}, err
+	}
+
+	available, err := s.repository.GetLayerAttributes(ctx, layer.Name)
+	if err != nil {
+		return LayerRowRulesResponse{}, err
+	}
+	if err := s.validator.ValidateRowRuleAttributes(req.Rules, available); err != nil {
+		return LayerRowRulesResponse{}, err
+	}
+
+	rules := make([]LayerRowRuleEntity, 0, len(req.Rules))
+	for _, rule := range req.Rules {
+		rules = append(rules, LayerRowRuleEntity{
+			LayerID:     layer.ID,
+			Attribute:   rule.Attribute,
+			Claim:       rule.Claim,
+			ExemptRoles: rule.ExemptRoles,
+		})
+	}
+	saved, err := s.repository.ReplaceLayerRowRules(ctx, layer.ID, rules)
+	if err != nil {
+		return LayerRowRulesResponse{}, err
+	}
+	return LayerRowRulesResponse{Rules: saved}, nil
+}
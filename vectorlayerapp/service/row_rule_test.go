@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/gocastsian/roham/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveRowScope(t *testing.T) {
+	const roleAnalyst types.Role = 2
+	rules := []LayerRowRuleEntity{
+		{Attribute: "province", Claim: ClaimRegion, ExemptRoles: []types.Role{roleAnalyst}},
+		{Attribute: "office", Claim: ClaimOrganization},
+	}
+
+	tests := []struct {
+		name  string
+		actor Actor
+		rules []LayerRowRuleEntity
+		want  *RowScope
+	}{
+		{name: "no rules", actor: Actor{ID: 1}, want: nil},
+		{
+			name:  "provincial office",
+			actor: Actor{ID: 1, Organization: "tehran-office", Region: "tehran"},
+			rules: rules,
+			want: &RowScope{Matches: []RowMatch{
+				{Attribute: "province", Value: "tehran"},
+				{Attribute: "office", Value: "tehran-office"},
+			}},
+		},
+		{
+			name:  "exempt role skips its rule",
+			actor: Actor{ID: 1, Role: roleAnalyst, Organization: "tehran-office"},
+			rules: rules,
+			want:  &RowScope{Matches: []RowMatch{{Attribute: "office", Value: "tehran-office"}}},
+		},
+		{name: "missing claim", actor: Actor{ID: 1, Organization: "tehran-office"}, rules: rules, want: &RowScope{Denied: true}},
+		{name: "anonymous", actor: Actor{}, rules: rules, want: &RowScope{Denied: true}},
+		{
+			name:  "role claim",
+			actor: Actor{ID: 1, Role: roleAnalyst},
+			rules: []LayerRowRuleEntity{{Attribute: "audience", Claim: ClaimRole}},
+			want:  &RowScope{Matches: []RowMatch{{Attribute: "audience", Value: "2"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, resolveRowScope(tt.actor, tt.rules))
+		})
+	}
+}
+
+func TestRowScopeCacheKey(t *testing.T) {
+	tehran := FeatureFilter{Scope: &RowScope{Matches: []RowMatch{{Attribute: "province", Value: "tehran"}}}}
+	fars := FeatureFilter{Scope: &RowScope{Matches: []RowMatch{{Attribute: "province", Value: "fars"}}}}
+	denied := FeatureFilter{Scope: &RowScope{Denied: true}}
+
+	assert.NotEqual(t, tehran.CacheKey(), fars.CacheKey())
+	assert.NotEqual(t, tehran.CacheKey(), denied.CacheKey())
+	assert.NotEqual(t, FeatureFilter{}.CacheKey(), denied.CacheKey())
+}
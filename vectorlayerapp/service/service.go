@@ -2,15 +2,19 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gocastsian/roham/types"
 	"github.com/gocastsian/roham/vectorlayerapp/job"
 	"github.com/google/uuid"
-	"github.com/mholt/archiver/v3"
+	"go.temporal.io/sdk/temporal"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -19,30 +23,107 @@ type Repository interface {
 	HealthCheck(ctx context.Context) (string, error)
 	AddJob(ctx context.Context, job JobEntity) (types.ID, error)
 	GetJobByToken(ctx context.Context, token string) (JobEntity, error)
+	GetJobByIdempotencyKey(ctx context.Context, key string) (JobEntity, error)
+	ReleaseIdempotencyKey(ctx context.Context, token string) error
+	AcquireJobSlot(ctx context.Context, token string, slot JobSlot) (bool, error)
+	GetJobQueuePosition(ctx context.Context, token string, priorities []Priority) (int, error)
+	CountPendingJobs(ctx context.Context, userID types.ID) (int, error)
 	UpdateJob(ctx context.Context, job JobEntity) (bool, error)
 	CreateLayer(ctx context.Context, layer LayerEntity) (types.ID, error)
 	DropTable(ctx context.Context, tableName string) (bool, error)
+	ReplaceLayerTable(ctx context.Context, id types.ID, stagingTable string, tableName string, layerTime *LayerTime) error
+	TableExists(ctx context.Context, tableName string) (bool, error)
+	DropTableCreatedBy(ctx context.Context, tableName string, createdBy string) (bool, error)
 	GetLayerByName(ctx context.Context, name string) (LayerEntity, error)
 	CreateStyle(ctx context.Context, style StyleEntity) (types.ID, error)
+	DeleteStyle(ctx context.Context, id types.ID) (string, error)
+	GetLayerByID(ctx context.Context, id types.ID) (LayerEntity, error)
+	ComputeLayerStatistics(ctx context.Context, tableName string, topN int) (LayerStatistics, error)
+	UpdateLayerStatistics(ctx context.Context, id types.ID, statistics LayerStatistics) error
+	FindInvalidGeometries(ctx context.Context, tableName string) ([]InvalidGeometry, error)
+	RepairGeometries(ctx context.Context, tableName string) (int64, error)
+	QuarantineInvalidGeometries(ctx context.Context, tableName string) (string, error)
+	GetLayersByContentHash(ctx context.Context, contentHash string, ownerID types.ID) ([]LayerEntity, error)
+	GetLayerShares(ctx context.Context, layerID types.ID) ([]LayerShareEntity, error)
+	UpsertLayerShare(ctx context.Context, share LayerShareEntity) (LayerShareEntity, error)
+	DeleteLayerShare(ctx context.Context, layerID types.ID, userID types.ID) error
+	GetLayerRowRules(ctx context.Context, layerID types.ID) ([]LayerRowRuleEntity, error)
+	ReplaceLayerRowRules(ctx context.Context, layerID types.ID, rules []LayerRowRuleEntity) ([]LayerRowRuleEntity, error)
+	UpdateLayerAccess(ctx context.Context, id types.ID, visibility Visibility, tags []string) error
+	UpdateLayerMetadata(ctx context.Context, id types.ID, metadata LayerMetadata) error
+	SearchLayers(ctx context.Context, filter CatalogFilter) ([]LayerEntity, int64, error)
+	LookupFeatures(ctx context.Context, layer LayerEntity, point LookupPoint, tolerance float64, limit int, filter FeatureFilter) ([]LookupFeature, error)
+	NearestFeatures(ctx context.Context, layer LayerEntity, point LookupPoint, k int, maxDistance *float64, filter FeatureFilter) ([]NearestFeature, error)
+	GetTile(ctx context.Context, layer LayerEntity, tile TileCoordinate, attributes []string, filter FeatureFilter, options TileOptions) ([]byte, error)
+	GetLayerAttributes(ctx context.Context, tableName string) ([]string, error)
+	GetNumericAttributes(ctx context.Context, tableName string) ([]string, error)
+	AggregateLayer(ctx context.Context, layer LayerEntity, filter FeatureFilter, bbox Extent, options AggregateOptions) ([]AggregateCell, error)
+	AggregateLayerTile(ctx context.Context, layer LayerEntity, filter FeatureFilter, bbox Extent, options AggregateOptions) ([]byte, error)
+	QueryFeatures(ctx context.Context, layer LayerEntity, filter FeatureFilter, limit int, offset int) (FeaturePage, error)
+	InvalidateLayerCache(ctx context.Context, layerID types.ID) error
+	TouchLayer(ctx context.Context, id types.ID) error
+	DeleteLayer(ctx context.Context, id types.ID) error
+	GetTimeAttributes(ctx context.Context, tableName string) ([]string, error)
+	UpdateLayerTime(ctx context.Context, id types.ID, layerTime *LayerTime) error
+	ComputeTemporalExtent(ctx context.Context, tableName string, layerTime LayerTime) (*TemporalExtent, error)
+	BuildGeneralizedGeometries(ctx context.Context, tableName string, levels []GeneralizationLevel) error
+	UpdateLayerGeneralization(ctx context.Context, id types.ID, zooms []int) error
+	ReprojectLayerTable(ctx context.Context, layerID types.ID, tableName string, srid EPSGCode) error
+	CopyReprojectedTable(ctx context.Context, tableName string, targetTable string, srid EPSGCode, createdBy string) error
+	GetSpatialReference(ctx context.Context, srid EPSGCode) (SpatialReference, error)
+	TransformGeometry(ctx context.Context, geometry json.RawMessage, from EPSGCode, to EPSGCode) (json.RawMessage, error)
+	MeasureGeometry(ctx context.Context, geometry json.RawMessage, srid EPSGCode, method MeasurementMethod) (GeometryMeasurements, error)
+	GetDistinctAttributeValues(ctx context.Context, tableName string, attribute string) ([]string, error)
+	ConvertAttributeToDate(ctx context.Context, tableName string, attribute string, dates map[string]string) error
+	CreateMapProject(ctx context.Context, project MapProjectEntity) (types.ID, error)
+	UpdateMapProject(ctx context.Context, project MapProjectEntity) error
+	GetMapProject(ctx context.Context, id types.ID) (MapProjectEntity, error)
+	ListMapProjects(ctx context.Context, filter MapProjectFilter) ([]MapProjectEntity, int64, error)
+	DeleteMapProject(ctx context.Context, id types.ID) error
+	GetMapProjectShares(ctx context.Context, mapID types.ID) ([]MapProjectShareEntity, error)
+	UpsertMapProjectShare(ctx context.Context, share MapProjectShareEntity) (MapProjectShareEntity, error)
+	DeleteMapProjectShare(ctx context.Context, mapID types.ID, userID types.ID) error
 }
 
+// number of most frequent values kept for every categorical attribute
+const statisticsTopValues = 10
+
+// number of invalid features listed one by one in the job result, the rest are only counted
+const maxReportedInvalidGeometries = 100
+
 type Scheduler interface {
 	Add(ctx context.Context, event job.Event) (string, error)
 }
 
 type FilerClient interface {
-	DownloadShapeFile(fileKey string) ([]byte, error)
+	DownloadFile(ctx context.Context, fileKey string, dst string) (DownloadedFile, error)
+}
+
+type Config struct {
+	Archive   ArchiveConfig    `koanf:"archive"`
+	Lookup    LookupConfig     `koanf:"lookup"`
+	Tile      TileConfig       `koanf:"tile"`
+	Map       MapProjectConfig `koanf:"map"`
+	Geometry  GeometryConfig   `koanf:"geometry"`
+	Feature   FeatureConfig    `koanf:"feature"`
+	Queue     QueueConfig      `koanf:"queue"`
+	Aggregate AggregateConfig  `koanf:"aggregate"`
+	Nearest   NearestConfig    `koanf:"nearest"`
 }
 
 type Service struct {
+	config      Config
 	repository  Repository
 	validator   Validator
 	scheduler   Scheduler
 	filerClient FilerClient
+	authorizer  Authorizer
 }
 
-func NewService(repo Repository, validator Validator, scheduler Scheduler, queryClient FilerClient) Service {
+func NewService(repo Repository, validator Validator, scheduler Scheduler, queryClient FilerClient, authorizer Authorizer, cfg Config) Service {
 	return Service{
+		authorizer:  authorizer,
+		config:      cfg,
 		repository:  repo,
 		validator:   validator,
 		scheduler:   scheduler,
@@ -58,14 +139,66 @@ func (s Service) HealthCheckSrv(ctx context.Context) (string, error) {
 	return check, nil
 }
 
-func (s Service) ScheduleImportLayer(ctx context.Context, fileKey string) (ScheduleImportLayerResponse, error) {
+func (s Service) ScheduleImportLayer(ctx context.Context, req ScheduleImportLayerRequest) (ScheduleImportLayerResponse, error) {
+	if req.GeometryMode == "" {
+		req.GeometryMode = GeometryModeRepair
+	}
+	if req.OnDuplicate == "" {
+		req.OnDuplicate = DuplicateModeLink
+	}
+	if req.Visibility == "" {
+		req.Visibility = VisibilityPrivate
+	}
+	if req.Priority == "" {
+		req.Priority = s.config.Queue.defaultPriority()
+	}
+	// ogr2ogr launders attribute names to lower case
+	req.TimeStart = strings.ToLower(req.TimeStart)
+	req.TimeEnd = strings.ToLower(req.TimeEnd)
+	for i := range req.JalaliDates {
+		req.JalaliDates[i] = strings.ToLower(req.JalaliDates[i])
+	}
+	if err := s.validator.ValidateScheduleImportLayer(req, s.config.Queue); err != nil {
+		return ScheduleImportLayerResponse{}, err
+	}
+
+	if req.IdempotencyKey != "" {
+		existing, err := s.repository.GetJobByIdempotencyKey(ctx, req.IdempotencyKey)
+		if err == nil {
+			return ScheduleImportLayerResponse{WorkflowId: existing.Token}, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return ScheduleImportLayerResponse{}, fmt.Errorf("failed to check idempotency key: %w", err)
+		}
+	}
+
+	if limit := s.config.Queue.MaxPendingPerUser; limit > 0 {
+		pending, err := s.repository.CountPendingJobs(ctx, req.UserID)
+		if err != nil {
+			return ScheduleImportLayerResponse{}, err
+		}
+		if pending >= limit {
+			return ScheduleImportLayerResponse{}, ErrQueueFull
+		}
+	}
+
 	workflowId := "layer_" + uuid.New().String()
 
 	_, err := s.repository.AddJob(ctx, JobEntity{
-		Token:  workflowId,
-		Status: JobStatusPending,
+		Token:          workflowId,
+		Status:         JobStatusPending,
+		UserID:         req.UserID,
+		IdempotencyKey: req.IdempotencyKey,
+		Priority:       req.Priority,
+		Organization:   req.Organization,
 	})
 	if err != nil {
+		// a concurrent delivery of the same request won the race on the unique key
+		if req.IdempotencyKey != "" {
+			if existing, getErr := s.repository.GetJobByIdempotencyKey(ctx, req.IdempotencyKey); getErr == nil {
+				return ScheduleImportLayerResponse{WorkflowId: existing.Token}, nil
+			}
+		}
 		return ScheduleImportLayerResponse{}, fmt.Errorf("failed to create job record: %w", err)
 	}
 
@@ -74,14 +207,32 @@ func (s Service) ScheduleImportLayer(ctx context.Context, fileKey string) (Sched
 		WorkflowName: "ImportLayerWorkflow",
 		QueueName:    "import_layer",
 		Args: map[string]any{
-			"key": fileKey},
+			"key":           req.FileKey,
+			"geometry_mode": string(req.GeometryMode),
+			"layers":        strings.Join(req.Layers, ","),
+			"layer_name":    req.LayerName,
+			"on_duplicate":  string(req.OnDuplicate),
+			"owner_id":      strconv.FormatUint(uint64(req.UserID), 10),
+			"visibility":    string(req.Visibility),
+			"organization":  req.Organization,
+			"time_start":    req.TimeStart,
+			"time_end":      req.TimeEnd,
+			"jalali_dates":  strings.Join(req.JalaliDates, ","),
+			"priority":      string(req.Priority),
+		},
 	})
 
 	if err != nil {
-		_, _ = s.repository.AddJob(ctx, JobEntity{
+		errMsg := err.Error()
+		_, _ = s.repository.UpdateJob(ctx, JobEntity{
 			Token:  workflowId,
 			Status: JobStatusFailed,
+			Error:  &errMsg,
 		})
+		// the job never ran, a redelivery of the same request must be able to schedule it again
+		if req.IdempotencyKey != "" {
+			_ = s.repository.ReleaseIdempotencyKey(ctx, workflowId)
+		}
 		return ScheduleImportLayerResponse{}, fmt.Errorf("failed to start workflow: %w", err)
 	}
 
@@ -92,9 +243,11 @@ func (s Service) ScheduleImportLayer(ctx context.Context, fileKey string) (Sched
 
 func (s Service) UpdateJob(ctx context.Context, req UpdateJobStatusRequest) error {
 	_, err := s.repository.UpdateJob(ctx, JobEntity{
-		Token:  req.WorkflowId,
-		Status: req.Status,
-		Error:  req.ErrorMsg,
+		Token:       req.WorkflowId,
+		Status:      req.Status,
+		Error:       req.ErrorMsg,
+		Result:      req.Result,
+		ContentHash: req.ContentHash,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to update job Status: %w", err)
@@ -111,60 +264,187 @@ func (s Service) ImportLayer(ctx context.Context, req ImportLayerRequest) (Impor
 
 	log.Printf("Created temporary directory: %s", tempDir)
 
-	data, err := s.filerClient.DownloadShapeFile(req.FileKey)
+	downloaded, err := s.fetchArchive(ctx, req.FileKey, tempDir)
 	if err != nil {
-		return ImportLayerResponse{}, fmt.Errorf("failed to download %s: %w", req.FileKey, err)
+		return ImportLayerResponse{}, err
 	}
 
-	zipPath := filepath.Join(tempDir, filepath.Base(req.FileKey)+".zip")
-	if err := os.WriteFile(zipPath, data, 0644); err != nil {
-		return ImportLayerResponse{}, fmt.Errorf("failed to write zip file %s: %w", zipPath, err)
+	datasets, err := findDatasets(tempDir)
+	if err != nil {
+		return ImportLayerResponse{}, err
+	}
+	if len(datasets) == 0 {
+		return ImportLayerResponse{}, fmt.Errorf("no importable dataset found in the extracted directory")
 	}
-	log.Printf("Saved zip file %s", zipPath)
 
-	if err := archiver.Unarchive(zipPath, tempDir); err != nil {
-		return ImportLayerResponse{}, fmt.Errorf("failed to unzip file %s: %w", zipPath, err)
+	infos := make([]ogrInfo, len(datasets))
+	for i, ds := range datasets {
+		infos[i], err = inspectDataset(ctx, ds.Path)
+		if err != nil {
+			return ImportLayerResponse{}, err
+		}
+	}
+	targets, err := planImport(datasets, infos, req.Layers, req.LayerName)
+	if err != nil {
+		return ImportLayerResponse{}, err
 	}
-	log.Printf("Unzipped files to %s", tempDir)
 
-	var shpFilePath string
-	var sldFilePath string
-	err = filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
+	duplicates, err := s.repository.GetLayersByContentHash(ctx, downloaded.SHA256, req.OwnerID)
+	if err != nil {
+		return ImportLayerResponse{}, fmt.Errorf("failed to look up layers of archive %s: %w", downloaded.SHA256, err)
+	}
+	linked, targets, err := linkDuplicateLayers(req, targets, duplicates)
+	if err != nil {
+		return ImportLayerResponse{}, err
+	}
+	if len(linked) > 0 {
+		log.Printf("Archive %s was already imported, linking %d layers and importing %d", downloaded.SHA256, len(linked), len(targets))
+	}
+	replaced := make(map[string]types.ID)
+	for _, target := range targets {
+		existingID, err := s.checkLayerName(ctx, target.LayerName, req.OwnerID)
 		if err != nil {
-			return err
+			return ImportLayerResponse{}, err
 		}
-		if !info.IsDir() {
-			ext := strings.ToLower(filepath.Ext(path))
-			switch ext {
-			case ".shp":
-				shpFilePath = path
-			case ".sld":
-				sldFilePath = path
+		if existingID != 0 {
+			if err := s.checkStagingTable(ctx, target.LayerName); err != nil {
+				return ImportLayerResponse{}, err
 			}
+			replaced[target.LayerName] = existingID
 		}
-		return nil
-	})
-	if err != nil {
-		return ImportLayerResponse{}, fmt.Errorf("failed to scan directory for .shp files: %w", err)
 	}
 
-	if shpFilePath == "" {
-		return ImportLayerResponse{}, fmt.Errorf("no .shp file found in the extracted directory")
+	layers := make([]ImportedLayer, 0, len(targets))
+	for _, target := range targets {
+		// a re-import is written next to the table of its layer, which keeps serving until the job swaps it in
+		imported := ImportedLayer{
+			LayerName:       target.LayerName,
+			TableName:       target.LayerName,
+			GeomType:        target.GeomType,
+			ReplacedLayerID: replaced[target.LayerName],
+		}
+		if imported.ReplacedLayerID != 0 {
+			imported.TableName = target.LayerName + StagingTableSuffix
+		}
+
+		log.Printf("Importing %s from %s as %s", target.SourceLayer, target.Dataset.Path, imported.TableName)
+		if err := importDataset(ctx, target.Dataset.Path, target.SourceLayer, imported.TableName); err != nil {
+			// the workflow only learns about the layers of a successful attempt, a failing one removes its own
+			// tables, including the one ogr2ogr may have partly written, even when the attempt was cancelled
+			s.discardImportedLayers(context.WithoutCancel(ctx), append(layers, imported))
+			return ImportLayerResponse{}, err
+		}
+
+		if stylePath := target.Dataset.StylePath; stylePath != "" {
+			log.Printf("Found SLD file: %s", stylePath)
+
+			styleRes, err := s.CreateStyle(ctx, CreateStyleRequest{FilePath: stylePath})
+			if err != nil {
+				log.Printf("Warning: Failed to process SLD file: %v", err)
+			} else {
+				imported.StyleFileID = styleRes.ID
+				log.Printf("Style created successfully with ID: %v", styleRes)
+			}
+		}
+		layers = append(layers, imported)
 	}
 
-	log.Printf("Found shapefile: %s", shpFilePath)
+	log.Printf("%d layers imported successfully!", len(layers))
+	return ImportLayerResponse{
+		Status:      true,
+		Layers:      append(linked, layers...),
+		ContentHash: downloaded.SHA256,
+	}, nil
+}
 
-	layerName := strings.ToLower(filepath.Base(shpFilePath[:len(shpFilePath)-4]))
+// checkLayerName makes sure an import may write the table of a layer name, it may when the name is new or the
+// owner re-imports a layer of their own, whose ID is returned. Names of other users' layers and of tables that
+// aren't layers, the job tables among them, are rejected
+func (s Service) checkLayerName(ctx context.Context, name string, ownerID types.ID) (types.ID, error) {
+	layer, err := s.repository.GetLayerByName(ctx, name)
+	if err == nil {
+		if layer.OwnerID != ownerID {
+			return 0, temporal.NewNonRetryableApplicationError(
+				fmt.Sprintf("layer %s belongs to another user", name), LayerNameTakenErrorType, nil)
+		}
+		return layer.ID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	for _, table := range layerTables(name) {
+		exists, err := s.repository.TableExists(ctx, table)
+		if err != nil {
+			return 0, err
+		}
+		if exists {
+			return 0, temporal.NewNonRetryableApplicationError(
+				fmt.Sprintf("the name %s is taken by table %s", name, table), LayerNameTakenErrorType, nil)
+		}
+	}
+	return 0, nil
+}
+
+// checkStagingTable makes sure the staging table of a re-import of name isn't a layer of its own, ogr2ogr
+// overwrites what a failed re-import left behind there
+func (s Service) checkStagingTable(ctx context.Context, name string) error {
+	_, err := s.repository.GetLayerByName(ctx, name+StagingTableSuffix)
+	if err == nil {
+		return temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("layer %s%s keeps %s from being re-imported", name, StagingTableSuffix, name), LayerNameTakenErrorType, nil)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// linkDuplicateLayers splits the targets of an import into the layers the same archive was already imported as,
+// which are linked instead of imported again, and the targets still to import. The import is rejected instead
+// when it asked for that and any of its targets was imported before. Nothing is written to PostGIS here
+func linkDuplicateLayers(req ImportLayerRequest, targets []importTarget, duplicates []LayerEntity) ([]ImportedLayer, []importTarget, error) {
+	existing := make(map[string]LayerEntity, len(duplicates))
+	for _, layer := range duplicates {
+		existing[layer.Name] = layer
+	}
+
+	linked := make([]ImportedLayer, 0)
+	names := make([]string, 0)
+	pending := make([]importTarget, 0, len(targets))
+	for _, target := range targets {
+		layer, ok := existing[target.LayerName]
+		if !ok {
+			pending = append(pending, target)
+			continue
+		}
+		names = append(names, layer.Name)
+		linked = append(linked, ImportedLayer{
+			LayerName:       layer.Name,
+			GeomType:        layer.GeomType,
+			StyleFileID:     layer.DefaultStyle,
+			ExistingLayerID: layer.ID,
+		})
+	}
+
+	if len(linked) > 0 && req.OnDuplicate == DuplicateModeReject {
+		return nil, nil, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("archive was already imported as %s", strings.Join(names, ", ")), DuplicateDatasetErrorType, nil)
+	}
+	return linked, pending, nil
+}
 
+func importDataset(ctx context.Context, path string, sourceLayer string, layerName string) error {
 	connStr := "PG:host=localhost user=nimamleo dbname=vectorlayer_db password=root"
 	cmd := exec.CommandContext(ctx, "ogr2ogr",
 		"-f", "PostgreSQL",
 		connStr,
-		shpFilePath,
+		path,
+		sourceLayer,
 		"-nln", layerName,
 		"-overwrite",
 		"-append",
-		"-nlt", "MULTIPOLYGON",
+		"-nlt", "PROMOTE_TO_MULTI",
 		"-t_srs", "EPSG:4326",
 		"-lco", "GEOMETRY_NAME=wkb_geometry",
 		"-lco", "FID=ogc_fid",
@@ -172,28 +452,24 @@ func (s Service) ImportLayer(ctx context.Context, req ImportLayerRequest) (Impor
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Printf("ogr2ogr failed: %v\nOutput: %s", err, string(output))
-		return ImportLayerResponse{}, fmt.Errorf("ogr2ogr failed: %w", err)
+		return fmt.Errorf("ogr2ogr failed on %s: %w", layerName, err)
 	}
+	return nil
+}
 
-	var styleFileId types.ID
-	if sldFilePath != "" {
-		log.Printf("Found SLD file: %s", sldFilePath)
-
-		styleRes, err := s.CreateStyle(ctx, CreateStyleRequest{FilePath: sldFilePath})
-		if err != nil {
-			log.Printf("Warning: Failed to process SLD file: %v", err)
-		} else {
-			styleFileId = styleRes.ID
-			log.Printf("Style created successfully with ID: %v", styleRes)
-		}
+// promoteToMultiGeometryType maps a GDAL geometry type name to the multi type ogr2ogr stores with PROMOTE_TO_MULTI
+func promoteToMultiGeometryType(gdalType string) string {
+	lower := strings.ToLower(gdalType)
+	switch {
+	case strings.Contains(lower, "polygon"):
+		return "MULTIPOLYGON"
+	case strings.Contains(lower, "line"):
+		return "MULTILINESTRING"
+	case strings.Contains(lower, "point"):
+		return "MULTIPOINT"
+	default:
+		return "GEOMETRY"
 	}
-
-	log.Println("Shapefile imported successfully!")
-	return ImportLayerResponse{
-		Status:      true,
-		LayerName:   layerName,
-		StyleFileID: styleFileId,
-	}, nil
 }
 
 // TODO: implement real notification
@@ -221,37 +497,92 @@ func (s Service) SendNotification(ctx context.Context, req SendNotificationReque
 }
 
 func (s Service) CreateLayer(ctx context.Context, req CreateLayerRequest) (CreateLayerResponse, error) {
+	table := req.LayerName
+	if req.TableName != "" {
+		table = req.TableName
+	}
+	if err := s.checkLayerTime(ctx, table, req.Time); err != nil {
+		return CreateLayerResponse{}, err
+	}
+
 	getLayer, err := s.repository.GetLayerByName(ctx, req.LayerName)
 	if err != nil {
+		// the layer a re-import replaces was deleted while it ran, its staging table is dropped by the job
+		if table != req.LayerName {
+			return CreateLayerResponse{}, temporal.NewNonRetryableApplicationError(
+				fmt.Sprintf("layer %s was deleted during its re-import", req.LayerName), LayerNotFoundErrorType, nil)
+		}
 		createLayer, err := s.repository.CreateLayer(ctx, LayerEntity{
 			Name:         req.LayerName,
 			GeomType:     req.GeomType,
+			SRID:         req.SRID,
 			DefaultStyle: req.DefaultStyle,
+			ContentHash:  req.ContentHash,
+			OwnerID:      req.OwnerID,
+			Visibility:   req.Visibility,
+			Organization: req.Organization,
+			Time:         req.Time,
 		})
 		if err != nil {
 			return CreateLayerResponse{}, fmt.Errorf("failed to create createLayer %s: %w", req.LayerName, err)
 		}
 
 		return CreateLayerResponse{
-			ID: createLayer,
+			ID:      createLayer,
+			Created: true,
 		}, nil
 	}
 
+	// ImportLayer rejects the names of other users' layers, this keeps a direct call from taking one over
+	if getLayer.OwnerID != req.OwnerID {
+		return CreateLayerResponse{}, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("layer %s belongs to another user", req.LayerName), LayerNameTakenErrorType, nil)
+	}
+
+	// a re-import is swapped in only now that it passed every check, the generalized geometries of the old
+	// table go with it in the same transaction so tiles never join the new features to them
+	if table != req.LayerName {
+		if err := s.repository.ReplaceLayerTable(ctx, getLayer.ID, table, req.LayerName, req.Time); err != nil {
+			return CreateLayerResponse{}, err
+		}
+	} else if req.Time != nil {
+		if err := s.repository.UpdateLayerTime(ctx, getLayer.ID, req.Time); err != nil {
+			return CreateLayerResponse{}, err
+		}
+	}
+	s.layerChanged(ctx, getLayer.ID)
 	return CreateLayerResponse{
 		ID: getLayer.ID,
 	}, nil
 }
 
+// DropLayerTable drops the table of a layer together with the quarantine and generalized tables derived from it
 func (s Service) DropLayerTable(ctx context.Context, req DropLayerRequest) (DropLayerResponse, error) {
-	res, err := s.repository.DropTable(ctx, req.TableName)
-	if err != nil {
-		return DropLayerResponse{}, fmt.Errorf("failed to drop table %s: %w", req.TableName, err)
+	if req.CreatedBy != "" {
+		dropped, err := s.repository.DropTableCreatedBy(ctx, req.TableName, req.CreatedBy)
+		if err != nil {
+			return DropLayerResponse{}, fmt.Errorf("failed to drop table %s: %w", req.TableName, err)
+		}
+		return DropLayerResponse{Success: dropped}, nil
+	}
+
+	res := true
+	for _, table := range layerTables(req.TableName) {
+		dropped, err := s.repository.DropTable(ctx, table)
+		if err != nil {
+			return DropLayerResponse{}, fmt.Errorf("failed to drop table %s: %w", table, err)
+		}
+		res = res && dropped
 	}
 
 	return DropLayerResponse{
 		Success: res,
 	}, nil
+}
 
+// layerTables lists the table of a layer and the tables import and generalization derive from it
+func layerTables(name string) []string {
+	return []string{name, name + QuarantineTableSuffix, name + GeneralizedTableSuffix, name + StagingTableSuffix}
 }
 
 func (s Service) CreateStyle(ctx context.Context, req CreateStyleRequest) (CreateStyleResponse, error) {
@@ -288,3 +619,111 @@ func (s Service) CreateStyle(ctx context.Context, req CreateStyleRequest) (Creat
 
 	return CreateStyleResponse{ID: styleID}, nil
 }
+
+func (s Service) ComputeLayerStatistics(ctx context.Context, req ComputeLayerStatisticsRequest) (ComputeLayerStatisticsResponse, error) {
+	statistics, err := s.repository.ComputeLayerStatistics(ctx, req.TableName, statisticsTopValues)
+	if err != nil {
+		return ComputeLayerStatisticsResponse{}, fmt.Errorf("failed to compute statistics of layer %s: %w", req.TableName, err)
+	}
+
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return ComputeLayerStatisticsResponse{}, err
+	}
+	if layer.Time != nil {
+		statistics.TemporalExtent, err = s.repository.ComputeTemporalExtent(ctx, req.TableName, *layer.Time)
+		if err != nil {
+			return ComputeLayerStatisticsResponse{}, fmt.Errorf("failed to compute temporal extent of layer %s: %w", req.TableName, err)
+		}
+	}
+
+	if err := s.repository.UpdateLayerStatistics(ctx, req.LayerID, statistics); err != nil {
+		return ComputeLayerStatisticsResponse{}, err
+	}
+	if err := s.repository.InvalidateLayerCache(ctx, req.LayerID); err != nil {
+		log.Printf("failed to invalidate cache of layer %d: %v", req.LayerID, err)
+	}
+
+	return ComputeLayerStatisticsResponse{
+		FeatureCount: statistics.FeatureCount,
+	}, nil
+}
+
+func (s Service) GetLayer(ctx context.Context, req GetLayerRequest) (GetLayerResponse, error) {
+	layer, err := s.repository.GetLayerByID(ctx, req.ID)
+	if err != nil {
+		return GetLayerResponse{}, err
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionRead); err != nil {
+		return GetLayerResponse{}, err
+	}
+
+	if err := s.scopeLayer(ctx, req.Actor, &layer); err != nil {
+		return GetLayerResponse{}, err
+	}
+
+	return GetLayerResponse{Layer: layer}, nil
+}
+
+func (s Service) ValidateGeometries(ctx context.Context, req ValidateGeometriesRequest) (ValidateGeometriesResponse, error) {
+	invalids, err := s.repository.FindInvalidGeometries(ctx, req.TableName)
+	if err != nil {
+		return ValidateGeometriesResponse{}, err
+	}
+
+	summary := GeometryValidationSummary{
+		Mode:         req.Mode,
+		InvalidCount: len(invalids),
+		Problems:     make(map[GeometryProblem]int),
+		Features:     make([]InvalidGeometry, 0),
+	}
+	for i := range invalids {
+		invalids[i].Problem = classifyGeometryProblem(invalids[i].Reason)
+		summary.Problems[invalids[i].Problem]++
+		if i < maxReportedInvalidGeometries {
+			summary.Features = append(summary.Features, invalids[i])
+		}
+	}
+
+	if len(invalids) == 0 {
+		return ValidateGeometriesResponse{Summary: summary}, nil
+	}
+
+	switch req.Mode {
+	case GeometryModeReject:
+		return ValidateGeometriesResponse{}, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("import rejected: %d features of %s have invalid geometries", len(invalids), req.TableName),
+			InvalidGeometryErrorType, nil, summary)
+	case GeometryModeQuarantine:
+		quarantineTable, err := s.repository.QuarantineInvalidGeometries(ctx, req.TableName)
+		if err != nil {
+			return ValidateGeometriesResponse{}, err
+		}
+		summary.QuarantineTable = quarantineTable
+	default:
+		repaired, err := s.repository.RepairGeometries(ctx, req.TableName)
+		if err != nil {
+			return ValidateGeometriesResponse{}, err
+		}
+		summary.RepairedCount = repaired
+	}
+
+	log.Printf("Validated geometries of %s: %d invalid, mode %s", req.TableName, len(invalids), req.Mode)
+	return ValidateGeometriesResponse{Summary: summary}, nil
+}
+
+// classifyGeometryProblem maps the free text of ST_IsValidReason to a GeometryProblem
+func classifyGeometryProblem(reason string) GeometryProblem {
+	lower := strings.ToLower(reason)
+	switch {
+	case strings.Contains(lower, "empty"):
+		return GeometryProblemEmpty
+	case strings.Contains(lower, "ring"), strings.Contains(lower, "hole"), strings.Contains(lower, "shell"),
+		strings.Contains(lower, "too few points"):
+		return GeometryProblemRing
+	case strings.Contains(lower, "self-intersection"):
+		return GeometryProblemSelfIntersection
+	default:
+		return GeometryProblemOther
+	}
+}
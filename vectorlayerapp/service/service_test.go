@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gocastsian/roham/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/temporal"
+)
+
+func TestClassifyGeometryProblem(t *testing.T) {
+	tests := []struct {
+		reason   string
+		expected GeometryProblem
+	}{
+		{reason: "Empty geometry", expected: GeometryProblemEmpty},
+		{reason: "Self-intersection[10 20]", expected: GeometryProblemSelfIntersection},
+		{reason: "Ring Self-intersection[10 20]", expected: GeometryProblemRing},
+		{reason: "Hole lies outside shell[1 1]", expected: GeometryProblemRing},
+		{reason: "Too few points in geometry component[0 0]", expected: GeometryProblemRing},
+		{reason: "Interior is disconnected[5 5]", expected: GeometryProblemOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			assert.Equal(t, tt.expected, classifyGeometryProblem(tt.reason))
+		})
+	}
+}
+
+func TestFindDatasets(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"roads.shp", "roads.dbf", "roads.SLD",
+		"nested/Districts.shp", "nested/districts.sld",
+		"parcels.gpkg",
+		"orphan.sld",
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+	}
+
+	datasets, err := findDatasets(dir)
+	require.NoError(t, err)
+
+	styles := make(map[string]string)
+	for _, ds := range datasets {
+		styles[ds.Name] = ds.StylePath
+	}
+	assert.Len(t, datasets, 3)
+	assert.Equal(t, filepath.Join(dir, "roads.SLD"), styles["roads"])
+	assert.Equal(t, filepath.Join(dir, "nested", "districts.sld"), styles["districts"])
+	assert.Empty(t, styles["parcels"])
+}
+
+func TestPromoteToMultiGeometryType(t *testing.T) {
+	assert.Equal(t, "MULTIPOLYGON", promoteToMultiGeometryType("Polygon"))
+	assert.Equal(t, "MULTIPOLYGON", promoteToMultiGeometryType("3D Multi Polygon"))
+	assert.Equal(t, "MULTILINESTRING", promoteToMultiGeometryType("LineString"))
+	assert.Equal(t, "MULTIPOINT", promoteToMultiGeometryType("Point"))
+	assert.Equal(t, "GEOMETRY", promoteToMultiGeometryType("Unknown (any)"))
+}
+
+func TestLinkDuplicateLayers(t *testing.T) {
+	duplicates := []LayerEntity{
+		{ID: 7, Name: "roads", GeomType: "MULTILINESTRING", DefaultStyle: 3},
+		{ID: 8, Name: "rivers", GeomType: "MULTILINESTRING"},
+	}
+	targets := []importTarget{{LayerName: "roads"}, {LayerName: "lakes"}}
+
+	t.Run("links the existing layers and imports the rest", func(t *testing.T) {
+		linked, pending, err := linkDuplicateLayers(ImportLayerRequest{OnDuplicate: DuplicateModeLink}, targets, duplicates)
+		require.NoError(t, err)
+		require.Len(t, linked, 1)
+		assert.EqualValues(t, 7, linked[0].ExistingLayerID)
+		assert.EqualValues(t, 3, linked[0].StyleFileID)
+		assert.Equal(t, []importTarget{{LayerName: "lakes"}}, pending)
+	})
+
+	t.Run("imports everything of a new archive", func(t *testing.T) {
+		linked, pending, err := linkDuplicateLayers(ImportLayerRequest{OnDuplicate: DuplicateModeReject}, targets, nil)
+		require.NoError(t, err)
+		assert.Empty(t, linked)
+		assert.Equal(t, targets, pending)
+	})
+
+	t.Run("rejects with a non-retryable error", func(t *testing.T) {
+		_, _, err := linkDuplicateLayers(ImportLayerRequest{OnDuplicate: DuplicateModeReject}, targets, duplicates)
+		var appErr *temporal.ApplicationError
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, DuplicateDatasetErrorType, appErr.Type())
+		assert.True(t, appErr.NonRetryable())
+		assert.Contains(t, err.Error(), "roads")
+	})
+}
+
+func TestValidateLookup(t *testing.T) {
+	config := LookupConfig{MaxTolerance: 100, MaxLayers: 2}
+	tolerance := func(v float64) *float64 { return &v }
+	v := NewValidator(nil)
+
+	assert.NoError(t, v.ValidateLookup(LookupRequest{Point: LookupPoint{Lat: 35.7, Lon: 51.4}, Layers: []string{"district"}, Tolerance: tolerance(10)}, config))
+	assert.Error(t, v.ValidateLookup(LookupRequest{Point: LookupPoint{Lat: 95, Lon: 51.4}, Layers: []string{"district"}, Tolerance: tolerance(10)}, config))
+	assert.Error(t, v.ValidateLookup(LookupRequest{Point: LookupPoint{Lat: 35.7, Lon: 51.4}, Tolerance: tolerance(10)}, config))
+	assert.Error(t, v.ValidateLookup(LookupRequest{Point: LookupPoint{Lat: 35.7, Lon: 51.4}, Layers: []string{"a", "b", "c"}, Tolerance: tolerance(10)}, config))
+	assert.Error(t, v.ValidateLookup(LookupRequest{Point: LookupPoint{Lat: 35.7, Lon: 51.4}, Layers: []string{"a"}, Tolerance: tolerance(500)}, config))
+}
+
+func TestValidateGetTile(t *testing.T) {
+	config := TileConfig{MaxZoom: 14}
+	v := NewValidator(nil)
+
+	assert.NoError(t, v.ValidateGetTile(GetTileRequest{Tile: TileCoordinate{Z: 0, X: 0, Y: 0}}, config))
+	assert.NoError(t, v.ValidateGetTile(GetTileRequest{Tile: TileCoordinate{Z: 3, X: 7, Y: 5}}, config))
+	assert.Error(t, v.ValidateGetTile(GetTileRequest{Tile: TileCoordinate{Z: 3, X: 8, Y: 5}}, config))
+	assert.Error(t, v.ValidateGetTile(GetTileRequest{Tile: TileCoordinate{Z: 15, X: 0, Y: 0}}, config))
+	assert.Error(t, v.ValidateGetTile(GetTileRequest{Tile: TileCoordinate{Z: -1, X: 0, Y: 0}}, config))
+
+	assert.NoError(t, v.ValidateTileAttributes([]string{"name"}, []string{"name", "population"}))
+	assert.Error(t, v.ValidateTileAttributes([]string{"name", "secret"}, []string{"name", "population"}))
+}
+
+func TestValidateScheduleReprojectLayer(t *testing.T) {
+	v := NewValidator(nil)
+
+	tests := []struct {
+		name  string
+		req   ScheduleReprojectLayerRequest
+		field string
+	}{
+		{name: "in place", req: ScheduleReprojectLayerRequest{TargetCRS: 32639, Mode: ReprojectModeInPlace}},
+		{name: "new layer", req: ScheduleReprojectLayerRequest{TargetCRS: 32639, Mode: ReprojectModeNewLayer, LayerName: "parcels_utm39"}},
+		{name: "missing target", req: ScheduleReprojectLayerRequest{Mode: ReprojectModeInPlace}, field: "target_crs"},
+		{name: "unknown mode", req: ScheduleReprojectLayerRequest{TargetCRS: 32639, Mode: "copy"}, field: "mode"},
+		{name: "new layer without name", req: ScheduleReprojectLayerRequest{TargetCRS: 32639, Mode: ReprojectModeNewLayer}, field: "layer_name"},
+		{name: "invalid name", req: ScheduleReprojectLayerRequest{TargetCRS: 32639, Mode: ReprojectModeNewLayer, LayerName: "parcels-utm"}, field: "layer_name"},
+		{name: "in place with name", req: ScheduleReprojectLayerRequest{TargetCRS: 32639, Mode: ReprojectModeInPlace, LayerName: "parcels"}, field: "layer_name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.ValidateScheduleReprojectLayer(tt.req)
+			if tt.field == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var errs validation.Errors
+			require.ErrorAs(t, err, &errs)
+			assert.Contains(t, errs, tt.field)
+		})
+	}
+}
+
+// statisticsRepository records what ComputeLayerStatistics stores, the other methods of Repository are not used
+type statisticsRepository struct {
+	Repository
+	layer       LayerEntity
+	statistics  LayerStatistics
+	stored      *LayerStatistics
+	invalidated bool
+}
+
+func (r *statisticsRepository) ComputeLayerStatistics(ctx context.Context, tableName string, topN int) (LayerStatistics, error) {
+	return r.statistics, nil
+}
+
+func (r *statisticsRepository) GetLayerByID(ctx context.Context, id types.ID) (LayerEntity, error) {
+	return r.layer, nil
+}
+
+func (r *statisticsRepository) ComputeTemporalExtent(ctx context.Context, tableName string, layerTime LayerTime) (*TemporalExtent, error) {
+	start := time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)
+	return &TemporalExtent{Start: &start}, nil
+}
+
+func (r *statisticsRepository) UpdateLayerStatistics(ctx context.Context, id types.ID, statistics LayerStatistics) error {
+	r.stored = &statistics
+	return nil
+}
+
+func (r *statisticsRepository) InvalidateLayerCache(ctx context.Context, layerID types.ID) error {
+	r.invalidated = true
+	return nil
+}
+
+func TestComputeLayerStatisticsService(t *testing.T) {
+	t.Run("stores the statistics of an empty layer without an extent", func(t *testing.T) {
+		repo := &statisticsRepository{layer: LayerEntity{ID: 4, Name: "parcels"}}
+		res, err := Service{repository: repo}.ComputeLayerStatistics(context.Background(),
+			ComputeLayerStatisticsRequest{LayerID: 4, TableName: "parcels"})
+		require.NoError(t, err)
+
+		assert.Zero(t, res.FeatureCount)
+		require.NotNil(t, repo.stored)
+		assert.Nil(t, repo.stored.Extent)
+		assert.Nil(t, repo.stored.TemporalExtent)
+		assert.True(t, repo.invalidated)
+	})
+
+	t.Run("adds the temporal extent of a time-enabled layer", func(t *testing.T) {
+		repo := &statisticsRepository{
+			layer:      LayerEntity{ID: 4, Name: "permits", Time: &LayerTime{StartAttribute: "issued_at"}},
+			statistics: LayerStatistics{FeatureCount: 3, Extent: &Extent{MinX: 51.2, MinY: 35.5, MaxX: 51.6, MaxY: 35.9}},
+		}
+		res, err := Service{repository: repo}.ComputeLayerStatistics(context.Background(),
+			ComputeLayerStatisticsRequest{LayerID: 4, TableName: "permits"})
+		require.NoError(t, err)
+
+		assert.EqualValues(t, 3, res.FeatureCount)
+		require.NotNil(t, repo.stored)
+		assert.Equal(t, repo.statistics.Extent, repo.stored.Extent)
+		require.NotNil(t, repo.stored.TemporalExtent)
+		assert.Equal(t, 2024, repo.stored.TemporalExtent.Start.Year())
+	})
+}
+
+// reimportRepository serves the layer a re-import replaces and records the swap of its staging table
+type reimportRepository struct {
+	Repository
+	layer    *LayerEntity
+	swapped  []string
+	swapTime *LayerTime
+}
+
+func (r *reimportRepository) GetLayerByName(ctx context.Context, name string) (LayerEntity, error) {
+	if r.layer == nil {
+		return LayerEntity{}, sql.ErrNoRows
+	}
+	return *r.layer, nil
+}
+
+// GetTimeAttributes only finds the time attribute in the staging table, the old table doesn't have it
+func (r *reimportRepository) GetTimeAttributes(ctx context.Context, tableName string) ([]string, error) {
+	if tableName == "permits"+StagingTableSuffix {
+		return []string{"issued_at"}, nil
+	}
+	return nil, nil
+}
+
+func (r *reimportRepository) ReplaceLayerTable(ctx context.Context, id types.ID, stagingTable string, tableName string, layerTime *LayerTime) error {
+	r.swapped = append(r.swapped, stagingTable+" -> "+tableName)
+	r.swapTime = layerTime
+	return nil
+}
+
+func (r *reimportRepository) TouchLayer(ctx context.Context, id types.ID) error { return nil }
+
+func (r *reimportRepository) InvalidateLayerCache(ctx context.Context, layerID types.ID) error {
+	return nil
+}
+
+func TestCreateLayerReimport(t *testing.T) {
+	req := CreateLayerRequest{
+		LayerName: "permits",
+		TableName: "permits" + StagingTableSuffix,
+		OwnerID:   3,
+		Time:      &LayerTime{StartAttribute: "issued_at"},
+	}
+
+	t.Run("swaps the staging table in once its time attributes are checked", func(t *testing.T) {
+		repo := &reimportRepository{layer: &LayerEntity{ID: 12, Name: "permits", OwnerID: 3}}
+		res, err := Service{repository: repo}.CreateLayer(context.Background(), req)
+		require.NoError(t, err)
+
+		assert.Equal(t, CreateLayerResponse{ID: 12}, res)
+		assert.Equal(t, []string{"permits_staging -> permits"}, repo.swapped)
+		assert.Equal(t, req.Time, repo.swapTime)
+	})
+
+	t.Run("keeps the old table when the layer belongs to another user", func(t *testing.T) {
+		repo := &reimportRepository{layer: &LayerEntity{ID: 12, Name: "permits", OwnerID: 4}}
+		_, err := Service{repository: repo}.CreateLayer(context.Background(), req)
+
+		var appErr *temporal.ApplicationError
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, LayerNameTakenErrorType, appErr.Type())
+		assert.Empty(t, repo.swapped)
+	})
+
+	t.Run("rejects a re-import of a layer deleted in the meantime", func(t *testing.T) {
+		repo := &reimportRepository{}
+		_, err := Service{repository: repo}.CreateLayer(context.Background(), req)
+
+		var appErr *temporal.ApplicationError
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, LayerNotFoundErrorType, appErr.Type())
+	})
+}
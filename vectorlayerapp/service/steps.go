@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"time"
+
+	"github.com/gocastsian/roham/vectorlayerapp/job"
+	"go.temporal.io/sdk/log"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// steps runs the activities of a workflow, the import orchestration is written once against it and
+// executed either as a Temporal workflow or directly by the in-process scheduler
+type steps interface {
+	// Execute runs activity with req and stores its result in res, res is nil for activities without a result
+	Execute(activity any, req any, res any) error
+	Logger() log.Logger
+	// Detached returns steps that keep running when the workflow is cancelled, compensations run on them
+	Detached() steps
+	// Wait pauses the workflow for d, the in-process runner can't hold a worker that long and hands the job
+	// back to its scheduler instead, the workflow returns the error and runs again from the start
+	Wait(d time.Duration) error
+}
+
+type temporalSteps struct {
+	ctx workflow.Context
+}
+
+func (t temporalSteps) Execute(activity any, req any, res any) error {
+	future := workflow.ExecuteActivity(t.ctx, activity, req)
+	if res == nil {
+		return future.Get(t.ctx, nil)
+	}
+	return future.Get(t.ctx, res)
+}
+
+func (t temporalSteps) Logger() log.Logger {
+	return workflow.GetLogger(t.ctx)
+}
+
+func (t temporalSteps) Wait(d time.Duration) error {
+	return workflow.Sleep(t.ctx, d)
+}
+
+func (t temporalSteps) Detached() steps {
+	ctx, _ := workflow.NewDisconnectedContext(t.ctx)
+	return temporalSteps{ctx: ctx}
+}
+
+// directSteps calls the activities as plain functions and retries them with importRetryPolicy,
+// non-retryable application errors are returned right away like Temporal does
+type directSteps struct {
+	ctx    context.Context
+	logger *slog.Logger
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func (d directSteps) Execute(activity any, req any, res any) error {
+	fn := reflect.ValueOf(activity)
+	if fn.Kind() != reflect.Func || fn.Type().NumIn() != 2 || fn.Type().NumOut() == 0 ||
+		!fn.Type().Out(fn.Type().NumOut()-1).Implements(errorType) {
+		return fmt.Errorf("activity %T must be a func(context.Context, request) ([response,] error)", activity)
+	}
+
+	var (
+		out      []reflect.Value
+		err      error
+		interval = importRetryPolicy.InitialInterval
+	)
+	for attempt := int32(1); ; attempt++ {
+		out = fn.Call([]reflect.Value{reflect.ValueOf(d.ctx), reflect.ValueOf(req)})
+		err, _ = out[len(out)-1].Interface().(error)
+		if err == nil {
+			break
+		}
+
+		var appErr *temporal.ApplicationError
+		if (errors.As(err, &appErr) && appErr.NonRetryable()) || attempt >= importRetryPolicy.MaximumAttempts {
+			return err
+		}
+
+		d.logger.Warn("activity failed, retrying", "attempt", attempt, "error", err)
+		select {
+		case <-d.ctx.Done():
+			return d.ctx.Err()
+		case <-time.After(interval):
+		}
+		interval = min(time.Duration(float64(interval)*importRetryPolicy.BackoffCoefficient), importRetryPolicy.MaximumInterval)
+	}
+
+	if res != nil && len(out) == 2 {
+		reflect.ValueOf(res).Elem().Set(out[0])
+	}
+	return nil
+}
+
+func (d directSteps) Logger() log.Logger {
+	return d.logger
+}
+
+func (d directSteps) Wait(after time.Duration) error {
+	return job.DeferredError{After: after}
+}
+
+func (d directSteps) Detached() steps {
+	return directSteps{ctx: context.WithoutCancel(d.ctx), logger: d.logger}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/gocastsian/roham/vectorlayerapp/job"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/temporal"
+)
+
+func TestDirectStepsExecute(t *testing.T) {
+	steps := directSteps{ctx: context.Background(), logger: slog.Default()}
+
+	t.Run("stores the activity result", func(t *testing.T) {
+		activity := func(ctx context.Context, req CreateLayerRequest) (CreateLayerResponse, error) {
+			return CreateLayerResponse{ID: 42}, nil
+		}
+
+		var res CreateLayerResponse
+		require.NoError(t, steps.Execute(activity, CreateLayerRequest{LayerName: "roads"}, &res))
+		assert.EqualValues(t, 42, res.ID)
+	})
+
+	t.Run("accepts activities without a result", func(t *testing.T) {
+		called := false
+		activity := func(ctx context.Context, req UpdateJobStatusRequest) error {
+			called = true
+			return nil
+		}
+
+		require.NoError(t, steps.Execute(activity, UpdateJobStatusRequest{}, nil))
+		assert.True(t, called)
+	})
+
+	t.Run("does not retry non-retryable errors", func(t *testing.T) {
+		calls := 0
+		activity := func(ctx context.Context, req ValidateGeometriesRequest) (ValidateGeometriesResponse, error) {
+			calls++
+			return ValidateGeometriesResponse{}, temporal.NewNonRetryableApplicationError("invalid", InvalidGeometryErrorType, nil,
+				GeometryValidationSummary{InvalidCount: 3})
+		}
+
+		err := steps.Execute(activity, ValidateGeometriesRequest{}, &ValidateGeometriesResponse{})
+		require.Error(t, err)
+		assert.Equal(t, 1, calls)
+
+		var appErr *temporal.ApplicationError
+		require.True(t, errors.As(err, &appErr))
+		var summary GeometryValidationSummary
+		require.NoError(t, appErr.Details(&summary))
+		assert.Equal(t, 3, summary.InvalidCount)
+	})
+
+	t.Run("rejects non activity functions", func(t *testing.T) {
+		assert.Error(t, steps.Execute(func() {}, nil, nil))
+	})
+
+	t.Run("hands waiting jobs back to the scheduler", func(t *testing.T) {
+		var deferred job.DeferredError
+		require.ErrorAs(t, steps.Wait(time.Minute), &deferred)
+		assert.Equal(t, time.Minute, deferred.After)
+	})
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gocastsian/roham/pkg/cql2"
+	dateparser "github.com/gocastsian/roham/pkg/date_parser"
+	"go.temporal.io/sdk/temporal"
+)
+
+var errInvalidDatetime = errors.New("datetime must be an RFC 3339 instant or an interval start/end with .. for an open end")
+
+// TimeFilter is the datetime parameter of OGC API requests, a nil bound is open
+type TimeFilter struct {
+	Start *time.Time
+	End   *time.Time
+}
+
+// String renders the filter back in the datetime syntax it was parsed from
+func (f TimeFilter) String() string {
+	bound := func(t *time.Time) string {
+		if t == nil {
+			return ".."
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return bound(f.Start) + "/" + bound(f.End)
+}
+
+// FeatureFilter narrows down the features a tile or a lookup returns
+type FeatureFilter struct {
+	// Time keeps the features overlapping it, layers without time attributes ignore it
+	Time *TimeFilter
+	// CQL keeps the features matching a CQL2 filter whose properties were checked against the layer
+	CQL cql2.Expression
+	// Scope keeps the features the row rules of the layer let the actor read, nil keeps them all
+	Scope *RowScope
+}
+
+// CacheKey identifies the filter in the keys of cached results, it is empty for a filter keeping every feature
+func (f FeatureFilter) CacheKey() string {
+	parts := make([]string, 0, 3)
+	if f.Time != nil {
+		parts = append(parts, "t="+f.Time.String())
+	}
+	if f.CQL != nil {
+		// filters can be long and hold any character, only their digest goes into the key
+		sum := sha1.Sum([]byte(f.CQL.String()))
+		parts = append(parts, "f="+hex.EncodeToString(sum[:]))
+	}
+	if f.Scope != nil {
+		sum := sha1.Sum([]byte(f.Scope.String()))
+		parts = append(parts, "s="+hex.EncodeToString(sum[:]))
+	}
+	return strings.Join(parts, "&")
+}
+
+// ParseDatetime parses the OGC API datetime parameter: an instant, or an interval of two instants separated
+// by a slash where .. or an empty string is an open end. A date without a time stands for the whole day
+func ParseDatetime(value string) (*TimeFilter, error) {
+	return ParseDatetimeIn(value, dateparser.CalendarGregorian)
+}
+
+// ParseDatetimeIn parses the datetime parameter with the dates of its instants written in calendar, Jalali dates
+// have to use - as separator since / splits the interval
+func ParseDatetimeIn(value string, calendar dateparser.Calendar) (*TimeFilter, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	start, end, isInterval := strings.Cut(value, "/")
+	if !isInterval {
+		instant, day, err := parseInstant(value, calendar)
+		if err != nil {
+			return nil, err
+		}
+		if day {
+			last := instant.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			return &TimeFilter{Start: &instant, End: &last}, nil
+		}
+		return &TimeFilter{Start: &instant, End: &instant}, nil
+	}
+
+	var filter TimeFilter
+	if start != "" && start != ".." {
+		instant, _, err := parseInstant(start, calendar)
+		if err != nil {
+			return nil, err
+		}
+		filter.Start = &instant
+	}
+	if end != "" && end != ".." {
+		instant, day, err := parseInstant(end, calendar)
+		if err != nil {
+			return nil, err
+		}
+		if day {
+			instant = instant.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		filter.End = &instant
+	}
+
+	if filter.Start == nil && filter.End == nil {
+		return nil, errInvalidDatetime
+	}
+	if filter.Start != nil && filter.End != nil && filter.End.Before(*filter.Start) {
+		return nil, errors.New("datetime interval ends before it starts")
+	}
+	return &filter, nil
+}
+
+// parseInstant reads an RFC 3339 date-time or a full date, day reports the latter
+func parseInstant(value string, calendar dateparser.Calendar) (instant time.Time, day bool, err error) {
+	if calendar == dateparser.CalendarJalali {
+		// only the date differs between the calendars, it is swapped for its gregorian day before parsing
+		date, clock, _ := strings.Cut(value, "T")
+		gregorian, err := dateparser.ParseJalaliDate(date)
+		if err != nil {
+			return time.Time{}, false, errInvalidDatetime
+		}
+		value = gregorian.Format(time.DateOnly)
+		if clock != "" {
+			value += "T" + clock
+		}
+	}
+	if instant, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return instant, false, nil
+	}
+	if instant, err := time.Parse(time.DateOnly, value); err == nil {
+		return instant, true, nil
+	}
+	return time.Time{}, false, errInvalidDatetime
+}
+
+// checkLayerTime makes sure the time attributes chosen at import exist on the layer table with a date or timestamp type
+func (s Service) checkLayerTime(ctx context.Context, tableName string, layerTime *LayerTime) error {
+	if layerTime == nil {
+		return nil
+	}
+
+	available, err := s.repository.GetTimeAttributes(ctx, tableName)
+	if err != nil {
+		return err
+	}
+
+	allowed := make([]interface{}, 0, len(available))
+	for _, name := range available {
+		allowed = append(allowed, name)
+	}
+	err = validation.ValidateStruct(layerTime,
+		validation.Field(&layerTime.StartAttribute, validation.In(allowed...).Error("must be a date or timestamp attribute")),
+		validation.Field(&layerTime.EndAttribute, validation.In(allowed...).Error("must be a date or timestamp attribute")),
+	)
+	if err != nil {
+		return temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("time attributes of %s: %v", tableName, err), InvalidTimeAttributeErrorType, nil)
+	}
+	return nil
+}
+
+// ConvertJalaliDates replaces attribute columns holding Jalali dates with date columns of the same name, so they can
+// be filtered and chosen as time attributes. Values that aren't a valid Jalali date become null and are counted.
+// Columns that already hold dates are left alone, a retried conversion must not parse its own output
+func (s Service) ConvertJalaliDates(ctx context.Context, req ConvertJalaliDatesRequest) (ConvertJalaliDatesResponse, error) {
+	if len(req.Attributes) == 0 {
+		return ConvertJalaliDatesResponse{}, nil
+	}
+
+	available, err := s.repository.GetLayerAttributes(ctx, req.TableName)
+	if err != nil {
+		return ConvertJalaliDatesResponse{}, err
+	}
+	attributes := req.Attributes
+	if req.SkipMissing {
+		attributes = presentAttributes(attributes, available)
+	}
+	allowed := make([]interface{}, 0, len(available))
+	for _, name := range available {
+		allowed = append(allowed, name)
+	}
+	err = validation.Validate(attributes, validation.Each(validation.In(allowed...).Error("must be an attribute of the layer")))
+	if err != nil {
+		return ConvertJalaliDatesResponse{}, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("jalali date attributes of %s: %v", req.TableName, err), InvalidDateAttributeErrorType, nil)
+	}
+
+	converted, err := s.repository.GetTimeAttributes(ctx, req.TableName)
+	if err != nil {
+		return ConvertJalaliDatesResponse{}, err
+	}
+
+	conversions := make([]DateConversion, 0, len(attributes))
+	for _, attribute := range attributes {
+		if slices.Contains(converted, attribute) {
+			continue
+		}
+
+		values, err := s.repository.GetDistinctAttributeValues(ctx, req.TableName, attribute)
+		if err != nil {
+			return ConvertJalaliDatesResponse{}, err
+		}
+
+		conversion := DateConversion{Attribute: attribute}
+		dates := make(map[string]string, len(values))
+		for _, value := range values {
+			date, err := dateparser.ParseJalaliDate(value)
+			if err != nil {
+				conversion.InvalidValues++
+				continue
+			}
+			dates[value] = date.Format(time.DateOnly)
+		}
+		conversion.ConvertedValues = len(dates)
+
+		if err := s.repository.ConvertAttributeToDate(ctx, req.TableName, attribute, dates); err != nil {
+			return ConvertJalaliDatesResponse{}, err
+		}
+		conversions = append(conversions, conversion)
+	}
+
+	return ConvertJalaliDatesResponse{Conversions: conversions}, nil
+}
+
+// presentAttributes keeps the attributes that are among the available ones, in their original order
+func presentAttributes(attributes []string, available []string) []string {
+	present := make([]string, 0, len(attributes))
+	for _, attribute := range attributes {
+		if slices.Contains(available, attribute) {
+			present = append(present, attribute)
+		}
+	}
+	return present
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	dateparser "github.com/gocastsian/roham/pkg/date_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDatetime(t *testing.T) {
+	at := func(value string) *time.Time {
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		require.NoError(t, err)
+		return &parsed
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    *TimeFilter
+		wantErr bool
+	}{
+		{name: "empty", value: "", want: nil},
+		{
+			name:  "instant",
+			value: "2024-03-20T10:15:00Z",
+			want:  &TimeFilter{Start: at("2024-03-20T10:15:00Z"), End: at("2024-03-20T10:15:00Z")},
+		},
+		{
+			name:  "date is the whole day",
+			value: "2024-03-20",
+			want:  &TimeFilter{Start: at("2024-03-20T00:00:00Z"), End: at("2024-03-20T23:59:59.999999999Z")},
+		},
+		{
+			name:  "closed interval",
+			value: "2024-01-01T00:00:00Z/2024-06-30T00:00:00+03:30",
+			want:  &TimeFilter{Start: at("2024-01-01T00:00:00Z"), End: at("2024-06-30T00:00:00+03:30")},
+		},
+		{name: "open start", value: "../2024-06-30", want: &TimeFilter{End: at("2024-06-30T23:59:59.999999999Z")}},
+		{name: "open end", value: "2024-01-01T00:00:00Z/", want: &TimeFilter{Start: at("2024-01-01T00:00:00Z")}},
+		{name: "both ends open", value: "../..", wantErr: true},
+		{name: "reversed interval", value: "2024-06-30/2024-01-01", wantErr: true},
+		{name: "not a time", value: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDatetime(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.want == nil {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.Equal(t, tt.want.String(), got.String())
+		})
+	}
+}
+
+func TestFeatureFilterCacheKey(t *testing.T) {
+	assert.Empty(t, FeatureFilter{}.CacheKey())
+
+	filter, err := ParseDatetime("2024-01-01T03:30:00+03:30/..")
+	require.NoError(t, err)
+	assert.Equal(t, "t=2024-01-01T00:00:00Z/..", FeatureFilter{Time: filter}.CacheKey())
+
+	// the same filter in either encoding shares its cached results
+	text, err := ParseFilter(`name = 'Tehran'`, "")
+	require.NoError(t, err)
+	json, err := ParseFilter(`{"op": "=", "args": [{"property": "name"}, "Tehran"]}`, "cql2-json")
+	require.NoError(t, err)
+	key := FeatureFilter{Time: filter, CQL: text}.CacheKey()
+	assert.Regexp(t, `^t=2024-01-01T00:00:00Z/\.\.&f=[0-9a-f]{40}$`, key)
+	assert.Equal(t, key, FeatureFilter{Time: filter, CQL: json}.CacheKey())
+}
+
+func TestParseDatetimeJalali(t *testing.T) {
+	filter, err := ParseDatetimeIn("1403-01-01/1403-01-02T12:00:00+03:30", dateparser.CalendarJalali)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-03-20T00:00:00Z/2024-03-21T08:30:00Z", filter.String())
+
+	filter, err = ParseDatetimeIn("۱۴۰۳-۰۱-۰۱", dateparser.CalendarJalali)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-03-20T00:00:00Z/2024-03-20T23:59:59.999999999Z", filter.String())
+
+	_, err = ParseDatetimeIn("1403-12-31", dateparser.CalendarJalali)
+	assert.Error(t, err)
+}
+
+func TestPresentAttributes(t *testing.T) {
+	available := []string{"fid", "name", "issued_at"}
+	assert.Equal(t, []string{"issued_at"}, presentAttributes([]string{"issued_at", "expires_at"}, available))
+	assert.Empty(t, presentAttributes([]string{"expires_at"}, available))
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gocastsian/roham/types"
+)
+
+type TileConfig struct {
+	MaxZoom int `koanf:"max_zoom"`
+	// Extent and Buffer are in tile coordinate units, see ST_AsMVTGeom
+	Extent         int                  `koanf:"extent"`
+	Buffer         int                  `koanf:"buffer"`
+	Generalization GeneralizationConfig `koanf:"generalization"`
+}
+
+type TileCoordinate struct {
+	Z int
+	X int
+	Y int
+}
+
+type TileOptions struct {
+	Extent int
+	Buffer int
+	// GeneralizedZoom is the zoom band whose simplified geometries the tile is cut from, nil uses the full geometries
+	GeneralizedZoom *int
+}
+
+func (s Service) GetTile(ctx context.Context, req GetTileRequest) (GetTileResponse, error) {
+	if err := s.validator.ValidateGetTile(req, s.config.Tile); err != nil {
+		return GetTileResponse{}, err
+	}
+
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return GetTileResponse{}, err
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionRead); err != nil {
+		return GetTileResponse{}, err
+	}
+
+	if len(req.Attributes) > 0 {
+		available, err := s.repository.GetLayerAttributes(ctx, layer.Name)
+		if err != nil {
+			return GetTileResponse{}, err
+		}
+		if err := s.validator.ValidateTileAttributes(req.Attributes, available); err != nil {
+			return GetTileResponse{}, err
+		}
+	}
+	if err := s.checkFilter(ctx, layer, req.Filter); err != nil {
+		return GetTileResponse{}, err
+	}
+	scope, err := s.rowScope(ctx, req.Actor, layer)
+	if err != nil {
+		return GetTileResponse{}, err
+	}
+
+	data, err := s.repository.GetTile(ctx, layer, req.Tile, req.Attributes, FeatureFilter{Time: req.Datetime, CQL: req.Filter, Scope: scope}, TileOptions{
+		Extent:          s.config.Tile.Extent,
+		Buffer:          s.config.Tile.Buffer,
+		GeneralizedZoom: generalizedZoom(layer, req.Tile.Z),
+	})
+	if err != nil {
+		return GetTileResponse{}, err
+	}
+
+	return GetTileResponse{Data: data}, nil
+}
+
+// layerChanged bumps the version of a layer and drops its cached tiles and lookups, it is called whenever
+// the data of a layer table is replaced. A failure only leaves stale entries until their TTL, so it is logged
+func (s Service) layerChanged(ctx context.Context, id types.ID) {
+	if err := s.repository.TouchLayer(ctx, id); err != nil {
+		log.Printf("failed to bump version of layer %d: %v", id, err)
+	}
+	if err := s.repository.InvalidateLayerCache(ctx, id); err != nil {
+		log.Printf("failed to invalidate cache of layer %d: %v", id, err)
+	}
+}
+
+func (s Service) DeleteLayer(ctx context.Context, req DeleteLayerRequest) error {
+	layer, err := s.repository.GetLayerByID(ctx, req.LayerID)
+	if err != nil {
+		return err
+	}
+	if err := s.authorizeLayer(ctx, req.Actor, layer, PermissionAdmin); err != nil {
+		return err
+	}
+
+	if err := s.repository.DeleteLayer(ctx, layer.ID); err != nil {
+		return err
+	}
+	for _, table := range layerTables(layer.Name) {
+		if _, err := s.repository.DropTable(ctx, table); err != nil {
+			return fmt.Errorf("failed to drop table of layer %d: %w", layer.ID, err)
+		}
+	}
+
+	if err := s.repository.InvalidateLayerCache(ctx, layer.ID); err != nil {
+		log.Printf("failed to invalidate cache of deleted layer %d: %v", layer.ID, err)
+	}
+	return nil
+}
@@ -1,5 +1,19 @@
 package service
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+)
+
+// layer names become postgres table names
+var layerNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
 type ValidatorRepository interface {
 }
 
@@ -12,3 +26,334 @@ func NewValidator(repo ValidatorRepository) Validator {
 		repo: repo,
 	}
 }
+
+// highest zoom level a map view or a layer scale range can use
+const maxMapZoom = 24.0
+
+var visibilities = []interface{}{VisibilityPrivate, VisibilityOrganization, VisibilityPublic}
+
+func (v Validator) ValidateScheduleImportLayer(req ScheduleImportLayerRequest, queue QueueConfig) error {
+	priorities := make([]interface{}, 0, len(queue.classes()))
+	for _, priority := range queue.classes() {
+		priorities = append(priorities, priority)
+	}
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.FileKey, validation.Required.Error("file key is required")),
+		validation.Field(&req.GeometryMode, validation.In(GeometryModeRepair, GeometryModeReject, GeometryModeQuarantine).
+			Error("geometry mode must be one of repair, reject or quarantine")),
+		validation.Field(&req.LayerName, validation.Match(layerNameRegexp).
+			Error("layer name must start with a letter or underscore and contain only letters, digits and underscores")),
+		validation.Field(&req.OnDuplicate, validation.In(DuplicateModeLink, DuplicateModeReject).
+			Error("duplicate mode must be one of link or reject")),
+		validation.Field(&req.Visibility, validation.In(visibilities...).
+			Error("visibility must be one of private, organization or public")),
+		validation.Field(&req.TimeEnd, validation.When(req.TimeStart == "",
+			validation.Empty.Error("time end requires a time start"))),
+		validation.Field(&req.JalaliDates, validation.Each(validation.Match(layerNameRegexp).
+			Error("jalali date attributes must be attribute names"))),
+		validation.Field(&req.Priority, validation.In(priorities...).
+			Error(fmt.Sprintf("priority must be one of %v", queue.classes()))),
+	)
+}
+
+func (v Validator) ValidateScheduleReprojectLayer(req ScheduleReprojectLayerRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.TargetCRS, validation.Required.Error("target crs is required")),
+		validation.Field(&req.Mode, validation.In(ReprojectModeInPlace, ReprojectModeNewLayer).
+			Error("mode must be one of in_place or new_layer")),
+		validation.Field(&req.LayerName,
+			validation.When(req.Mode == ReprojectModeNewLayer, validation.Required.Error("layer name is required for a new layer")),
+			validation.When(req.Mode == ReprojectModeInPlace, validation.Empty.Error("an in place reprojection keeps the layer name")),
+			validation.Match(layerNameRegexp).
+				Error("layer name must start with a letter or underscore and contain only letters, digits and underscores")),
+	)
+}
+
+func (v Validator) ValidateShareLayer(req ShareLayerRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.UserID, validation.Required.Error("user id is required")),
+		validation.Field(&req.Permission, validation.Required, validation.In(PermissionRead, PermissionEdit, PermissionAdmin).
+			Error("permission must be one of read, edit or admin")),
+	)
+}
+
+func (v Validator) ValidateUpdateLayerAccess(req UpdateLayerAccessRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Visibility, validation.In(visibilities...).
+			Error("visibility must be one of private, organization or public")),
+	)
+}
+
+func (v Validator) ValidateSetLayerRowRules(req SetLayerRowRulesRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Rules, validation.Each(validation.By(func(value interface{}) error {
+			rule := value.(LayerRowRule)
+			return validation.ValidateStruct(&rule,
+				validation.Field(&rule.Attribute, validation.Required.Error("attribute is required")),
+				validation.Field(&rule.Claim, validation.Required, validation.In(ClaimRole, ClaimOrganization, ClaimRegion).
+					Error("claim must be one of role, organization or region")),
+			)
+		}))),
+	)
+}
+
+// ValidateRowRuleAttributes makes sure row rules only compare attribute columns of the layer
+func (v Validator) ValidateRowRuleAttributes(rules []LayerRowRule, available []string) error {
+	allowed := make([]interface{}, 0, len(available))
+	for _, name := range available {
+		allowed = append(allowed, name)
+	}
+	attributes := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		attributes = append(attributes, rule.Attribute)
+	}
+	return validation.Errors{
+		"rules": validation.Validate(attributes, validation.Each(validation.In(allowed...).Error("unknown attribute"))),
+	}.Filter()
+}
+
+var updateFrequencies = []interface{}{
+	UpdateFrequencyContinual, UpdateFrequencyDaily, UpdateFrequencyWeekly, UpdateFrequencyFortnightly,
+	UpdateFrequencyMonthly, UpdateFrequencyQuarterly, UpdateFrequencyBiannually, UpdateFrequencyAnnually,
+	UpdateFrequencyAsNeeded, UpdateFrequencyIrregular, UpdateFrequencyNotPlanned, UpdateFrequencyUnknown,
+}
+
+func (v Validator) ValidateLayerMetadata(metadata LayerMetadata) error {
+	return validation.ValidateStruct(&metadata,
+		validation.Field(&metadata.Title, validation.Length(0, 255)),
+		validation.Field(&metadata.Keywords, validation.Each(validation.Required, validation.Length(1, 100))),
+		validation.Field(&metadata.UpdateFrequency, validation.In(updateFrequencies...).
+			Error("update frequency must be an ISO 19115 maintenance frequency code")),
+		validation.Field(&metadata.Contact, validation.By(func(value interface{}) error {
+			contact := value.(Contact)
+			return validation.ValidateStruct(&contact,
+				validation.Field(&contact.Email, is.EmailFormat),
+			)
+		})),
+	)
+}
+
+func (v Validator) ValidateExportLayerMetadata(req ExportLayerMetadataRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Format, validation.In(MetadataFormatISO19115, MetadataFormatDublinCore).
+			Error("format must be one of iso19115 or dublincore")),
+	)
+}
+
+func (v Validator) ValidateSearchCatalog(req SearchCatalogRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.BBox, validation.By(func(value interface{}) error {
+			bbox := value.(*Extent)
+			if bbox == nil {
+				return nil
+			}
+			if bbox.MinX > bbox.MaxX || bbox.MinY > bbox.MaxY {
+				return errors.New("bbox must be minx,miny,maxx,maxy")
+			}
+			return nil
+		})),
+	)
+}
+
+func (v Validator) ValidateLookup(req LookupRequest, config LookupConfig) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Point, validation.By(func(value interface{}) error {
+			point := value.(LookupPoint)
+			return validation.ValidateStruct(&point,
+				validation.Field(&point.Lat, validation.Min(-90.0), validation.Max(90.0)),
+				validation.Field(&point.Lon, validation.Min(-180.0), validation.Max(180.0)),
+			)
+		})),
+		validation.Field(&req.Layers, validation.Required.Error("at least one layer is required"),
+			validation.Length(1, config.MaxLayers).Error(fmt.Sprintf("at most %d layers can be looked up at once", config.MaxLayers))),
+		validation.Field(&req.Tolerance, validation.Min(0.0), validation.Max(config.MaxTolerance).
+			Error(fmt.Sprintf("tolerance must be between 0 and %g meters", config.MaxTolerance))),
+	)
+}
+
+func (v Validator) ValidateNearest(req NearestRequest, config NearestConfig) error {
+	maxDistance := []validation.Rule{
+		validation.NilOrNotEmpty.Error("max distance must be greater than 0"),
+		validation.Min(0.0).Exclusive().Error("max distance must be greater than 0"),
+	}
+	if config.MaxDistance > 0 {
+		maxDistance = append(maxDistance, validation.Max(config.MaxDistance).
+			Error(fmt.Sprintf("max distance must be at most %g meters", config.MaxDistance)))
+	}
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Point, validation.By(func(value interface{}) error {
+			point := value.(LookupPoint)
+			return validation.ValidateStruct(&point,
+				validation.Field(&point.Lat, validation.Min(-90.0), validation.Max(90.0)),
+				validation.Field(&point.Lon, validation.Min(-180.0), validation.Max(180.0)),
+			)
+		})),
+		validation.Field(&req.K, validation.Required, validation.Min(1), validation.Max(config.MaxK).
+			Error(fmt.Sprintf("k must be between 1 and %d", config.MaxK))),
+		validation.Field(&req.MaxDistance, maxDistance...),
+	)
+}
+
+func (v Validator) ValidateQueryFeatures(req QueryFeaturesRequest, config FeatureConfig) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Limit, validation.Min(1), validation.Max(config.MaxLimit).
+			Error(fmt.Sprintf("limit must be between 1 and %d", config.MaxLimit))),
+		validation.Field(&req.Offset, validation.Min(0)),
+	)
+}
+
+func (v Validator) ValidateGetTile(req GetTileRequest, config TileConfig) error {
+	tile := req.Tile
+	maxIndex := 0
+	if tile.Z > 0 && tile.Z <= config.MaxZoom {
+		maxIndex = 1<<tile.Z - 1
+	}
+	return validation.ValidateStruct(&tile,
+		validation.Field(&tile.Z, validation.Min(0), validation.Max(config.MaxZoom).
+			Error(fmt.Sprintf("zoom must be between 0 and %d", config.MaxZoom))),
+		validation.Field(&tile.X, validation.Min(0), validation.Max(maxIndex).Error("x is outside of the zoom level")),
+		validation.Field(&tile.Y, validation.Min(0), validation.Max(maxIndex).Error("y is outside of the zoom level")),
+	)
+}
+
+func (v Validator) ValidateTileAttributes(attributes []string, available []string) error {
+	allowed := make([]interface{}, 0, len(available))
+	for _, name := range available {
+		allowed = append(allowed, name)
+	}
+	return validation.Errors{
+		"attributes": validation.Validate(attributes, validation.Each(validation.In(allowed...).Error("unknown attribute"))),
+	}.Filter()
+}
+
+func (v Validator) ValidateAggregateLayer(req AggregateLayerRequest, config AggregateConfig) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Grid, validation.In(GridHexagon, GridSquare).Error("grid must be one of hex or square")),
+		validation.Field(&req.Format, validation.In(AggregateFormatGeoJSON, AggregateFormatMVT).
+			Error("format must be one of geojson or mvt")),
+		validation.Field(&req.BBox, validation.By(func(value interface{}) error {
+			bbox := value.(Extent)
+			if bbox.MinX >= bbox.MaxX || bbox.MinY >= bbox.MaxY || bbox.MinX < -180 || bbox.MaxX > 180 ||
+				bbox.MinY < -90 || bbox.MaxY > 90 {
+				return errors.New("bbox must be minx,miny,maxx,maxy in WGS 84")
+			}
+			return nil
+		})),
+		validation.Field(&req.Resolution, validation.Min(0), validation.Max(MaxGridResolution).
+			Error(fmt.Sprintf("resolution must be between 0 and %d", MaxGridResolution)),
+			validation.By(func(value interface{}) error {
+				resolution := value.(int)
+				if resolution < 0 || resolution > MaxGridResolution || config.MaxCells <= 0 {
+					return nil
+				}
+				if gridCellCount(req.BBox, resolution) > float64(config.MaxCells) {
+					return fmt.Errorf("resolution splits the bbox into more than %d cells", config.MaxCells)
+				}
+				return nil
+			})),
+	)
+}
+
+// ValidateAggregateAttribute makes sure the aggregated attribute is one of the numeric attributes of the layer
+func (v Validator) ValidateAggregateAttribute(attribute string, numeric []string) error {
+	allowed := make([]interface{}, 0, len(numeric))
+	for _, name := range numeric {
+		allowed = append(allowed, name)
+	}
+	return validation.Errors{
+		"attribute": validation.Validate(attribute, validation.In(allowed...).Error("must be a numeric attribute of the layer")),
+	}.Filter()
+}
+
+func (v Validator) ValidateSaveMapProject(req SaveMapProjectRequest, config MapProjectConfig) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Name, validation.Required.Error("name is required"), validation.Length(1, 255)),
+		validation.Field(&req.Visibility, validation.In(visibilities...).
+			Error("visibility must be one of private, organization or public")),
+		validation.Field(&req.View, validation.By(func(value interface{}) error {
+			view := value.(MapView)
+			return validation.ValidateStruct(&view,
+				validation.Field(&view.Center, validation.By(func(value interface{}) error {
+					center := value.(LookupPoint)
+					return validation.ValidateStruct(&center,
+						validation.Field(&center.Lat, validation.Min(-90.0), validation.Max(90.0)),
+						validation.Field(&center.Lon, validation.Min(-180.0), validation.Max(180.0)),
+					)
+				})),
+				validation.Field(&view.Zoom, validation.Min(0.0), validation.Max(maxMapZoom)),
+			)
+		})),
+		validation.Field(&req.Basemap, validation.By(func(value interface{}) error {
+			basemap := value.(*Basemap)
+			if basemap == nil {
+				return nil
+			}
+			return validation.ValidateStruct(basemap,
+				validation.Field(&basemap.Name, validation.Required),
+				validation.Field(&basemap.URL, validation.Required, validation.By(func(value interface{}) error {
+					template := value.(string)
+					for _, placeholder := range []string{"{z}", "{x}", "{y}"} {
+						if !strings.Contains(template, placeholder) {
+							return errors.New("url must be a tile template with {z}, {x} and {y}")
+						}
+					}
+					return nil
+				})),
+			)
+		})),
+		validation.Field(&req.Layers, validation.Length(0, config.MaxLayers).
+			Error(fmt.Sprintf("a map can have at most %d layers", config.MaxLayers)),
+			validation.Each(validation.By(func(value interface{}) error {
+				layer := value.(MapProjectLayer)
+				return validation.ValidateStruct(&layer,
+					validation.Field(&layer.LayerID, validation.Required.Error("layer id is required")),
+					validation.Field(&layer.Opacity, validation.Min(0.0), validation.Max(1.0)),
+					validation.Field(&layer.MinZoom, validation.Min(0.0), validation.Max(maxMapZoom)),
+					validation.Field(&layer.MaxZoom, validation.Max(maxMapZoom), validation.When(layer.MaxZoom != 0,
+						validation.Min(layer.MinZoom).Error("max zoom must not be less than min zoom"))),
+				)
+			}))),
+	)
+}
+
+func (v Validator) ValidateExportMapProject(req ExportMapProjectRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Format, validation.In(MapExportFormatMapLibre, MapExportFormatQGIS).
+			Error("format must be one of maplibre or qgis")),
+	)
+}
+
+// geometryRule validates a GeoJSON geometry of at most maxVertices positions
+func geometryRule(maxVertices int) validation.Rule {
+	return validation.By(func(value interface{}) error {
+		geometry := value.(json.RawMessage)
+		if len(geometry) == 0 {
+			return errors.New("geometry is required")
+		}
+		count, err := geoJSONVertices(geometry)
+		if err != nil {
+			return err
+		}
+		if maxVertices > 0 && count > maxVertices {
+			return fmt.Errorf("geometry has %d vertices, at most %d are allowed", count, maxVertices)
+		}
+		return nil
+	})
+}
+
+func (v Validator) ValidateTransformGeometry(req TransformGeometryRequest, config GeometryConfig) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Geometry, geometryRule(config.MaxVertices)),
+		validation.Field(&req.From, validation.Min(EPSGCode(1)).Error("from must be an EPSG code")),
+		validation.Field(&req.To, validation.Required.Error("to is required"), validation.Min(EPSGCode(1)).Error("to must be an EPSG code")),
+	)
+}
+
+func (v Validator) ValidateMeasureGeometry(req MeasureGeometryRequest, config GeometryConfig) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Geometry, geometryRule(config.MaxVertices)),
+		validation.Field(&req.CRS, validation.Min(EPSGCode(1)).Error("crs must be an EPSG code")),
+		validation.Field(&req.Method, validation.In(MeasurementGeodesic, MeasurementPlanar).
+			Error("method must be one of geodesic or planar")),
+	)
+}
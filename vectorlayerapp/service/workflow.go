@@ -1,116 +1,507 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gocastsian/roham/types"
 	"github.com/gocastsian/roham/vectorlayerapp/job"
 	"go.temporal.io/sdk/temporal"
+	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.temporal.io/sdk/workflow"
 )
 
+// importRetryPolicy is shared by the temporal activities and the in-process steps so both runners behave the same
+var importRetryPolicy = temporal.RetryPolicy{
+	InitialInterval:    time.Second,
+	BackoffCoefficient: 2.0,
+	MaximumInterval:    time.Minute * 10,
+	MaximumAttempts:    3,
+}
+
 type Workflow struct {
 	service Service
+	logger  *slog.Logger
 }
 
-func New(service Service) Workflow {
-	return Workflow{service: service}
+func New(service Service, logger *slog.Logger) Workflow {
+	return Workflow{service: service, logger: logger}
 }
 
 func (w Workflow) ImportLayerWorkflow(ctx workflow.Context, event job.Event) error {
-	fileKey, ok := event.Args["key"].(string)
-	if !ok {
-		workflow.ExecuteActivity(ctx, w.service.UpdateJob, UpdateJobStatusRequest{
-			WorkflowId: event.WorkflowId,
-			Status:     JobStatusFailed,
-		})
-	}
-
 	ao := workflow.ActivityOptions{
 		StartToCloseTimeout:    time.Hour * 24,
 		HeartbeatTimeout:       time.Minute * 5,
 		ScheduleToCloseTimeout: time.Hour * 24,
-		RetryPolicy: &temporal.RetryPolicy{
-			InitialInterval:    time.Second,
-			BackoffCoefficient: 2.0,
-			MaximumInterval:    time.Minute * 10,
-			MaximumAttempts:    3,
-		},
+		RetryPolicy:            &importRetryPolicy,
 	}
 	ctx = workflow.WithActivityOptions(ctx, ao)
-	logger := workflow.GetLogger(ctx)
 
-	err := workflow.ExecuteActivity(ctx, w.service.UpdateJob, UpdateJobStatusRequest{
-		WorkflowId: event.WorkflowId,
-		Status:     JobStatusProcessing,
-	}).Get(ctx, nil)
-	if err != nil {
-		logger.Error("Failed to update job Status", "Error", err)
+	return w.importLayer(temporalSteps{ctx: ctx}, event)
+}
+
+// ImportLayer runs the same steps as ImportLayerWorkflow inside the current process, it is used by the
+// in-process scheduler when vectorlayerapp runs without a Temporal cluster
+func (w Workflow) ImportLayer(ctx context.Context, event job.Event) error {
+	return w.importLayer(directSteps{ctx: ctx, logger: w.logger.With("workflow_id", event.WorkflowId)}, event)
+}
+
+func (w Workflow) importLayer(steps steps, event job.Event) error {
+	logger := steps.Logger()
+
+	fileKey, ok := event.Args["key"].(string)
+	if !ok {
+		errMsg := "file key is missing from the job arguments"
+		_ = steps.Execute(w.service.UpdateJob, UpdateJobStatusRequest{
+			WorkflowId: event.WorkflowId,
+			Status:     JobStatusFailed,
+			ErrorMsg:   &errMsg,
+		}, nil)
+		return errors.New(errMsg)
+	}
+	geometryMode, _ := event.Args["geometry_mode"].(string)
+	layerName, _ := event.Args["layer_name"].(string)
+	onDuplicate, _ := event.Args["on_duplicate"].(string)
+	visibility, _ := event.Args["visibility"].(string)
+	organization, _ := event.Args["organization"].(string)
+	ownerArg, _ := event.Args["owner_id"].(string)
+	ownerID, _ := strconv.ParseUint(ownerArg, 10, 64)
+	var layerTime *LayerTime
+	if timeStart, _ := event.Args["time_start"].(string); timeStart != "" {
+		timeEnd, _ := event.Args["time_end"].(string)
+		layerTime = &LayerTime{StartAttribute: timeStart, EndAttribute: timeEnd}
+	}
+	var layers []string
+	if selected, _ := event.Args["layers"].(string); selected != "" {
+		layers = strings.Split(selected, ",")
+	}
+	var jalaliDates []string
+	if attributes, _ := event.Args["jalali_dates"].(string); attributes != "" {
+		jalaliDates = strings.Split(attributes, ",")
+	}
+
+	// the job turns processing once the queue admits it, nothing is written before
+	if err := w.waitForSlot(steps, event.WorkflowId); err != nil {
+		errMsg := err.Error()
+		_ = steps.Execute(w.service.UpdateJob, UpdateJobStatusRequest{
+			WorkflowId: event.WorkflowId,
+			Status:     JobStatusFailed,
+			ErrorMsg:   &errMsg,
+		}, nil)
+		logger.Error("Failed to acquire an import slot", "Error", err)
 		return err
 	}
 
 	var importResult ImportLayerResponse
-	err = workflow.ExecuteActivity(ctx, w.service.ImportLayer, ImportLayerRequest{
-		FileKey: fileKey,
-	}).Get(ctx, &importResult)
+	err := steps.Execute(w.service.ImportLayer, ImportLayerRequest{
+		FileKey:     fileKey,
+		LayerName:   layerName,
+		Layers:      layers,
+		OnDuplicate: DuplicateMode(onDuplicate),
+		OwnerID:     types.ID(ownerID),
+	}, &importResult)
 	if err != nil {
 		errMsg := err.Error()
 
-		workflow.ExecuteActivity(ctx, w.service.UpdateJob, UpdateJobStatusRequest{
+		_ = steps.Execute(w.service.UpdateJob, UpdateJobStatusRequest{
 			WorkflowId: event.WorkflowId,
 			Status:     JobStatusFailed,
 			ErrorMsg:   &errMsg,
-		})
+		}, nil)
 
-		workflow.ExecuteActivity(ctx, w.service.SendNotification, SendNotificationRequest{
+		_ = steps.Execute(w.service.SendNotification, SendNotificationRequest{
 			WorkflowId: event.WorkflowId,
 			Status:     "failed",
-		})
+		}, nil)
 		logger.Error("Failed to import layer", "Error", err)
 		return err
 	}
 
-	var createLayer CreateLayerResponse
-	err = workflow.ExecuteActivity(ctx, w.service.CreateLayer, CreateLayerRequest{
-		LayerName:    importResult.LayerName,
-		GeomType:     "MULTIPOLYGON",
-		DefaultStyle: importResult.StyleFileID,
-	}).Get(ctx, &createLayer)
+	options := layerOptions{
+		geometryMode: GeometryMode(geometryMode),
+		contentHash:  importResult.ContentHash,
+		ownerID:      types.ID(ownerID),
+		visibility:   Visibility(visibility),
+		organization: organization,
+		time:         layerTime,
+		jalaliDates:  jalaliDates,
+		multiLayer:   len(importResult.Layers) > 1,
+	}
+	result := &JobResult{Layers: make([]LayerImportResult, 0, len(importResult.Layers))}
+	// created holds the saga of every layer in result this job created, it is nil for failed and linked layers
+	created := make([]*saga, 0, len(importResult.Layers))
+	succeeded := 0
+	for _, layer := range importResult.Layers {
+		if layer.ExistingLayerID != 0 {
+			result.Layers = append(result.Layers, LayerImportResult{
+				Name:      layer.LayerName,
+				LayerID:   layer.ExistingLayerID,
+				GeomType:  layer.GeomType,
+				Status:    JobStatusComplete,
+				Duplicate: true,
+			})
+			created = append(created, nil)
+			succeeded++
+			continue
+		}
+
+		layerResult, undo := w.processImportedLayer(steps, layer, options)
+		if layerResult.Status == JobStatusComplete {
+			succeeded++
+		}
+		result.Layers = append(result.Layers, layerResult)
+		created = append(created, undo)
+	}
+
+	if succeeded == 0 {
+		errMsg := fmt.Sprintf("none of the %d imported layers could be created", len(importResult.Layers))
+
+		_ = steps.Execute(w.service.UpdateJob, UpdateJobStatusRequest{
+			WorkflowId:  event.WorkflowId,
+			Status:      JobStatusFailed,
+			ErrorMsg:    &errMsg,
+			Result:      result,
+			ContentHash: importResult.ContentHash,
+		}, nil)
+		_ = steps.Execute(w.service.SendNotification, SendNotificationRequest{
+			WorkflowId: event.WorkflowId,
+			Status:     "failed",
+		}, nil)
+		logger.Error("Failed to create layers", "Error", errMsg)
+		return errors.New(errMsg)
+	}
+
+	err = steps.Execute(w.service.UpdateJob, UpdateJobStatusRequest{
+		WorkflowId:  event.WorkflowId,
+		Status:      JobStatusComplete,
+		Result:      result,
+		ContentHash: importResult.ContentHash,
+	}, nil)
 	if err != nil {
+		// a job that can't be completed leaves nothing behind, the layers it created are undone too
+		logger.Error("Failed to update job Status", "Error", err)
 		errMsg := err.Error()
+		for i := len(created) - 1; i >= 0; i-- {
+			undo := created[i]
+			if undo == nil {
+				continue
+			}
+			result.Layers[i].Status = JobStatusFailed
+			result.Layers[i].Error = errMsg
+			result.Layers[i].RolledBack = undo.rollback(steps)
+			// a re-imported layer keeps its ID, only a layer the job created is deleted
+			for _, undone := range result.Layers[i].RolledBack {
+				if undone.Step == CompensationDeleteLayer && undone.Error == "" {
+					result.Layers[i].LayerID = 0
+				}
+			}
+		}
+
+		_ = steps.Execute(w.service.UpdateJob, UpdateJobStatusRequest{
+			WorkflowId:  event.WorkflowId,
+			Status:      JobStatusFailed,
+			ErrorMsg:    &errMsg,
+			Result:      result,
+			ContentHash: importResult.ContentHash,
+		}, nil)
+		_ = steps.Execute(w.service.SendNotification, SendNotificationRequest{
+			WorkflowId: event.WorkflowId,
+			Status:     "failed",
+		}, nil)
+		return err
+	}
+
+	err = steps.Execute(w.service.SendNotification, SendNotificationRequest{
+		WorkflowId: event.WorkflowId,
+		Status:     string(JobStatusComplete),
+	}, nil)
+	if err != nil {
+		logger.Error("Failed to send notification", "Error", err)
+	}
+
+	return nil
+}
+
+// waitForSlot returns once the queue admitted the job and moved it to processing, it asks again for as long as
+// the queue tells it to wait
+func (w Workflow) waitForSlot(steps steps, workflowId string) error {
+	for {
+		var slot AcquireImportSlotResponse
+		if err := steps.Execute(w.service.AcquireImportSlot, AcquireImportSlotRequest{WorkflowId: workflowId}, &slot); err != nil {
+			return err
+		}
+		if slot.Granted {
+			return nil
+		}
+		steps.Logger().Info("Waiting for an import slot", "Position", slot.Position, "RetryAfter", slot.RetryAfter)
+		if err := steps.Wait(slot.RetryAfter); err != nil {
+			return err
+		}
+	}
+}
+
+// layerOptions are the settings of an import that apply to every layer it creates
+type layerOptions struct {
+	geometryMode GeometryMode
+	contentHash  string
+	ownerID      types.ID
+	visibility   Visibility
+	organization string
+	time         *LayerTime
+	jalaliDates  []string
+	// multiLayer is set when the archive has several layers, they don't all have every attribute of the options
+	multiLayer bool
+}
+
+// processImportedLayer validates and registers one table written by ImportLayer, a failing layer is rolled
+// back and reported without affecting the other layers of the archive. The saga of a created layer is
+// returned so the job can still undo it when it fails later
+func (w Workflow) processImportedLayer(steps steps, layer ImportedLayer, options layerOptions) (LayerImportResult, *saga) {
+	logger := steps.Logger()
+	result := LayerImportResult{
+		Name:     layer.LayerName,
+		GeomType: layer.GeomType,
+		Status:   JobStatusFailed,
+	}
+
+	// ImportLayer already wrote the style and the table, the layer row is only added once CreateLayer succeeds.
+	// A re-import wrote a staging table, the existing layer keeps its own table until CreateLayer swaps it in
+	table := layer.table()
+	undo := &saga{}
+	if layer.StyleFileID != 0 {
+		undo.add(CompensationDeleteStyle, strconv.FormatUint(uint64(layer.StyleFileID), 10),
+			w.service.DeleteStyle, DeleteStyleRequest{StyleID: layer.StyleFileID})
+	}
+	undo.add(CompensationDropTable, table, w.service.DropLayerTable, DropLayerRequest{TableName: table})
+
+	var validation ValidateGeometriesResponse
+	err := steps.Execute(w.service.ValidateGeometries, ValidateGeometriesRequest{
+		TableName: table,
+		Mode:      options.geometryMode,
+	}, &validation)
+	if err != nil {
+		var appErr *temporal.ApplicationError
+		if errors.As(err, &appErr) && appErr.Type() == InvalidGeometryErrorType {
+			var summary GeometryValidationSummary
+			if appErr.Details(&summary) == nil {
+				result.GeometryValidation = &summary
+			}
+		}
+		result.Error = err.Error()
+		result.RolledBack = undo.rollback(steps)
+		logger.Error("Failed to validate layer geometries", "Layer", layer.LayerName, "Error", err)
+		return result, nil
+	}
+	result.GeometryValidation = &validation.Summary
+
+	// the converted columns have to exist before CreateLayer checks the time attributes, they may be among them
+	if len(options.jalaliDates) > 0 {
+		var conversion ConvertJalaliDatesResponse
+		err = steps.Execute(w.service.ConvertJalaliDates, ConvertJalaliDatesRequest{
+			TableName:   table,
+			Attributes:  options.jalaliDates,
+			SkipMissing: options.multiLayer,
+		}, &conversion)
+		if err != nil {
+			result.Error = err.Error()
+			result.RolledBack = undo.rollback(steps)
+			logger.Error("Failed to convert jalali dates", "Layer", layer.LayerName, "Error", err)
+			return result, nil
+		}
+		result.DateConversions = conversion.Conversions
+	}
+
+	var createLayer CreateLayerResponse
+	err = steps.Execute(w.service.CreateLayer, CreateLayerRequest{
+		LayerName:    layer.LayerName,
+		GeomType:     layer.GeomType,
+		DefaultStyle: layer.StyleFileID,
+		ContentHash:  options.contentHash,
+		OwnerID:      options.ownerID,
+		Visibility:   options.visibility,
+		Organization: options.organization,
+		Time:         options.time,
+		TableName:    table,
+	}, &createLayer)
+	if err != nil {
+		result.Error = err.Error()
+		result.RolledBack = undo.rollback(steps)
+		logger.Error("Failed to create layer", "Layer", layer.LayerName, "Error", err)
+		return result, nil
+	}
+	result.LayerID = createLayer.ID
+	if createLayer.Created {
+		undo.add(CompensationDeleteLayer, strconv.FormatUint(uint64(createLayer.ID), 10),
+			w.service.DeleteLayerRecord, DeleteLayerRecordRequest{LayerID: createLayer.ID})
+	}
+
+	// statistics are a post-processing step, a failure here must not fail the import
+	err = steps.Execute(w.service.ComputeLayerStatistics, ComputeLayerStatisticsRequest{
+		LayerID:   createLayer.ID,
+		TableName: layer.LayerName,
+	}, nil)
+	if err != nil {
+		logger.Error("Failed to compute layer statistics", "Layer", layer.LayerName, "Error", err)
+	}
+
+	// without generalized geometries the layer is served from its full geometries, only slower at low zooms
+	err = steps.Execute(w.service.GeneralizeLayer, GeneralizeLayerRequest{
+		LayerID:   createLayer.ID,
+		TableName: layer.LayerName,
+		GeomType:  layer.GeomType,
+	}, nil)
+	if err != nil {
+		logger.Error("Failed to generalize layer", "Layer", layer.LayerName, "Error", err)
+	}
+
+	result.Status = JobStatusComplete
+	return result, undo
+}
+
+func (w Workflow) ReprojectLayerWorkflow(ctx workflow.Context, event job.Event) error {
+	ao := workflow.ActivityOptions{
+		StartToCloseTimeout:    time.Hour * 24,
+		HeartbeatTimeout:       time.Minute * 5,
+		ScheduleToCloseTimeout: time.Hour * 24,
+		RetryPolicy:            &importRetryPolicy,
+	}
+	ctx = workflow.WithActivityOptions(ctx, ao)
+
+	return w.reprojectLayer(temporalSteps{ctx: ctx}, event)
+}
+
+// ReprojectLayer runs the steps of ReprojectLayerWorkflow inside the current process for the in-process scheduler
+func (w Workflow) ReprojectLayer(ctx context.Context, event job.Event) error {
+	return w.reprojectLayer(directSteps{ctx: ctx, logger: w.logger.With("workflow_id", event.WorkflowId)}, event)
+}
 
-		var dropTable DropLayerResponse
-		workflow.ExecuteActivity(ctx, w.service.DropLayerTable, DropLayerRequest{TableName: importResult.LayerName}).Get(
-			ctx, &dropTable)
+func (w Workflow) reprojectLayer(steps steps, event job.Event) error {
+	logger := steps.Logger()
 
-		workflow.ExecuteActivity(ctx, w.service.UpdateJob, UpdateJobStatusRequest{
+	fail := func(errMsg string, result *JobResult) error {
+		_ = steps.Execute(w.service.UpdateJob, UpdateJobStatusRequest{
 			WorkflowId: event.WorkflowId,
 			Status:     JobStatusFailed,
 			ErrorMsg:   &errMsg,
-		})
-		workflow.ExecuteActivity(ctx, w.service.SendNotification, SendNotificationRequest{
+			Result:     result,
+		}, nil)
+		_ = steps.Execute(w.service.SendNotification, SendNotificationRequest{
 			WorkflowId: event.WorkflowId,
 			Status:     "failed",
-		})
-		logger.Error("Failed to create layer", "Error", err)
-		return err
+		}, nil)
+		return errors.New(errMsg)
+	}
+
+	layerArg, _ := event.Args["layer_id"].(string)
+	layerID, _ := strconv.ParseUint(layerArg, 10, 64)
+	sridArg, _ := event.Args["target_srid"].(string)
+	srid, _ := strconv.Atoi(sridArg)
+	if layerID == 0 || srid == 0 {
+		return fail("layer id or target srid is missing from the job arguments", nil)
+	}
+	mode, _ := event.Args["mode"].(string)
+	layerName, _ := event.Args["layer_name"].(string)
+	organization, _ := event.Args["organization"].(string)
+	ownerArg, _ := event.Args["owner_id"].(string)
+	ownerID, _ := strconv.ParseUint(ownerArg, 10, 64)
+
+	// reprojections count against the limits of the import queue like imports do
+	err := w.waitForSlot(steps, event.WorkflowId)
+	if err != nil {
+		logger.Error("Failed to acquire an import slot", "Error", err)
+		return fail(err.Error(), nil)
 	}
 
-	err = workflow.ExecuteActivity(ctx, w.service.UpdateJob, UpdateJobStatusRequest{
+	req := ReprojectLayerRequest{LayerID: types.ID(layerID), SRID: EPSGCode(srid), WorkflowId: event.WorkflowId}
+	// a new layer is undone by dropping its table, a failing copy may already have written part of it. Only a
+	// table this job created is dropped, the name may have been taken since the job was scheduled
+	undo := &saga{}
+	if ReprojectMode(mode) == ReprojectModeNewLayer {
+		req.TargetTable = layerName
+		undo.add(CompensationDropTable, layerName, w.service.DropLayerTable,
+			DropLayerRequest{TableName: layerName, CreatedBy: event.WorkflowId})
+	}
+	var reprojected ReprojectLayerResponse
+	if err := steps.Execute(w.service.ReprojectLayer, req, &reprojected); err != nil {
+		logger.Error("Failed to reproject layer", "Layer", layerID, "Error", err)
+		if req.TargetTable == "" {
+			return fail(err.Error(), nil)
+		}
+		return fail(err.Error(), &JobResult{Layers: []LayerImportResult{{
+			Name:       req.TargetTable,
+			Status:     JobStatusFailed,
+			Error:      err.Error(),
+			RolledBack: undo.rollback(steps),
+		}}})
+	}
+
+	result := LayerImportResult{
+		Name:     reprojected.TableName,
+		LayerID:  types.ID(layerID),
+		GeomType: reprojected.GeomType,
+		Status:   JobStatusComplete,
+	}
+	if req.TargetTable != "" {
+		result.Name = req.TargetTable
+		var createLayer CreateLayerResponse
+		err = steps.Execute(w.service.CreateLayer, CreateLayerRequest{
+			LayerName:    req.TargetTable,
+			GeomType:     reprojected.GeomType,
+			DefaultStyle: reprojected.DefaultStyle,
+			OwnerID:      types.ID(ownerID),
+			Visibility:   VisibilityPrivate,
+			Organization: organization,
+			Time:         reprojected.Time,
+			SRID:         req.SRID,
+		}, &createLayer)
+		if err != nil {
+			logger.Error("Failed to create layer", "Layer", req.TargetTable, "Error", err)
+			result.LayerID = 0
+			result.Status = JobStatusFailed
+			result.Error = err.Error()
+			result.RolledBack = undo.rollback(steps)
+			return fail(err.Error(), &JobResult{Layers: []LayerImportResult{result}})
+		}
+		result.LayerID = createLayer.ID
+	}
+
+	// the extent and the generalized geometries follow the transformed table, both are optional like on import
+	err = steps.Execute(w.service.ComputeLayerStatistics, ComputeLayerStatisticsRequest{
+		LayerID:   result.LayerID,
+		TableName: result.Name,
+	}, nil)
+	if err != nil {
+		logger.Error("Failed to compute layer statistics", "Layer", result.Name, "Error", err)
+	}
+	err = steps.Execute(w.service.GeneralizeLayer, GeneralizeLayerRequest{
+		LayerID:   result.LayerID,
+		TableName: result.Name,
+		GeomType:  result.GeomType,
+	}, nil)
+	if err != nil {
+		logger.Error("Failed to generalize layer", "Layer", result.Name, "Error", err)
+	}
+
+	err = steps.Execute(w.service.UpdateJob, UpdateJobStatusRequest{
 		WorkflowId: event.WorkflowId,
 		Status:     JobStatusComplete,
-	}).Get(ctx, nil)
+		Result:     &JobResult{Layers: []LayerImportResult{result}},
+	}, nil)
 	if err != nil {
 		logger.Error("Failed to update job Status", "Error", err)
 		return err
 	}
 
-	err = workflow.ExecuteActivity(ctx, w.service.SendNotification, UpdateJobStatusRequest{
+	err = steps.Execute(w.service.SendNotification, SendNotificationRequest{
 		WorkflowId: event.WorkflowId,
-		Status:     JobStatusComplete,
-	}).Get(ctx, nil)
+		Status:     string(JobStatusComplete),
+	}, nil)
 	if err != nil {
 		logger.Error("Failed to send notification", "Error", err)
 	}
-
 	return nil
 }
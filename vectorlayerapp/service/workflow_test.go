@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/gocastsian/roham/vectorlayerapp/job"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+)
+
+// importWorkflowEnv mocks every activity of ImportLayerWorkflow for a single imported layer with a style. The
+// errors make the matching activity fail, the compensations that ran are appended to undone and the last job
+// update is kept in job
+type importWorkflowEnv struct {
+	*testsuite.TestWorkflowEnvironment
+	validateErr error
+	createErr   error
+	completeErr error
+	dropErr     error
+	// busySlots is how many times the queue turns the job away before admitting it
+	busySlots int
+	// reimport makes the archive replace the table of the existing layer 12 instead of creating a layer
+	reimport bool
+
+	undone  []string
+	job     UpdateJobStatusRequest
+	created CreateLayerRequest
+}
+
+func newImportWorkflowEnv() *importWorkflowEnv {
+	var suite testsuite.WorkflowTestSuite
+	env := &importWorkflowEnv{TestWorkflowEnvironment: suite.NewTestWorkflowEnvironment()}
+	s := Service{}
+
+	env.OnActivity(s.UpdateJob, mock.Anything, mock.Anything).Return(func(ctx context.Context, req UpdateJobStatusRequest) error {
+		env.job = req
+		if req.Status == JobStatusComplete {
+			return env.completeErr
+		}
+		return nil
+	})
+	env.OnActivity(s.SendNotification, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(s.AcquireImportSlot, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, req AcquireImportSlotRequest) (AcquireImportSlotResponse, error) {
+			if env.busySlots > 0 {
+				env.busySlots--
+				return AcquireImportSlotResponse{Position: 3, RetryAfter: time.Minute}, nil
+			}
+			return AcquireImportSlotResponse{Granted: true}, nil
+		})
+	env.OnActivity(s.ImportLayer, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, req ImportLayerRequest) (ImportLayerResponse, error) {
+			layer := ImportedLayer{LayerName: "roads", GeomType: "MULTILINESTRING", StyleFileID: 7}
+			if env.reimport {
+				layer.TableName = "roads" + StagingTableSuffix
+				layer.ReplacedLayerID = 12
+			}
+			return ImportLayerResponse{Status: true, Layers: []ImportedLayer{layer}}, nil
+		})
+	env.OnActivity(s.ValidateGeometries, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, req ValidateGeometriesRequest) (ValidateGeometriesResponse, error) {
+			return ValidateGeometriesResponse{}, env.validateErr
+		})
+	env.OnActivity(s.CreateLayer, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, req CreateLayerRequest) (CreateLayerResponse, error) {
+			env.created = req
+			if env.createErr != nil {
+				return CreateLayerResponse{}, env.createErr
+			}
+			return CreateLayerResponse{ID: 12, Created: !env.reimport}, nil
+		})
+	env.OnActivity(s.ComputeLayerStatistics, mock.Anything, mock.Anything).Return(ComputeLayerStatisticsResponse{}, nil)
+	env.OnActivity(s.GeneralizeLayer, mock.Anything, mock.Anything).Return(GeneralizeLayerResponse{}, nil)
+
+	env.OnActivity(s.DeleteLayerRecord, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, req DeleteLayerRecordRequest) error {
+			env.undone = append(env.undone, "layer")
+			return nil
+		})
+	env.OnActivity(s.DropLayerTable, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, req DropLayerRequest) (DropLayerResponse, error) {
+			if env.dropErr != nil {
+				return DropLayerResponse{}, env.dropErr
+			}
+			env.undone = append(env.undone, "table "+req.TableName)
+			return DropLayerResponse{Success: true}, nil
+		})
+	env.OnActivity(s.DeleteStyle, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, req DeleteStyleRequest) (DeleteStyleResponse, error) {
+			env.undone = append(env.undone, "style")
+			return DeleteStyleResponse{}, nil
+		})
+	return env
+}
+
+func (env *importWorkflowEnv) run(t *testing.T) error {
+	env.ExecuteWorkflow(New(Service{}, slog.Default()).ImportLayerWorkflow, job.Event{
+		WorkflowId: "import_1",
+		Args:       map[string]any{"key": "archive.zip"},
+	})
+	require.True(t, env.IsWorkflowCompleted())
+	return env.GetWorkflowError()
+}
+
+func TestImportLayerWorkflowWaitsForSlot(t *testing.T) {
+	env := newImportWorkflowEnv()
+	env.busySlots = 2
+	started := env.Now()
+
+	require.NoError(t, env.run(t))
+	assert.Zero(t, env.busySlots)
+	assert.GreaterOrEqual(t, env.Now().Sub(started), 2*time.Minute)
+	assert.Equal(t, JobStatusComplete, env.job.Status)
+}
+
+func TestImportLayerWorkflowCompensation(t *testing.T) {
+	t.Run("completes without rolling back", func(t *testing.T) {
+		env := newImportWorkflowEnv()
+
+		require.NoError(t, env.run(t))
+		assert.Empty(t, env.undone)
+		assert.Equal(t, JobStatusComplete, env.job.Status)
+	})
+
+	t.Run("undoes the table and style of a layer that can't be created", func(t *testing.T) {
+		env := newImportWorkflowEnv()
+		env.createErr = temporal.NewNonRetryableApplicationError("layer exists", "LayerExists", nil)
+
+		require.Error(t, env.run(t))
+		assert.Equal(t, []string{"table roads", "style"}, env.undone)
+		require.Equal(t, JobStatusFailed, env.job.Status)
+		require.Len(t, env.job.Result.Layers, 1)
+		assert.Equal(t, []CompensationResult{
+			{Step: CompensationDropTable, Target: "roads"},
+			{Step: CompensationDeleteStyle, Target: "7"},
+		}, env.job.Result.Layers[0].RolledBack)
+	})
+
+	t.Run("undoes created layers when the job can't be completed", func(t *testing.T) {
+		env := newImportWorkflowEnv()
+		env.completeErr = temporal.NewNonRetryableApplicationError("database is gone", "Unavailable", nil)
+
+		require.Error(t, env.run(t))
+		assert.Equal(t, []string{"layer", "table roads", "style"}, env.undone)
+		require.Equal(t, JobStatusFailed, env.job.Status)
+		layer := env.job.Result.Layers[0]
+		assert.Equal(t, JobStatusFailed, layer.Status)
+		assert.Zero(t, layer.LayerID)
+		assert.Equal(t, CompensationDeleteLayer, layer.RolledBack[0].Step)
+		assert.Len(t, layer.RolledBack, 3)
+	})
+
+	t.Run("keeps undoing when a compensation fails", func(t *testing.T) {
+		env := newImportWorkflowEnv()
+		env.validateErr = temporal.NewNonRetryableApplicationError("invalid", InvalidGeometryErrorType, nil)
+		env.dropErr = temporal.NewNonRetryableApplicationError("table is locked", "Locked", nil)
+
+		require.Error(t, env.run(t))
+		assert.Equal(t, []string{"style"}, env.undone)
+		rolledBack := env.job.Result.Layers[0].RolledBack
+		require.Len(t, rolledBack, 2)
+		assert.Contains(t, rolledBack[0].Error, "table is locked")
+		assert.Empty(t, rolledBack[1].Error)
+	})
+	t.Run("swaps a re-import in through its staging table", func(t *testing.T) {
+		env := newImportWorkflowEnv()
+		env.reimport = true
+
+		require.NoError(t, env.run(t))
+		assert.Equal(t, "roads", env.created.LayerName)
+		assert.Equal(t, "roads_staging", env.created.TableName)
+	})
+
+	t.Run("keeps a re-imported layer when the job can't be completed", func(t *testing.T) {
+		env := newImportWorkflowEnv()
+		env.reimport = true
+		env.completeErr = temporal.NewNonRetryableApplicationError("database is gone", "Unavailable", nil)
+
+		require.Error(t, env.run(t))
+		assert.Equal(t, []string{"table roads_staging", "style"}, env.undone)
+		require.Equal(t, JobStatusFailed, env.job.Status)
+		layer := env.job.Result.Layers[0]
+		assert.Equal(t, JobStatusFailed, layer.Status)
+		assert.EqualValues(t, 12, layer.LayerID)
+		assert.Equal(t, []CompensationResult{
+			{Step: CompensationDropTable, Target: "roads_staging"},
+			{Step: CompensationDeleteStyle, Target: "7"},
+		}, layer.RolledBack)
+	})
+
+	t.Run("drops only the staging table of a re-imported layer that fails validation", func(t *testing.T) {
+		env := newImportWorkflowEnv()
+		env.reimport = true
+		env.validateErr = temporal.NewNonRetryableApplicationError("invalid", InvalidGeometryErrorType, nil)
+
+		require.Error(t, env.run(t))
+		assert.Equal(t, []string{"table roads_staging", "style"}, env.undone)
+	})
+}